@@ -0,0 +1,78 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// ipAllowlist holds the client networks allowed to call the administrative paths.
+type ipAllowlist struct {
+	networks []*net.IPNet
+}
+
+// newIPAllowlist parses cidrs, defaulting to the loopback networks when empty.
+func newIPAllowlist(cidrs []string) (*ipAllowlist, error) {
+	if len(cidrs) == 0 {
+		cidrs = []string{"127.0.0.0/8", "::1/128"}
+	}
+
+	allowlist := &ipAllowlist{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid adminAllowedCIDRs entry %q: %w", cidr, err)
+		}
+		allowlist.networks = append(allowlist.networks, network)
+	}
+	return allowlist, nil
+}
+
+// allows reports whether the direct client of req is in one of the networks. A nil
+// allowlist allows nobody.
+func (a *ipAllowlist) allows(req *http.Request) bool {
+	if a == nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveInvalidate expires every cached secret, and forgets the secrets found missing, on a
+// POST from an allowed client, so the next request reads the rotated value instead of
+// waiting out the TTL.
+func (s *SecretHeader) serveInvalidate(rw http.ResponseWriter, req *http.Request) {
+	if !s.admins.allows(req) {
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	entries := s.cache.len()
+	s.cache.invalidate()
+	s.misses.reset()
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Cache of middleware %s invalidated by %s, %d entries expired\n",
+		s.name, req.RemoteAddr, entries)
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(map[string]int{"invalidated": entries})
+}
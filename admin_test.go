@@ -0,0 +1,115 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPInvalidatePath tests flushing the cache on demand from an allowed client.
+func TestServeHTTPInvalidatePath(t *testing.T) {
+	secretData := map[string]string{"token": "old-token"}
+	mockServer := mockK8sServer(t, secretData, true)
+	defer mockServer.Close()
+
+	admins, err := newIPAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-Auth-Token")
+		}),
+		name: "test-middleware",
+		config: &Config{
+			SecretName:     "my-secret",
+			SecretKey:      "token",
+			HeaderName:     "X-Auth-Token",
+			Namespace:      "default",
+			CacheTTL:       300,
+			InvalidatePath: "/admin/invalidate",
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:  &secretCache{ttl: 300 * time.Second},
+		admins: admins,
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	secretData["token"] = "new-token"
+
+	tests := []struct {
+		name           string
+		method         string
+		remoteAddr     string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{name: "client outside the allowlist", method: http.MethodPost, remoteAddr: "192.0.2.1:4711", expectedStatus: http.StatusForbidden, expectedHeader: "old-token"},
+		{name: "wrong method", method: http.MethodGet, remoteAddr: "10.1.2.3:4711", expectedStatus: http.StatusMethodNotAllowed, expectedHeader: "old-token"},
+		{name: "allowed client", method: http.MethodPost, remoteAddr: "10.1.2.3:4711", expectedStatus: http.StatusOK, expectedHeader: "new-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com/admin/invalidate", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if captured != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, captured)
+			}
+		})
+	}
+}
+
+// TestIPAllowlist tests client network matching.
+func TestIPAllowlist(t *testing.T) {
+	tests := []struct {
+		name        string
+		cidrs       []string
+		allowed     []string
+		denied      []string
+		expectError bool
+	}{
+		{name: "loopback default", allowed: []string{"127.0.0.1:1234", "[::1]:1234"}, denied: []string{"10.0.0.1:1234"}},
+		{name: "networks", cidrs: []string{"10.0.0.0/8", "fd00::/8"}, allowed: []string{"10.2.3.4:1", "[fd00::1]:1"}, denied: []string{"127.0.0.1:1", "invalid"}},
+		{name: "invalid cidr", cidrs: []string{"10.0.0.0"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowlist, err := newIPAllowlist(tt.cidrs)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, addr := range tt.allowed {
+				if !allowlist.allows(&http.Request{RemoteAddr: addr}) {
+					t.Errorf("Expected %s to be allowed", addr)
+				}
+			}
+			for _, addr := range tt.denied {
+				if allowlist.allows(&http.Request{RemoteAddr: addr}) {
+					t.Errorf("Expected %s to be denied", addr)
+				}
+			}
+		})
+	}
+}
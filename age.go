@@ -0,0 +1,52 @@
+package traefik_k8s_secret_header
+
+import (
+	"time"
+)
+
+// perRequestSelection reports whether the secret is selected per request, in which case
+// per-secret metrics are not recorded, as every tenant would add a series.
+func (s *SecretHeader) perRequestSelection() bool {
+	return s.config.JWTClaim != "" || s.nameGuard != nil || s.perHost
+}
+
+// observeSecretData updates the age and rotation metrics of the secret cached under cacheKey
+// after a read. previous is the data cached before, nil when there was none. modified is when
+// the source last wrote the secret, if known; otherwise the age counts from the first read or
+// the last change seen.
+func (s *SecretHeader) observeSecretData(cacheKey string, previous, data map[string]string, modified time.Time) {
+	if s.perRequestSelection() {
+		return
+	}
+
+	labels := []string{"middleware", s.name, "secret", cacheKey}
+	changed := previous != nil && !equalData(previous, data)
+	if changed {
+		metrics.inc(metricSecretRotations, labels...)
+		s.notifyRotation(cacheKey, previous, data)
+	} else {
+		metrics.add(metricSecretRotations, 0, labels...)
+	}
+
+	switch {
+	case !modified.IsZero():
+	case changed || metrics.value(metricSecretAge, labels...) == 0:
+		modified = time.Now()
+	default:
+		return
+	}
+	metrics.set(metricSecretAge, float64(modified.UnixNano())/1e9, labels...)
+}
+
+// equalData reports whether two decoded secrets hold the same keys and values.
+func equalData(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
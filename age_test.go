@@ -0,0 +1,76 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestObserveSecretData tests the secret age and rotation metrics across refreshes.
+func TestObserveSecretData(t *testing.T) {
+	handler := &SecretHeader{name: "age-test", config: &Config{}}
+	labels := []string{"middleware", "age-test", "secret", "default/api-token"}
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	steps := []struct {
+		name              string
+		previous          map[string]string
+		data              map[string]string
+		modified          time.Time
+		expectedRotations float64
+		expectedSince     time.Time // zero: about now
+	}{
+		{name: "first read", data: map[string]string{"token": "a"}, modified: modified, expectedSince: modified},
+		{name: "unchanged", previous: map[string]string{"token": "a"}, data: map[string]string{"token": "a"}, expectedSince: modified},
+		{name: "rotated", previous: map[string]string{"token": "a"}, data: map[string]string{"token": "b"}, expectedRotations: 1},
+		{name: "key added", previous: map[string]string{"token": "b"}, data: map[string]string{"token": "b", "next": "c"}, modified: modified.Add(time.Hour), expectedRotations: 2, expectedSince: modified.Add(time.Hour)},
+	}
+
+	for _, step := range steps {
+		handler.observeSecretData("default/api-token", step.previous, step.data, step.modified)
+
+		if got := metrics.value(metricSecretRotations, labels...); got != step.expectedRotations {
+			t.Errorf("%s: expected %v rotations, got %v", step.name, step.expectedRotations, got)
+		}
+		since := time.Unix(0, int64(metrics.value(metricSecretAge, labels...)*1e9))
+		if step.expectedSince.IsZero() {
+			if time.Since(since) > time.Minute {
+				t.Errorf("%s: expected the age to restart now, got %v", step.name, since)
+			}
+		} else if d := since.Sub(step.expectedSince); d < -time.Millisecond || d > time.Millisecond {
+			t.Errorf("%s: expected the age to count from %v, got %v", step.name, step.expectedSince, since)
+		}
+	}
+}
+
+// TestWritePrometheusSince tests that timestamp gauges are exposed as seconds elapsed.
+func TestWritePrometheusSince(t *testing.T) {
+	registry := newMetricsRegistry()
+	registry.set(metricSecretAge, float64(time.Now().Add(-time.Hour).Unix()), "middleware", "a")
+
+	var out bytes.Buffer
+	if err := registry.writePrometheus(&out); err != nil {
+		t.Fatal(err)
+	}
+	line := out.String()[strings.LastIndex(strings.TrimSpace(out.String()), "\n")+1:]
+	age, err := strconv.ParseFloat(strings.Fields(line)[1], 64)
+	if err != nil || age < 3599 || age > 3700 {
+		t.Errorf("Expected an age of about 3600 seconds, got %q", line)
+	}
+}
+
+// TestObjectMetaLastModified tests the last write time read from secret metadata.
+func TestObjectMetaLastModified(t *testing.T) {
+	meta := k8sObjectMeta{
+		CreationTimestamp: "2026-01-01T00:00:00Z",
+		ManagedFields:     []k8sManagedField{{Time: "2026-03-01T00:00:00Z"}, {Time: "2026-02-01T00:00:00Z"}, {Time: "invalid"}},
+	}
+	if got := meta.lastModified(); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the newest managedFields time, got %v", got)
+	}
+	if got := (k8sObjectMeta{}).lastModified(); !got.IsZero() {
+		t.Errorf("Expected a zero time without metadata, got %v", got)
+	}
+}
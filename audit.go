@@ -0,0 +1,134 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// validateAuditLog checks the auditLog destination.
+func validateAuditLog(config *Config) error {
+	switch config.AuditLog {
+	case "", "stdout", "stderr":
+		return nil
+	}
+	if !filepath.IsAbs(config.AuditLog) {
+		return fmt.Errorf("auditLog must be stdout, stderr or an absolute file path, got %q", config.AuditLog)
+	}
+	return nil
+}
+
+// auditEntry is one line of the audit log. It describes a secret read and never contains
+// secret values.
+type auditEntry struct {
+	Time            string  `json:"time"`
+	Middleware      string  `json:"middleware"`
+	Source          string  `json:"source"`
+	Secret          string  `json:"secret"`
+	ResourceVersion string  `json:"resourceVersion,omitempty"`
+	Outcome         string  `json:"outcome"`
+	LatencyMs       float64 `json:"latencyMs"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// auditLog writes audit entries as JSON lines to one destination.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// write appends entry to the log. A failed write is reported on stderr and otherwise
+// ignored, so auditing never fails a request.
+func (l *auditLog) write(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.w.Write(line); err != nil {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Failed to write audit log: %v\n", err)
+	}
+}
+
+// auditLogRegistry holds the audit logs of the process, so instances logging to the same
+// file share one handle and their lines are never interleaved.
+type auditLogRegistry struct {
+	mu   sync.Mutex
+	logs map[string]*auditLog // by destination
+}
+
+// auditLogs is the process-wide registry; files stay open across configuration reloads.
+var auditLogs = &auditLogRegistry{logs: make(map[string]*auditLog)}
+
+// get returns the audit log writing to destination, opening it on first use.
+func (r *auditLogRegistry) get(destination string) (*auditLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if log, ok := r.logs[destination]; ok {
+		return log, nil
+	}
+	var w io.Writer
+	switch destination {
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		file, err := os.OpenFile(destination, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("auditLog: %w", err)
+		}
+		w = file
+	}
+	log := &auditLog{w: w}
+	r.logs[destination] = log
+	return log, nil
+}
+
+// auditFetch records a read of the secret cached under cacheKey, started at start, in the
+// audit log when one is configured. version is the resourceVersion read, if known.
+func (s *SecretHeader) auditFetch(cacheKey, version string, start time.Time, err error) {
+	if s.audit == nil {
+		return
+	}
+	source := s.config.Source
+	if source == "" {
+		source = sourceKubernetes
+	}
+	entry := auditEntry{
+		Time:            start.UTC().Format(time.RFC3339Nano),
+		Middleware:      s.name,
+		Source:          source,
+		Secret:          cacheKey,
+		ResourceVersion: version,
+		Outcome:         auditOutcome(err),
+		LatencyMs:       float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	s.audit.write(entry)
+}
+
+// auditOutcome classifies the result of a secret read for the audit log.
+func auditOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case hasStatus(err, http.StatusNotFound):
+		return "notFound"
+	case hasStatus(err, http.StatusForbidden):
+		return "forbidden"
+	default:
+		return "error"
+	}
+}
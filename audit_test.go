@@ -0,0 +1,122 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPAuditLog tests that each secret read, and only reads, is audited without values.
+func TestServeHTTPAuditLog(t *testing.T) {
+	exists := true
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !exists {
+			http.Error(w, `{"kind":"Status","reason":"NotFound"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{
+			Metadata: k8sObjectMeta{ResourceVersion: "42"},
+			Data:     map[string]string{"token": base64.StdEncoding.EncodeToString([]byte("my-secret-token"))},
+		})
+	}))
+	defer mockServer.Close()
+
+	var out bytes.Buffer
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+		name: "audit-test",
+		config: &Config{
+			SecretName: "my-secret",
+			SecretKey:  "token",
+			HeaderName: "X-Auth-Token",
+			Namespace:  "default",
+			CacheTTL:   300,
+			AuditLog:   "stdout",
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+		audit: &auditLog{w: &out},
+	}
+
+	// The second request is served from the cache
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	exists = false
+	handler.cache.expire("default/my-secret", 0)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if strings.Contains(out.String(), "my-secret-token") {
+		t.Fatalf("Expected no secret value in the audit log, got %s", out.String())
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audited reads, got %d: %s", len(lines), out.String())
+	}
+	expected := []auditEntry{
+		{Middleware: "audit-test", Source: "kubernetes", Secret: "default/my-secret", ResourceVersion: "42", Outcome: "success"},
+		{Middleware: "audit-test", Source: "kubernetes", Secret: "default/my-secret", Outcome: "notFound"},
+	}
+	for i, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, entry.Time); err != nil {
+			t.Errorf("Expected an RFC 3339 time, got %q", entry.Time)
+		}
+		if entry.LatencyMs < 0 || (entry.Outcome == "success") != (entry.Error == "") {
+			t.Errorf("Unexpected latency or error in %s", line)
+		}
+		entry.Time, entry.LatencyMs, entry.Error = "", 0, ""
+		if entry != expected[i] {
+			t.Errorf("Line %d: expected %+v, got %+v", i, expected[i], entry)
+		}
+	}
+}
+
+// TestAuditLogRegistry tests that instances logging to one file share its handle.
+func TestAuditLogRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	first, err := auditLogs.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := auditLogs.get(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("Expected the same audit log for one file")
+	}
+	defer first.w.(*os.File).Close()
+
+	first.write(auditEntry{Middleware: "a", Outcome: "success"})
+	second.write(auditEntry{Middleware: "b", Outcome: "error"})
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(content), "\n"); got != 2 {
+		t.Errorf("Expected 2 lines, got %q", content)
+	}
+
+	if _, err := auditLogs.get(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Error("Expected an error for a file that cannot be created")
+	}
+	if err := validateAuditLog(&Config{AuditLog: "audit.log"}); err == nil {
+		t.Error("Expected an error for a relative path")
+	}
+}
@@ -0,0 +1,247 @@
+package traefik_k8s_secret_header
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// authFailureRefreshInterval is the minimum age of a cached secret for an upstream 401 or 403
+// to read it again, so an upstream rejecting every request cannot turn each one into an API
+// read.
+const authFailureRefreshInterval = 10 * time.Second
+
+// authFailureHeldBytes bounds the body of a 401 or 403 response held back while the secret is
+// read again; a larger response is sent to the client as is, without retry.
+const authFailureHeldBytes = 64 << 10
+
+// validateRefreshOnAuthFailure checks the refreshOnAuthFailure settings.
+func validateRefreshOnAuthFailure(config *Config) error {
+	if !config.RefreshOnAuthFailure {
+		return nil
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("refreshOnAuthFailure is only supported in mode %q", modeInject)
+	}
+	if config.SecretKeyPattern != "" || usesBasicAuthSecret(config) {
+		return fmt.Errorf("refreshOnAuthFailure needs a single secretKey")
+	}
+	return nil
+}
+
+// serveRefreshingOnAuthFailure forwards a request carrying value in HeaderName. When the
+// upstream answers 401 or 403, the secret is read again and, if its value changed, the
+// request is sent once more with the new value instead of returning the failure, so a
+// rotation is picked up at the first rejection rather than after the cache TTL. Request
+// bodies up to RetryMaxBodyBytes are buffered in memory to be sent again; requests with a
+// larger body are forwarded once.
+func (s *SecretHeader) serveRefreshingOnAuthFailure(rw http.ResponseWriter, req *http.Request, secretName, secretKey, value string) {
+	body, replayable, err := bufferRetryBody(req, s.config.RetryMaxBodyBytes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] %v\n", err)
+		http.Error(rw, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if !replayable {
+		s.next.ServeHTTP(rw, req)
+		return
+	}
+
+	recorder := newAuthFailureRecorder(rw)
+	s.next.ServeHTTP(recorder, req)
+	if !recorder.held {
+		return
+	}
+
+	refreshed, err := s.refreshValue(req, secretName, secretKey)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Refresh after upstream status %d failed: %v\n", recorder.status, err)
+		metrics.inc(metricAuthFailureRefreshes, "middleware", s.name, "result", "failed")
+		recorder.release()
+	case refreshed == value:
+		metrics.inc(metricAuthFailureRefreshes, "middleware", s.name, "result", "unchanged")
+		recorder.release()
+	default:
+		s.debugf("Retrying request rejected with status %d with the refreshed secret %s", recorder.status, secretName)
+		metrics.inc(metricAuthFailureRefreshes, "middleware", s.name, "result", "retried")
+		s.replaceInjectedHeader(req, value, refreshed)
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		s.next.ServeHTTP(rw, req)
+	}
+}
+
+// bufferRetryBody reads the request body into memory so the request can be sent twice, and
+// reports whether it can. A body larger than limit is left to stream to the upstream once:
+// what was read is put back in front of the rest.
+func bufferRetryBody(req *http.Request, limit int64) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	if limit <= 0 || req.ContentLength > limit {
+		return nil, false, nil
+	}
+
+	original := req.Body
+	body, err := io.ReadAll(io.LimitReader(original, limit+1))
+	if err != nil {
+		original.Close()
+		return nil, false, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), original), Closer: original}
+		return nil, false, nil
+	}
+
+	original.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, true, nil
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// refreshValue expires the cached secret unless it was read within
+// authFailureRefreshInterval, and returns the value to inject read through the cache.
+func (s *SecretHeader) refreshValue(req *http.Request, secretName, secretKey string) (string, error) {
+	s.cache.expire(s.secretCacheKey(secretName), authFailureRefreshInterval)
+
+	value, err := s.getValue(req.Context(), secretName, secretKey)
+	if err == nil {
+		value, err = s.headerValue(value)
+	}
+	if err == nil {
+		value, err = s.checkValue(value, secretName, secretKey)
+	}
+	if err == nil {
+		value, err = s.compressValue(req, value)
+	}
+	return value, err
+}
+
+// replaceInjectedHeader replaces the injected value of HeaderName, keeping the client values
+// kept alongside it with appendHeader.
+func (s *SecretHeader) replaceInjectedHeader(req *http.Request, previous, value string) {
+	if !s.config.AppendHeader {
+		s.injectHeader(req, value)
+		return
+	}
+	values := req.Header.Values(s.config.HeaderName)
+	kept := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != s.config.ValuePrefix+previous {
+			kept = append(kept, v)
+		}
+	}
+	req.Header[http.CanonicalHeaderKey(s.config.HeaderName)] = kept
+	s.injectHeader(req, value)
+}
+
+// authFailureRecorder forwards the upstream response, except a 401 or 403 response, which is
+// held back until release so the request can be retried instead.
+type authFailureRecorder struct {
+	rw     http.ResponseWriter
+	header http.Header
+	status int
+	held   bool
+	body   bytes.Buffer
+}
+
+func newAuthFailureRecorder(rw http.ResponseWriter) *authFailureRecorder {
+	return &authFailureRecorder{rw: rw, header: make(http.Header)}
+}
+
+// Header returns the headers of the response being held, or of rw once they are sent.
+func (w *authFailureRecorder) Header() http.Header {
+	if w.status != 0 && !w.held {
+		return w.rw.Header()
+	}
+	return w.header
+}
+
+func (w *authFailureRecorder) WriteHeader(code int) {
+	if w.status != 0 {
+		return
+	}
+	// Informational responses do not end the response
+	if code >= 100 && code < 200 {
+		copyHeader(w.rw.Header(), w.header)
+		w.rw.WriteHeader(code)
+		return
+	}
+	w.status = code
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		w.held = true
+		return
+	}
+	copyHeader(w.rw.Header(), w.header)
+	w.rw.WriteHeader(code)
+}
+
+func (w *authFailureRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.held {
+		if w.body.Len()+len(b) <= authFailureHeldBytes {
+			return w.body.Write(b)
+		}
+		w.release()
+	}
+	return w.rw.Write(b)
+}
+
+// release sends the held response to the client.
+func (w *authFailureRecorder) release() {
+	if !w.held {
+		return
+	}
+	w.held = false
+	copyHeader(w.rw.Header(), w.header)
+	w.rw.WriteHeader(w.status)
+	if w.body.Len() > 0 {
+		w.rw.Write(w.body.Bytes())
+	}
+}
+
+// Flush sends a held response, as a streaming upstream wants it delivered now.
+func (w *authFailureRecorder) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.release()
+	if flusher, ok := w.rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack keeps WebSocket upgrades working; the proxy writes the upgrade response itself.
+func (w *authFailureRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", w.rw)
+	}
+	copyHeader(w.rw.Header(), w.header)
+	w.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// copyHeader sets the headers of src in dst, replacing values of the same name.
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,232 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPRefreshOnAuthFailure tests that a request rejected by the upstream is retried
+// once with a rotated secret.
+func TestServeHTTPRefreshOnAuthFailure(t *testing.T) {
+	tests := []struct {
+		name             string
+		rotated          bool
+		cacheAge         time.Duration
+		body             string
+		maxBodyBytes     int64
+		expectedStatus   int
+		expectedBody     string
+		expectedUpstream int32
+		expectedAPIReads int32
+	}{
+		{
+			name:             "rotated secret",
+			rotated:          true,
+			cacheAge:         time.Minute,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "welcome",
+			expectedUpstream: 2,
+			expectedAPIReads: 2,
+		},
+		{
+			name:             "unchanged secret",
+			cacheAge:         time.Minute,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     "invalid key",
+			expectedUpstream: 1,
+			expectedAPIReads: 2,
+		},
+		{
+			name:             "recently read secret",
+			rotated:          true,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     "invalid key",
+			expectedUpstream: 1,
+			expectedAPIReads: 1,
+		},
+		{
+			name:             "buffered body",
+			rotated:          true,
+			cacheAge:         time.Minute,
+			body:             `{"order": 1}`,
+			maxBodyBytes:     64,
+			expectedStatus:   http.StatusOK,
+			expectedBody:     "welcome",
+			expectedUpstream: 2,
+			expectedAPIReads: 2,
+		},
+		{
+			name:             "body over the limit",
+			rotated:          true,
+			cacheAge:         time.Minute,
+			body:             `{"order": 1, "lines": [1, 2, 3]}`,
+			maxBodyBytes:     16,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     "invalid key",
+			expectedUpstream: 1,
+			expectedAPIReads: 1,
+		},
+		{
+			name:             "body buffering disabled",
+			rotated:          true,
+			cacheAge:         time.Minute,
+			body:             `{"order": 1}`,
+			expectedStatus:   http.StatusUnauthorized,
+			expectedBody:     "invalid key",
+			expectedUpstream: 1,
+			expectedAPIReads: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiReads int32
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				value := "old-key"
+				if atomic.AddInt32(&apiReads, 1) > 1 && tt.rotated {
+					value = "new-key"
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{
+					Data: map[string]string{"api-key": base64.StdEncoding.EncodeToString([]byte(value))},
+				})
+			}))
+			defer mockServer.Close()
+
+			var upstreamCalls int32
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					atomic.AddInt32(&upstreamCalls, 1)
+					if received, _ := io.ReadAll(req.Body); string(received) != tt.body {
+						t.Errorf("Expected the upstream to receive body %q, got %q", tt.body, received)
+					}
+					rw.Header().Set("X-Upstream-Call", "yes")
+					if req.Header.Get("X-Api-Key") != "new-key" {
+						rw.Header().Set("WWW-Authenticate", "ApiKey")
+						rw.WriteHeader(http.StatusUnauthorized)
+						rw.Write([]byte("invalid key"))
+						return
+					}
+					rw.Write([]byte("welcome"))
+				}),
+				name: "auth-refresh-" + tt.name,
+				config: &Config{
+					SecretName:           "my-secret",
+					SecretKey:            "api-key",
+					HeaderName:           "X-Api-Key",
+					Namespace:            "default",
+					CacheTTL:             300,
+					RefreshOnAuthFailure: true,
+					RetryMaxBodyBytes:    tt.maxBodyBytes,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			// Read the secret, then age the cached entry
+			if _, err := handler.getValue(httptest.NewRequest(http.MethodGet, "/", nil).Context(), "my-secret", "api-key"); err != nil {
+				t.Fatal(err)
+			}
+			entry, _ := handler.cache.load("default/my-secret")
+			entry.lastFetch = time.Now().Add(-tt.cacheAge)
+			handler.cache.put("default/my-secret", entry)
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodPost, "http://example.com/orders", body))
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if got := rw.Body.String(); got != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, got)
+			}
+			if got := rw.Header().Values("X-Upstream-Call"); len(got) != 1 {
+				t.Errorf("Expected the headers of a single upstream response, got %q", got)
+			}
+			if got := rw.Header().Get("WWW-Authenticate"); (tt.expectedStatus == http.StatusUnauthorized) != (got != "") {
+				t.Errorf("Expected WWW-Authenticate only on the rejected response, got %q", got)
+			}
+			if got := atomic.LoadInt32(&upstreamCalls); got != tt.expectedUpstream {
+				t.Errorf("Expected %d upstream calls, got %d", tt.expectedUpstream, got)
+			}
+			if got := atomic.LoadInt32(&apiReads); got != tt.expectedAPIReads {
+				t.Errorf("Expected %d API reads, got %d", tt.expectedAPIReads, got)
+			}
+		})
+	}
+}
+
+// TestAuthFailureRecorderLargeBody tests that a rejection too large to hold is sent as is.
+func TestAuthFailureRecorderLargeBody(t *testing.T) {
+	rw := httptest.NewRecorder()
+	recorder := newAuthFailureRecorder(rw)
+
+	recorder.Header().Set("Content-Type", "text/plain")
+	recorder.WriteHeader(http.StatusForbidden)
+	recorder.Write([]byte("denied"))
+	if !recorder.held {
+		t.Fatal("Expected the 403 response to be held")
+	}
+	recorder.Write(make([]byte, authFailureHeldBytes))
+
+	if recorder.held {
+		t.Error("Expected the response to be released")
+	}
+	if rw.Code != http.StatusForbidden || rw.Header().Get("Content-Type") != "text/plain" {
+		t.Errorf("Expected the held status and headers, got %d %v", rw.Code, rw.Header())
+	}
+	if rw.Body.Len() != len("denied")+authFailureHeldBytes {
+		t.Errorf("Expected the whole body, got %d bytes", rw.Body.Len())
+	}
+}
+
+// TestBufferRetryBody tests that a body of unknown length over the limit still reaches the
+// upstream whole.
+func TestBufferRetryBody(t *testing.T) {
+	tests := []struct {
+		name               string
+		body               string
+		limit              int64
+		expectedReplayable bool
+	}{
+		{name: "within limit", body: "0123456789", limit: 10, expectedReplayable: true},
+		{name: "over limit", body: "0123456789abcdef", limit: 10},
+		{name: "disabled", body: "0123456789", limit: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader(tt.body)))
+			req.ContentLength = -1
+
+			buffered, replayable, err := bufferRetryBody(req, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replayable != tt.expectedReplayable {
+				t.Errorf("Expected replayable %v, got %v", tt.expectedReplayable, replayable)
+			}
+			if replayable && string(buffered) != tt.body {
+				t.Errorf("Expected buffered body %q, got %q", tt.body, buffered)
+			}
+			if forwarded, _ := io.ReadAll(req.Body); string(forwarded) != tt.body {
+				t.Errorf("Expected forwarded body %q, got %q", tt.body, forwarded)
+			}
+		})
+	}
+}
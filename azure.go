@@ -0,0 +1,201 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// azureIMDSURL is the managed identity endpoint of the Azure Instance Metadata Service.
+const azureIMDSURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// azureVaultResource is the audience of Key Vault access tokens.
+const azureVaultResource = "https://vault.azure.net"
+
+// azureClient reads secrets from Azure Key Vault. It authenticates with workload identity
+// federation when the Azure Workload Identity webhook injected AZURE_FEDERATED_TOKEN_FILE,
+// and with the managed identity of the node otherwise.
+type azureClient struct {
+	httpClient *http.Client
+	vaultURI   string
+
+	// Identity settings, from the environment injected by the workload identity webhook
+	clientID      string
+	tenantID      string
+	authorityHost string
+	tokenFile     string
+	imdsURL       string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// azureTokenResponse is the token answer of Microsoft Entra ID and of IMDS, which sends
+// expires_in as a string.
+type azureTokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// readSecret returns the current version of the named secret, or the version given as
+// "name/version". A value holding a JSON object yields its members as keys; any other value
+// is returned under the key "value".
+func (c *azureClient) readSecret(ctx context.Context, name string) (map[string]string, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := c.vaultURI + "/secrets/" + strings.Trim(name, "/") + "?api-version=7.4"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, classify(ErrAPIUnavailable, fmt.Errorf("failed to execute request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if resp.StatusCode == http.StatusUnauthorized {
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		}
+		return nil, classify(statusClass(resp.StatusCode), fmt.Errorf("key vault returned status %d for secret %s: %s", resp.StatusCode, name, body))
+	}
+
+	var out struct {
+		Value *string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode key vault response: %w", err)
+	}
+	if out.Value == nil {
+		return nil, fmt.Errorf("key vault secret %s has no value", name)
+	}
+	return jsonFields(*out.Value, "value")
+}
+
+// accessToken returns a cached Key Vault token, requesting a new one five minutes before the
+// current one expires.
+func (c *azureClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(5*time.Minute).Before(c.expires) {
+		return c.token, nil
+	}
+
+	var req *http.Request
+	var err error
+	if c.tokenFile != "" {
+		req, err = c.federatedTokenRequest(ctx)
+	} else {
+		req, err = c.managedIdentityRequest(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request Azure token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("azure token endpoint returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var token azureTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode Azure token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("azure token response has no access_token")
+	}
+	lifetime, err := token.ExpiresIn.Int64()
+	if err != nil {
+		return "", fmt.Errorf("invalid expires_in in Azure token response: %w", err)
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(lifetime) * time.Second)
+	return c.token, nil
+}
+
+// federatedTokenRequest exchanges the projected service account token for an Entra ID token
+// (client credentials grant with a client assertion).
+func (c *azureClient) federatedTokenRequest(ctx context.Context) (*http.Request, error) {
+	// The projected token rotates, so it is read on every exchange
+	assertion, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read federated token: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_id":             {c.clientID},
+		"scope":                 {azureVaultResource + "/.default"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {strings.TrimSpace(string(assertion))},
+	}
+	endpoint := strings.TrimSuffix(c.authorityHost, "/") + "/" + c.tenantID + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+// managedIdentityRequest asks IMDS for a token of the node's managed identity, or of the
+// user-assigned identity in clientID.
+func (c *azureClient) managedIdentityRequest(ctx context.Context) (*http.Request, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {azureVaultResource}}
+	if c.clientID != "" {
+		query.Set("client_id", c.clientID)
+	}
+	imdsURL := c.imdsURL
+	if imdsURL == "" {
+		imdsURL = azureIMDSURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IMDS request: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
+
+// validateAzureConfig checks the Azure Key Vault source settings.
+func validateAzureConfig(config *Config) error {
+	if config.AzureVaultURI == "" {
+		return fmt.Errorf("azureVaultURI is required with source %q", sourceAzure)
+	}
+	vaultURI, err := url.Parse(config.AzureVaultURI)
+	if err != nil || vaultURI.Scheme != "https" || vaultURI.Host == "" {
+		return fmt.Errorf("invalid azureVaultURI %q, expected https://<vault>.vault.azure.net", config.AzureVaultURI)
+	}
+	config.AzureVaultURI = strings.TrimSuffix(config.AzureVaultURI, "/")
+
+	if os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "" && (os.Getenv("AZURE_CLIENT_ID") == "" || os.Getenv("AZURE_TENANT_ID") == "") {
+		return fmt.Errorf("workload identity needs AZURE_CLIENT_ID and AZURE_TENANT_ID next to AZURE_FEDERATED_TOKEN_FILE")
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// mockAzureServer serves Entra ID token exchanges, IMDS managed identity tokens and Key Vault
+// secrets. IMDS answers expires_in as a string, like the real service.
+func mockAzureServer(t *testing.T, secrets map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant-id/oauth2/v2.0/token":
+			r.ParseForm()
+			if r.Form.Get("client_assertion") != "federated-token" || r.Form.Get("client_id") != "client-id" ||
+				r.Form.Get("scope") != "https://vault.azure.net/.default" {
+				http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token_type":"Bearer","expires_in":3599,"access_token":"workload-token"}`)
+		case "/imds":
+			if r.Header.Get("Metadata") != "true" || r.URL.Query().Get("resource") != "https://vault.azure.net" {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token_type":"Bearer","expires_in":"86399","access_token":"managed-token"}`)
+		default:
+			auth := r.Header.Get("Authorization")
+			if auth != "Bearer workload-token" && auth != "Bearer managed-token" {
+				http.Error(w, `{"error":{"code":"Unauthorized"}}`, http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("api-version") == "" {
+				http.Error(w, `{"error":{"code":"MissingApiVersionParameter"}}`, http.StatusBadRequest)
+				return
+			}
+			value, ok := secrets[r.URL.Path]
+			if !ok {
+				http.Error(w, `{"error":{"code":"SecretNotFound"}}`, http.StatusNotFound)
+				return
+			}
+			fmt.Fprintf(w, `{"value":%q,"id":"https://shop.vault.azure.net%s"}`, value, r.URL.Path)
+		}
+	}))
+}
+
+// TestAzureReadSecret tests reading secrets with workload identity and managed identity tokens.
+func TestAzureReadSecret(t *testing.T) {
+	server := mockAzureServer(t, map[string]string{
+		"/secrets/payments":       `{"api-key":"azure-value"}`,
+		"/secrets/plain/0123abcd": "pinned-value",
+	})
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	if err := os.WriteFile(tokenFile, []byte("federated-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	identities := map[string]*azureClient{
+		"workload identity": {
+			httpClient:    server.Client(),
+			vaultURI:      server.URL,
+			clientID:      "client-id",
+			tenantID:      "tenant-id",
+			authorityHost: server.URL + "/",
+			tokenFile:     tokenFile,
+		},
+		"managed identity": {
+			httpClient: server.Client(),
+			vaultURI:   server.URL,
+			imdsURL:    server.URL + "/imds",
+		},
+	}
+
+	for identity, client := range identities {
+		t.Run(identity, func(t *testing.T) {
+			data, err := client.readSecret(t.Context(), "payments")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(data, map[string]string{"api-key": "azure-value"}) {
+				t.Errorf("Unexpected data %v", data)
+			}
+
+			data, err = client.readSecret(t.Context(), "plain/0123abcd")
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if data["value"] != "pinned-value" {
+				t.Errorf("Expected the pinned version, got %v", data)
+			}
+
+			if _, err := client.readSecret(t.Context(), "missing"); err == nil {
+				t.Error("Expected an error for a missing secret")
+			}
+		})
+	}
+}
+
+// TestValidateAzureConfig tests Azure Key Vault source configuration checks.
+func TestValidateAzureConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		env         map[string]string
+		expectError bool
+	}{
+		{name: "managed identity", config: &Config{AzureVaultURI: "https://shop.vault.azure.net/"}},
+		{
+			name:   "workload identity",
+			config: &Config{AzureVaultURI: "https://shop.vault.azure.net"},
+			env:    map[string]string{"AZURE_FEDERATED_TOKEN_FILE": "/token", "AZURE_CLIENT_ID": "id", "AZURE_TENANT_ID": "tenant"},
+		},
+		{
+			name:        "incomplete workload identity",
+			config:      &Config{AzureVaultURI: "https://shop.vault.azure.net"},
+			env:         map[string]string{"AZURE_FEDERATED_TOKEN_FILE": "/token"},
+			expectError: true,
+		},
+		{name: "missing vault", config: &Config{}, expectError: true},
+		{name: "plaintext vault", config: &Config{AzureVaultURI: "http://shop.vault.azure.net"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AZURE_FEDERATED_TOKEN_FILE", "AZURE_CLIENT_ID", "AZURE_TENANT_ID"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			err := validateAzureConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// secretTypeBasicAuth is the type of Kubernetes secrets holding basic authentication
+// credentials in their username and password keys.
+const secretTypeBasicAuth = "kubernetes.io/basic-auth"
+
+// usesBasicAuthSecret reports whether config injects the credentials of a
+// kubernetes.io/basic-auth secret, which it does in inject mode when no key is configured.
+func usesBasicAuthSecret(config *Config) bool {
+	return (config.Mode == "" || config.Mode == modeInject) &&
+		config.SecretKey == "" && len(config.SecretKeys) == 0 && config.SecretKeyPattern == ""
+}
+
+// validateBasicAuthSecret checks the settings of kubernetes.io/basic-auth secret injection.
+func validateBasicAuthSecret(config *Config) error {
+	if !usesBasicAuthSecret(config) {
+		if config.BasicAuthUsernameHeader != "" {
+			return fmt.Errorf("basicAuthUsernameHeader is only used in mode %q without secretKey", modeInject)
+		}
+		return nil
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("secretKey cannot be empty with source %q", config.Source)
+	}
+	if len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return fmt.Errorf("fallbackSources and fallbackValue require secretKey")
+	}
+	if len(config.WarmupHeaders) > 0 || len(config.WarmupMethods) > 0 || len(config.WarmupUserAgents) > 0 {
+		return fmt.Errorf("warm-up detection requires secretKey")
+	}
+	if config.RotationGracePeriod > 0 || config.CompressThreshold > 0 || config.DryRun || len(config.Transforms) > 0 {
+		return fmt.Errorf("rotationGracePeriod, compressThreshold, dryRun and transforms require secretKey")
+	}
+	if config.BasicAuthUsernameHeader != "" && strings.EqualFold(config.BasicAuthUsernameHeader, config.HeaderName) {
+		return fmt.Errorf("basicAuthUsernameHeader and headerName cannot be the same header")
+	}
+	return nil
+}
+
+// basicAuthCredentials returns the username and password of a kubernetes.io/basic-auth secret.
+// Secrets of any other type are refused, so a missing secretKey is not mistaken for one.
+func (s *SecretHeader) basicAuthCredentials(ctx context.Context, secretName string) (string, string, error) {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName)
+	if err != nil {
+		return "", "", err
+	}
+
+	entry, _ := s.cache.load(s.secretCacheKey(secretName))
+	if entry.secretType != secretTypeBasicAuth {
+		return "", "", fmt.Errorf("secret %s/%s is not of type %s and no secretKey is set",
+			s.config.Namespace, secretName, secretTypeBasicAuth)
+	}
+	return data["username"], data["password"], nil
+}
+
+// serveBasicAuth injects the credentials of a kubernetes.io/basic-auth secret: the password
+// in HeaderName and the username in BasicAuthUsernameHeader, or both as a Basic credential in
+// HeaderName.
+func (s *SecretHeader) serveBasicAuth(rw http.ResponseWriter, req *http.Request, secretName string) {
+	username, password, err := s.basicAuthCredentials(req.Context(), secretName)
+	if err == nil {
+		username, err = s.headerValue(username)
+	}
+	if err == nil {
+		password, err = s.headerValue(password)
+	}
+	if err == nil {
+		password, err = s.checkValue(password, secretName, "password")
+	}
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	if s.config.BasicAuthUsernameHeader != "" {
+		req.Header.Set(s.config.BasicAuthUsernameHeader, username)
+		s.injectHeader(req, password)
+	} else {
+		s.injectHeader(req, base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	}
+	s.injectIdentity(req)
+	s.next.ServeHTTP(rw, req)
+}
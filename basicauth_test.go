@@ -0,0 +1,130 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPBasicAuthSecret tests injection of kubernetes.io/basic-auth secrets without secretKey.
+func TestServeHTTPBasicAuthSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		secretType     string
+		headerName     string
+		valuePrefix    string
+		usernameHeader string
+		expectedStatus int
+		expected       map[string]string
+	}{
+		{
+			name:           "combined Basic credential",
+			secretType:     secretTypeBasicAuth,
+			headerName:     "Authorization",
+			valuePrefix:    "Basic ",
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"Authorization": "Basic YWxpY2U6czNjcjN0"},
+		},
+		{
+			name:           "separate headers",
+			secretType:     secretTypeBasicAuth,
+			headerName:     "X-Password",
+			usernameHeader: "X-Username",
+			expectedStatus: http.StatusOK,
+			expected:       map[string]string{"X-Username": "alice", "X-Password": "s3cr3t"},
+		},
+		{
+			name:           "opaque secret",
+			secretType:     "Opaque",
+			headerName:     "Authorization",
+			valuePrefix:    "Basic ",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{
+					Type: tt.secretType,
+					Data: map[string]string{
+						"username": base64.StdEncoding.EncodeToString([]byte("alice")),
+						"password": base64.StdEncoding.EncodeToString([]byte("s3cr3t")),
+					},
+				})
+			}))
+			defer mockServer.Close()
+
+			var captured http.Header
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Clone()
+				}),
+				name: "basic-auth-test",
+				config: &Config{
+					SecretName:              "partner-login",
+					HeaderName:              tt.headerName,
+					ValuePrefix:             tt.valuePrefix,
+					BasicAuthUsernameHeader: tt.usernameHeader,
+					Namespace:               "default",
+					CacheTTL:                300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:     &secretCache{ttl: 300 * time.Second},
+				basicAuth: true,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("X-Username", "mallory")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			for name, expected := range tt.expected {
+				if got := captured.Get(name); got != expected {
+					t.Errorf("Expected %s %q, got %q", name, expected, got)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateBasicAuthSecret tests kubernetes.io/basic-auth configuration checks.
+func TestValidateBasicAuthSecret(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "secret key", config: &Config{SecretKey: "token"}},
+		{name: "basic-auth secret", config: &Config{HeaderName: "Authorization"}},
+		{name: "separate headers", config: &Config{HeaderName: "X-Password", BasicAuthUsernameHeader: "X-Username"}},
+		{name: "username header with secret key", config: &Config{SecretKey: "token", BasicAuthUsernameHeader: "X-Username"}, expectError: true},
+		{name: "same header", config: &Config{HeaderName: "X-User", BasicAuthUsernameHeader: "x-user"}, expectError: true},
+		{name: "external source", config: &Config{Source: sourceFile}, expectError: true},
+		{name: "fallback value", config: &Config{FallbackValue: "dev"}, expectError: true},
+		{name: "warm-up detection", config: &Config{WarmupMethods: []string{"HEAD"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBasicAuthSecret(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+package traefik_k8s_secret_header
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Supported values for Config.CacheImplementation.
+const (
+	cacheAuto    = "auto"
+	cacheRWMutex = "rwmutex"
+	cacheAtomic  = "atomic"
+	cacheSharded = "sharded"
+	cacheLRU     = "lru"
+)
+
+// cacheShards is the number of shards of the sharded store.
+const cacheShards = 32
+
+// secretCache provides caching for decoded secret data, keyed by namespace/name. A secret is
+// cached whole, so all its keys are served by one read, and each entry tracks its own fetch
+// time and optionally its own TTL. Entries live in store when set, otherwise in the
+// RWMutex-guarded entries map. With a seal, entries hold their values encrypted in sealed
+// and load decrypts them.
+type secretCache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+	ttl     time.Duration
+	jitter  float64 // fraction of ttl each entry's TTL is randomly moved by
+	store   cacheStore
+	flushed int64 // UnixNano before which entries count as expired, see invalidate
+	seal    *valueSeal
+	sealMu  sync.RWMutex // held for writing while replaced sealed values are wiped
+	clock   Clock        // nil uses the system clock
+}
+
+// cacheEntry is the decoded data of a single cached secret.
+type cacheEntry struct {
+	data       map[string]string
+	lastFetch  time.Time
+	ttl        time.Duration     // 0 uses the cache TTL
+	version    string            // resourceVersion of a Kubernetes secret, if known
+	secretType string            // type of a Kubernetes secret, if known
+	keyPointer string            // key named by the secretKeyAnnotation of the secret, if any
+	sealed     map[string][]byte // encrypted data, replacing data in caches with a seal
+}
+
+// expired reports whether the entry, age old, is older than its TTL, or the cache TTL
+// without one.
+func (e cacheEntry) expired(cacheTTL, age time.Duration) bool {
+	ttl := e.ttl
+	if ttl == 0 {
+		ttl = cacheTTL
+	}
+	return age > ttl
+}
+
+// cacheStore is an alternative concurrent map behind secretCache. BenchmarkSecretCache
+// compares the implementations.
+type cacheStore interface {
+	load(key string) (cacheEntry, bool)
+	store(key string, entry cacheEntry) (evicted int)
+	size() int
+	each(fn func(key string, entry cacheEntry))
+}
+
+// newSecretCache returns a cache using the named implementation. "auto" picks the LRU store
+// when maxEntries bounds the cache, the sharded store when secrets are selected per request
+// (one entry per tenant, frequent inserts) and the copy-on-write atomic store otherwise (a
+// few entries, reads only between refreshes).
+func newSecretCache(ttl time.Duration, implementation string, perRequestSecrets bool, maxEntries int) (*secretCache, error) {
+	if implementation == "" || implementation == cacheAuto {
+		implementation = cacheAtomic
+		if perRequestSecrets {
+			implementation = cacheSharded
+		}
+		if maxEntries > 0 {
+			implementation = cacheLRU
+		}
+	}
+	if maxEntries > 0 && implementation != cacheLRU {
+		return nil, fmt.Errorf("cacheMaxEntries requires cacheImplementation %s or %s", cacheAuto, cacheLRU)
+	}
+
+	cache := &secretCache{ttl: ttl}
+	switch implementation {
+	case cacheRWMutex:
+	case cacheAtomic:
+		cache.store = &atomicStore{}
+	case cacheSharded:
+		cache.store = newShardedStore()
+	case cacheLRU:
+		if maxEntries <= 0 {
+			return nil, fmt.Errorf("cacheImplementation %s requires cacheMaxEntries", cacheLRU)
+		}
+		cache.store = newLRUStore(maxEntries)
+	default:
+		return nil, fmt.Errorf("unknown cacheImplementation %q, expected %s, %s, %s, %s or %s",
+			implementation, cacheAuto, cacheRWMutex, cacheAtomic, cacheSharded, cacheLRU)
+	}
+	return cache, nil
+}
+
+func (c *secretCache) get(key string) (map[string]string, bool) {
+	entry, ok := c.load(key)
+	if !ok || c.stale(entry) {
+		return nil, false
+	}
+	return entry.data, true
+}
+
+// stale reports whether entry expired or was fetched before the last invalidate.
+func (c *secretCache) stale(entry cacheEntry) bool {
+	return entry.expired(c.ttl, c.since(entry.lastFetch)) || entry.lastFetch.UnixNano() < atomic.LoadInt64(&c.flushed)
+}
+
+// invalidate expires every cached entry, so the next lookup of each reads it again. Entries
+// are kept, so peek still finds a last known good value if that read fails.
+func (c *secretCache) invalidate() {
+	atomic.StoreInt64(&c.flushed, c.now().UnixNano())
+}
+
+// expire makes the entry for key expired if it is older than minAge, so the next lookup
+// reads it again. The entry is kept for peek and maxStale.
+func (c *secretCache) expire(key string, minAge time.Duration) {
+	entry, ok := c.load(key)
+	if !ok || c.since(entry.lastFetch) < minAge {
+		return
+	}
+	ttl := entry.ttl
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	if expiredAt := c.now().Add(-ttl - time.Nanosecond); entry.lastFetch.After(expiredAt) {
+		entry.lastFetch = expiredAt
+		c.put(key, entry)
+	}
+}
+
+// peek returns a cached entry regardless of its age.
+func (c *secretCache) peek(key string) (map[string]string, bool) {
+	entry, ok := c.load(key)
+	return entry.data, ok
+}
+
+// len returns the number of cached entries, including expired ones not yet replaced.
+func (c *secretCache) len() int {
+	if c.store != nil {
+		return c.store.size()
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.entries)
+}
+
+// newConfigCache returns the cache described by the cache settings of config.
+func newConfigCache(config *Config, perRequestSecrets bool) (*secretCache, error) {
+	cache, err := newSecretCache(time.Duration(config.CacheTTL)*time.Second, config.CacheImplementation, perRequestSecrets, config.CacheMaxEntries)
+	if err != nil {
+		return nil, err
+	}
+	cache.jitter = float64(config.CacheTTLJitter) / 100
+	if config.ProtectCachedValues {
+		if cache.seal, err = newValueSeal(); err != nil {
+			return nil, err
+		}
+	}
+	return cache, nil
+}
+
+// each calls fn for every cached entry, including expired ones, without changing their
+// recency. fn must not use the cache.
+func (c *secretCache) each(fn func(key string, entry cacheEntry)) {
+	if c.seal != nil {
+		c.sealMu.RLock()
+		defer c.sealMu.RUnlock()
+
+		visit := fn
+		fn = func(key string, entry cacheEntry) {
+			visit(key, c.unseal(entry))
+		}
+	}
+
+	if c.store != nil {
+		c.store.each(fn)
+		return
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for key, entry := range c.entries {
+		fn(key, entry)
+	}
+}
+
+// set caches data under key and returns the number of entries evicted to make room.
+func (c *secretCache) set(key string, data map[string]string) int {
+	return c.setSecret(key, data, "", "", "", 0)
+}
+
+// setSecret caches data under key along with the resourceVersion, type and key pointer of
+// the Kubernetes secret it was read from. A ttl other than 0 replaces the cache TTL for this
+// entry.
+func (c *secretCache) setSecret(key string, data map[string]string, version, secretType, keyPointer string, ttl time.Duration) int {
+	return c.put(key, cacheEntry{
+		data:       data,
+		lastFetch:  c.now(),
+		ttl:        c.jitteredTTL(ttl),
+		version:    version,
+		secretType: secretType,
+		keyPointer: keyPointer,
+	})
+}
+
+// jitteredTTL returns ttl, or the cache TTL when 0, moved randomly by up to the jitter
+// fraction, so entries fetched together by many instances do not all expire at the same
+// moment. It returns 0, the cache TTL, for the cache TTL without jitter.
+func (c *secretCache) jitteredTTL(ttl time.Duration) time.Duration {
+	if c.jitter == 0 {
+		return ttl
+	}
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	return ttl + time.Duration(float64(ttl)*c.jitter*(2*rand.Float64()-1))
+}
+
+// setTTL caches data under key with its own TTL; 0 uses the cache TTL.
+func (c *secretCache) setTTL(key string, data map[string]string, ttl time.Duration) int {
+	return c.put(key, cacheEntry{
+		data:      data,
+		lastFetch: c.now(),
+		ttl:       ttl,
+	})
+}
+
+// put stores entry under key and returns the number of entries evicted to make room. With a
+// seal, the values are encrypted and those of the entry replaced or evicted are wiped.
+func (c *secretCache) put(key string, entry cacheEntry) int {
+	if c.seal == nil {
+		return c.putEntry(key, entry)
+	}
+
+	entry.sealed = c.seal.seal(entry.data)
+	entry.data = nil
+
+	c.sealMu.Lock()
+	defer c.sealMu.Unlock()
+
+	previous, replaced := c.loadEntry(key)
+	evicted := c.putEntry(key, entry)
+	if replaced {
+		wipe(previous.sealed)
+	}
+	return evicted
+}
+
+// putEntry stores entry under key in the configured store.
+func (c *secretCache) putEntry(key string, entry cacheEntry) int {
+	if c.store != nil {
+		return c.store.store(key, entry)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[key] = entry
+	return 0
+}
+
+// load returns the entry for key, with its values decrypted with a seal.
+func (c *secretCache) load(key string) (cacheEntry, bool) {
+	if c.seal == nil {
+		return c.loadEntry(key)
+	}
+
+	c.sealMu.RLock()
+	defer c.sealMu.RUnlock()
+
+	entry, ok := c.loadEntry(key)
+	return c.unseal(entry), ok
+}
+
+// unseal returns entry with its sealed values decrypted into data.
+func (c *secretCache) unseal(entry cacheEntry) cacheEntry {
+	if entry.sealed != nil {
+		entry.data = c.seal.open(entry.sealed)
+		entry.sealed = nil
+	}
+	return entry
+}
+
+// loadEntry returns the entry for key from the configured store.
+func (c *secretCache) loadEntry(key string) (cacheEntry, bool) {
+	if c.store != nil {
+		return c.store.load(key)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+// atomicStore is a copy-on-write map: lookups are a single atomic load, every store copies
+// the map. Best for a handful of secrets refreshed once per TTL.
+type atomicStore struct {
+	mu      sync.Mutex // serializes writers
+	entries atomic.Value
+}
+
+func (s *atomicStore) load(key string) (cacheEntry, bool) {
+	entries, _ := s.entries.Load().(map[string]cacheEntry)
+	entry, ok := entries[key]
+	return entry, ok
+}
+
+func (s *atomicStore) store(key string, entry cacheEntry) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, _ := s.entries.Load().(map[string]cacheEntry)
+	next := make(map[string]cacheEntry, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[key] = entry
+	s.entries.Store(next)
+	return 0
+}
+
+func (s *atomicStore) size() int {
+	entries, _ := s.entries.Load().(map[string]cacheEntry)
+	return len(entries)
+}
+
+func (s *atomicStore) each(fn func(key string, entry cacheEntry)) {
+	entries, _ := s.entries.Load().(map[string]cacheEntry)
+	for key, entry := range entries {
+		fn(key, entry)
+	}
+}
+
+// shardedStore spreads entries over RWMutex-guarded shards by key hash, so inserts for one
+// tenant do not block lookups for others.
+type shardedStore struct {
+	shards []cacheShard
+}
+
+// cacheShard is one partition of a shardedStore.
+type cacheShard struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+func newShardedStore() *shardedStore {
+	s := &shardedStore{shards: make([]cacheShard, cacheShards)}
+	for i := range s.shards {
+		s.shards[i].entries = make(map[string]cacheEntry)
+	}
+	return s
+}
+
+func (s *shardedStore) shard(key string) *cacheShard {
+	// FNV-1a, inlined to keep lookups allocation-free
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h%uint32(len(s.shards))]
+}
+
+func (s *shardedStore) load(key string) (cacheEntry, bool) {
+	shard := s.shard(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	entry, ok := shard.entries[key]
+	return entry, ok
+}
+
+func (s *shardedStore) store(key string, entry cacheEntry) int {
+	shard := s.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.entries[key] = entry
+	return 0
+}
+
+func (s *shardedStore) size() int {
+	n := 0
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+		n += len(s.shards[i].entries)
+		s.shards[i].mu.RUnlock()
+	}
+	return n
+}
+
+func (s *shardedStore) each(fn func(key string, entry cacheEntry)) {
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+		for key, entry := range s.shards[i].entries {
+			fn(key, entry)
+		}
+		s.shards[i].mu.RUnlock()
+	}
+}
+
+// lruStore holds at most capacity entries, evicting the least recently used one. Every
+// lookup reorders the list, so all operations take the same mutex.
+type lruStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // of *lruItem, most recently used first
+	items    map[string]*list.Element
+}
+
+// lruItem is an element of lruStore.order.
+type lruItem struct {
+	key   string
+	entry cacheEntry
+}
+
+func newLRUStore(capacity int) *lruStore {
+	return &lruStore{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *lruStore) load(key string) (cacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.items[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	s.order.MoveToFront(element)
+	return element.Value.(*lruItem).entry, true
+}
+
+func (s *lruStore) store(key string, entry cacheEntry) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.items[key]; ok {
+		element.Value.(*lruItem).entry = entry
+		s.order.MoveToFront(element)
+		return 0
+	}
+
+	s.items[key] = s.order.PushFront(&lruItem{key: key, entry: entry})
+	evicted := 0
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		item := oldest.Value.(*lruItem)
+		delete(s.items, item.key)
+		// Like a replaced entry, an evicted one has its sealed values wiped; put holds sealMu
+		wipe(item.entry.sealed)
+		item.entry = cacheEntry{}
+		evicted++
+	}
+	return evicted
+}
+
+func (s *lruStore) size() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+func (s *lruStore) each(fn func(key string, entry cacheEntry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for element := s.order.Front(); element != nil; element = element.Next() {
+		item := element.Value.(*lruItem)
+		fn(item.key, item.entry)
+	}
+}
@@ -0,0 +1,269 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// cacheImplementations are the stores compared by the cache tests and benchmarks.
+var cacheImplementations = []string{cacheRWMutex, cacheAtomic, cacheSharded, cacheLRU}
+
+// filledCache returns a cache of the given implementation holding n tenant secrets. The LRU
+// store is sized to hold them all.
+func filledCache(tb testing.TB, implementation string, n int) (*secretCache, []string) {
+	tb.Helper()
+
+	maxEntries := 0
+	if implementation == cacheLRU {
+		maxEntries = n
+	}
+	cache, err := newSecretCache(time.Hour, implementation, false, maxEntries)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	keys := make([]string, n)
+	entries := make(map[string]cacheEntry, n)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("tenants/tenant-%05d", i)
+		entries[keys[i]] = cacheEntry{data: map[string]string{"api-key": keys[i]}, lastFetch: time.Now()}
+	}
+
+	// Filling the copy-on-write store one set at a time is quadratic; load it in one go
+	if store, ok := cache.store.(*atomicStore); ok {
+		store.entries.Store(entries)
+		return cache, keys
+	}
+	for _, key := range keys {
+		cache.set(key, entries[key].data)
+	}
+	return cache, keys
+}
+
+// TestSecretCacheImplementations tests that every store behaves like the original cache.
+func TestSecretCacheImplementations(t *testing.T) {
+	for _, implementation := range cacheImplementations {
+		t.Run(implementation, func(t *testing.T) {
+			cache, keys := filledCache(t, implementation, 100)
+
+			if cache.len() != 100 {
+				t.Errorf("Expected 100 entries, got %d", cache.len())
+			}
+			data, ok := cache.get(keys[42])
+			if !ok || data["api-key"] != keys[42] {
+				t.Errorf("Expected entry for %s, got %v", keys[42], data)
+			}
+			if _, ok := cache.get("tenants/unknown"); ok {
+				t.Error("Expected a miss for an unknown key")
+			}
+			visited := 0
+			cache.each(func(key string, entry cacheEntry) { visited++ })
+			if visited != 100 {
+				t.Errorf("Expected each to visit 100 entries, got %d", visited)
+			}
+
+			cache.set(keys[42], map[string]string{"api-key": "rotated"})
+			if data, _ := cache.get(keys[42]); data["api-key"] != "rotated" || cache.len() != 100 {
+				t.Errorf("Expected the entry to be replaced, got %v with %d entries", data, cache.len())
+			}
+
+			cache.invalidate()
+			if _, ok := cache.get(keys[1]); ok {
+				t.Error("Expected invalidated entries to miss")
+			}
+			cache.set(keys[1], map[string]string{"api-key": "refreshed"})
+			if data, ok := cache.get(keys[1]); !ok || data["api-key"] != "refreshed" {
+				t.Errorf("Expected entries set after invalidation to hit, got %v", data)
+			}
+
+			cache.ttl = time.Nanosecond
+			time.Sleep(time.Millisecond)
+			if _, ok := cache.get(keys[0]); ok {
+				t.Error("Expected expired entries to miss")
+			}
+			if _, ok := cache.peek(keys[0]); !ok {
+				t.Error("Expected peek to return expired entries")
+			}
+		})
+	}
+}
+
+// TestNewSecretCache tests the automatic and explicit implementation selection.
+func TestNewSecretCache(t *testing.T) {
+	tests := []struct {
+		implementation    string
+		perRequestSecrets bool
+		maxEntries        int
+		expected          string
+		expectError       bool
+	}{
+		{implementation: "", expected: cacheAtomic},
+		{implementation: cacheAuto, perRequestSecrets: true, expected: cacheSharded},
+		{implementation: cacheAuto, perRequestSecrets: true, maxEntries: 100, expected: cacheLRU},
+		{implementation: cacheRWMutex, perRequestSecrets: true, expected: cacheRWMutex},
+		{implementation: cacheAtomic, expected: cacheAtomic},
+		{implementation: cacheSharded, expected: cacheSharded},
+		{implementation: cacheLRU, maxEntries: 100, expected: cacheLRU},
+		{implementation: cacheLRU, expectError: true},
+		{implementation: cacheSharded, maxEntries: 100, expectError: true},
+		{implementation: "lfu", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v/%d", tt.implementation, tt.perRequestSecrets, tt.maxEntries), func(t *testing.T) {
+			cache, err := newSecretCache(time.Minute, tt.implementation, tt.perRequestSecrets, tt.maxEntries)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			got := cacheRWMutex
+			switch cache.store.(type) {
+			case *atomicStore:
+				got = cacheAtomic
+			case *shardedStore:
+				got = cacheSharded
+			case *lruStore:
+				got = cacheLRU
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestSecretCacheEntryTTL tests that an entry's own TTL overrides the cache TTL.
+func TestSecretCacheEntryTTL(t *testing.T) {
+	for _, implementation := range cacheImplementations {
+		t.Run(implementation, func(t *testing.T) {
+			cache, _ := filledCache(t, implementation, 4)
+
+			cache.setTTL("default/short-lived", map[string]string{"token": "a"}, time.Nanosecond)
+			cache.setTTL("default/long-lived", map[string]string{"token": "b"}, time.Hour)
+			cache.ttl = time.Nanosecond
+			time.Sleep(time.Millisecond)
+
+			if _, ok := cache.get("default/short-lived"); ok {
+				t.Error("Expected the entry to expire after its own TTL")
+			}
+			if _, ok := cache.get("default/long-lived"); !ok {
+				t.Error("Expected the entry to outlive the cache TTL")
+			}
+		})
+	}
+}
+
+// TestSecretCacheTTLJitter tests that entry TTLs are spread within the jitter bounds.
+func TestSecretCacheTTLJitter(t *testing.T) {
+	cache, err := newConfigCache(&Config{CacheTTL: 100, CacheTTLJitter: 10}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("default/secret-%d", i)
+		cache.set(key, map[string]string{"token": "a"})
+		entry, _ := cache.load(key)
+		if entry.ttl < 90*time.Second || entry.ttl > 110*time.Second {
+			t.Fatalf("Expected a TTL within 10%% of 100s, got %v", entry.ttl)
+		}
+		seen[entry.ttl] = true
+	}
+	if len(seen) < 2 {
+		t.Error("Expected jittered TTLs to differ")
+	}
+}
+
+// TestLRUStoreEviction tests that the least recently used entry is evicted first.
+func TestLRUStoreEviction(t *testing.T) {
+	cache, err := newSecretCache(time.Hour, cacheLRU, false, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.set("default/tenant-a", map[string]string{"token": "a"})
+	cache.set("default/tenant-b", map[string]string{"token": "b"})
+	cache.get("default/tenant-a")
+	if evicted := cache.set("default/tenant-c", map[string]string{"token": "c"}); evicted != 1 {
+		t.Errorf("Expected 1 eviction, got %d", evicted)
+	}
+	if evicted := cache.set("default/tenant-c", map[string]string{"token": "c2"}); evicted != 0 {
+		t.Errorf("Expected replacing an entry to evict nothing, got %d", evicted)
+	}
+
+	if cache.len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.len())
+	}
+	if _, ok := cache.peek("default/tenant-b"); ok {
+		t.Error("Expected tenant-b to be evicted as least recently used")
+	}
+	for _, key := range []string{"default/tenant-a", "default/tenant-c"} {
+		if _, ok := cache.peek(key); !ok {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+}
+
+// BenchmarkSecretCacheLookup measures the 10k-tenant lookup of the implementation chosen for
+// per-tenant secrets, which is budgeted at 200ns.
+func BenchmarkSecretCacheLookup(b *testing.B) {
+	cache, err := newSecretCache(time.Hour, cacheAuto, true, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, keys := filledCache(b, cacheRWMutex, 10000)
+	for _, key := range keys {
+		cache.set(key, map[string]string{"api-key": key})
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			cache.get(keys[i%len(keys)])
+			i += 7 // stride over shards like distinct tenants would
+		}
+	})
+}
+
+// BenchmarkSecretCacheGet compares lookups for a single secret and for 10k tenants.
+func BenchmarkSecretCacheGet(b *testing.B) {
+	for _, implementation := range cacheImplementations {
+		for _, n := range []int{1, 10000} {
+			b.Run(fmt.Sprintf("%s/%d", implementation, n), func(b *testing.B) {
+				cache, keys := filledCache(b, implementation, n)
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					i := 0
+					for pb.Next() {
+						cache.get(keys[i%len(keys)])
+						i++
+					}
+				})
+			})
+		}
+	}
+}
+
+// BenchmarkSecretCacheSet compares inserts, which dominate while tenant caches warm up.
+func BenchmarkSecretCacheSet(b *testing.B) {
+	for _, implementation := range cacheImplementations {
+		for _, n := range []int{1, 10000} {
+			b.Run(fmt.Sprintf("%s/%d", implementation, n), func(b *testing.B) {
+				cache, keys := filledCache(b, implementation, n)
+				data := map[string]string{"api-key": "value"}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					cache.set(keys[i%len(keys)], data)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// secretTypeTLS is the type of Kubernetes secrets holding a certificate chain in tls.crt.
+const secretTypeTLS = "kubernetes.io/tls"
+
+// validateCertExpiry checks the certificate expiry settings.
+func validateCertExpiry(config *Config) error {
+	if config.CertExpiryWarningDays < 0 {
+		return fmt.Errorf("certExpiryWarningDays cannot be negative")
+	}
+	if config.CertExpiresHeader != "" && config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("certExpiresHeader is only supported in mode %q", modeInject)
+	}
+	return nil
+}
+
+// secretCertificate returns the certificate held by a secret: the value of secretKey with
+// certificateField, otherwise tls.crt of a kubernetes.io/tls secret.
+func (s *SecretHeader) secretCertificate(data map[string]string, secretType, secretKey string) (*x509.Certificate, bool) {
+	key := ""
+	switch {
+	case s.config.CertificateField != "":
+		key = secretKey
+	case secretType == secretTypeTLS:
+		key = "tls.crt"
+	default:
+		return nil, false
+	}
+
+	pemData, ok := data[key]
+	if !ok {
+		return nil, false
+	}
+	cert, err := s.certFields.certificate(pemData)
+	return cert, err == nil
+}
+
+// observeCertificate updates the expiry metrics of the certificate held by the secret cached
+// under cacheKey after a read, and warns when it expires within certExpiryWarningDays. It
+// runs on every refresh, so a certificate entering the window is noticed without a change.
+func (s *SecretHeader) observeCertificate(cacheKey, secretType string, data map[string]string) {
+	if s.perRequestSelection() {
+		return
+	}
+	cert, ok := s.secretCertificate(data, secretType, s.injectedKey(cacheKey, data))
+	if !ok {
+		return
+	}
+
+	labels := []string{"middleware", s.name, "secret", cacheKey}
+	metrics.set(metricCertificateNotAfter, float64(cert.NotAfter.Unix()), labels...)
+	if s.config.CertExpiryWarningDays == 0 {
+		return
+	}
+
+	left := time.Until(cert.NotAfter)
+	if left >= time.Duration(s.config.CertExpiryWarningDays)*24*time.Hour {
+		metrics.set(metricCertificateExpiring, 0, labels...)
+		return
+	}
+	metrics.set(metricCertificateExpiring, 1, labels...)
+	if left <= 0 {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Warning: certificate %q in secret %s expired at %s\n",
+			cert.Subject.String(), cacheKey, cert.NotAfter.UTC().Format(time.RFC3339))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Warning: certificate %q in secret %s expires at %s, in %d days\n",
+		cert.Subject.String(), cacheKey, cert.NotAfter.UTC().Format(time.RFC3339), int(left.Hours()/24))
+}
+
+// certificateExpiry returns the expiry time, in RFC 3339, of the certificate held by the
+// secret cached under cacheKey, or "" when it holds none.
+func (s *SecretHeader) certificateExpiry(cacheKey, secretKey string) string {
+	entry, ok := s.cache.load(cacheKey)
+	if !ok {
+		return ""
+	}
+	cert, ok := s.secretCertificate(entry.data, entry.secretType, secretKey)
+	if !ok {
+		return ""
+	}
+	return cert.NotAfter.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,121 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestObserveCertificate tests the certificate expiry metrics.
+func TestObserveCertificate(t *testing.T) {
+	tests := []struct {
+		name             string
+		secretType       string
+		notAfter         time.Time
+		expectedExpiring float64
+		expectObserved   bool
+	}{
+		{name: "valid", secretType: secretTypeTLS, notAfter: time.Now().Add(60 * 24 * time.Hour), expectObserved: true},
+		{name: "expiring", secretType: secretTypeTLS, notAfter: time.Now().Add(10 * 24 * time.Hour), expectedExpiring: 1, expectObserved: true},
+		{name: "expired", secretType: secretTypeTLS, notAfter: time.Now().Add(-time.Hour), expectedExpiring: 1, expectObserved: true},
+		{name: "opaque secret", secretType: "Opaque", notAfter: time.Now().Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &SecretHeader{
+				name:   "cert-expiry-" + tt.name,
+				config: &Config{SecretKey: "token", CertExpiryWarningDays: 30},
+			}
+			certPEM, _ := testCertificate(t, "api.example.com", tt.notAfter)
+			labels := []string{"middleware", handler.name, "secret", "default/api-tls"}
+
+			handler.observeCertificate("default/api-tls", tt.secretType, map[string]string{"tls.crt": certPEM})
+
+			notAfter := metrics.value(metricCertificateNotAfter, labels...)
+			if !tt.expectObserved {
+				if notAfter != 0 {
+					t.Errorf("Expected no certificate metrics, got expiry %v", notAfter)
+				}
+				return
+			}
+			if notAfter != float64(tt.notAfter.Unix()) {
+				t.Errorf("Expected expiry %d, got %v", tt.notAfter.Unix(), notAfter)
+			}
+			if got := metrics.value(metricCertificateExpiring, labels...); got != tt.expectedExpiring {
+				t.Errorf("Expected expiring %v, got %v", tt.expectedExpiring, got)
+			}
+		})
+	}
+}
+
+// TestServeHTTPCertExpiresHeader tests that the certificate expiry is sent to the upstream.
+func TestServeHTTPCertExpiresHeader(t *testing.T) {
+	notAfter := time.Date(2027, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		secretType string
+		expected   string
+	}{
+		{name: "TLS secret", secretType: secretTypeTLS, expected: "2027-06-01T12:00:00Z"},
+		{name: "opaque secret", secretType: "Opaque"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, _ := testCertificate(t, "api.example.com", notAfter)
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{
+					Type: tt.secretType,
+					Data: map[string]string{
+						"tls.crt": base64.StdEncoding.EncodeToString([]byte(certPEM)),
+						"token":   base64.StdEncoding.EncodeToString([]byte("my-secret-token")),
+					},
+				})
+			}))
+			defer mockServer.Close()
+
+			var captured http.Header
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Clone()
+				}),
+				name: "cert-expires-test",
+				config: &Config{
+					SecretName:        "api-tls",
+					SecretKey:         "token",
+					HeaderName:        "X-Auth-Token",
+					CertExpiresHeader: "X-Cert-Expires",
+					Namespace:         "default",
+					CacheTTL:          300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("X-Cert-Expires", "client-value")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rw.Code)
+			}
+			if got := captured.Get("X-Cert-Expires"); got != tt.expected {
+				t.Errorf("Expected X-Cert-Expires %q, got %q", tt.expected, got)
+			}
+			if got := captured.Get("X-Auth-Token"); got != "my-secret-token" {
+				t.Errorf("Expected the secret value to be injected, got %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Supported values for Config.CertificateField.
+const (
+	certFieldFingerprint = "fingerprint"
+	certFieldSPKIPin     = "spkiPin"
+	certFieldSubject     = "subject"
+	certFieldPublicKey   = "publicKey"
+)
+
+// validateCertificateField checks the certificateField settings and defaults secretKey to the
+// certificate of a kubernetes.io/tls secret.
+func validateCertificateField(config *Config) error {
+	if config.CertificateField == "" {
+		return nil
+	}
+	switch config.CertificateField {
+	case certFieldFingerprint, certFieldSPKIPin, certFieldSubject, certFieldPublicKey:
+	default:
+		return fmt.Errorf("certificateField must be %q, %q, %q or %q, got %q",
+			certFieldFingerprint, certFieldSPKIPin, certFieldSubject, certFieldPublicKey, config.CertificateField)
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("certificateField is only supported in mode %q", modeInject)
+	}
+	if config.SecretKeyPattern != "" {
+		return fmt.Errorf("certificateField cannot be combined with secretKeyPattern")
+	}
+	return nil
+}
+
+// certFields remembers the last certificate parsed, so a certificate is only parsed again
+// when the secret changes.
+type certFields struct {
+	mu   sync.Mutex
+	pem  string
+	cert *x509.Certificate
+}
+
+// certificate returns the first certificate in the PEM data.
+func (c *certFields) certificate(data string) (*x509.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cert != nil && data == c.pem {
+		return c.cert, nil
+	}
+	cert, err := parseLeafCertificate([]byte(data))
+	if err != nil {
+		return nil, err
+	}
+	c.pem, c.cert = data, cert
+	return cert, nil
+}
+
+// certificateField returns field of cert: the hex SHA-256 fingerprint, the base64 SHA-256
+// SPKI pin as used by HPKP, the subject distinguished name, or the PEM public key, which
+// spans several lines, without its delimiters and line breaks and URL-escaped like
+// Traefik's passTLSClientCert.
+func certificateField(cert *x509.Certificate, field string) (string, error) {
+	switch field {
+	case certFieldFingerprint:
+		sum := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(sum[:]), nil
+	case certFieldSPKIPin:
+		sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		return base64.StdEncoding.EncodeToString(sum[:]), nil
+	case certFieldSubject:
+		return cert.Subject.String(), nil
+	case certFieldPublicKey:
+		return url.QueryEscape(base64.StdEncoding.EncodeToString(cert.RawSubjectPublicKeyInfo)), nil
+	}
+	return "", fmt.Errorf("unknown certificate field %q", field)
+}
+
+// parseLeafCertificate parses the first CERTIFICATE block of PEM data, the leaf of a
+// kubernetes.io/tls chain.
+func parseLeafCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid certificate: %w", err)
+			}
+			return cert, nil
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed certificate for commonName valid until notAfter,
+// in PEM and parsed.
+func testCertificate(t *testing.T, commonName string, notAfter time.Time) (string, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Example"}},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), cert
+}
+
+// TestCertificateField tests the values derived from a certificate.
+func TestCertificateField(t *testing.T) {
+	certPEM, cert := testCertificate(t, "api.example.com", time.Now().Add(24*time.Hour))
+	fingerprint := sha256.Sum256(cert.Raw)
+	pin := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	// A chain is read from its leaf, and other blocks before it are skipped
+	chain := "-----BEGIN EC PARAMETERS-----\nBggqhkjOPQMBBw==\n-----END EC PARAMETERS-----\n" + certPEM + certPEM
+
+	tests := []struct {
+		name        string
+		data        string
+		field       string
+		expected    string
+		expectError bool
+	}{
+		{name: "fingerprint", data: certPEM, field: certFieldFingerprint, expected: hex.EncodeToString(fingerprint[:])},
+		{name: "spki pin", data: chain, field: certFieldSPKIPin, expected: base64.StdEncoding.EncodeToString(pin[:])},
+		{name: "subject", data: certPEM, field: certFieldSubject, expected: "CN=api.example.com,O=Example"},
+		{name: "public key", data: certPEM, field: certFieldPublicKey, expected: url.QueryEscape(base64.StdEncoding.EncodeToString(cert.RawSubjectPublicKeyInfo))},
+		{name: "not PEM", data: "not a certificate", field: certFieldSubject, expectError: true},
+		{name: "invalid certificate", data: "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n", field: certFieldSubject, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := parseLeafCertificate([]byte(tt.data))
+			var value string
+			if err == nil {
+				value, err = certificateField(cert, tt.field)
+			}
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+// TestServeHTTPCertificateField tests that the derived value is injected instead of the certificate.
+func TestServeHTTPCertificateField(t *testing.T) {
+	certPEM, cert := testCertificate(t, "api.example.com", time.Now().Add(24*time.Hour))
+	mockServer := mockK8sServer(t, map[string]string{"tls.crt": certPEM, "tls.key": "private"}, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:       "api-tls",
+		SecretKey:        "tls.crt",
+		CertificateField: certFieldSPKIPin,
+		HeaderName:       "X-Client-Cert-Pin",
+		Namespace:        "default",
+		CacheTTL:         300,
+	}
+	transforms, err := newValuePipeline(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-Client-Cert-Pin")
+		}),
+		name:   "cert-field-test",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:      &secretCache{ttl: 300 * time.Second},
+		transforms: transforms,
+	}
+
+	pin := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	for i := 0; i < 2; i++ {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rw.Code)
+		}
+		if expected := base64.StdEncoding.EncodeToString(pin[:]); captured != expected {
+			t.Errorf("Request %d: expected %q, got %q", i+1, expected, captured)
+		}
+	}
+}
+
+// TestValidateCertificateField tests certificateField configuration checks.
+func TestValidateCertificateField(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "disabled", config: &Config{Mode: modeValidate}},
+		{name: "fingerprint", config: &Config{CertificateField: certFieldFingerprint}},
+		{name: "unknown field", config: &Config{CertificateField: "issuer"}, expectError: true},
+		{name: "validate mode", config: &Config{CertificateField: certFieldSubject, Mode: modeValidate}, expectError: true},
+		{name: "key pattern", config: &Config{CertificateField: certFieldSubject, SecretKeyPattern: "(.+)"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCertificateField(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// validateAPIClientCertificate checks the apiClientCertFile and apiClientKeyFile settings.
+func validateAPIClientCertificate(config *Config) error {
+	if (config.APIClientCertFile == "") != (config.APIClientKeyFile == "") {
+		return fmt.Errorf("apiClientCertFile and apiClientKeyFile must be set together")
+	}
+	if config.APIClientCertFile != "" && config.APITokenSecretName != "" {
+		return fmt.Errorf("apiClientCertFile cannot be combined with apiTokenSecretName")
+	}
+	return nil
+}
+
+// clientCertificate is a TLS client certificate read from files and read again when they
+// change, so certificates renewed on disk, e.g. by cert-manager or a SPIFFE agent, are used
+// for new connections without a restart.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	version string
+	cert    *tls.Certificate
+}
+
+// get returns the current certificate. It is the GetClientCertificate hook of the API
+// client's TLS configuration.
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	version, err := fileVersion(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cert != nil && version == c.version {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API client certificate: %w", err)
+	}
+	c.cert, c.version = &cert, version
+	return c.cert, nil
+}
+
+// fileVersion identifies the contents of files by their size and modification time.
+func fileVersion(paths ...string) (string, error) {
+	version := ""
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		version += fmt.Sprintf("%s:%d:%d,", path, info.Size(), info.ModTime().UnixNano())
+	}
+	return version, nil
+}
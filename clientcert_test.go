@@ -0,0 +1,114 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCertificate writes a self-signed client certificate for commonName and its key
+// as PEM files in dir.
+func writeClientCertificate(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make a rewrite visible even on filesystems with coarse modification times
+	later := time.Now().Add(time.Duration(len(commonName)) * time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certFile, keyFile
+}
+
+// TestK8sClientCertificateAuth tests authenticating to the API server with a client
+// certificate that is read again after a renewal.
+func TestK8sClientCertificateAuth(t *testing.T) {
+	var subject, authorization string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject = r.TLS.PeerCertificates[0].Subject.CommonName
+		authorization = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{Data: map[string]string{}})
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	certFile, keyFile := writeClientCertificate(t, dir, "traefik")
+	tlsConfig, err := buildTLSConfig(&Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := newK8sClient(tlsConfig, &Config{APIClientCertFile: certFile, APIClientKeyFile: keyFile, APICAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if subject != "traefik" || authorization != "" {
+		t.Errorf("Expected certificate traefik without a token, got %q and %q", subject, authorization)
+	}
+
+	writeClientCertificate(t, dir, "traefik-renewed")
+	client.httpClient.CloseIdleConnections()
+	if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+		t.Fatal(err)
+	}
+	if subject != "traefik-renewed" {
+		t.Errorf("Expected the renewed certificate, got %q", subject)
+	}
+}
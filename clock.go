@@ -0,0 +1,26 @@
+package traefik_k8s_secret_header
+
+import "time"
+
+// Clock tells the time cached secrets are aged by. NewWithClient takes one, so tests and
+// embedding programs can expire cache entries without waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the time of the cache clock, or the system time without one.
+func (c *secretCache) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// since returns the time elapsed since t on the cache clock. Without a clock it keeps the
+// monotonic fast path of time.Since, as every cache lookup calls it.
+func (c *secretCache) since(t time.Time) time.Duration {
+	if c.clock == nil {
+		return time.Since(t)
+	}
+	return c.clock.Now().Sub(t)
+}
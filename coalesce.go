@@ -0,0 +1,76 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// readGroup shares a secret read between the requests needing the same secret at the same
+// time, so a cold or expired cache costs one read instead of one per request.
+type readGroup struct {
+	mu    sync.Mutex
+	calls map[string]*readCall
+}
+
+// readCall is a read in progress; done is closed once data/err are set.
+type readCall struct {
+	done chan struct{}
+	data map[string]string
+	err  error
+}
+
+// coalescedRead returns the result of read, run by the first request asking for cacheKey
+// while the others wait for it for up to CoalesceTimeout seconds. A waiting request that
+// times out fails like a failed read.
+func (s *SecretHeader) coalescedRead(ctx context.Context, cacheKey string, read func(ctx context.Context) (map[string]string, error)) (map[string]string, error) {
+	if s.config.CoalesceTimeout <= 0 {
+		return read(ctx)
+	}
+
+	g := &s.reads
+	g.mu.Lock()
+	if call, ok := g.calls[cacheKey]; ok {
+		g.mu.Unlock()
+		return s.waitRead(ctx, cacheKey, call)
+	}
+	call := &readCall{done: make(chan struct{})}
+	if g.calls == nil {
+		g.calls = make(map[string]*readCall)
+	}
+	g.calls[cacheKey] = call
+	g.mu.Unlock()
+
+	// Waiters are released even if the read panics, and then see it as failed
+	call.err = fmt.Errorf("the read of secret %s in progress did not complete", cacheKey)
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, cacheKey)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+
+	// The read is shared, so the request that happens to start it must not cancel it
+	call.data, call.err = read(context.Background())
+
+	return call.data, call.err
+}
+
+// waitRead waits for a read started by another request.
+func (s *SecretHeader) waitRead(ctx context.Context, cacheKey string, call *readCall) (map[string]string, error) {
+	timeout := time.Duration(s.config.CoalesceTimeout) * time.Second
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	s.debugf("Waiting for the read of secret %s in progress", cacheKey)
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-timer.C:
+		metrics.inc(metricCoalesceTimeouts, "middleware", s.name)
+		return nil, fmt.Errorf("timed out after %v waiting for the read of secret %s in progress", timeout, cacheKey)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,142 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPCoalescedReads tests that concurrent requests on a cold cache share one read.
+func TestServeHTTPCoalescedReads(t *testing.T) {
+	var reads int32
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reads, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{
+			Data: map[string]string{"api-key": base64.StdEncoding.EncodeToString([]byte("my-secret-token"))},
+		})
+	}))
+	defer mockServer.Close()
+
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if got := req.Header.Get("X-Api-Key"); got != "my-secret-token" {
+				t.Errorf("Expected the secret value, got %q", got)
+			}
+		}),
+		name: "coalesce-test",
+		config: &Config{
+			SecretName:      "my-secret",
+			SecretKey:       "api-key",
+			HeaderName:      "X-Api-Key",
+			Namespace:       "default",
+			CacheTTL:        300,
+			CoalesceTimeout: 5,
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if rw.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", rw.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&reads); got != 1 {
+		t.Errorf("Expected a single API read, got %d", got)
+	}
+}
+
+// TestCoalescedReadTimeout tests that a waiting request gives up after coalesceTimeout.
+func TestCoalescedReadTimeout(t *testing.T) {
+	handler := &SecretHeader{name: "coalesce-timeout-test", config: &Config{CoalesceTimeout: 1}}
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go handler.coalescedRead(context.Background(), "default/my-secret", func(ctx context.Context) (map[string]string, error) {
+		close(started)
+		<-release
+		return map[string]string{"api-key": "late"}, nil
+	})
+	<-started
+	defer close(release)
+
+	begin := time.Now()
+	_, err := handler.coalescedRead(context.Background(), "default/my-secret", func(ctx context.Context) (map[string]string, error) {
+		t.Error("Expected the read in progress to be shared")
+		return nil, nil
+	})
+	if err == nil {
+		t.Fatal("Expected a timeout error, got nil")
+	}
+	if waited := time.Since(begin); waited < time.Second || waited > 3*time.Second {
+		t.Errorf("Expected to wait about 1s, waited %v", waited)
+	}
+	if got := metrics.value(metricCoalesceTimeouts, "middleware", handler.name); got != 1 {
+		t.Errorf("Expected 1 coalesce timeout, got %v", got)
+	}
+}
+
+// TestCoalescedReadPanic tests that a panicking read releases its waiters and the next read.
+func TestCoalescedReadPanic(t *testing.T) {
+	handler := &SecretHeader{name: "coalesce-panic-test", config: &Config{CoalesceTimeout: 5}}
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	go func() {
+		defer func() { _ = recover() }()
+		handler.coalescedRead(context.Background(), "default/my-secret", func(ctx context.Context) (map[string]string, error) {
+			close(started)
+			<-release
+			panic("read failed")
+		})
+	}()
+	<-started
+
+	waited := make(chan error, 1)
+	go func() {
+		_, err := handler.coalescedRead(context.Background(), "default/my-secret", func(ctx context.Context) (map[string]string, error) {
+			t.Error("Expected the read in progress to be shared")
+			return nil, nil
+		})
+		waited <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // let the waiter join the read in progress
+	close(release)
+
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Error("Expected the waiter to see the panicked read as failed")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected the waiter to be released by the panicked read")
+	}
+
+	data, err := handler.coalescedRead(context.Background(), "default/my-secret", func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"api-key": "fresh"}, nil
+	})
+	if err != nil || data["api-key"] != "fresh" {
+		t.Errorf("Expected a new read after the panic, got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,69 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// compressedEncoding is the companion header value announcing a compressed header value.
+const compressedEncoding = "gzip+base64"
+
+// compressor gzips and base64-encodes oversized values, remembering the last result
+// so a cached secret is not recompressed on every request.
+type compressor struct {
+	mu     sync.Mutex
+	input  string
+	output string
+}
+
+// compress returns the gzip+base64 form of value.
+func (c *compressor) compress(value string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.output != "" && c.input == value {
+		return c.output, nil
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := zw.Write([]byte(value)); err != nil {
+		return "", fmt.Errorf("failed to compress value: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress value: %w", err)
+	}
+
+	c.input = value
+	c.output = base64.StdEncoding.EncodeToString(buf.Bytes())
+	return c.output, nil
+}
+
+// compressValue applies the opt-in compression to values above the configured threshold,
+// marking compressed requests with the companion encoding header.
+func (s *SecretHeader) compressValue(req *http.Request, value string) (string, error) {
+	if s.config.CompressThreshold <= 0 {
+		return value, nil
+	}
+
+	// The encoding header is ours to set; never trust a client-supplied one
+	req.Header.Del(s.config.CompressEncodingHeader)
+
+	if len(value) <= s.config.CompressThreshold {
+		return value, nil
+	}
+
+	compressed, err := s.compressor.compress(value)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set(s.config.CompressEncodingHeader, compressedEncoding)
+	return compressed, nil
+}
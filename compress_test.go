@@ -0,0 +1,119 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPCompression tests gzip+base64 encoding of oversized values.
+func TestServeHTTPCompression(t *testing.T) {
+	largeValue := strings.Repeat("eyJhbGciOiJSUzI1NiJ9.", 200)
+
+	tests := []struct {
+		name             string
+		value            string
+		threshold        int
+		expectCompressed bool
+	}{
+		{
+			name:      "compression disabled",
+			value:     largeValue,
+			threshold: 0,
+		},
+		{
+			name:      "small value is not compressed",
+			value:     "short-token",
+			threshold: 1024,
+		},
+		{
+			name:             "large value is compressed",
+			value:            largeValue,
+			threshold:        1024,
+			expectCompressed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"token": tt.value}, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:             "my-secret",
+				SecretKey:              "token",
+				HeaderName:             "X-Auth-Token",
+				Namespace:              "default",
+				CacheTTL:               300,
+				CompressThreshold:      tt.threshold,
+				CompressEncodingHeader: "X-K8s-Secret-Header-Encoding",
+			}
+
+			var capturedHeader, capturedEncoding string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				capturedHeader = req.Header.Get(config.HeaderName)
+				capturedEncoding = req.Header.Get(config.CompressEncodingHeader)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+				compressor: &compressor{},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			req.Header.Set(config.CompressEncodingHeader, "spoofed")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if !tt.expectCompressed {
+				if capturedHeader != tt.value {
+					t.Errorf("Expected uncompressed value, got %q", capturedHeader)
+				}
+				if tt.threshold > 0 && capturedEncoding != "" {
+					t.Errorf("Expected no encoding header, got %q", capturedEncoding)
+				}
+				return
+			}
+
+			if capturedEncoding != compressedEncoding {
+				t.Errorf("Expected encoding header %q, got %q", compressedEncoding, capturedEncoding)
+			}
+			if len(capturedHeader) >= len(tt.value) {
+				t.Errorf("Expected compressed value to be smaller, got %d >= %d bytes", len(capturedHeader), len(tt.value))
+			}
+
+			raw, err := base64.StdEncoding.DecodeString(capturedHeader)
+			if err != nil {
+				t.Fatalf("Failed to decode base64: %v", err)
+			}
+			zr, err := gzip.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatalf("Failed to open gzip stream: %v", err)
+			}
+			decoded, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatalf("Failed to decompress: %v", err)
+			}
+			if string(decoded) != tt.value {
+				t.Error("Decompressed value does not match the secret")
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package traefik_k8s_secret_header
+
+// ConfigSchema returns the JSON Schema (draft 2020-12) of the middleware configuration of this
+// plugin version, for linting middleware manifests before they are deployed.
+func ConfigSchema() string {
+	return configSchema
+}
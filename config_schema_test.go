@@ -0,0 +1,152 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// generateConfigSchema builds the JSON Schema of Config from its source: JSON names and types
+// from the struct, descriptions from the field comments and defaults from CreateConfig.
+func generateConfigSchema(t *testing.T) string {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "k8s_secret_header.go", nil, parser.ParseComments)
+	if err != nil {
+		t.Fatalf("Failed to parse k8s_secret_header.go: %v", err)
+	}
+
+	var fields []*ast.Field
+	ast.Inspect(file, func(n ast.Node) bool {
+		if spec, ok := n.(*ast.TypeSpec); ok && spec.Name.Name == "Config" {
+			fields = spec.Type.(*ast.StructType).Fields.List
+			return false
+		}
+		return true
+	})
+	if fields == nil {
+		t.Fatal("Config struct not found")
+	}
+
+	defaults := reflect.ValueOf(CreateConfig()).Elem()
+	configType := defaults.Type()
+	properties := make(map[string]interface{})
+	description, previousLine := "", 0
+	for _, field := range fields {
+		line := fset.Position(field.Pos()).Line
+		switch {
+		case field.Doc != nil:
+			description = strings.Join(strings.Fields(field.Doc.Text()), " ")
+		case field.Comment != nil:
+			description = strings.Join(strings.Fields(field.Comment.Text()), " ")
+		case line != previousLine+1:
+			description = ""
+		}
+		// An undocumented field directly below another shares its comment
+		previousLine = line
+
+		for _, name := range field.Names {
+			structField, ok := configType.FieldByName(name.Name)
+			if !ok {
+				t.Fatalf("Field %s not found on Config", name.Name)
+			}
+			jsonName := strings.Split(structField.Tag.Get("json"), ",")[0]
+
+			property := schemaType(t, structField.Type)
+			if description != "" {
+				property["description"] = description
+			}
+			if value := defaults.FieldByName(name.Name); !value.IsZero() {
+				property["default"] = value.Interface()
+			}
+			properties[jsonName] = property
+		}
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  "https://github.com/effecti-bot/traefik-k8s-secret-header/config.schema.json",
+		"title":                "traefik-k8s-secret-header middleware configuration",
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// schemaType maps a Config field type to its JSON Schema type.
+func schemaType(t *testing.T, typ reflect.Type) map[string]interface{} {
+	switch typ.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaType(t, typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaType(t, typ.Elem())}
+	}
+	t.Fatalf("No JSON Schema type for %s", typ)
+	return nil
+}
+
+// TestConfigSchemaUpToDate fails when config_schema_gen.go no longer matches Config. Run with
+// UPDATE_CONFIG_SCHEMA=1 to regenerate it.
+func TestConfigSchemaUpToDate(t *testing.T) {
+	generated := generateConfigSchema(t)
+	if strings.Contains(generated, "`") {
+		t.Fatal("Config comments cannot contain backquotes, the schema is stored in a raw string")
+	}
+
+	if os.Getenv("UPDATE_CONFIG_SCHEMA") != "" {
+		source := fmt.Sprintf(`// Code generated by TestConfigSchemaUpToDate with UPDATE_CONFIG_SCHEMA=1; DO NOT EDIT.
+
+package traefik_k8s_secret_header
+
+// configSchema is the JSON Schema of Config.
+const configSchema = %s
+`, "`"+generated+"`")
+		if err := os.WriteFile("config_schema_gen.go", []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	if configSchema != generated {
+		t.Fatal("config_schema_gen.go is out of date with Config, regenerate it with UPDATE_CONFIG_SCHEMA=1 go test -run TestConfigSchemaUpToDate")
+	}
+}
+
+// TestConfigSchema tests that the exported schema describes the plugin configuration.
+func TestConfigSchema(t *testing.T) {
+	var schema struct {
+		Type       string                            `json:"type"`
+		Properties map[string]map[string]interface{} `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(ConfigSchema()), &schema); err != nil {
+		t.Fatalf("ConfigSchema is not valid JSON: %v", err)
+	}
+
+	expected := map[string]string{"secretName": "string", "cacheTTL": "integer", "methods": "array", "mintClaims": "object", "signBody": "boolean"}
+	for name, typ := range expected {
+		if schema.Properties[name]["type"] != typ {
+			t.Errorf("Expected property %s of type %s, got %v", name, typ, schema.Properties[name])
+		}
+	}
+	if schema.Properties["cacheTTL"]["default"] != float64(300) {
+		t.Errorf("Expected cacheTTL default 300, got %v", schema.Properties["cacheTTL"]["default"])
+	}
+}
@@ -0,0 +1,342 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// configErrors collects every problem found in a configuration, so New reports them all at
+// once instead of one per attempt.
+type configErrors []error
+
+// Error lists the problems, e.g. "2 configuration problems: headerName ...; cacheTTL ...".
+func (e configErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d configuration problems: %s", len(e), strings.Join(messages, "; "))
+}
+
+// Unwrap returns the problems, for errors.Is and errors.As.
+func (e configErrors) Unwrap() []error {
+	return e
+}
+
+// add records err unless it is nil.
+func (e *configErrors) add(err error) {
+	if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// addf records a problem formatted like fmt.Errorf.
+func (e *configErrors) addf(format string, args ...interface{}) {
+	*e = append(*e, fmt.Errorf(format, args...))
+}
+
+// err returns nil without problems, the problem itself when there is only one, and all of
+// them otherwise.
+func (e configErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+// validateConfig checks the options that do not need the environment, filling in defaults
+// that depend on other options, and returns every problem found. Checks keep going after a
+// problem, so one mistake may be reported along with problems it causes.
+func validateConfig(config *Config) configErrors {
+	var problems configErrors
+
+	// serviceAccountToken mode mints its value instead of reading a secret
+	if config.SecretName == "" && config.Mode != modeServiceAccountToken {
+		problems.addf("secretName cannot be empty")
+	}
+	if config.SecretKey == "" && len(config.SecretKeys) == 0 && config.SecretKeyPattern == "" && !usesBasicAuthSecret(config) &&
+		config.Mode != modeServiceAccountToken && config.Mode != modeEnvelope {
+		problems.addf("secretKey cannot be empty")
+	}
+	if len(config.SecretKeys) > 0 {
+		switch config.Mode {
+		case "", modeInject, modeValidate:
+		default:
+			problems.addf("secretKeys is only supported in modes %q and %q", modeInject, modeValidate)
+		}
+		if config.Mode != modeValidate && config.SecretKey != "" {
+			problems.addf("secretKeys cannot be combined with secretKey")
+		}
+		if config.SecretKeyPattern != "" {
+			problems.addf("secretKeys cannot be combined with secretKeyPattern")
+		}
+		if config.JWTClaim != "" {
+			problems.addf("secretKeys cannot be combined with jwtClaim")
+		}
+	}
+	if len(config.JWTClaimHeaders) > 0 && config.Mode != modeVerifyJWT {
+		problems.addf("jwtClaimHeaders is only supported in mode %q", modeVerifyJWT)
+	}
+	if config.HeaderName == "" {
+		problems.addf("headerName cannot be empty")
+	}
+	validateHeaderNames(config, &problems)
+
+	problems.add(validateNamespaces(config))
+
+	// Default namespace to "default" if not specified
+	if config.Namespace == "" {
+		config.Namespace = "default"
+	}
+
+	for i, method := range config.Methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			problems.addf("methods cannot contain an empty entry")
+		}
+		config.Methods[i] = method
+	}
+
+	if config.TrustedHeadersOnly && config.PreserveExistingHeader {
+		problems.addf("trustedHeadersOnly and preserveExistingHeader cannot both be set")
+	}
+
+	if config.RejectExistingHeader {
+		if config.PreserveExistingHeader {
+			problems.addf("rejectExistingHeader and preserveExistingHeader cannot both be set")
+		}
+		switch config.RejectStatus {
+		case 0:
+			config.RejectStatus = http.StatusForbidden
+		case http.StatusBadRequest, http.StatusForbidden:
+		default:
+			problems.addf("rejectStatus must be 400 or 403, got %d", config.RejectStatus)
+		}
+	}
+
+	if config.CacheTTL < 0 {
+		problems.addf("cacheTTL cannot be negative")
+	}
+	if config.MaxStale < 0 {
+		problems.addf("maxStale cannot be negative")
+	}
+	if config.CoalesceTimeout < 0 {
+		problems.addf("coalesceTimeout cannot be negative")
+	}
+	if config.RetryMaxBodyBytes < 0 {
+		problems.addf("retryMaxBodyBytes cannot be negative")
+	}
+	overridden := make([]string, 0, len(config.CacheTTLOverrides))
+	for secret := range config.CacheTTLOverrides {
+		overridden = append(overridden, secret)
+	}
+	sort.Strings(overridden)
+	for _, secret := range overridden {
+		if secret == "" || strings.HasPrefix(secret, "/") || strings.HasSuffix(secret, "/") {
+			problems.addf("cacheTTLOverrides has an invalid secret %q, expected name or namespace/name", secret)
+		}
+		if config.CacheTTLOverrides[secret] <= 0 {
+			problems.addf("cacheTTLOverrides[%s] must be positive, got %d", secret, config.CacheTTLOverrides[secret])
+		}
+	}
+	if config.RetryAfter < 0 {
+		problems.addf("retryAfter cannot be negative")
+	}
+	if config.CompressThreshold < 0 {
+		problems.addf("compressThreshold cannot be negative")
+	}
+	if config.CompressThreshold > 0 && config.CompressEncodingHeader == "" {
+		problems.addf("compressEncodingHeader cannot be empty when compressThreshold is set")
+	}
+	if config.CacheMaxEntries < 0 {
+		problems.addf("cacheMaxEntries cannot be negative")
+	}
+	if config.CacheTTLJitter < 0 || config.CacheTTLJitter > 50 {
+		problems.addf("cacheTTLJitter must be between 0 and 50 percent, got %d", config.CacheTTLJitter)
+	}
+	if config.APIMaxConnectionAge < 0 {
+		problems.addf("apiMaxConnectionAge cannot be negative")
+	}
+
+	problems.add(validateClaimSelection(config))
+	problems.add(validateHostSelection(config))
+
+	if config.APITokenSecretName != "" && config.APITokenSecretKey == "" {
+		problems.addf("apiTokenSecretKey cannot be empty when apiTokenSecretName is set")
+	}
+
+	validateMode(config, &problems)
+
+	problems.add(validateSource(config))
+	problems.add(validateFallbackConfig(config))
+	if config.Source != "" && config.Source != sourceKubernetes {
+		if config.Mode == modeGenerate {
+			problems.addf("mode %q stores values in Kubernetes secrets and cannot use source %q", modeGenerate, config.Source)
+		}
+		if config.APITokenSecretName != "" {
+			problems.addf("apiTokenSecretName cannot be used with source %q", config.Source)
+		}
+	}
+
+	if len(config.Transforms) > 0 && config.Mode != "" && config.Mode != modeInject && config.Mode != modeSubstitute {
+		problems.addf("transforms are only supported in modes %q and %q", modeInject, modeSubstitute)
+	}
+	problems.add(validateCertificateField(config))
+	problems.add(validateCertExpiry(config))
+	problems.add(validateBasicAuthSecret(config))
+	problems.add(validateDockerRegistryConfig(config))
+	problems.add(validateSubstituteConfig(config))
+	problems.add(validateRefreshOnAuthFailure(config))
+	problems.add(validateUpstreamTLS(config))
+	problems.add(validateWarmupConfig(config))
+	problems.add(validatePrefetch(config))
+	problems.add(validateRBACPreflight(config))
+	problems.add(validateAuditLog(config))
+	problems.add(validateFailureEvents(config))
+	problems.add(validateRotationWebhook(config))
+	problems.add(validateOptInAnnotation(config))
+	problems.add(validateAPIClientCertificate(config))
+	problems.add(validateAPIProxyURL(config))
+	problems.add(validateAPIImpersonation(config))
+	problems.add(validateAPIAttribution(config))
+	problems.add(validateAPITransport(config))
+	problems.add(validateStatsD(config))
+	problems.add(validateSecretKeyAnnotation(config))
+	problems.add(validateDryRun(config))
+	problems.add(validateEnvFile(config))
+	problems.add(validateEnvelopeConfig(config))
+	problems.add(validateKubeconfig(config))
+	problems.add(validateWriteBack(config))
+	return problems
+}
+
+// validateMode checks the options specific to config.Mode.
+func validateMode(config *Config, problems *configErrors) {
+	switch config.Mode {
+	case "", modeInject, modeDockerRegistry, modeSubstitute:
+	case modeGenerate:
+		if config.JWTClaim != "" {
+			problems.addf("jwtClaim cannot be used with mode %q", modeGenerate)
+		}
+		if config.GenerateInterval <= 0 {
+			problems.addf("generateInterval must be positive")
+		}
+		if config.GenerateBytes < 16 {
+			problems.addf("generateBytes must be at least 16")
+		}
+	case modeValidate:
+		if config.PreserveExistingHeader || config.AppendHeader || config.TrustedHeadersOnly ||
+			config.RejectExistingHeader || config.CompressThreshold > 0 {
+			problems.addf("mode %q cannot be combined with header injection options", modeValidate)
+		}
+	case modeHMACSign, modeHMACVerify:
+		if config.SignatureTimestampHeader == "" {
+			problems.addf("signatureTimestampHeader cannot be empty in mode %q", config.Mode)
+		}
+		if config.SignBody && config.SignatureMaxBodyBytes <= 0 {
+			problems.addf("signatureMaxBodyBytes must be positive when signBody is set")
+		}
+		problems.add(validateSignatureComponents(config.SignatureComponents))
+		for _, component := range config.SignatureComponents {
+			if component == "nonce" && config.SignatureNonceHeader == "" {
+				problems.addf("signatureNonceHeader cannot be empty when signing a nonce")
+			}
+		}
+		if config.Mode == modeHMACVerify {
+			if config.SignatureMaxSkew <= 0 {
+				problems.addf("signatureMaxSkew must be positive")
+			}
+			if config.PreserveExistingHeader || config.AppendHeader || config.TrustedHeadersOnly ||
+				config.RejectExistingHeader || config.CompressThreshold > 0 {
+				problems.addf("mode %q cannot be combined with header injection options", modeHMACVerify)
+			}
+		} else if config.PreserveExistingHeader || config.AppendHeader || config.CompressThreshold > 0 {
+			problems.addf("mode %q cannot be combined with preserveExistingHeader, appendHeader or compressThreshold", modeHMACSign)
+		}
+	case modeMintJWT:
+		problems.add(validateMintConfig(config))
+	case modeVerifyJWT:
+		problems.add(validateVerifyJWTConfig(config))
+	case modeOAuth2:
+		problems.add(validateOAuth2Config(config))
+	case modeServiceAccountToken:
+		problems.add(validateServiceAccountTokenConfig(config))
+	case modeEnvelope:
+	case modeSigV4:
+		if config.AWSRegion == "" || config.AWSService == "" {
+			problems.addf("awsRegion and awsService are required in mode %q", modeSigV4)
+		}
+		if config.SignatureMaxBodyBytes <= 0 {
+			problems.addf("signatureMaxBodyBytes must be positive in mode %q", modeSigV4)
+		}
+		if config.JWTClaim != "" || config.PreserveExistingHeader || config.AppendHeader || config.CompressThreshold > 0 {
+			problems.addf("mode %q cannot be combined with jwtClaim, preserveExistingHeader, appendHeader or compressThreshold", modeSigV4)
+		}
+	default:
+		problems.addf("unknown mode %q", config.Mode)
+	}
+}
+
+// validateHeaderNames checks that every configured header name is a valid HTTP field name.
+// A {{ .Key }} placeholder in headerName is checked as the letters it is replaced with.
+func validateHeaderNames(config *Config, problems *configErrors) {
+	check := func(option, name string) {
+		if name != "" && !validHeaderName(name) {
+			problems.addf("%s: invalid header name %q", option, name)
+		}
+	}
+
+	check("headerName", keyPlaceholder.ReplaceAllString(config.HeaderName, "Key"))
+	check("previousHeaderName", config.PreviousHeaderName)
+	check("basicAuthUsernameHeader", config.BasicAuthUsernameHeader)
+	check("certExpiresHeader", config.CertExpiresHeader)
+	check("jwtHeader", config.JWTHeader)
+	check("secretNameHeader", config.SecretNameHeader)
+	check("signatureTimestampHeader", config.SignatureTimestampHeader)
+	check("signatureNonceHeader", config.SignatureNonceHeader)
+	check("retryMarkerHeader", config.RetryMarkerHeader)
+	check("errorCodeHeader", config.ErrorCodeHeader)
+	check("apiAttributionHeader", config.APIAttributionHeader)
+	check("compressEncodingHeader", config.CompressEncodingHeader)
+	check("clusterNameHeader", config.ClusterNameHeader)
+	check("clusterRegionHeader", config.ClusterRegionHeader)
+	for _, name := range config.JWTClaimHeaders {
+		check("jwtClaimHeaders", name)
+	}
+	for name := range config.InstanceHeaders {
+		check("instanceHeaders", name)
+	}
+	for _, name := range config.StripHeaders {
+		check("stripHeaders", name)
+	}
+	for _, name := range config.StripResponseHeaders {
+		check("stripResponseHeaders", name)
+	}
+	for _, name := range config.WarmupHeaders {
+		check("warmupHeaders", name)
+	}
+	for _, name := range config.EnvFileHeaders {
+		check("envFileHeaders", name)
+	}
+}
+
+// validHeaderName reports whether name is an HTTP field name, a token of RFC 9110.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
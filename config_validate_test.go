@@ -0,0 +1,164 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestValidateConfig tests that every configuration problem is reported, not only the first.
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		expected []string
+	}{
+		{
+			name:   "valid",
+			config: &Config{SecretName: "api-token", SecretKey: "token", HeaderName: "X-Api-Key"},
+		},
+		{
+			name:   "key placeholder in header name",
+			config: &Config{SecretName: "api-token", SecretKeyPattern: "partner-(.+)", HeaderName: "X-{{ .Key }}-Api-Key"},
+		},
+		{
+			name: "several problems",
+			config: &Config{
+				SecretKey:              "token",
+				HeaderName:             "X Api Key",
+				CacheTTL:               -1,
+				TrustedHeadersOnly:     true,
+				PreserveExistingHeader: true,
+				Mode:                   "encrypt",
+			},
+			expected: []string{
+				"secretName cannot be empty",
+				`headerName: invalid header name "X Api Key"`,
+				"trustedHeadersOnly and preserveExistingHeader cannot both be set",
+				"cacheTTL cannot be negative",
+				`unknown mode "encrypt"`,
+			},
+		},
+		{
+			name:   "fallback key list",
+			config: &Config{SecretName: "api-token", SecretKeys: []string{"token", "api-key"}, HeaderName: "X-Api-Key"},
+		},
+		{
+			name: "fallback key list problems",
+			config: &Config{
+				SecretName: "api-token",
+				SecretKey:  "token",
+				SecretKeys: []string{"api-key"},
+				HeaderName: "Authorization",
+				Mode:       "substitute",
+			},
+			expected: []string{
+				`secretKeys is only supported in modes "inject" and "validate"`,
+				"secretKeys cannot be combined with secretKey",
+			},
+		},
+		{
+			name: "header name lists",
+			config: &Config{
+				SecretName:    "api-token",
+				SecretKey:     "token",
+				HeaderName:    "X-Api-Key",
+				StripHeaders:  []string{"X-Internal", "X-Bad:"},
+				WarmupHeaders: []string{"X-Warmup(1)"},
+			},
+			expected: []string{
+				`stripHeaders: invalid header name "X-Bad:"`,
+				`warmupHeaders: invalid header name "X-Warmup(1)"`,
+			},
+		},
+		{
+			name: "cache TTL overrides",
+			config: &Config{
+				SecretName:        "api-token",
+				SecretKey:         "token",
+				HeaderName:        "X-Api-Key",
+				CacheTTLOverrides: map[string]int{"default/oauth-token": 30, "static-key": 0, "default/": 60},
+			},
+			expected: []string{
+				`cacheTTLOverrides has an invalid secret "default/", expected name or namespace/name`,
+				"cacheTTLOverrides[static-key] must be positive, got 0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := validateConfig(tt.config)
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("Expected %d problems, got %d: %v", len(tt.expected), len(problems), problems)
+			}
+			for i, expected := range tt.expected {
+				if got := problems[i].Error(); got != expected {
+					t.Errorf("Problem %d: expected %q, got %q", i, expected, got)
+				}
+			}
+		})
+	}
+}
+
+// TestNewAggregatedErrors tests that New reports all problems in one error.
+func TestNewAggregatedErrors(t *testing.T) {
+	config := CreateConfig()
+	config.SecretName = "api-token"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Api-Key"
+	config.RetryAfter = -1
+	config.CacheTTLJitter = 80
+	config.ValuePattern = "("
+
+	_, err := New(context.Background(), http.NotFoundHandler(), config, "aggregate-test")
+	var problems configErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected configErrors, got %v", err)
+	}
+	if len(problems) != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", len(problems), err)
+	}
+	if !strings.HasPrefix(err.Error(), "3 configuration problems: retryAfter cannot be negative; ") {
+		t.Errorf("Unexpected error message %q", err.Error())
+	}
+}
+
+// TestConfigErrorsErr tests that a single problem is returned as is.
+func TestConfigErrorsErr(t *testing.T) {
+	var problems configErrors
+	if err := problems.err(); err != nil {
+		t.Errorf("Expected nil without problems, got %v", err)
+	}
+	problems.add(nil)
+	single := errors.New("secretName cannot be empty")
+	problems.add(single)
+	if err := problems.err(); err != single {
+		t.Errorf("Expected the single problem, got %v", err)
+	}
+}
+
+// TestValidHeaderName tests HTTP field name syntax.
+func TestValidHeaderName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected bool
+	}{
+		{name: "Authorization", expected: true},
+		{name: "X-Api-Key_2", expected: true},
+		{name: "x.custom!header", expected: true},
+		{name: ""},
+		{name: "X Api"},
+		{name: "X-Api:"},
+		{name: "Über"},
+		{name: "X-Api\n"},
+	}
+
+	for _, tt := range tests {
+		if got := validHeaderName(tt.name); got != tt.expected {
+			t.Errorf("validHeaderName(%q) = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+)
+
+// debugHeader is the response header describing how the injected value was obtained.
+const debugHeader = "X-K8s-Secret-Header-Debug"
+
+// wantsDebugHeader reports whether the response to req carries the debug header: debug must
+// be enabled and the client be in adminAllowedCIDRs.
+func (s *SecretHeader) wantsDebugHeader(req *http.Request) bool {
+	return s.config.Debug && s.admins.allows(req)
+}
+
+// debugHeaderValue describes a value injected from the secret cached under cacheKey, e.g.
+// "cache=hit; resourceVersion=4711; sha256=9f86d081". Only a prefix of the value's hash is
+// included, enough to compare it with the secret without revealing it.
+func (s *SecretHeader) debugHeaderValue(cacheKey string, hit bool, value string) string {
+	cache := "miss"
+	if hit {
+		cache = "hit"
+	}
+	version := "unknown"
+	if entry, ok := s.cache.load(cacheKey); ok && entry.version != "" {
+		version = entry.version
+	}
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("cache=%s; resourceVersion=%s; sha256=%s", cache, version, hex.EncodeToString(sum[:4]))
+}
@@ -0,0 +1,81 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPDebugHeader tests the debug response header and its client allowlist.
+func TestServeHTTPDebugHeader(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{
+			Metadata: k8sObjectMeta{ResourceVersion: "4711"},
+			Data:     map[string]string{"token": base64.StdEncoding.EncodeToString([]byte("test"))},
+		})
+	}))
+	defer mockServer.Close()
+
+	admins, err := newIPAllowlist([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		debug      bool
+		remoteAddr string
+		expected   []string
+	}{
+		{
+			name:       "allowed client",
+			debug:      true,
+			remoteAddr: "10.1.2.3:4711",
+			expected: []string{
+				"cache=miss; resourceVersion=4711; sha256=9f86d081",
+				"cache=hit; resourceVersion=4711; sha256=9f86d081",
+			},
+		},
+		{name: "client outside the allowlist", debug: true, remoteAddr: "192.0.2.1:4711", expected: []string{"", ""}},
+		{name: "debug disabled", remoteAddr: "10.1.2.3:4711", expected: []string{"", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+				name: "test-middleware",
+				config: &Config{
+					SecretName: "my-secret",
+					SecretKey:  "token",
+					HeaderName: "X-Auth-Token",
+					Namespace:  "default",
+					CacheTTL:   300,
+					Debug:      tt.debug,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:  &secretCache{ttl: 300 * time.Second},
+				admins: admins,
+			}
+
+			for i, expected := range tt.expected {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+				req.RemoteAddr = tt.remoteAddr
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if got := rw.Header().Get(debugHeader); got != expected {
+					t.Errorf("Request %d: expected debug header %q, got %q", i+1, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// dryRunLog remembers the last value hash logged in dry-run mode, so a value is logged once
+// per change rather than on every request.
+type dryRunLog struct {
+	mu   sync.Mutex
+	last string
+}
+
+// changed records hash and reports whether it differs from the previous one.
+func (d *dryRunLog) changed(hash string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if hash == d.last {
+		return false
+	}
+	d.last = hash
+	return true
+}
+
+// validateDryRun checks the dryRun settings: only a fixed secret can be injected without
+// touching the request.
+func validateDryRun(config *Config) error {
+	if !config.DryRun {
+		return nil
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("dryRun is only supported in mode %q", modeInject)
+	}
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || usesHostPlaceholder(config) || config.SecretKeyPattern != "" {
+		return fmt.Errorf("dryRun cannot be combined with jwtClaim, secretNameHeader, {{ .Host }} or secretKeyPattern")
+	}
+	return nil
+}
+
+// serveDryRun reads the value that would be injected and records the outcome, then forwards
+// the request unchanged, whatever the outcome.
+func (s *SecretHeader) serveDryRun(rw http.ResponseWriter, req *http.Request) {
+	if !s.methodAllowed(req.Method) {
+		s.next.ServeHTTP(rw, req)
+		return
+	}
+
+	value, err := s.getValue(req.Context(), s.config.SecretName, s.config.SecretKey)
+	if err == nil {
+		value, err = s.headerValue(value)
+	}
+	if err == nil {
+		value, err = s.checkValue(value, s.config.SecretName, s.config.SecretKey)
+	}
+	if err != nil {
+		metrics.inc(metricDryRunRequests, "middleware", s.name, "result", "error")
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] [dry run] Request would fail: %v\n", err)
+		s.next.ServeHTTP(rw, req)
+		return
+	}
+
+	metrics.inc(metricDryRunRequests, "middleware", s.name, "result", "inject")
+	sum := sha256.Sum256([]byte(s.config.ValuePrefix + value))
+	if hash := hex.EncodeToString(sum[:4]); s.dryRun.changed(hash) {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] [dry run] Would set %s from secret %s/%s key %s (sha256=%s)\n",
+			s.config.HeaderName, s.config.Namespace, s.config.SecretName, s.config.SecretKey, hash)
+	}
+	s.next.ServeHTTP(rw, req)
+}
@@ -0,0 +1,93 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPDryRun tests that a dry run reads the secret but forwards requests unchanged.
+func TestServeHTTPDryRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		secretExists bool
+		result       string
+	}{
+		{name: "value found", secretExists: true, result: "inject"},
+		{name: "secret missing", secretExists: false, result: "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"token": "my-secret-token"}, tt.secretExists)
+			defer mockServer.Close()
+
+			var captured http.Header
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Clone()
+				}),
+				name: "dry-run-test",
+				config: &Config{
+					SecretName:           "my-secret",
+					SecretKey:            "token",
+					HeaderName:           "X-Auth-Token",
+					Namespace:            "default",
+					CacheTTL:             300,
+					RejectExistingHeader: true,
+					DryRun:               true,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+			before := metrics.value(metricDryRunRequests, "middleware", "dry-run-test", "result", tt.result)
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Header.Set("X-Auth-Token", "client-value")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK || captured == nil {
+				t.Fatalf("Expected the request to be forwarded, got status %d", rw.Code)
+			}
+			if got := captured.Get("X-Auth-Token"); got != "client-value" {
+				t.Errorf("Expected the request headers to be untouched, got %q", got)
+			}
+			if got := metrics.value(metricDryRunRequests, "middleware", "dry-run-test", "result", tt.result) - before; got != 1 {
+				t.Errorf("Expected 1 %s dry run to be counted, got %v", tt.result, got)
+			}
+		})
+	}
+}
+
+// TestValidateDryRun tests dryRun configuration checks.
+func TestValidateDryRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "disabled", config: &Config{SecretName: "api-token", Mode: modeValidate}},
+		{name: "inject", config: &Config{SecretName: "api-token", DryRun: true}},
+		{name: "validate mode", config: &Config{SecretName: "api-token", Mode: modeValidate, DryRun: true}, expectError: true},
+		{name: "jwt claim", config: &Config{SecretName: "{{ .Claim }}", JWTClaim: "org", DryRun: true}, expectError: true},
+		{name: "key pattern", config: &Config{SecretName: "api-token", SecretKeyPattern: "partner-(.+)", DryRun: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDryRun(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
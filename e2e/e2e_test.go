@@ -0,0 +1,337 @@
+//go:build e2e
+
+// Package e2e runs the plugin inside a real Traefik (local plugin mode) against a fake
+// Kubernetes API and an echo backend, all started with docker compose.
+//
+// Run with:
+//
+//	go test -tags e2e -v ./e2e/...
+package e2e
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	composeProject = "k8s-secret-header-e2e"
+	httpAddr       = "http://127.0.0.1:18080"
+	controlAddr    = "http://127.0.0.1:18081"
+)
+
+// dynamicConfigTemplate is the Traefik file-provider configuration; %s is the injected header name.
+const dynamicConfigTemplate = `http:
+  routers:
+    whoami:
+      rule: Host(` + "`whoami.localhost`" + `)
+      entryPoints: [web]
+      middlewares: [secret-header]
+      service: whoami
+    missing:
+      rule: Host(` + "`missing.localhost`" + `)
+      entryPoints: [web]
+      middlewares: [missing-secret]
+      service: whoami
+  middlewares:
+    secret-header:
+      plugin:
+        k8s-secret-header:
+          secretName: e2e-credentials
+          secretKey: token
+          headerName: %s
+          namespace: default
+          cacheTTL: 1
+    missing-secret:
+      plugin:
+        k8s-secret-header:
+          secretName: does-not-exist
+          secretKey: token
+          headerName: X-Auth-Token
+          namespace: default
+  services:
+    whoami:
+      loadBalancer:
+        servers:
+          - url: http://whoami:80
+`
+
+var dynamicDir string
+
+func TestMain(m *testing.M) {
+	workDir, err := os.MkdirTemp("", "k8s-secret-header-e2e-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create work dir: %v\n", err)
+		os.Exit(1)
+	}
+
+	env, err := prepare(workDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to prepare e2e environment: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := compose(env, "up", "-d"); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to start e2e environment: %v\n", err)
+		compose(env, "down", "-v")
+		os.Exit(1)
+	}
+
+	code := 1
+	if err := seed(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to seed fake Kubernetes API: %v\n", err)
+	} else {
+		code = m.Run()
+	}
+
+	if code != 0 {
+		compose(env, "logs", "traefik", "mock-k8s")
+	}
+	compose(env, "down", "-v")
+	os.RemoveAll(workDir)
+	os.Exit(code)
+}
+
+// prepare writes certificates, the service account files and the dynamic configuration,
+// returning the environment docker compose needs to mount them.
+func prepare(workDir string) ([]string, error) {
+	certsDir := filepath.Join(workDir, "certs")
+	saDir := filepath.Join(workDir, "serviceaccount")
+	dynamicDir = filepath.Join(workDir, "dynamic")
+	for _, dir := range []string{certsDir, saDir, dynamicDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	caPEM, certPEM, keyPEM, err := generateCertificates("mock-k8s")
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		filepath.Join(certsDir, "tls.crt"): certPEM,
+		filepath.Join(certsDir, "tls.key"): keyPEM,
+		filepath.Join(saDir, "ca.crt"):     caPEM,
+		filepath.Join(saDir, "token"):      []byte("e2e-token"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, content, 0o644); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeDynamicConfig("X-Auth-Token"); err != nil {
+		return nil, err
+	}
+
+	return append(os.Environ(),
+		"E2E_CERTS_DIR="+certsDir,
+		"E2E_SERVICEACCOUNT_DIR="+saDir,
+		"E2E_DYNAMIC_DIR="+dynamicDir,
+	), nil
+}
+
+// generateCertificates creates a throwaway CA and a server certificate for host.
+func generateCertificates(host string) (caPEM, certPEM, keyPEM []byte, err error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "k8s-secret-header e2e CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serverTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	caPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: serverKeyDER})
+	return caPEM, certPEM, keyPEM, nil
+}
+
+// compose runs docker compose for the e2e project.
+func compose(env []string, args ...string) error {
+	cmd := exec.Command("docker", append([]string{"compose", "-p", composeProject, "-f", "docker-compose.yml"}, args...)...)
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// writeDynamicConfig (re)writes the Traefik dynamic configuration, triggering a reload.
+func writeDynamicConfig(headerName string) error {
+	content := fmt.Sprintf(dynamicConfigTemplate, headerName)
+	return os.WriteFile(filepath.Join(dynamicDir, "dynamic.yml"), []byte(content), 0o644)
+}
+
+// seed waits for the control API and stores the initial secret.
+func seed() error {
+	deadline := time.Now().Add(3 * time.Minute)
+	for {
+		err := putSecret("default", "e2e-credentials", map[string]string{"token": "initial-token"})
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// putSecret creates or replaces a secret in the fake Kubernetes API.
+func putSecret(namespace, name string, data map[string]string) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/secrets/%s/%s", controlAddr, namespace, name), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("control API returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// get sends a request through Traefik to the given virtual host and returns status and body.
+// whoami echoes the request it received, headers included.
+func get(host string) (int, string, error) {
+	req, err := http.NewRequest(http.MethodGet, httpAddr+"/", nil)
+	if err != nil {
+		return 0, "", err
+	}
+	req.Host = host
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body), err
+}
+
+// eventually retries check until it succeeds or the timeout expires.
+func eventually(t *testing.T, timeout time.Duration, check func() error) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// expectEcho returns a check asserting the backend received the header line.
+func expectEcho(host, headerLine string) func() error {
+	return func() error {
+		status, body, err := get(host)
+		if err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return fmt.Errorf("expected status 200, got %d", status)
+		}
+		if !strings.Contains(body, headerLine) {
+			return fmt.Errorf("expected backend to receive %q, got:\n%s", headerLine, body)
+		}
+		return nil
+	}
+}
+
+// TestHeaderInjected tests that the backend receives the secret value through Traefik.
+func TestHeaderInjected(t *testing.T) {
+	eventually(t, 3*time.Minute, expectEcho("whoami.localhost", "X-Auth-Token: initial-token"))
+}
+
+// TestMissingSecret tests that a middleware pointing at a missing secret fails closed.
+func TestMissingSecret(t *testing.T) {
+	eventually(t, time.Minute, func() error {
+		status, _, err := get("missing.localhost")
+		if err != nil {
+			return err
+		}
+		if status != http.StatusInternalServerError {
+			return fmt.Errorf("expected status 500, got %d", status)
+		}
+		return nil
+	})
+}
+
+// TestSecretRotation tests that a rotated secret reaches the backend once the cache expires.
+func TestSecretRotation(t *testing.T) {
+	if err := putSecret("default", "e2e-credentials", map[string]string{"token": "rotated-token"}); err != nil {
+		t.Fatalf("Failed to rotate secret: %v", err)
+	}
+	defer putSecret("default", "e2e-credentials", map[string]string{"token": "initial-token"})
+
+	eventually(t, 30*time.Second, expectEcho("whoami.localhost", "X-Auth-Token: rotated-token"))
+}
+
+// TestConfigReload tests that a dynamic configuration change rebuilds the middleware.
+func TestConfigReload(t *testing.T) {
+	if err := writeDynamicConfig("X-Reloaded-Token"); err != nil {
+		t.Fatalf("Failed to rewrite dynamic config: %v", err)
+	}
+	defer writeDynamicConfig("X-Auth-Token")
+
+	eventually(t, time.Minute, expectEcho("whoami.localhost", "X-Reloaded-Token: initial-token"))
+}
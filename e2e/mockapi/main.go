@@ -0,0 +1,123 @@
+// Command mockapi is a minimal stand-in for the Kubernetes secrets API used by the e2e tests.
+//
+// It serves GET /api/v1/namespaces/{namespace}/secrets/{name} over TLS, authenticated with a
+// static bearer token, and exposes a plain-HTTP control API so tests can create or rotate
+// secrets and count API reads:
+//
+//	PUT /secrets/{namespace}/{name}   body: {"key": "plain value", ...}
+//	DELETE /secrets/{namespace}/{name}
+//	GET /stats                        body: {"reads": N}
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type store struct {
+	mu      sync.RWMutex
+	secrets map[string]map[string]string
+	version int64
+	reads   int64
+}
+
+func main() {
+	listen := flag.String("listen", ":6443", "TLS address of the fake Kubernetes API")
+	control := flag.String("control", ":8081", "plain HTTP address of the control API")
+	certFile := flag.String("cert", "/certs/tls.crt", "server certificate")
+	keyFile := flag.String("key", "/certs/tls.key", "server private key")
+	token := flag.String("token", "e2e-token", "bearer token accepted by the fake API")
+	flag.Parse()
+
+	s := &store{secrets: make(map[string]map[string]string)}
+
+	api := http.NewServeMux()
+	api.HandleFunc("/api/v1/namespaces/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+*token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		// /api/v1/namespaces/{namespace}/secrets/{name}
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+		if r.Method != http.MethodGet || len(parts) != 3 || parts[1] != "secrets" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		atomic.AddInt64(&s.reads, 1)
+
+		s.mu.RLock()
+		data, ok := s.secrets[parts[0]+"/"+parts[2]]
+		version := s.version
+		s.mu.RUnlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+
+		encoded := make(map[string]string, len(data))
+		for k, v := range data {
+			encoded[k] = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name":            parts[2],
+				"namespace":       parts[0],
+				"resourceVersion": strconv.FormatInt(version, 10),
+			},
+			"type": "Opaque",
+			"data": encoded,
+		})
+	})
+
+	ctl := http.NewServeMux()
+	ctl.HandleFunc("/secrets/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/secrets/")
+		if strings.Count(id, "/") != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var data map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.mu.Lock()
+			s.secrets[id] = data
+			s.version++
+			s.mu.Unlock()
+		case http.MethodDelete:
+			s.mu.Lock()
+			delete(s.secrets, id)
+			s.version++
+			s.mu.Unlock()
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	ctl.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]int64{"reads": atomic.LoadInt64(&s.reads)})
+	})
+
+	go func() {
+		log.Fatal(http.ListenAndServe(*control, ctl))
+	}()
+	log.Printf("fake Kubernetes API listening on %s, control API on %s", *listen, *control)
+	log.Fatal(http.ListenAndServeTLS(*listen, *certFile, *keyFile, api))
+}
@@ -0,0 +1,42 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envSource reads secrets from the environment of the Traefik process: SecretName is a
+// variable name prefix and every variable starting with it is a key, named by the rest of
+// the variable name. SecretName "API_" and SecretKey "TOKEN" read API_TOKEN, like an envFrom
+// with a prefix.
+type envSource struct{}
+
+// readSecret returns the variables starting with prefix, keyed by the rest of their names.
+func (envSource) readSecret(ctx context.Context, prefix string) (map[string]string, error) {
+	data := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, ok := strings.Cut(variable, "=")
+		if !ok || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		data[strings.TrimPrefix(name, prefix)] = value
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no environment variables start with %s", prefix)
+	}
+	return data, nil
+}
+
+// validateEnvConfig checks the environment variable source settings.
+func validateEnvConfig(config *Config) error {
+	if strings.ContainsAny(config.SecretName, "= ") {
+		return fmt.Errorf("invalid secretName %q for source %q, expected a variable name prefix", config.SecretName, sourceEnv)
+	}
+	// Request claims must not select arbitrary variables of the Traefik process
+	if config.JWTClaim != "" {
+		return fmt.Errorf("jwtClaim cannot be used with source %q", sourceEnv)
+	}
+	return nil
+}
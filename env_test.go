@@ -0,0 +1,51 @@
+package traefik_k8s_secret_header
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestEnvReadSecret tests selecting environment variables by prefix.
+func TestEnvReadSecret(t *testing.T) {
+	t.Setenv("K8SSH_TEST_TOKEN", "env-token")
+	t.Setenv("K8SSH_TEST_USER", "api")
+	t.Setenv("K8SSH_TEST_", "prefix only")
+	t.Setenv("K8SSH_OTHER", "unrelated")
+
+	data, err := envSource{}.readSecret(t.Context(), "K8SSH_TEST_")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"TOKEN": "env-token", "USER": "api"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+
+	if _, err := (envSource{}).readSecret(t.Context(), "K8SSH_MISSING_"); err == nil {
+		t.Error("Expected an error when no variable matches")
+	}
+}
+
+// TestValidateEnvConfig tests environment variable source configuration checks.
+func TestValidateEnvConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "prefix", config: &Config{SecretName: "UPSTREAM_"}},
+		{name: "invalid name", config: &Config{SecretName: "UPSTREAM=TOKEN"}, expectError: true},
+		{name: "jwt claim", config: &Config{SecretName: "TENANT_", JWTClaim: "tenant"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
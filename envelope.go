@@ -0,0 +1,89 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Supported values for Config.EnvelopeEncoding.
+const (
+	envelopeJSON      = "json"
+	envelopeBase64    = "base64"
+	envelopeBase64URL = "base64url"
+)
+
+// validateEnvelopeConfig checks the envelope settings.
+func validateEnvelopeConfig(config *Config) error {
+	if config.Mode != modeEnvelope {
+		if len(config.EnvelopeKeys) > 0 || config.EnvelopeEncoding != "" {
+			return fmt.Errorf("envelopeKeys and envelopeEncoding are only supported in mode %q", modeEnvelope)
+		}
+		return nil
+	}
+	if len(config.EnvelopeKeys) == 0 {
+		return fmt.Errorf("envelopeKeys is required in mode %q", modeEnvelope)
+	}
+	seen := make(map[string]bool, len(config.EnvelopeKeys))
+	for _, key := range config.EnvelopeKeys {
+		if key == "" || seen[key] {
+			return fmt.Errorf("envelopeKeys cannot contain empty or duplicate keys")
+		}
+		seen[key] = true
+	}
+	switch config.EnvelopeEncoding {
+	case "":
+		config.EnvelopeEncoding = envelopeJSON
+	case envelopeJSON, envelopeBase64, envelopeBase64URL:
+	default:
+		return fmt.Errorf("envelopeEncoding must be %q, %q or %q", envelopeJSON, envelopeBase64, envelopeBase64URL)
+	}
+	if config.SecretKey != "" || len(config.SecretKeys) > 0 || config.SecretKeyPattern != "" ||
+		config.SecretKeyAnnotation != "" || len(config.EnvFileHeaders) > 0 {
+		return fmt.Errorf("mode %q selects keys with envelopeKeys and cannot use secretKey, secretKeys, secretKeyPattern, secretKeyAnnotation or envFileHeaders", modeEnvelope)
+	}
+	if config.JWTClaim != "" || len(config.FallbackSources) > 0 {
+		return fmt.Errorf("mode %q cannot be combined with jwtClaim or fallbackSources", modeEnvelope)
+	}
+	return nil
+}
+
+// envelopeValue returns the envelopeKeys of the secret as a JSON object, encoded as
+// configured by envelopeEncoding. Every key must be present.
+func (s *SecretHeader) envelopeValue(ctx context.Context, secretName string) (string, error) {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName)
+	if err != nil {
+		return "", err
+	}
+	return s.envelope(data, secretName)
+}
+
+// envelope serializes the envelopeKeys of data. encoding/json writes map keys in sorted
+// order, so the same data always yields the same header value.
+func (s *SecretHeader) envelope(data map[string]string, secretName string) (string, error) {
+	fields := make(map[string]string, len(s.config.EnvelopeKeys))
+	for _, key := range s.config.EnvelopeKeys {
+		value, ok := data[key]
+		if !ok {
+			return "", classify(ErrKeyMissing, fmt.Errorf("key '%s' not found in secret %s/%s", key, s.config.Namespace, secretName))
+		}
+		fields[key] = value
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode envelope: %w", err)
+	}
+
+	switch s.config.EnvelopeEncoding {
+	case envelopeBase64:
+		return base64.StdEncoding.EncodeToString(encoded), nil
+	case envelopeBase64URL:
+		return base64.RawURLEncoding.EncodeToString(encoded), nil
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,148 @@
+package traefik_k8s_secret_header
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestEnvelope tests the serialization and encodings of the envelope.
+func TestEnvelope(t *testing.T) {
+	data := map[string]string{"client_secret": "s3cr\"t", "client_id": "svc", "unrelated": "x"}
+	tests := []struct {
+		name          string
+		encoding      string
+		keys          []string
+		expectedValue string
+		expectError   bool
+	}{
+		{
+			name:          "json",
+			encoding:      envelopeJSON,
+			keys:          []string{"client_secret", "client_id"},
+			expectedValue: `{"client_id":"svc","client_secret":"s3cr\"t"}`,
+		},
+		{
+			name:          "base64",
+			encoding:      envelopeBase64,
+			keys:          []string{"client_id"},
+			expectedValue: "eyJjbGllbnRfaWQiOiJzdmMifQ==",
+		},
+		{
+			name:          "base64url",
+			encoding:      envelopeBase64URL,
+			keys:          []string{"client_id"},
+			expectedValue: "eyJjbGllbnRfaWQiOiJzdmMifQ",
+		},
+		{
+			name:        "missing key",
+			encoding:    envelopeJSON,
+			keys:        []string{"client_id", "tenant"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &SecretHeader{config: &Config{
+				Mode:             modeEnvelope,
+				Namespace:        "default",
+				EnvelopeKeys:     tt.keys,
+				EnvelopeEncoding: tt.encoding,
+			}}
+			value, err := handler.envelope(data, "partner")
+			if tt.expectError {
+				if !errors.Is(err, ErrKeyMissing) {
+					t.Errorf("Expected ErrKeyMissing, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if value != tt.expectedValue {
+				t.Errorf("Expected %q, got %q", tt.expectedValue, value)
+			}
+		})
+	}
+}
+
+// TestServeHTTPEnvelope tests that envelope mode injects the selected keys in one header.
+func TestServeHTTPEnvelope(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{"client_id": "svc", "client_secret": "s3cret", "notes": "x"}, true)
+	defer mockServer.Close()
+
+	var captured http.Header
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Clone()
+		}),
+		name: "envelope-test",
+		config: &Config{
+			Mode:             modeEnvelope,
+			SecretName:       "partner",
+			HeaderName:       "X-Credential-Envelope",
+			Namespace:        "default",
+			CacheTTL:         300,
+			EnvelopeKeys:     []string{"client_id", "client_secret"},
+			EnvelopeEncoding: envelopeJSON,
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rw.Code)
+	}
+	expected := `{"client_id":"svc","client_secret":"s3cret"}`
+	if got := captured.Get("X-Credential-Envelope"); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// TestValidateEnvelopeConfig tests envelope configuration checks.
+func TestValidateEnvelopeConfig(t *testing.T) {
+	keys := []string{"client_id", "client_secret"}
+	tests := []struct {
+		name             string
+		config           *Config
+		expectedEncoding string
+		expectError      bool
+	}{
+		{name: "inject", config: &Config{SecretKey: "token"}},
+		{name: "default encoding", config: &Config{Mode: modeEnvelope, EnvelopeKeys: keys}, expectedEncoding: envelopeJSON},
+		{name: "base64", config: &Config{Mode: modeEnvelope, EnvelopeKeys: keys, EnvelopeEncoding: envelopeBase64}, expectedEncoding: envelopeBase64},
+		{name: "missing keys", config: &Config{Mode: modeEnvelope}, expectError: true},
+		{name: "duplicate key", config: &Config{Mode: modeEnvelope, EnvelopeKeys: []string{"a", "a"}}, expectError: true},
+		{name: "unknown encoding", config: &Config{Mode: modeEnvelope, EnvelopeKeys: keys, EnvelopeEncoding: "hex"}, expectError: true},
+		{name: "with secretKey", config: &Config{Mode: modeEnvelope, EnvelopeKeys: keys, SecretKey: "token"}, expectError: true},
+		{name: "keys outside its mode", config: &Config{SecretKey: "token", EnvelopeKeys: keys}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvelopeConfig(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.EnvelopeEncoding != tt.expectedEncoding {
+				t.Errorf("Expected encoding %q, got %q", tt.expectedEncoding, tt.config.EnvelopeEncoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package traefik_k8s_secret_header
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported values for Config.EnvFileFormat.
+const (
+	envFileDotenv     = "dotenv"
+	envFileProperties = "properties"
+)
+
+// validateEnvFile checks the envFileHeaders settings.
+func validateEnvFile(config *Config) error {
+	if len(config.EnvFileHeaders) == 0 {
+		if config.EnvFileFormat != "" {
+			return fmt.Errorf("envFileFormat requires envFileHeaders")
+		}
+		return nil
+	}
+	switch config.EnvFileFormat {
+	case "":
+		config.EnvFileFormat = envFileDotenv
+	case envFileDotenv, envFileProperties:
+	default:
+		return fmt.Errorf("envFileFormat must be %q or %q", envFileDotenv, envFileProperties)
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("envFileHeaders is only supported in mode %q", modeInject)
+	}
+	if config.SecretKey == "" {
+		return fmt.Errorf("envFileHeaders requires secretKey")
+	}
+	if config.SecretKeyPattern != "" || len(config.SecretKeys) > 0 || config.SecretKeyAnnotation != "" {
+		return fmt.Errorf("envFileHeaders cannot be combined with secretKeyPattern, secretKeys or secretKeyAnnotation")
+	}
+	if config.PreserveExistingHeader || config.RejectExistingHeader || config.TrustedHeadersOnly || config.CompressThreshold > 0 {
+		return fmt.Errorf("envFileHeaders cannot be combined with preserveExistingHeader, rejectExistingHeader, trustedHeadersOnly or compressThreshold")
+	}
+	if len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return fmt.Errorf("envFileHeaders cannot be used with fallbackSources or fallbackValue")
+	}
+	if len(config.WarmupHeaders) > 0 || len(config.WarmupMethods) > 0 || len(config.WarmupUserAgents) > 0 {
+		return fmt.Errorf("envFileHeaders cannot be used with warm-up detection")
+	}
+	for entry := range config.EnvFileHeaders {
+		if entry == "" {
+			return fmt.Errorf("envFileHeaders cannot map an empty entry name")
+		}
+	}
+	return nil
+}
+
+// parseEnvFile returns the entries of content in format, dotenv or Java properties.
+func parseEnvFile(content, format string) (map[string]string, error) {
+	if format == envFileProperties {
+		return parseProperties(content), nil
+	}
+	return parseDotenv(content)
+}
+
+// parseDotenv parses KEY=VALUE lines, as written by docker --env-file and most dotenv
+// libraries: blank lines and # comments are skipped, an "export " prefix is ignored, double
+// quoted values may span lines and use \n, \t, \" and \\ escapes, single quoted values are
+// literal, and unquoted values end at a " #" comment.
+func parseDotenv(content string) (map[string]string, error) {
+	entries := make(map[string]string)
+	rest := strings.ReplaceAll(content, "\r\n", "\n")
+	line := 0
+	for rest != "" {
+		var current string
+		current, rest, _ = strings.Cut(rest, "\n")
+		line++
+		current = strings.TrimSpace(current)
+		if current == "" || strings.HasPrefix(current, "#") {
+			continue
+		}
+		current = strings.TrimPrefix(current, "export ")
+
+		key, value, ok := strings.Cut(current, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("env file line %d is not KEY=VALUE", line)
+		}
+		value = strings.TrimLeft(value, " \t")
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			// A double quoted value ends at the next unescaped quote, possibly on a later line
+			value = value[1:] + "\n" + rest
+			end := closingQuote(value)
+			if end < 0 {
+				return nil, fmt.Errorf("env file line %d has an unterminated quoted value", line)
+			}
+			line += strings.Count(value[:end], "\n")
+			var tail string
+			tail, rest, _ = strings.Cut(value[end+1:], "\n")
+			if tail = strings.TrimSpace(tail); tail != "" && !strings.HasPrefix(tail, "#") {
+				return nil, fmt.Errorf("env file line %d has text after the quoted value", line)
+			}
+			value = unescapeDotenv(value[:end])
+		case strings.HasPrefix(value, "'"):
+			end := strings.IndexByte(value[1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("env file line %d has an unterminated quoted value", line)
+			}
+			value = value[1 : end+1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = value[:i]
+			}
+			value = strings.TrimSpace(value)
+		}
+		entries[key] = value
+	}
+	return entries, nil
+}
+
+// closingQuote returns the index of the first double quote of value not escaped by a
+// backslash, or -1.
+func closingQuote(value string) int {
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// unescapeDotenv resolves the escapes of a double quoted dotenv value.
+func unescapeDotenv(value string) string {
+	return strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\r`, "\r", `\"`, `"`, `\\`, `\`).Replace(value)
+}
+
+// parseProperties parses Java properties: # and ! comments, key=value, key:value or
+// key value separators, lines continued by a trailing backslash, and the \t, \n, \r, \f
+// and \uXXXX escapes.
+func parseProperties(content string) map[string]string {
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), len(content)+1)
+
+	var logical strings.Builder
+	for scanner.Scan() {
+		line := strings.TrimLeft(scanner.Text(), " \t\f")
+		if logical.Len() == 0 && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		if continued(line) {
+			logical.WriteString(line[:len(line)-1])
+			continue
+		}
+		logical.WriteString(line)
+		key, value := splitProperty(logical.String())
+		entries[unescapeProperty(key)] = unescapeProperty(value)
+		logical.Reset()
+	}
+	if logical.Len() > 0 {
+		key, value := splitProperty(logical.String())
+		entries[unescapeProperty(key)] = unescapeProperty(value)
+	}
+	return entries
+}
+
+// continued reports whether a properties line ends with an odd number of backslashes.
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits a logical properties line at its first unescaped =, : or whitespace.
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			value := strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = strings.TrimLeft(value[1:], " \t\f")
+			}
+			return line[:i], value
+		}
+	}
+	return line, ""
+}
+
+// unescapeProperty resolves the escapes of a properties key or value.
+func unescapeProperty(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(value) {
+				if code, err := strconv.ParseUint(value[i+1:i+5], 16, 16); err == nil {
+					b.WriteRune(rune(code))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// envFileHeaders returns the headers mapped by envFileHeaders from the env file stored in
+// key secretKey of data, in header name order.
+func (s *SecretHeader) envFileHeaders(data map[string]string, secretName string) ([]patternHeader, error) {
+	content, ok := data[s.config.SecretKey]
+	if !ok {
+		return nil, classify(ErrKeyMissing, fmt.Errorf("key '%s' not found in secret %s/%s", s.config.SecretKey, s.config.Namespace, secretName))
+	}
+	entries, err := parseEnvFile(content, s.config.EnvFileFormat)
+	if err != nil {
+		return nil, fmt.Errorf("secret %s/%s key '%s': %w", s.config.Namespace, secretName, s.config.SecretKey, err)
+	}
+
+	headers := make([]patternHeader, 0, len(s.config.EnvFileHeaders))
+	for entry, name := range s.config.EnvFileHeaders {
+		value, ok := entries[entry]
+		if !ok {
+			return nil, classify(ErrKeyMissing, fmt.Errorf("entry '%s' not found in key '%s' of secret %s/%s",
+				entry, s.config.SecretKey, s.config.Namespace, secretName))
+		}
+		value, err := s.headerValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s/%s entry '%s': %w", s.config.Namespace, secretName, entry, err)
+		}
+		value, err = s.checkValue(value, secretName, s.config.SecretKey)
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, patternHeader{name: name, value: value})
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].name < headers[j].name })
+	return headers, nil
+}
+
+// serveEnvFile injects the entries of the env file stored in secretKey as the headers named
+// by envFileHeaders.
+func (s *SecretHeader) serveEnvFile(rw http.ResponseWriter, req *http.Request, secretName string) {
+	client, err := s.apiClient(req.Context())
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+	data, err := s.fetchSecretData(req.Context(), client, s.config.Namespace, secretName)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+	headers, err := s.envFileHeaders(data, secretName)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	for _, header := range headers {
+		s.injectNamedHeader(req, header.name, header.value)
+	}
+	s.injectIdentity(req)
+
+	s.next.ServeHTTP(rw, req)
+}
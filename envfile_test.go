@@ -0,0 +1,244 @@
+package traefik_k8s_secret_header
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestParseDotenv tests dotenv entries, quoting and comments.
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		expectedEntries map[string]string
+		expectError     bool
+	}{
+		{
+			name:            "plain",
+			content:         "API_KEY=abc123\nAPI_USER=svc\n",
+			expectedEntries: map[string]string{"API_KEY": "abc123", "API_USER": "svc"},
+		},
+		{
+			name:            "comments and export",
+			content:         "# credentials\n\nexport API_KEY=abc123 # rotated monthly\r\nEMPTY=\n",
+			expectedEntries: map[string]string{"API_KEY": "abc123", "EMPTY": ""},
+		},
+		{
+			name:            "double quotes",
+			content:         `API_KEY="a b\"c\n" # comment` + "\nNEXT=1",
+			expectedEntries: map[string]string{"API_KEY": "a b\"c\n", "NEXT": "1"},
+		},
+		{
+			name:            "multiline double quotes",
+			content:         "CERT=\"line1\nline2\"\nNEXT=1",
+			expectedEntries: map[string]string{"CERT": "line1\nline2", "NEXT": "1"},
+		},
+		{
+			name:            "single quotes",
+			content:         `API_KEY='a\n #b'`,
+			expectedEntries: map[string]string{"API_KEY": `a\n #b`},
+		},
+		{name: "missing separator", content: "API_KEY\n", expectError: true},
+		{name: "unterminated quote", content: "API_KEY=\"abc\n", expectError: true},
+		{name: "text after quote", content: "API_KEY=\"abc\" def\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseEnvFile(tt.content, envFileDotenv)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", entries)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(entries, tt.expectedEntries) {
+				t.Errorf("Expected entries %v, got %v", tt.expectedEntries, entries)
+			}
+		})
+	}
+}
+
+// TestParseProperties tests Java properties separators, continuations and escapes.
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		expectedEntries map[string]string
+	}{
+		{
+			name:            "separators",
+			content:         "api.key=abc\napi.user : svc\napi.region eu-west-1\n",
+			expectedEntries: map[string]string{"api.key": "abc", "api.user": "svc", "api.region": "eu-west-1"},
+		},
+		{
+			name:            "comments",
+			content:         "# comment\n! comment\n\n  api.key = abc\n",
+			expectedEntries: map[string]string{"api.key": "abc"},
+		},
+		{
+			name:            "continuation",
+			content:         "api.key = abc\\\n    def\\\n    ghi\nnext=1",
+			expectedEntries: map[string]string{"api.key": "abcdefghi", "next": "1"},
+		},
+		{
+			name:            "escapes",
+			content:         `api\:key=a\tbé\\` + "\n",
+			expectedEntries: map[string]string{"api:key": "a\tbé\\"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := parseEnvFile(tt.content, envFileProperties)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(entries, tt.expectedEntries) {
+				t.Errorf("Expected entries %v, got %v", tt.expectedEntries, entries)
+			}
+		})
+	}
+}
+
+// TestServeHTTPEnvFile tests injecting the mapped entries of an env file key.
+func TestServeHTTPEnvFile(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		content         string
+		expectedHeaders map[string]string
+		expectError     bool
+	}{
+		{
+			name:    "dotenv",
+			content: "API_KEY=abc123\nAPI_USER=svc\nDB_PASSWORD=hunter2\n",
+			expectedHeaders: map[string]string{
+				"X-Api-Key":  "abc123",
+				"X-Api-User": "svc",
+			},
+		},
+		{
+			name:    "properties",
+			format:  envFileProperties,
+			content: "API_KEY: abc123\nAPI_USER svc\n",
+			expectedHeaders: map[string]string{
+				"X-Api-Key":  "abc123",
+				"X-Api-User": "svc",
+			},
+		},
+		{
+			name:        "missing entry",
+			content:     "API_KEY=abc123\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"legacy.env": tt.content}, true)
+			defer mockServer.Close()
+
+			var captured http.Header
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Clone()
+				}),
+				name: "envfile-test",
+				config: &Config{
+					SecretName:     "legacy",
+					SecretKey:      "legacy.env",
+					HeaderName:     "X-Secret",
+					Namespace:      "default",
+					EnvFileHeaders: map[string]string{"API_KEY": "X-Api-Key", "API_USER": "X-Api-User"},
+					EnvFileFormat:  tt.format,
+					CacheTTL:       300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if tt.expectError {
+				if captured != nil || rw.Code != http.StatusInternalServerError {
+					t.Errorf("Expected status 500 without calling next, got %d", rw.Code)
+				}
+				return
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := captured.Get(name); got != value {
+					t.Errorf("Expected %s: %q, got %q", name, value, got)
+				}
+			}
+			if len(captured) != len(tt.expectedHeaders) {
+				t.Errorf("Expected %d headers, got %v", len(tt.expectedHeaders), captured)
+			}
+		})
+	}
+}
+
+// TestEnvFileMissingEntryClass tests that a missing entry is classified as a missing key.
+func TestEnvFileMissingEntryClass(t *testing.T) {
+	handler := &SecretHeader{config: &Config{
+		SecretKey:      "legacy.env",
+		Namespace:      "default",
+		EnvFileHeaders: map[string]string{"API_KEY": "X-Api-Key"},
+	}}
+	_, err := handler.envFileHeaders(map[string]string{"legacy.env": "OTHER=1"}, "legacy")
+	if !errors.Is(err, ErrKeyMissing) {
+		t.Errorf("Expected ErrKeyMissing, got %v", err)
+	}
+}
+
+// TestValidateEnvFile tests envFileHeaders configuration checks.
+func TestValidateEnvFile(t *testing.T) {
+	headers := map[string]string{"API_KEY": "X-Api-Key"}
+	tests := []struct {
+		name           string
+		config         *Config
+		expectedFormat string
+		expectError    bool
+	}{
+		{name: "unset", config: &Config{SecretKey: "token"}},
+		{name: "default format", config: &Config{SecretKey: "legacy.env", EnvFileHeaders: headers}, expectedFormat: envFileDotenv},
+		{name: "properties", config: &Config{SecretKey: "legacy.env", EnvFileHeaders: headers, EnvFileFormat: envFileProperties}, expectedFormat: envFileProperties},
+		{name: "format without headers", config: &Config{SecretKey: "legacy.env", EnvFileFormat: envFileDotenv}, expectError: true},
+		{name: "unknown format", config: &Config{SecretKey: "legacy.env", EnvFileHeaders: headers, EnvFileFormat: "yaml"}, expectError: true},
+		{name: "without secretKey", config: &Config{EnvFileHeaders: headers}, expectError: true},
+		{name: "validate mode", config: &Config{Mode: modeValidate, SecretKey: "legacy.env", EnvFileHeaders: headers}, expectError: true},
+		{name: "with secretKeys", config: &Config{SecretKey: "legacy.env", SecretKeys: []string{"a"}, EnvFileHeaders: headers}, expectError: true},
+		{name: "preserve existing", config: &Config{SecretKey: "legacy.env", EnvFileHeaders: headers, PreserveExistingHeader: true}, expectError: true},
+		{name: "empty entry", config: &Config{SecretKey: "legacy.env", EnvFileHeaders: map[string]string{"": "X-Api-Key"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEnvFile(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.EnvFileFormat != tt.expectedFormat {
+				t.Errorf("Expected format %q, got %q", tt.expectedFormat, tt.config.EnvFileFormat)
+			}
+		})
+	}
+}
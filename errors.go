@@ -0,0 +1,92 @@
+package traefik_k8s_secret_header
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error classes of the failures returned while resolving a secret. The errors returned by
+// the plugin wrap their cause, so callers match a class with errors.Is and still read the
+// underlying message.
+var (
+	// ErrSecretNotFound reports that the secret does not exist in its source.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrKeyMissing reports that the secret exists but lacks the requested key.
+	ErrKeyMissing = errors.New("secret key missing")
+	// ErrForbidden reports that the source refused access to the secret.
+	ErrForbidden = errors.New("access to secret forbidden")
+	// ErrAPIUnavailable reports that the source could not be reached or failed to answer.
+	ErrAPIUnavailable = errors.New("secret API unavailable")
+)
+
+// Values of the error code header, by error class.
+const (
+	errorCodeSecretNotFound = "secret_not_found"
+	errorCodeKeyMissing     = "key_missing"
+	errorCodeForbidden      = "forbidden"
+	errorCodeAPIUnavailable = "api_unavailable"
+	errorCodeInternal       = "internal"
+)
+
+// classifiedError tags err with one of the exported error classes while keeping its message.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+// classify returns err tagged with class, or err itself when class is nil.
+func classify(class, err error) error {
+	if class == nil || err == nil {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// statusClass returns the error class of an HTTP status answered by a secret source, or nil
+// when the status has none.
+func statusClass(code int) error {
+	switch {
+	case code == http.StatusNotFound:
+		return ErrSecretNotFound
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return ErrForbidden
+	case code == http.StatusTooManyRequests || code >= 500:
+		return ErrAPIUnavailable
+	}
+	return nil
+}
+
+// fetchResult returns the result label of a secret read: success or the error code.
+func fetchResult(err error) string {
+	if err == nil {
+		return "success"
+	}
+	return errorCode(err)
+}
+
+// errorCode returns the error code header value of err.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		return errorCodeSecretNotFound
+	case errors.Is(err, ErrKeyMissing):
+		return errorCodeKeyMissing
+	case errors.Is(err, ErrForbidden):
+		return errorCodeForbidden
+	case errors.Is(err, ErrAPIUnavailable):
+		return errorCodeAPIUnavailable
+	}
+	return errorCodeInternal
+}
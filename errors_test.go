@@ -0,0 +1,120 @@
+package traefik_k8s_secret_header
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestErrorClasses tests that failures match their exported class and keep their message.
+func TestErrorClasses(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		expectedClass error
+		expectedCode  string
+	}{
+		{name: "API not found", err: &apiStatusError{code: http.StatusNotFound}, expectedClass: ErrSecretNotFound, expectedCode: "secret_not_found"},
+		{name: "API forbidden", err: &apiStatusError{code: http.StatusForbidden}, expectedClass: ErrForbidden, expectedCode: "forbidden"},
+		{name: "API unauthorized", err: &apiStatusError{code: http.StatusUnauthorized}, expectedClass: ErrForbidden, expectedCode: "forbidden"},
+		{name: "API throttled", err: &apiStatusError{code: http.StatusTooManyRequests}, expectedClass: ErrAPIUnavailable, expectedCode: "api_unavailable"},
+		{name: "API failure", err: &apiStatusError{code: http.StatusBadGateway}, expectedClass: ErrAPIUnavailable, expectedCode: "api_unavailable"},
+		{name: "API conflict", err: &apiStatusError{code: http.StatusConflict}, expectedCode: "internal"},
+		{name: "vault not found", err: &vaultStatusError{code: http.StatusNotFound}, expectedClass: ErrSecretNotFound, expectedCode: "secret_not_found"},
+		{name: "key missing", err: classify(ErrKeyMissing, errors.New("no key")), expectedClass: ErrKeyMissing, expectedCode: "key_missing"},
+		{name: "wrapped", err: fmt.Errorf("failed to read secret: %w", &apiStatusError{code: http.StatusForbidden}), expectedClass: ErrForbidden, expectedCode: "forbidden"},
+		{name: "provider error", err: fmt.Errorf("consul: %w", ErrAPIUnavailable), expectedClass: ErrAPIUnavailable, expectedCode: "api_unavailable"},
+		{name: "unclassified", err: errors.New("bad base64"), expectedCode: "internal"},
+	}
+
+	classes := []error{ErrSecretNotFound, ErrKeyMissing, ErrForbidden, ErrAPIUnavailable}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, class := range classes {
+				if got := errors.Is(tt.err, class); got != (class == tt.expectedClass) {
+					t.Errorf("errors.Is(%v) = %v", class, got)
+				}
+			}
+			if code := errorCode(tt.err); code != tt.expectedCode {
+				t.Errorf("Expected code %q, got %q", tt.expectedCode, code)
+			}
+		})
+	}
+}
+
+// TestClassifyKeepsCause tests that a classified error keeps its message and cause.
+func TestClassifyKeepsCause(t *testing.T) {
+	cause := fmt.Errorf("open /mnt/secret: %w", fs.ErrNotExist)
+	err := classify(ErrSecretNotFound, cause)
+	if err.Error() != cause.Error() {
+		t.Errorf("Expected message %q, got %q", cause.Error(), err.Error())
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("Expected the cause to be unwrapped")
+	}
+	if classify(nil, cause) != cause {
+		t.Error("Expected an error without class to be returned as is")
+	}
+}
+
+// TestServeHTTPErrorCodeHeader tests that failed requests carry the class of the failure,
+// which also labels the fetch metric.
+func TestServeHTTPErrorCodeHeader(t *testing.T) {
+	tests := []struct {
+		name          string
+		exists        bool
+		secretKey     string
+		header        string
+		expectedCode  string
+		expectedFetch string
+	}{
+		{name: "secret not found", header: "X-Error-Code", secretKey: "api-key", expectedCode: "secret_not_found", expectedFetch: "secret_not_found"},
+		{name: "key missing", header: "X-Error-Code", exists: true, secretKey: "other", expectedCode: "key_missing", expectedFetch: "success"},
+		{name: "disabled", secretKey: "api-key", expectedFetch: "secret_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"api-key": "secret"}, tt.exists)
+			defer mockServer.Close()
+
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					t.Error("Request should not reach the upstream")
+				}),
+				name: "error-code-" + tt.name,
+				config: &Config{
+					SecretName:      "my-secret",
+					SecretKey:       tt.secretKey,
+					HeaderName:      "X-API-Key",
+					Namespace:       "default",
+					CacheTTL:        300,
+					ErrorCodeHeader: tt.header,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if rw.Code != http.StatusInternalServerError {
+				t.Fatalf("Expected status 500, got %d", rw.Code)
+			}
+			if got := rw.Header().Get("X-Error-Code"); got != tt.expectedCode {
+				t.Errorf("Expected error code %q, got %q", tt.expectedCode, got)
+			}
+			if got := metrics.value(metricSecretFetches, "middleware", "error-code-"+tt.name, "result", tt.expectedFetch); got != 1 {
+				t.Errorf("Expected 1 fetch with result %q, got %v", tt.expectedFetch, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failureEventInterval is the minimum time between two events about the same secret, so a
+// lasting outage adds one event every few minutes rather than one per read.
+const failureEventInterval = 5 * time.Minute
+
+// eventComponent is the component events are reported by.
+const eventComponent = "traefik-k8s-secret-header"
+
+// validateFailureEvents checks the failureEventThreshold and failureEventObject settings.
+func validateFailureEvents(config *Config) error {
+	if config.FailureEventThreshold < 0 {
+		return fmt.Errorf("failureEventThreshold cannot be negative")
+	}
+	switch config.FailureEventObject {
+	case "", "secret", "pod":
+	default:
+		return fmt.Errorf("failureEventObject must be secret or pod, got %q", config.FailureEventObject)
+	}
+	if config.FailureEventThreshold > 0 && config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("failureEventThreshold is only supported with source %q", sourceKubernetes)
+	}
+	return nil
+}
+
+// k8sEvent is the subset of a core/v1 Event used by the plugin.
+type k8sEvent struct {
+	APIVersion         string             `json:"apiVersion"`
+	Kind               string             `json:"kind"`
+	Metadata           k8sObjectMeta      `json:"metadata"`
+	InvolvedObject     k8sObjectReference `json:"involvedObject"`
+	Reason             string             `json:"reason"`
+	Message            string             `json:"message"`
+	Type               string             `json:"type"`
+	Source             k8sEventSource     `json:"source"`
+	FirstTimestamp     string             `json:"firstTimestamp"`
+	LastTimestamp      string             `json:"lastTimestamp"`
+	Count              int                `json:"count"`
+	ReportingComponent string             `json:"reportingComponent"`
+	ReportingInstance  string             `json:"reportingInstance,omitempty"`
+}
+
+// k8sObjectReference identifies the object an event is about.
+type k8sObjectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+}
+
+// k8sEventSource is the component that reported an event.
+type k8sEventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host,omitempty"`
+}
+
+// createEvent creates an event through the Kubernetes API.
+func (c *k8sClient) createEvent(ctx context.Context, event *k8sEvent) error {
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/events", c.baseURL, event.InvolvedObject.Namespace)
+	return c.do(ctx, http.MethodPost, url, event, nil)
+}
+
+// failureTracker counts the consecutive failed reads of each secret.
+type failureTracker struct {
+	mu     sync.Mutex
+	counts map[string]int       // consecutive failures by cache key
+	sent   map[string]time.Time // last event by cache key
+}
+
+// observe records the outcome of a read of the secret cached under key, and returns the
+// number of consecutive failures and whether an event is due: threshold is reached and no
+// event was sent within failureEventInterval.
+func (f *failureTracker) observe(key string, err error, threshold int, now time.Time) (int, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.counts, key)
+		delete(f.sent, key)
+		return 0, false
+	}
+	if f.counts == nil {
+		f.counts = make(map[string]int)
+		f.sent = make(map[string]time.Time)
+	}
+	f.counts[key]++
+	count := f.counts[key]
+	if count < threshold || now.Sub(f.sent[key]) < failureEventInterval {
+		return count, false
+	}
+	f.sent[key] = now
+	return count, true
+}
+
+// reportFailures creates a Warning event once reads of a secret failed failureEventThreshold
+// times in a row, so the outage shows in kubectl describe and event pipelines. Secrets
+// selected per request are not tracked, as their names are chosen by clients.
+func (s *SecretHeader) reportFailures(ctx context.Context, namespace, secretName, cacheKey string, err error) {
+	if s.config.FailureEventThreshold <= 0 || s.perRequestSelection() {
+		return
+	}
+	count, due := s.failures.observe(cacheKey, err, s.config.FailureEventThreshold, time.Now())
+	if !due {
+		return
+	}
+
+	client, clientErr := s.kubernetesClient()
+	if clientErr == nil && client == nil {
+		clientErr = fmt.Errorf("no Kubernetes client")
+	}
+	if clientErr == nil {
+		clientErr = client.createEvent(ctx, s.failureEvent(namespace, secretName, count, err))
+	}
+	if clientErr != nil {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Failed to create event for secret %s: %v\n", cacheKey, clientErr)
+	}
+}
+
+// failureEvent returns the event describing count consecutive failed reads of a secret, about
+// the secret or, with failureEventObject pod, the Traefik pod.
+func (s *SecretHeader) failureEvent(namespace, secretName string, count int, err error) *k8sEvent {
+	object := k8sObjectReference{APIVersion: "v1", Kind: "Secret", Namespace: namespace, Name: secretName}
+	host, _ := os.Hostname()
+	if s.config.FailureEventObject == "pod" {
+		object = podReference(host)
+	}
+
+	message := fmt.Sprintf("Middleware %s failed to read secret %s/%s %d times in a row: %v", s.name, namespace, secretName, count, err)
+	if len(message) > 1024 {
+		message = message[:1021] + "..."
+	}
+	now := time.Now().UTC()
+	return &k8sEvent{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata: k8sObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", object.Name, now.UnixNano()),
+			Namespace: object.Namespace,
+		},
+		InvolvedObject:     object,
+		Reason:             "SecretReadFailed",
+		Message:            message,
+		Type:               "Warning",
+		Source:             k8sEventSource{Component: eventComponent, Host: host},
+		FirstTimestamp:     now.Format(time.RFC3339),
+		LastTimestamp:      now.Format(time.RFC3339),
+		Count:              1,
+		ReportingComponent: eventComponent,
+		ReportingInstance:  host,
+	}
+}
+
+// podReference returns the Traefik pod, named by the POD_NAME and POD_NAMESPACE variables of
+// the downward API, or else by its hostname and service account namespace.
+func podReference(host string) k8sObjectReference {
+	name, namespace := os.Getenv("POD_NAME"), os.Getenv("POD_NAMESPACE")
+	if name == "" {
+		name = host
+	}
+	if namespace == "" {
+		content, _ := os.ReadFile(serviceAccountDir + "/namespace")
+		namespace = strings.TrimSpace(string(content))
+	}
+	return k8sObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: namespace, Name: name}
+}
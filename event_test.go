@@ -0,0 +1,141 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPFailureEvents tests that persistent read failures create one event.
+func TestServeHTTPFailureEvents(t *testing.T) {
+	tests := []struct {
+		name           string
+		object         string
+		failures       int
+		expectedEvents int
+		expectedObject k8sObjectReference
+	}{
+		{name: "below threshold", failures: 2},
+		{
+			name:           "threshold reached",
+			failures:       3,
+			expectedEvents: 1,
+			expectedObject: k8sObjectReference{APIVersion: "v1", Kind: "Secret", Namespace: "default", Name: "my-secret"},
+		},
+		{
+			name:           "repeated failures",
+			failures:       8,
+			expectedEvents: 1,
+			expectedObject: k8sObjectReference{APIVersion: "v1", Kind: "Secret", Namespace: "default", Name: "my-secret"},
+		},
+		{
+			name:           "pod",
+			object:         "pod",
+			failures:       3,
+			expectedEvents: 1,
+			expectedObject: k8sObjectReference{APIVersion: "v1", Kind: "Pod", Namespace: "traefik", Name: "traefik-7d9f8-abcde"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAME", "traefik-7d9f8-abcde")
+			t.Setenv("POD_NAMESPACE", "traefik")
+
+			var mu sync.Mutex
+			var events []k8sEvent
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					var event k8sEvent
+					if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+						t.Fatal(err)
+					}
+					if !strings.HasSuffix(r.URL.Path, "/namespaces/"+event.InvolvedObject.Namespace+"/events") {
+						t.Errorf("Expected the event in the namespace of its object, got %s", r.URL.Path)
+					}
+					mu.Lock()
+					events = append(events, event)
+					mu.Unlock()
+					w.WriteHeader(http.StatusCreated)
+					return
+				}
+				http.Error(w, "etcdserver: request timed out", http.StatusInternalServerError)
+			}))
+			defer mockServer.Close()
+
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+				name: "failure-events-test",
+				config: &Config{
+					SecretName:            "my-secret",
+					SecretKey:             "token",
+					HeaderName:            "X-Auth-Token",
+					Namespace:             "default",
+					CacheTTL:              300,
+					FailureEventThreshold: 3,
+					FailureEventObject:    tt.object,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			for i := 0; i < tt.failures; i++ {
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+
+			if len(events) != tt.expectedEvents {
+				t.Fatalf("Expected %d events, got %d", tt.expectedEvents, len(events))
+			}
+			if len(events) == 0 {
+				return
+			}
+			event := events[0]
+			if event.InvolvedObject != tt.expectedObject {
+				t.Errorf("Expected object %+v, got %+v", tt.expectedObject, event.InvolvedObject)
+			}
+			if event.Type != "Warning" || event.Reason != "SecretReadFailed" || event.Source.Component != eventComponent {
+				t.Errorf("Unexpected event %+v", event)
+			}
+			if !strings.Contains(event.Message, "default/my-secret 3 times in a row") || !strings.Contains(event.Message, "status 500") {
+				t.Errorf("Expected the failure count and error in the message, got %q", event.Message)
+			}
+		})
+	}
+}
+
+// TestFailureTracker tests that a successful read restarts the count.
+func TestFailureTracker(t *testing.T) {
+	var tracker failureTracker
+	now := time.Now()
+	failure := &apiStatusError{code: http.StatusInternalServerError}
+
+	steps := []struct {
+		err           error
+		after         time.Duration
+		expectedCount int
+		expectedDue   bool
+	}{
+		{err: failure, expectedCount: 1},
+		{err: failure, expectedCount: 2, expectedDue: true},
+		{err: failure, expectedCount: 3},
+		{err: failure, after: failureEventInterval, expectedCount: 4, expectedDue: true},
+		{err: nil},
+		{err: failure, expectedCount: 1},
+		{err: failure, expectedCount: 2, expectedDue: true},
+	}
+	for i, step := range steps {
+		now = now.Add(step.after)
+		count, due := tracker.observe("default/my-secret", step.err, 2, now)
+		if count != step.expectedCount || due != step.expectedDue {
+			t.Errorf("Step %d: expected count %d due %v, got %d %v", i, step.expectedCount, step.expectedDue, count, due)
+		}
+	}
+}
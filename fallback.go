@@ -0,0 +1,102 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// fallbackSource is an entry of Config.FallbackSources.
+type fallbackSource struct {
+	label  string // "<source>:<secretName>" as configured, also the cache key
+	source string
+	name   string
+	reader secretReader // nil reads Kubernetes secrets
+}
+
+// validateFallbackConfig checks the fallback settings that do not depend on each entry.
+func validateFallbackConfig(config *Config) error {
+	if len(config.FallbackSources) == 0 && config.FallbackValue == "" {
+		return nil
+	}
+	// A fixed fallback would hand one tenant's credential to every other tenant
+	if config.JWTClaim != "" {
+		return fmt.Errorf("fallbackSources and fallbackValue cannot be used with jwtClaim")
+	}
+	if config.Mode == modeGenerate {
+		return fmt.Errorf("fallbackSources and fallbackValue cannot be used with mode %q", modeGenerate)
+	}
+	if config.FallbackValue != "" && config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("fallbackValue is only supported in mode %q", modeInject)
+	}
+	return nil
+}
+
+// newFallbackSources parses and validates config.FallbackSources and builds their readers.
+// Each entry is validated against a copy of config with its own source and secret name.
+func newFallbackSources(config *Config, tlsConfig *tls.Config) ([]fallbackSource, error) {
+	fallbacks := make([]fallbackSource, 0, len(config.FallbackSources))
+	for _, entry := range config.FallbackSources {
+		source, name, ok := strings.Cut(entry, ":")
+		if !ok || source == "" || name == "" {
+			return nil, fmt.Errorf("invalid fallback source %q, expected <source>:<secretName>", entry)
+		}
+
+		entryConfig := *config
+		entryConfig.Source = source
+		entryConfig.SecretName = name
+		if err := validateSource(&entryConfig); err != nil {
+			return nil, fmt.Errorf("invalid fallback source %q: %w", entry, err)
+		}
+
+		reader, err := newSourceReader(&entryConfig, tlsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fallback source %q: %w", entry, err)
+		}
+		fallbacks = append(fallbacks, fallbackSource{
+			label:  entry,
+			source: source,
+			name:   name,
+			reader: reader,
+		})
+	}
+	return fallbacks, nil
+}
+
+// fallbackValue returns the value of secretKey from the first fallback source providing it,
+// or FallbackValue. primaryErr is returned when none does.
+func (s *SecretHeader) fallbackValue(ctx context.Context, secretKey string, primaryErr error) (string, error) {
+	for _, fallback := range s.fallbacks {
+		var data map[string]string
+		var err error
+		if fallback.reader == nil {
+			var client *k8sClient
+			if client, err = s.kubernetesClient(); err == nil {
+				data, err = s.readKubernetesSecret(ctx, client, s.config.Namespace, fallback.name)
+			}
+		} else {
+			data, err = s.readSource(ctx, fallback.reader, fallback.label, fallback.name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[k8s-secret-header] Fallback %s failed: %v\n", fallback.label, err)
+			continue
+		}
+		value, ok := data[secretKey]
+		if !ok {
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Using fallback %s for key '%s': %v\n", fallback.label, secretKey, primaryErr)
+		metrics.inc(metricSourceFallbacks, "middleware", s.name, "source", fallback.source)
+		return value, nil
+	}
+
+	if s.config.FallbackValue != "" {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Using fallbackValue for key '%s': %v\n", secretKey, primaryErr)
+		metrics.inc(metricSourceFallbacks, "middleware", s.name, "source", "fallbackValue")
+		return s.config.FallbackValue, nil
+	}
+	return "", primaryErr
+}
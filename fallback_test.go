@@ -0,0 +1,188 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPFallbackSources tests that the chain is tried in order when the Kubernetes
+// secret cannot provide the value.
+func TestServeHTTPFallbackSources(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("file-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("K8SSH_FALLBACK_TOKEN", "env-token")
+	t.Setenv("K8SSH_FALLBACK_USER", "env-user")
+
+	tests := []struct {
+		name           string
+		secretData     map[string]string
+		secretExists   bool
+		secretKey      string
+		fallbackValue  string
+		expectedHeader string
+		expectedSource string
+		expectError    bool
+	}{
+		{
+			name:           "primary secret",
+			secretData:     map[string]string{"token": "k8s-token"},
+			secretExists:   true,
+			secretKey:      "token",
+			expectedHeader: "k8s-token",
+		},
+		{
+			name:           "secret missing, file provides the key",
+			secretKey:      "token",
+			expectedHeader: "file-token",
+			expectedSource: sourceFile,
+		},
+		{
+			name:           "key missing in secret and file, env provides it",
+			secretData:     map[string]string{"token": "k8s-token"},
+			secretExists:   true,
+			secretKey:      "USER",
+			expectedHeader: "env-user",
+			expectedSource: sourceEnv,
+		},
+		{
+			name:           "static default",
+			secretKey:      "password",
+			fallbackValue:  "default-password",
+			expectedHeader: "default-password",
+			expectedSource: "fallbackValue",
+		},
+		{
+			name:        "nothing provides the key",
+			secretKey:   "password",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, tt.secretData, tt.secretExists)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:      "my-secret",
+				SecretKey:       tt.secretKey,
+				HeaderName:      "X-Auth-Token",
+				Namespace:       "default",
+				CacheTTL:        300,
+				FallbackSources: []string{"file:" + dir, "env:K8SSH_FALLBACK_"},
+				FallbackValue:   tt.fallbackValue,
+			}
+			fallbacks, err := newFallbackSources(config, &tls.Config{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var captured string
+			nextCalled := false
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					nextCalled = true
+					captured = req.Header.Get("X-Auth-Token")
+				}),
+				name:   "fallback-test",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:     &secretCache{ttl: 300 * time.Second},
+				fallbacks: fallbacks,
+			}
+
+			before := metrics.value(metricSourceFallbacks, "middleware", "fallback-test", "source", tt.expectedSource)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if tt.expectError {
+				if nextCalled || rw.Code != http.StatusInternalServerError {
+					t.Errorf("Expected status 500 without calling next, got %d", rw.Code)
+				}
+				return
+			}
+			if captured != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, captured)
+			}
+			if tt.expectedSource != "" {
+				if got := metrics.value(metricSourceFallbacks, "middleware", "fallback-test", "source", tt.expectedSource) - before; got != 1 {
+					t.Errorf("Expected one fallback from %s, got %v", tt.expectedSource, got)
+				}
+			}
+		})
+	}
+}
+
+// TestNewFallbackSources tests parsing and validating fallback entries.
+func TestNewFallbackSources(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		expectError bool
+	}{
+		{name: "file and env", entries: []string{"file:/etc/secret/api-token", "env:API_"}},
+		{name: "kubernetes", entries: []string{"kubernetes:api-token"}},
+		{name: "missing separator", entries: []string{"env"}, expectError: true},
+		{name: "missing name", entries: []string{"env:"}, expectError: true},
+		{name: "unknown source", entries: []string{"consul:api-token"}, expectError: true},
+		{name: "relative file", entries: []string{"file:secret/api-token"}, expectError: true},
+		{name: "vault without address", entries: []string{"vault:shop/api"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallbacks, err := newFallbackSources(&Config{SecretName: "api-token", FallbackSources: tt.entries}, &tls.Config{})
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(fallbacks) != len(tt.entries) {
+				t.Errorf("Expected %d fallbacks, got %d", len(tt.entries), len(fallbacks))
+			}
+		})
+	}
+}
+
+// TestValidateFallbackConfig tests the fallback settings checked against the rest of the config.
+func TestValidateFallbackConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "no fallback", config: &Config{JWTClaim: "tenant"}},
+		{name: "fallback value", config: &Config{FallbackValue: "default"}},
+		{name: "fallback source in validate mode", config: &Config{Mode: modeValidate, FallbackSources: []string{"env:API_"}}},
+		{name: "jwt claim", config: &Config{JWTClaim: "tenant", FallbackSources: []string{"env:API_"}}, expectError: true},
+		{name: "generate mode", config: &Config{Mode: modeGenerate, FallbackValue: "default"}, expectError: true},
+		{name: "fallback value in validate mode", config: &Config{Mode: modeValidate, FallbackValue: "default"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFallbackConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
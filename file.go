@@ -0,0 +1,136 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileSource reads secrets mounted as files: SecretName is the mount directory and each
+// file in it is a key, like a Kubernetes secret volume. Files in subdirectories, as
+// projected volume items and Secrets Store CSI object aliases can create, are keys named by
+// their relative path, e.g. "db/password". Every read compares a cheap version
+// of the directory with the last one and only reads the files again when it changed.
+type fileSource struct {
+	mu      sync.Mutex
+	entries map[string]fileEntry // directory -> last read
+}
+
+// fileEntry is the data last read from a directory and the version it was read at.
+type fileEntry struct {
+	version string
+	data    map[string]string
+}
+
+// readSecret returns the files of dir, read again only when its version changed.
+func (f *fileSource) readSecret(ctx context.Context, dir string) (map[string]string, error) {
+	version, err := directoryVersion(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if entry, ok := f.entries[dir]; ok && entry.version == version {
+		return entry.data, nil
+	}
+
+	data := make(map[string]string)
+	err = walkSecretFiles(dir, "", 0, func(key, path string, info os.FileInfo) error {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read secret file %s: %w", path, err)
+		}
+		data[key] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if f.entries == nil {
+		f.entries = make(map[string]fileEntry)
+	}
+	f.entries[dir] = fileEntry{version: version, data: data}
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Loaded %d keys from %s\n", len(data), dir)
+	return data, nil
+}
+
+// directoryVersion identifies the contents of dir. Kubernetes volumes swap the ..data
+// symlink to a new timestamped directory on every update, so its target is enough; other
+// directories fall back to the size and modification time of every file.
+func directoryVersion(dir string) (string, error) {
+	if target, err := os.Readlink(filepath.Join(dir, "..data")); err == nil {
+		return target, nil
+	}
+
+	var parts []string
+	err := walkSecretFiles(dir, "", 0, func(key, path string, info os.FileInfo) error {
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", key, info.Size(), info.ModTime().UnixNano()))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ","), nil
+}
+
+// maxSecretFileDepth bounds the subdirectories walked below a secret directory, which also
+// stops symlink loops.
+const maxSecretFileDepth = 8
+
+// walkSecretFiles calls fn for every file below dir with its key, the path relative to the
+// secret directory, prefix holding the subdirectories walked so far. Symlinks are followed,
+// as the Kubernetes atomic writer links every visible file and subdirectory through ..data;
+// entries starting with a dot, such as ..data and the timestamped directories it points to,
+// are skipped.
+func walkSecretFiles(dir, prefix string, depth int, fn func(key, path string, info os.FileInfo) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list secret directory %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat secret file %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			if err := fn(prefix+entry.Name(), path, info); err != nil {
+				return err
+			}
+			continue
+		}
+		if depth >= maxSecretFileDepth {
+			return fmt.Errorf("secret directory %s is nested too deeply", path)
+		}
+		if err := walkSecretFiles(path, prefix+entry.Name()+"/", depth+1, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checksChanges marks fileSource as checking the directory version on every read. The
+// directory is not watched: a change is only noticed by the next read.
+func (f *fileSource) checksChanges() {}
+
+// validateFileConfig checks the file source settings.
+func validateFileConfig(config *Config) error {
+	if !filepath.IsAbs(config.SecretName) {
+		return fmt.Errorf("secretName must be an absolute directory with source %q, got %q", sourceFile, config.SecretName)
+	}
+	if config.JWTClaim != "" {
+		return fmt.Errorf("jwtClaim cannot be used with source %q", sourceFile)
+	}
+	return nil
+}
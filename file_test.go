@@ -0,0 +1,222 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAtomic updates dir the way the Kubernetes atomic writer does: the files go into a new
+// timestamped directory, ..data is swapped to it and the visible files link through ..data.
+func writeAtomic(t *testing.T, dir, version string, files map[string]string) {
+	t.Helper()
+
+	if err := os.Mkdir(filepath.Join(dir, version), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, version, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			if err := os.Symlink(filepath.Join("..data", name), link); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(version, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFileSourceReload tests that a mounted secret volume is re-read after a ..data swap.
+func TestFileSourceReload(t *testing.T) {
+	dir := t.TempDir()
+	writeAtomic(t, dir, "..2026_10_15_10_00_00.1", map[string]string{"token": "first-token", "user": "api"})
+
+	source := &fileSource{}
+	data, err := source.readSecret(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"token": "first-token", "user": "api"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+
+	writeAtomic(t, dir, "..2026_10_15_11_00_00.2", map[string]string{"token": "second-token", "user": "api"})
+
+	data, err = source.readSecret(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data["token"] != "second-token" {
+		t.Errorf("Expected the rotated token, got %q", data["token"])
+	}
+}
+
+// TestFileSourcePlainDirectory tests change detection for directories without ..data.
+func TestFileSourcePlainDirectory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("first-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "nested"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	source := &fileSource{}
+	data, err := source.readSecret(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"token": "first-token"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+
+	if err := os.WriteFile(path, []byte("second-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make the change visible even on filesystems with coarse modification times
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = source.readSecret(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data["token"] != "second-token" {
+		t.Errorf("Expected the updated token, got %q", data["token"])
+	}
+
+	if _, err := source.readSecret(t.Context(), filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+// TestFileSourceNestedKeys tests that files in linked subdirectories of a projected volume
+// are keys named by their path.
+func TestFileSourceNestedKeys(t *testing.T) {
+	dir := t.TempDir()
+	version := filepath.Join(dir, "..2026_10_15_10_00_00.1")
+	if err := os.MkdirAll(filepath.Join(version, "db"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"token": "api-token", "db/password": "db-password"} {
+		if err := os.WriteFile(filepath.Join(version, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Base(version), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"token", "db"} {
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := (&fileSource{}).readSecret(t.Context(), dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(data, map[string]string{"token": "api-token", "db/password": "db-password"}) {
+		t.Errorf("Unexpected data %v", data)
+	}
+}
+
+// TestNewDisableKubernetesAPI tests that only configurations without API reads load when the
+// Kubernetes API is disabled for the process.
+func TestNewDisableKubernetesAPI(t *testing.T) {
+	t.Setenv(disableKubernetesAPIEnv, "true")
+
+	config := CreateConfig()
+	config.SecretName = "api-token"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Api-Key"
+	_, err := New(context.Background(), http.NotFoundHandler(), config, "disable-api-test")
+	if err == nil || !strings.Contains(err.Error(), disableKubernetesAPIEnv) {
+		t.Errorf("Expected the Kubernetes source to be rejected, got %v", err)
+	}
+
+	config.Source = sourceFile
+	config.SecretName = t.TempDir()
+	if _, err := New(context.Background(), http.NotFoundHandler(), config, "disable-api-test"); err != nil {
+		t.Errorf("Expected the file source to load, got %v", err)
+	}
+}
+
+// TestServeHTTPFileSource tests serving from a file source without a Kubernetes client.
+func TestServeHTTPFileSource(t *testing.T) {
+	dir := t.TempDir()
+	writeAtomic(t, dir, "..2026_10_15_10_00_00.1", map[string]string{"token": "first-token"})
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-Auth-Token")
+		}),
+		name: "test-middleware",
+		config: &Config{
+			SecretName: dir,
+			SecretKey:  "token",
+			HeaderName: "X-Auth-Token",
+			Source:     sourceFile,
+			CacheTTL:   300,
+		},
+		source: &fileSource{},
+		cache:  &secretCache{ttl: 300 * time.Second},
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if captured != "first-token" {
+		t.Errorf("Expected first-token, got %q", captured)
+	}
+
+	// A rotation is visible on the next request despite the cache TTL
+	writeAtomic(t, dir, "..2026_10_15_11_00_00.2", map[string]string{"token": "second-token"})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if captured != "second-token" {
+		t.Errorf("Expected second-token, got %q", captured)
+	}
+}
+
+// TestValidateFileConfig tests file source configuration checks.
+func TestValidateFileConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "absolute directory", config: &Config{SecretName: "/etc/secret"}},
+		{name: "relative directory", config: &Config{SecretName: "etc/secret"}, expectError: true},
+		{name: "secret name", config: &Config{SecretName: "api-token"}, expectError: true},
+		{name: "jwt claim", config: &Config{SecretName: "/etc/secret", JWTClaim: "tenant"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFileConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcpMetadataURL is the GKE metadata server token endpoint. With Workload Identity it returns
+// tokens of the Google service account bound to the pod's Kubernetes service account.
+const gcpMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpClient reads secret versions from GCP Secret Manager with Workload Identity tokens.
+type gcpClient struct {
+	httpClient  *http.Client
+	project     string
+	endpoint    string // default https://secretmanager.googleapis.com
+	metadataURL string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// readSecret accesses a secret version. name is a secret ID in the configured project, or a
+// full projects/*/secrets/* resource name optionally ending in /versions/*; the latest version
+// is read unless one is given. A payload holding a JSON object yields its members as keys;
+// any other payload is returned under the key "value".
+func (c *gcpClient) readSecret(ctx context.Context, name string) (map[string]string, error) {
+	resource := gcpSecretVersion(c.project, name)
+
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := c.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/v1/"+resource+":access", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, classify(ErrAPIUnavailable, fmt.Errorf("failed to execute request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if resp.StatusCode == http.StatusUnauthorized {
+			// Drop a token revoked before its expiry
+			c.mu.Lock()
+			c.token = ""
+			c.mu.Unlock()
+		}
+		return nil, classify(statusClass(resp.StatusCode), fmt.Errorf("secret manager returned status %d for %s: %s", resp.StatusCode, resource, body))
+	}
+
+	var out struct {
+		Payload struct {
+			Data       []byte `json:"data"`
+			DataCrc32c string `json:"dataCrc32c"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode secret manager response: %w", err)
+	}
+	if out.Payload.DataCrc32c != "" {
+		expected, err := strconv.ParseUint(out.Payload.DataCrc32c, 10, 32)
+		if err != nil || crc32.Checksum(out.Payload.Data, crc32.MakeTable(crc32.Castagnoli)) != uint32(expected) {
+			return nil, fmt.Errorf("payload of %s failed its CRC32C check", resource)
+		}
+	}
+	return jsonFields(string(out.Payload.Data), "value")
+}
+
+// accessToken returns a cached metadata server token, fetching a new one a minute before
+// the current one expires.
+func (c *gcpClient) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(time.Minute).Before(c.expires) {
+		return c.token, nil
+	}
+
+	metadataURL := c.metadataURL
+	if metadataURL == "" {
+		metadataURL = gcpMetadataURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, metadataURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create metadata request: %w", err)
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Workload Identity token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("metadata server returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode metadata token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("metadata server returned no access token")
+	}
+
+	c.token = token.AccessToken
+	c.expires = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return c.token, nil
+}
+
+// gcpSecretVersion resolves a secret name to a projects/*/secrets/*/versions/* resource name.
+func gcpSecretVersion(project, name string) string {
+	name = strings.Trim(name, "/")
+	if !strings.HasPrefix(name, "projects/") {
+		name = "projects/" + project + "/secrets/" + name
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+	return name
+}
+
+// validateGCPConfig checks the GCP Secret Manager source settings.
+func validateGCPConfig(config *Config) error {
+	if config.GCPProject == "" && !strings.HasPrefix(config.SecretName, "projects/") {
+		return fmt.Errorf("gcpProject is required with source %q unless secretName is a full resource name", sourceGCP)
+	}
+	if config.GCPProject != "" && strings.Contains(config.GCPProject, "/") {
+		return fmt.Errorf("invalid gcpProject %q", config.GCPProject)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// mockGCPServer serves a metadata token endpoint on /token and Secret Manager access calls
+// for the payloads, keyed by secret version resource name.
+func mockGCPServer(t *testing.T, tokens *int32, payloads map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+				return
+			}
+			atomic.AddInt32(tokens, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "ya29.token", "expires_in": 3599, "token_type": "Bearer"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer ya29.token" {
+			http.Error(w, `{"error":{"code":401}}`, http.StatusUnauthorized)
+			return
+		}
+		resource := r.URL.Path[len("/v1/") : len(r.URL.Path)-len(":access")]
+		payload, ok := payloads[resource]
+		if !ok {
+			http.Error(w, `{"error":{"code":404,"status":"NOT_FOUND"}}`, http.StatusNotFound)
+			return
+		}
+		checksum := crc32.Checksum([]byte(payload), crc32.MakeTable(crc32.Castagnoli))
+		if resource == "projects/shop/secrets/corrupt/versions/latest" {
+			checksum++
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"name": resource,
+			"payload": map[string]interface{}{
+				"data":       []byte(payload),
+				"dataCrc32c": strconv.FormatUint(uint64(checksum), 10),
+			},
+		})
+	}))
+}
+
+// TestGCPReadSecret tests resource name resolution, payload decoding and checksum verification.
+func TestGCPReadSecret(t *testing.T) {
+	var tokens int32
+	server := mockGCPServer(t, &tokens, map[string]string{
+		"projects/shop/secrets/payments/versions/latest": `{"api-key":"gcp-value"}`,
+		"projects/shop/secrets/plain/versions/3":         "plain-value",
+		"projects/other/secrets/shared/versions/latest":  "shared-value",
+		"projects/shop/secrets/corrupt/versions/latest":  "corrupt-value",
+	})
+	defer server.Close()
+
+	client := &gcpClient{
+		httpClient:  server.Client(),
+		project:     "shop",
+		endpoint:    server.URL,
+		metadataURL: server.URL + "/token",
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		expected    map[string]string
+		expectError bool
+	}{
+		{name: "secret ID, JSON payload", secret: "payments", expected: map[string]string{"api-key": "gcp-value"}},
+		{name: "pinned version", secret: "projects/shop/secrets/plain/versions/3", expected: map[string]string{"value": "plain-value"}},
+		{name: "other project", secret: "projects/other/secrets/shared", expected: map[string]string{"value": "shared-value"}},
+		{name: "checksum mismatch", secret: "corrupt", expectError: true},
+		{name: "missing", secret: "missing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := client.readSecret(t.Context(), tt.secret)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, data)
+			}
+		})
+	}
+
+	if tokens != 1 {
+		t.Errorf("Expected one metadata token request, got %d", tokens)
+	}
+}
+
+// TestValidateGCPConfig tests GCP Secret Manager source configuration checks.
+func TestValidateGCPConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "project and secret ID", config: &Config{GCPProject: "shop", SecretName: "payments"}},
+		{name: "full resource name", config: &Config{SecretName: "projects/shop/secrets/payments"}},
+		{name: "secret ID without project", config: &Config{SecretName: "payments"}, expectError: true},
+		{name: "invalid project", config: &Config{GCPProject: "projects/shop", SecretName: "payments"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGCPConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
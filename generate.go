@@ -0,0 +1,136 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// generatedAtAnnotation records when the plugin last generated the value stored in a secret.
+const generatedAtAnnotation = "k8s-secret-header.traefik.io/generated-at"
+
+// generator holds the current value in generate mode.
+type generator struct {
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+}
+
+// generatedValue returns the current shared value, rotating it through the Kubernetes secret
+// once the interval has elapsed. Replicas coordinate through the secret's resourceVersion:
+// whoever loses the update race adopts the winner's value.
+func (s *SecretHeader) generatedValue(ctx context.Context) (string, error) {
+	g := s.generator
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if g.value != "" && now.Before(g.expires) {
+		return g.value, nil
+	}
+
+	interval := time.Duration(s.config.GenerateInterval) * time.Second
+
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	secret, err := client.getSecret(ctx, s.config.Namespace, s.config.SecretName)
+	s.auditFetch(s.config.Namespace+"/"+s.config.SecretName, secret.resourceVersion(), start, err)
+	if err != nil && !hasStatus(err, http.StatusNotFound) {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", s.config.Namespace, s.config.SecretName, err)
+	}
+
+	// Adopt a value another replica (or an earlier instance) generated within the interval
+	if secret != nil {
+		if value, generatedAt, ok := storedGeneratedValue(secret, s.config.SecretKey); ok && now.Before(generatedAt.Add(interval)) {
+			g.value, g.expires = value, generatedAt.Add(interval)
+			return g.value, nil
+		}
+	}
+
+	value, err := randomValue(s.config.GenerateBytes)
+	if err != nil {
+		return "", err
+	}
+
+	data := map[string]string{s.config.SecretKey: base64.StdEncoding.EncodeToString([]byte(value))}
+	annotations := map[string]string{generatedAtAnnotation: now.UTC().Format(time.RFC3339)}
+	if secret == nil {
+		err = client.createSecret(ctx, s.config.Namespace, &k8sSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: k8sObjectMeta{
+				Name:        s.config.SecretName,
+				Namespace:   s.config.Namespace,
+				Annotations: annotations,
+			},
+			Type: "Opaque",
+			Data: data,
+		})
+	} else {
+		// Only the generated key and annotation are written: the secret read above is a
+		// subset of the object, and replacing it would drop labels, owner references and
+		// everything else it does not model
+		err = client.patchSecret(ctx, s.config.Namespace, s.config.SecretName, &secretMergePatch{
+			Metadata: secretPatchMeta{ResourceVersion: secret.Metadata.ResourceVersion, Annotations: annotations},
+			Data:     data,
+		})
+	}
+
+	if hasStatus(err, http.StatusConflict) {
+		// Another replica rotated first - use its value
+		winner, getErr := client.getSecret(ctx, s.config.Namespace, s.config.SecretName)
+		if getErr != nil {
+			return "", fmt.Errorf("failed to get secret %s/%s after conflict: %w", s.config.Namespace, s.config.SecretName, getErr)
+		}
+		stored, generatedAt, ok := storedGeneratedValue(winner, s.config.SecretKey)
+		if !ok {
+			return "", fmt.Errorf("secret %s/%s has no generated value after conflict", s.config.Namespace, s.config.SecretName)
+		}
+		g.value, g.expires = stored, generatedAt.Add(interval)
+		return g.value, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to store generated value in secret %s/%s: %w", s.config.Namespace, s.config.SecretName, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rotated generated value in secret %s/%s\n",
+		s.config.Namespace, s.config.SecretName)
+
+	g.value, g.expires = value, now.Add(interval)
+	return g.value, nil
+}
+
+// storedGeneratedValue returns the decoded key and its generation time, if the plugin wrote it.
+func storedGeneratedValue(secret *k8sSecret, key string) (string, time.Time, bool) {
+	generatedAt, err := time.Parse(time.RFC3339, secret.Metadata.Annotations[generatedAtAnnotation])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	encoded, ok := secret.Data[key]
+	if !ok {
+		return "", time.Time{}, false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) == 0 {
+		return "", time.Time{}, false
+	}
+	return string(decoded), generatedAt, true
+}
+
+// randomValue returns n random bytes encoded as unpadded base64url.
+func randomValue(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
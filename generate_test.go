@@ -0,0 +1,311 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSecretStore is a stateful mock of the Kubernetes secrets API supporting get, create
+// and resourceVersion-guarded merge patches. Secrets are kept as raw JSON objects, so fields
+// the plugin does not model survive writes only if the plugin leaves them alone.
+type fakeSecretStore struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+	version int
+	writes  int
+	// beforeWrite runs before a write is applied, letting tests simulate a racing replica.
+	beforeWrite func(store *fakeSecretStore)
+}
+
+func (f *fakeSecretStore) put(secret *k8sSecret) {
+	encoded, _ := json.Marshal(secret)
+	var object map[string]interface{}
+	json.Unmarshal(encoded, &object)
+	f.putObject(secret.Metadata.Name, object)
+}
+
+func (f *fakeSecretStore) putObject(name string, object map[string]interface{}) {
+	f.version++
+	metadata, _ := object["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		object["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = strconv.Itoa(f.version)
+	f.secrets[name] = object
+}
+
+// mergePatch applies a JSON merge patch (RFC 7386) to target.
+func mergePatch(target, patch map[string]interface{}) {
+	for key, value := range patch {
+		nested, isObject := value.(map[string]interface{})
+		switch {
+		case value == nil:
+			delete(target, key)
+		case isObject:
+			existing, ok := target[key].(map[string]interface{})
+			if !ok {
+				existing = map[string]interface{}{}
+				target[key] = existing
+			}
+			mergePatch(existing, nested)
+		default:
+			target[key] = value
+		}
+	}
+}
+
+func (f *fakeSecretStore) server(t *testing.T) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		name := path.Base(r.URL.Path)
+		switch r.Method {
+		case http.MethodGet:
+			secret, ok := f.secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(secret)
+		case http.MethodPost, http.MethodPatch:
+			if r.Method == http.MethodPatch && r.Header.Get("Content-Type") != "application/merge-patch+json" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			var object map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&object); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if f.beforeWrite != nil {
+				f.beforeWrite(f)
+				f.beforeWrite = nil
+			}
+			metadata, _ := object["metadata"].(map[string]interface{})
+			if r.Method == http.MethodPost {
+				name, _ = metadata["name"].(string)
+			}
+			existing, exists := f.secrets[name]
+			if r.Method == http.MethodPost && exists {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			if r.Method == http.MethodPatch {
+				if !exists {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				version, ok := metadata["resourceVersion"]
+				if ok && version != existing["metadata"].(map[string]interface{})["resourceVersion"] {
+					w.WriteHeader(http.StatusConflict)
+					return
+				}
+				mergePatch(existing, object)
+				object = existing
+			}
+			f.writes++
+			f.putObject(name, object)
+			json.NewEncoder(w).Encode(object)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+// storedValue returns the decoded value of a key in the fake store.
+func (f *fakeSecretStore) storedValue(t *testing.T, name, key string) string {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	secret, ok := f.secrets[name]
+	if !ok {
+		t.Fatalf("Secret %s not found in store", name)
+	}
+	data, _ := secret["data"].(map[string]interface{})
+	encoded, _ := data[key].(string)
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Failed to decode stored value: %v", err)
+	}
+	return string(decoded)
+}
+
+// generatedSecret builds a secret holding a plugin-generated value.
+func generatedSecret(name, key, value string, generatedAt time.Time) *k8sSecret {
+	return &k8sSecret{
+		Metadata: k8sObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{generatedAtAnnotation: generatedAt.UTC().Format(time.RFC3339)},
+		},
+		Data: map[string]string{
+			key:     base64.StdEncoding.EncodeToString([]byte(value)),
+			"other": base64.StdEncoding.EncodeToString([]byte("untouched")),
+		},
+	}
+}
+
+// TestServeHTTPGenerateMode tests value generation, adoption and rotation through the secret.
+func TestServeHTTPGenerateMode(t *testing.T) {
+	tests := []struct {
+		name           string
+		existing       *k8sSecret
+		beforeWrite    func(store *fakeSecretStore)
+		expectedWrites int
+		expectedHeader string // empty means "whatever is stored in the secret"
+	}{
+		{
+			name:           "missing secret is created",
+			expectedWrites: 1,
+		},
+		{
+			name:           "fresh value from another replica is adopted",
+			existing:       generatedSecret("shared", "token", "replica-value", time.Now().Add(-time.Minute)),
+			expectedWrites: 0,
+			expectedHeader: "replica-value",
+		},
+		{
+			name:           "stale value is rotated",
+			existing:       generatedSecret("shared", "token", "old-value", time.Now().Add(-2*time.Hour)),
+			expectedWrites: 1,
+		},
+		{
+			name:     "losing the update race adopts the winner",
+			existing: generatedSecret("shared", "token", "old-value", time.Now().Add(-2*time.Hour)),
+			beforeWrite: func(store *fakeSecretStore) {
+				store.put(generatedSecret("shared", "token", "winner-value", time.Now()))
+			},
+			expectedWrites: 0,
+			expectedHeader: "winner-value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeSecretStore{secrets: map[string]map[string]interface{}{}, beforeWrite: tt.beforeWrite}
+			if tt.existing != nil {
+				store.put(tt.existing)
+			}
+			mockServer := store.server(t)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:       "shared",
+				SecretKey:        "token",
+				HeaderName:       "X-Gateway-Token",
+				Namespace:        "default",
+				Mode:             modeGenerate,
+				GenerateInterval: 3600,
+				GenerateBytes:    32,
+			}
+
+			var captured []string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				captured = append(captured, req.Header.Get(config.HeaderName))
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:     &secretCache{},
+				generator: &generator{},
+			}
+
+			for i := 0; i < 2; i++ {
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/test", nil))
+				if rw.Code != http.StatusOK {
+					t.Fatalf("Expected status 200, got %d", rw.Code)
+				}
+			}
+
+			stored := store.storedValue(t, "shared", "token")
+			expected := tt.expectedHeader
+			if expected == "" {
+				expected = stored
+			}
+			if captured[0] != expected || captured[1] != expected {
+				t.Errorf("Expected header %q on both requests, got %q", expected, captured)
+			}
+			if captured[0] != stored {
+				t.Errorf("Injected value %q does not match stored value %q", captured[0], stored)
+			}
+			if len(captured[0]) < 32 && tt.expectedHeader == "" {
+				t.Errorf("Generated value %q is too short", captured[0])
+			}
+			if store.writes != tt.expectedWrites {
+				t.Errorf("Expected %d writes, got %d", tt.expectedWrites, store.writes)
+			}
+			if tt.existing != nil && store.storedValue(t, "shared", "other") != "untouched" {
+				t.Error("Expected other keys in the secret to be preserved")
+			}
+		})
+	}
+}
+
+// TestGenerateRotationKeepsMetadata tests that a rotation only writes the generated key and
+// annotation, keeping labels, owner references and fields the plugin does not model.
+func TestGenerateRotationKeepsMetadata(t *testing.T) {
+	store := &fakeSecretStore{secrets: map[string]map[string]interface{}{}}
+	store.put(generatedSecret("shared", "token", "old-value", time.Now().Add(-2*time.Hour)))
+	metadata := store.secrets["shared"]["metadata"].(map[string]interface{})
+	metadata["labels"] = map[string]interface{}{"app": "gateway"}
+	metadata["ownerReferences"] = []interface{}{map[string]interface{}{"kind": "Deployment", "name": "gateway", "uid": "1234"}}
+	metadata["finalizers"] = []interface{}{"example.com/keep"}
+	metadata["annotations"].(map[string]interface{})["team"] = "platform"
+	store.secrets["shared"]["immutable"] = false
+	mockServer := store.server(t)
+	defer mockServer.Close()
+
+	handler := &SecretHeader{
+		next:   http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+		name:   "generate-metadata-test",
+		config: &Config{SecretName: "shared", SecretKey: "token", HeaderName: "X-Gateway-Token", Namespace: "default", Mode: modeGenerate, GenerateInterval: 3600, GenerateBytes: 32},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:     &secretCache{},
+		generator: &generator{},
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/test", nil))
+
+	if store.writes != 1 || store.storedValue(t, "shared", "token") == "old-value" {
+		t.Fatalf("Expected the value to be rotated, got %d writes", store.writes)
+	}
+	secret := store.secrets["shared"]
+	metadata = secret["metadata"].(map[string]interface{})
+	labels, _ := metadata["labels"].(map[string]interface{})
+	owners, _ := metadata["ownerReferences"].([]interface{})
+	finalizers, _ := metadata["finalizers"].([]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if labels["app"] != "gateway" || len(owners) != 1 || len(finalizers) != 1 || annotations["team"] != "platform" {
+		t.Errorf("Expected labels, owner references, finalizers and annotations to survive, got %v", metadata)
+	}
+	if _, ok := secret["immutable"]; !ok || store.storedValue(t, "shared", "other") != "untouched" {
+		t.Errorf("Expected other fields and keys to survive, got %v", secret)
+	}
+}
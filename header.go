@@ -0,0 +1,106 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// headerPlaceholder matches the {{ .Header }} placeholder in secretName/secretKey.
+var headerPlaceholder = regexp.MustCompile(`\{\{\s*\.Header\s*\}\}`)
+
+// defaultHeaderCacheEntries bounds the cache when secretNameHeader selects the secret, since
+// every distinct header value may add an entry.
+const defaultHeaderCacheEntries = 1000
+
+// secretNameGuard restricts the secret names a request header or the Host may select.
+type secretNameGuard struct {
+	names   map[string]bool
+	pattern *regexp.Regexp
+}
+
+// allows reports whether a resolved secret name is in the allowlist or matches the pattern.
+func (g *secretNameGuard) allows(name string) bool {
+	return g.names[name] || (g.pattern != nil && g.pattern.MatchString(name))
+}
+
+// newSecretNameGuard validates the header and host selection settings and returns the guard
+// for the resolved names, or nil when neither secretNameHeader nor {{ .Host }} in secretName
+// selects the secret.
+func newSecretNameGuard(config *Config) (*secretNameGuard, error) {
+	usesPlaceholder := headerPlaceholder.MatchString(config.SecretName) || headerPlaceholder.MatchString(config.SecretKey)
+	hostName := hostPlaceholder.MatchString(config.SecretName)
+	allowlist := len(config.AllowedSecretNames) > 0 || config.AllowedSecretNamePattern != ""
+
+	if config.SecretNameHeader == "" {
+		if usesPlaceholder {
+			return nil, fmt.Errorf("secretName/secretKey use {{ .Header }} but secretNameHeader is not set")
+		}
+		if !hostName {
+			if allowlist {
+				return nil, fmt.Errorf("allowedSecretNames and allowedSecretNamePattern require secretNameHeader or {{ .Host }} in secretName")
+			}
+			return nil, nil
+		}
+		// The client picks the Host header, so the names it may reach are listed like those of a header
+		if !allowlist {
+			return nil, fmt.Errorf("{{ .Host }} in secretName requires allowedSecretNames or allowedSecretNamePattern")
+		}
+		return compileSecretNameGuard(config)
+	}
+	if !usesPlaceholder {
+		return nil, fmt.Errorf("secretNameHeader requires a {{ .Header }} placeholder in secretName or secretKey")
+	}
+	if !allowlist {
+		return nil, fmt.Errorf("secretNameHeader requires allowedSecretNames or allowedSecretNamePattern")
+	}
+	if config.JWTClaim != "" || usesHostPlaceholder(config) {
+		return nil, fmt.Errorf("secretNameHeader cannot be combined with jwtClaim or {{ .Host }}")
+	}
+	if config.Mode == modeGenerate {
+		return nil, fmt.Errorf("secretNameHeader cannot be used with mode %q", modeGenerate)
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return nil, fmt.Errorf("secretNameHeader cannot be used with source %q", config.Source)
+	}
+	if len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return nil, fmt.Errorf("secretNameHeader cannot be used with fallbackSources or fallbackValue")
+	}
+
+	guard, err := compileSecretNameGuard(config)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.CacheImplementation {
+	case "", cacheAuto, cacheLRU:
+		if config.CacheMaxEntries == 0 {
+			config.CacheMaxEntries = defaultHeaderCacheEntries
+		}
+	}
+	return guard, nil
+}
+
+// compileSecretNameGuard returns the guard of allowedSecretNames and allowedSecretNamePattern.
+func compileSecretNameGuard(config *Config) (*secretNameGuard, error) {
+	guard := &secretNameGuard{names: make(map[string]bool, len(config.AllowedSecretNames))}
+	for _, name := range config.AllowedSecretNames {
+		if !secretNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid secret name %q in allowedSecretNames", name)
+		}
+		guard.names[name] = true
+	}
+	if config.AllowedSecretNamePattern != "" {
+		pattern, err := regexp.Compile("^(?:" + config.AllowedSecretNamePattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowedSecretNamePattern: %w", err)
+		}
+		guard.pattern = pattern
+	}
+	return guard, nil
+}
+
+// expandHeader substitutes the header value into the secret name and key and checks the
+// results are valid Kubernetes identifiers.
+func expandHeader(secretName, secretKey, value string) (string, string, error) {
+	return expandPlaceholder(headerPlaceholder, secretName, secretKey, value, "header value")
+}
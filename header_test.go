@@ -0,0 +1,172 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPSecretNameHeader tests selecting the secret from a trusted request header.
+func TestServeHTTPSecretNameHeader(t *testing.T) {
+	mockServer := mockK8sSecretsServer(t, map[string]map[string]string{
+		"tenant-acme-api":   {"token": "acme-token"},
+		"tenant-globex-api": {"token": "globex-token"},
+		"platform-admin":    {"token": "admin-token"},
+	})
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:               "tenant-{{ .Header }}-api",
+		SecretKey:                "token",
+		HeaderName:               "X-Api-Key",
+		Namespace:                "default",
+		CacheTTL:                 300,
+		SecretNameHeader:         "X-Tenant-Id",
+		AllowedSecretNamePattern: "tenant-[a-z]+-api",
+	}
+	guard, err := newSecretNameGuard(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	cache, err := newSecretCache(300*time.Second, config.CacheImplementation, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	evictions := metrics.value(metricCacheEvictions, "middleware", "test-middleware")
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-Api-Key")
+		}),
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:     cache,
+		nameGuard: guard,
+	}
+
+	tests := []struct {
+		name           string
+		tenant         string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{name: "tenant", tenant: "acme", expectedStatus: http.StatusOK, expectedHeader: "acme-token"},
+		{name: "other tenant", tenant: "globex", expectedStatus: http.StatusOK, expectedHeader: "globex-token"},
+		{name: "unknown tenant", tenant: "initech", expectedStatus: http.StatusInternalServerError},
+		{name: "missing header", expectedStatus: http.StatusBadRequest},
+		{name: "invalid name", tenant: "../admin", expectedStatus: http.StatusBadRequest},
+		{name: "name outside the guard", tenant: "acme-api.platform", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			captured = ""
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.tenant != "" {
+				req.Header.Set("X-Tenant-Id", tt.tenant)
+			}
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if captured != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, captured)
+			}
+		})
+	}
+
+	// The cache holds a single entry, so the first tenant was evicted by the second
+	if _, ok := cache.peek("default/tenant-acme-api"); ok {
+		t.Error("Expected the least recently used tenant to be evicted")
+	}
+	if _, ok := cache.peek("default/tenant-globex-api"); !ok {
+		t.Error("Expected the most recent tenant to be cached")
+	}
+	if got := metrics.value(metricCacheEvictions, "middleware", "test-middleware") - evictions; got != 1 {
+		t.Errorf("Expected 1 eviction to be counted, got %v", got)
+	}
+}
+
+// TestNewSecretNameGuard tests header and host selection configuration checks and the guard.
+func TestNewSecretNameGuard(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		allowed     []string
+		denied      []string
+		expectError bool
+	}{
+		{name: "unset", config: &Config{SecretName: "api-token"}},
+		{
+			name:    "allowlist",
+			config:  &Config{SecretName: "{{ .Header }}", SecretNameHeader: "X-Tenant-Id", AllowedSecretNames: []string{"acme", "globex"}},
+			allowed: []string{"acme", "globex"},
+			denied:  []string{"initech", "acme2"},
+		},
+		{
+			name:    "anchored pattern",
+			config:  &Config{SecretName: "tenant-{{ .Header }}", SecretNameHeader: "X-Tenant-Id", AllowedSecretNamePattern: "tenant-[a-z]+"},
+			allowed: []string{"tenant-acme"},
+			denied:  []string{"tenant-acme.admin", "platform-tenant-acme"},
+		},
+		{name: "placeholder without header", config: &Config{SecretName: "tenant-{{ .Header }}"}, expectError: true},
+		{name: "header without placeholder", config: &Config{SecretName: "api-token", SecretNameHeader: "X-Tenant-Id", AllowedSecretNames: []string{"api-token"}}, expectError: true},
+		{name: "no guard", config: &Config{SecretName: "tenant-{{ .Header }}", SecretNameHeader: "X-Tenant-Id"}, expectError: true},
+		{name: "guard without header", config: &Config{SecretName: "api-token", AllowedSecretNames: []string{"api-token"}}, expectError: true},
+		{
+			name:    "host name pattern",
+			config:  &Config{SecretName: "apikey-{{ .Host }}", AllowedSecretNamePattern: `apikey-[a-z]+\.example\.com`},
+			allowed: []string{"apikey-shop.example.com"},
+			denied:  []string{"apikey-shop.example.org", "apikey-tls-admin"},
+		},
+		{name: "host name without guard", config: &Config{SecretName: "apikey-{{ .Host }}"}, expectError: true},
+		{name: "host key without guard", config: &Config{SecretName: "api-keys", SecretKey: "{{ .Host }}"}},
+		{name: "invalid pattern", config: &Config{SecretName: "{{ .Header }}", SecretNameHeader: "X-Tenant-Id", AllowedSecretNamePattern: "("}, expectError: true},
+		{name: "jwt claim", config: &Config{SecretName: "{{ .Header }}", SecretNameHeader: "X-Tenant-Id", AllowedSecretNames: []string{"a"}, JWTClaim: "org"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := newSecretNameGuard(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if guard == nil {
+				if tt.config.SecretNameHeader != "" || len(tt.allowed) > 0 {
+					t.Error("Expected a guard")
+				}
+				return
+			}
+			if tt.config.SecretNameHeader != "" && tt.config.CacheMaxEntries != defaultHeaderCacheEntries {
+				t.Errorf("Expected cacheMaxEntries to default to %d, got %d", defaultHeaderCacheEntries, tt.config.CacheMaxEntries)
+			}
+			for _, name := range tt.allowed {
+				if !guard.allows(name) {
+					t.Errorf("Expected %s to be allowed", name)
+				}
+			}
+			for _, name := range tt.denied {
+				if guard.allows(name) {
+					t.Errorf("Expected %s to be denied", name)
+				}
+			}
+		})
+	}
+}
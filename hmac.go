@@ -0,0 +1,276 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errBodyTooLarge is returned when a body to be signed exceeds the configured limit.
+var errBodyTooLarge = fmt.Errorf("request body too large to sign")
+
+// defaultSignatureComponents produces METHOD \n REQUEST-URI \n TIMESTAMP \n HEX(SHA256(BODY)).
+var defaultSignatureComponents = []string{"method", "uri", "timestamp", "body"}
+
+// signatureComponents are the accepted canonicalization components besides "header:<Name>".
+var signatureComponents = map[string]bool{
+	"method":    true,
+	"uri":       true,
+	"path":      true,
+	"query":     true,
+	"host":      true,
+	"timestamp": true,
+	"nonce":     true,
+	"body":      true,
+}
+
+// serveSigned signs the request with the secret and forwards it.
+func (s *SecretHeader) serveSigned(rw http.ResponseWriter, req *http.Request, secretName, secretKey string) {
+	key, err := s.getValue(req.Context(), secretName, secretKey)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	// Identity headers go out first so they can be signed as header:<Name> components
+	s.injectIdentity(req)
+
+	if err := s.signRequest(req, key); err != nil {
+		if err == errBodyTooLarge {
+			http.Error(rw, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.serveError(rw, req, err)
+		return
+	}
+
+	s.next.ServeHTTP(rw, req)
+}
+
+// signRequest computes the HMAC-SHA256 signature of the request with the secret as key and
+// sets the signature (HeaderName), timestamp and, when signed, nonce headers.
+func (s *SecretHeader) signRequest(req *http.Request, key string) error {
+	var body []byte
+	if s.config.SignBody {
+		var err error
+		if body, err = bufferBody(req, s.config.SignatureMaxBodyBytes); err != nil {
+			return err
+		}
+	}
+
+	nonce := ""
+	if s.signsComponent("nonce") {
+		var err error
+		if nonce, err = randomValue(16); err != nil {
+			return err
+		}
+		req.Header.Set(s.config.SignatureNonceHeader, nonce)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := computeSignature([]byte(key), s.canonicalString(req, timestamp, nonce, body))
+
+	req.Header.Set(s.config.HeaderName, signature)
+	req.Header.Set(s.config.SignatureTimestampHeader, timestamp)
+	return nil
+}
+
+// serveVerified checks the request signature against the secret, answering 401 when it is
+// missing, invalid, outside the allowed clock skew or a replay of an already seen nonce.
+func (s *SecretHeader) serveVerified(rw http.ResponseWriter, req *http.Request, secretName, secretKey string) {
+	key, err := s.getValue(req.Context(), secretName, secretKey)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	if err := s.verifyRequest(req, key, time.Now()); err != nil {
+		if err == errBodyTooLarge {
+			http.Error(rw, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		metrics.inc(metricValidationFailures, "middleware", s.name)
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rejecting request: %v\n", err)
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.next.ServeHTTP(rw, req)
+}
+
+// verifyRequest validates the signature headers of req.
+func (s *SecretHeader) verifyRequest(req *http.Request, key string, now time.Time) error {
+	signature, err := hex.DecodeString(req.Header.Get(s.config.HeaderName))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("missing or malformed signature")
+	}
+
+	timestamp := req.Header.Get(s.config.SignatureTimestampHeader)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("missing or malformed signature timestamp")
+	}
+	skew := time.Duration(s.config.SignatureMaxSkew) * time.Second
+	if age := now.Sub(time.Unix(signedAt, 0)); age > skew || age < -skew {
+		return fmt.Errorf("signature timestamp outside the allowed clock skew")
+	}
+
+	nonce := ""
+	if s.signsComponent("nonce") {
+		if nonce = req.Header.Get(s.config.SignatureNonceHeader); nonce == "" {
+			return fmt.Errorf("missing signature nonce")
+		}
+	}
+
+	var body []byte
+	if s.config.SignBody {
+		if body, err = bufferBody(req, s.config.SignatureMaxBodyBytes); err != nil {
+			return err
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(s.canonicalString(req, timestamp, nonce, body)))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	// Only remember nonces of valid signatures, so forged requests cannot fill the cache
+	if nonce != "" && !s.nonces.add(nonce, now, 2*skew) {
+		return fmt.Errorf("replayed signature nonce")
+	}
+	return nil
+}
+
+// canonicalString builds the string that is signed from the configured components, one per
+// line. The default layout is:
+//
+//	METHOD \n REQUEST-URI \n TIMESTAMP \n HEX(SHA256(BODY))
+//
+// The body line is empty unless signBody is set.
+func (s *SecretHeader) canonicalString(req *http.Request, timestamp, nonce string, body []byte) string {
+	components := s.config.SignatureComponents
+	if len(components) == 0 {
+		components = defaultSignatureComponents
+	}
+
+	parts := make([]string, 0, len(components))
+	for _, component := range components {
+		switch component {
+		case "method":
+			parts = append(parts, req.Method)
+		case "uri":
+			parts = append(parts, req.URL.RequestURI())
+		case "path":
+			parts = append(parts, req.URL.EscapedPath())
+		case "query":
+			parts = append(parts, req.URL.RawQuery)
+		case "host":
+			parts = append(parts, req.Host)
+		case "timestamp":
+			parts = append(parts, timestamp)
+		case "nonce":
+			parts = append(parts, nonce)
+		case "body":
+			bodyHash := ""
+			if s.config.SignBody {
+				sum := sha256.Sum256(body)
+				bodyHash = hex.EncodeToString(sum[:])
+			}
+			parts = append(parts, bodyHash)
+		default:
+			parts = append(parts, req.Header.Get(strings.TrimPrefix(component, "header:")))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// signsComponent reports whether the canonical string includes component.
+func (s *SecretHeader) signsComponent(component string) bool {
+	for _, c := range s.config.SignatureComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSignatureComponents checks the configured canonicalization components.
+func validateSignatureComponents(components []string) error {
+	for _, component := range components {
+		if strings.HasPrefix(component, "header:") && len(component) > len("header:") {
+			continue
+		}
+		if !signatureComponents[component] {
+			return fmt.Errorf("unknown signature component %q", component)
+		}
+	}
+	return nil
+}
+
+// computeSignature returns the hex-encoded HMAC-SHA256 of message.
+func computeSignature(key []byte, message string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bufferBody reads the request body (up to limit bytes) and replaces it with an
+// in-memory copy so the upstream still receives it.
+func bufferBody(req *http.Request, limit int64) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// nonceCache remembers recently seen signature nonces to reject replays.
+type nonceCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // nonce -> expiry
+}
+
+// add records nonce until now+ttl and reports false if it was already seen.
+func (c *nonceCache) add(nonce string, now time.Time, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]time.Time)
+	}
+	if expiry, ok := c.entries[nonce]; ok && now.Before(expiry) {
+		return false
+	}
+
+	// Timestamps outside the skew window are rejected anyway, so expired nonces can go
+	if len(c.entries) >= 1024 {
+		for n, expiry := range c.entries {
+			if !now.Before(expiry) {
+				delete(c.entries, n)
+			}
+		}
+	}
+
+	c.entries[nonce] = now.Add(ttl)
+	return true
+}
@@ -0,0 +1,321 @@
+package traefik_k8s_secret_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPHMACSign tests request signing with the secret as HMAC key.
+func TestServeHTTPHMACSign(t *testing.T) {
+	secretData := map[string]string{
+		"hmac-key": "signing-key",
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		signBody       bool
+		maxBody        int64
+		expectedStatus int
+	}{
+		{
+			name:           "GET request is signed",
+			method:         http.MethodGet,
+			target:         "http://example.com/orders?id=7",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "body is signed and still forwarded",
+			method:         http.MethodPost,
+			target:         "http://example.com/orders",
+			body:           `{"item":"book"}`,
+			signBody:       true,
+			maxBody:        1024,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "oversized body is rejected",
+			method:         http.MethodPost,
+			target:         "http://example.com/orders",
+			body:           strings.Repeat("x", 2048),
+			signBody:       true,
+			maxBody:        1024,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:               "signing",
+				SecretKey:                "hmac-key",
+				HeaderName:               "X-Signature",
+				Namespace:                "default",
+				CacheTTL:                 300,
+				Mode:                     modeHMACSign,
+				SignatureTimestampHeader: "X-Signature-Timestamp",
+				SignBody:                 tt.signBody,
+				SignatureMaxBodyBytes:    tt.maxBody,
+			}
+
+			var signature, timestamp, forwardedBody, canonical string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				signature = req.Header.Get("X-Signature")
+				timestamp = req.Header.Get("X-Signature-Timestamp")
+				body, _ := io.ReadAll(req.Body)
+				forwardedBody = string(body)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			canonical = handler.canonicalString(req, timestamp, "", []byte(forwardedBody))
+			if forwardedBody != tt.body {
+				t.Errorf("Expected upstream to receive body %q, got %q", tt.body, forwardedBody)
+			}
+			ts, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+				t.Errorf("Expected a current unix timestamp, got %q", timestamp)
+			}
+			if expected := computeSignature([]byte("signing-key"), canonical); signature != expected {
+				t.Errorf("Expected signature %q, got %q", expected, signature)
+			}
+		})
+	}
+}
+
+// TestCanonicalString tests the signed string layout.
+func TestCanonicalString(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "http://example.com/a/b?x=1&y=2", nil)
+	req.Header.Set("X-Tenant", "acme")
+
+	tests := []struct {
+		name       string
+		components []string
+		signBody   bool
+		expected   string
+	}{
+		{
+			name:     "default layout without body",
+			expected: "PUT\n/a/b?x=1&y=2\n1700000000\n",
+		},
+		{
+			name:     "default layout with body",
+			signBody: true,
+			expected: "PUT\n/a/b?x=1&y=2\n1700000000\n2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+		},
+		{
+			name:       "custom components",
+			components: []string{"host", "path", "query", "nonce", "header:X-Tenant", "timestamp"},
+			expected:   "example.com\n/a/b\nx=1&y=2\nn0nce\nacme\n1700000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SecretHeader{config: &Config{SignatureComponents: tt.components, SignBody: tt.signBody}}
+			if got := s.canonicalString(req, "1700000000", "n0nce", []byte("hello")); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestServeHTTPHMACVerify tests verification of inbound request signatures.
+func TestServeHTTPHMACVerify(t *testing.T) {
+	secretData := map[string]string{
+		"hmac-key": "signing-key",
+	}
+
+	config := &Config{
+		SecretName:               "signing",
+		SecretKey:                "hmac-key",
+		HeaderName:               "X-Signature",
+		Namespace:                "default",
+		CacheTTL:                 300,
+		Mode:                     modeHMACVerify,
+		SignatureTimestampHeader: "X-Signature-Timestamp",
+		SignatureNonceHeader:     "X-Signature-Nonce",
+		SignatureComponents:      []string{"method", "uri", "timestamp", "nonce", "body"},
+		SignatureMaxSkew:         300,
+		SignBody:                 true,
+		SignatureMaxBodyBytes:    1024,
+	}
+	signer := &SecretHeader{config: config}
+
+	// sign builds a request signed like an hmacSign middleware would, then applies tamper
+	sign := func(key string, signedAt time.Time, nonce string, tamper func(*http.Request)) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/orders?id=7", strings.NewReader(`{"item":"book"}`))
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		canonical := signer.canonicalString(req, timestamp, nonce, []byte(`{"item":"book"}`))
+		req.Header.Set("X-Signature", computeSignature([]byte(key), canonical))
+		req.Header.Set("X-Signature-Timestamp", timestamp)
+		req.Header.Set("X-Signature-Nonce", nonce)
+		if tamper != nil {
+			tamper(req)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name           string
+		requests       []*http.Request
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature is accepted",
+			requests:       []*http.Request{sign("signing-key", time.Now(), "nonce-1", nil)},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong key is rejected",
+			requests:       []*http.Request{sign("other-key", time.Now(), "nonce-2", nil)},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "missing signature is rejected",
+			requests: []*http.Request{sign("signing-key", time.Now(), "nonce-3", func(req *http.Request) {
+				req.Header.Del("X-Signature")
+			})},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered path is rejected",
+			requests: []*http.Request{sign("signing-key", time.Now(), "nonce-4", func(req *http.Request) {
+				req.URL.RawQuery = "id=8"
+				req.RequestURI = "/orders?id=8"
+			})},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body is rejected",
+			requests: []*http.Request{sign("signing-key", time.Now(), "nonce-5", func(req *http.Request) {
+				req.Body = io.NopCloser(strings.NewReader(`{"item":"car"}`))
+			})},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "stale timestamp is rejected",
+			requests:       []*http.Request{sign("signing-key", time.Now().Add(-10*time.Minute), "nonce-6", nil)},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "future timestamp is rejected",
+			requests:       []*http.Request{sign("signing-key", time.Now().Add(10*time.Minute), "nonce-7", nil)},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing nonce is rejected",
+			requests:       []*http.Request{sign("signing-key", time.Now(), "", nil)},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "replayed nonce is rejected",
+			requests: []*http.Request{
+				sign("signing-key", time.Now(), "nonce-8", nil),
+				sign("signing-key", time.Now(), "nonce-8", nil),
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			var forwardedBody string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				body, _ := io.ReadAll(req.Body)
+				forwardedBody = string(body)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			var rw *httptest.ResponseRecorder
+			for _, req := range tt.requests {
+				rw = httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+			}
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if rw.Code == http.StatusOK && forwardedBody != `{"item":"book"}` {
+				t.Errorf("Expected upstream to receive the original body, got %q", forwardedBody)
+			}
+		})
+	}
+}
+
+// TestValidateSignatureComponents tests canonicalization component validation.
+func TestValidateSignatureComponents(t *testing.T) {
+	tests := []struct {
+		name        string
+		components  []string
+		expectError bool
+	}{
+		{name: "default", components: nil},
+		{name: "all components", components: []string{"method", "uri", "path", "query", "host", "timestamp", "nonce", "body", "header:X-Tenant"}},
+		{name: "unknown component", components: []string{"method", "cookie"}, expectError: true},
+		{name: "empty header name", components: []string{"header:"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSignatureComponents(tt.components)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostPlaceholder matches the {{ .Host }} placeholder in secretName/secretKey.
+var hostPlaceholder = regexp.MustCompile(`\{\{\s*\.Host\s*\}\}`)
+
+// hostMissTTL is how long a secret read for a host and found missing or forbidden is
+// answered from memory instead of the API server.
+const hostMissTTL = 30 * time.Second
+
+// usesHostPlaceholder reports whether the secret is selected per request from the Host.
+func usesHostPlaceholder(config *Config) bool {
+	return hostPlaceholder.MatchString(config.SecretName) || hostPlaceholder.MatchString(config.SecretKey)
+}
+
+// requestHost returns the host of req normalized for use in a secret name: lowercased,
+// without port and trailing dot. Hosts that are not DNS names, such as IP literals in
+// brackets, are rejected.
+func requestHost(req *http.Request) (string, error) {
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if !secretNamePattern.MatchString(host) {
+		return "", fmt.Errorf("host %q cannot select a secret", req.Host)
+	}
+	return host, nil
+}
+
+// expandHost substitutes the host into the secret name and key and checks the results are
+// valid Kubernetes identifiers.
+func expandHost(secretName, secretKey, host string) (string, string, error) {
+	return expandPlaceholder(hostPlaceholder, secretName, secretKey, host, "host")
+}
+
+// validateHostSelection checks the settings that cannot be combined with Host templating.
+func validateHostSelection(config *Config) error {
+	if !usesHostPlaceholder(config) {
+		return nil
+	}
+	if config.JWTClaim != "" {
+		return fmt.Errorf("{{ .Host }} and jwtClaim cannot be combined")
+	}
+	if config.Mode == modeGenerate {
+		return fmt.Errorf("{{ .Host }} cannot be used with mode %q", modeGenerate)
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("{{ .Host }} cannot be used with source %q", config.Source)
+	}
+	if len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return fmt.Errorf("{{ .Host }} cannot be used with fallbackSources or fallbackValue")
+	}
+	return nil
+}
+
+// missCache remembers the secrets selected by {{ .Host }} that the API server reported
+// missing or forbidden, so a client cycling through Host headers cannot turn every request
+// into an API read. It holds at most defaultHeaderCacheEntries misses; a nil missCache
+// remembers nothing.
+type missCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	misses map[string]secretMiss
+}
+
+// secretMiss is the failed read of a secret, remembered until until.
+type secretMiss struct {
+	err   error
+	until time.Time
+}
+
+func newMissCache(ttl time.Duration) *missCache {
+	return &missCache{ttl: ttl, misses: make(map[string]secretMiss)}
+}
+
+// lookup returns the error of the remembered miss of the secret cached under cacheKey, or
+// nil without one.
+func (c *missCache) lookup(cacheKey string) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	miss, ok := c.misses[cacheKey]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(miss.until) {
+		delete(c.misses, cacheKey)
+		return nil
+	}
+	return miss.err
+}
+
+// record remembers err for the secret cached under cacheKey when the API server answered
+// 404 or 403. Other errors, such as an unreachable API server, are retried by every request.
+func (c *missCache) record(cacheKey string, err error) {
+	if c == nil || !(hasStatus(err, http.StatusNotFound) || hasStatus(err, http.StatusForbidden)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.misses) >= defaultHeaderCacheEntries {
+		for key, miss := range c.misses {
+			if now.After(miss.until) {
+				delete(c.misses, key)
+			}
+		}
+		if len(c.misses) >= defaultHeaderCacheEntries {
+			return
+		}
+	}
+	c.misses[cacheKey] = secretMiss{err: err, until: now.Add(c.ttl)}
+}
+
+// reset forgets every miss, so secrets created since are read on the next request.
+func (c *missCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.misses = make(map[string]secretMiss)
+}
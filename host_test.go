@@ -0,0 +1,205 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestRequestHost tests host normalization and rejection.
+func TestRequestHost(t *testing.T) {
+	tests := []struct {
+		host        string
+		expected    string
+		expectError bool
+	}{
+		{host: "shop.example.com", expected: "shop.example.com"},
+		{host: "Shop.Example.COM:8443", expected: "shop.example.com"},
+		{host: "shop.example.com.", expected: "shop.example.com"},
+		{host: "10.0.0.1:80", expected: "10.0.0.1"},
+		{host: "[::1]:8080", expectError: true},
+		{host: "shop_example.com", expectError: true},
+		{host: "", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Host = tt.host
+
+			host, err := requestHost(req)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got host %q", host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if host != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, host)
+			}
+		})
+	}
+}
+
+// TestServeHTTPHostTemplate tests selecting the secret per request host, within the allowed
+// names, and remembering secrets found missing.
+func TestServeHTTPHostTemplate(t *testing.T) {
+	mockServer := mockK8sSecretsServer(t, map[string]map[string]string{
+		"apikey-shop.example.com": {"token": "shop-token"},
+		"apikey-blog.example.com": {"token": "blog-token"},
+	})
+	defer mockServer.Close()
+	var reads int32
+	secrets := mockServer.Config.Handler
+	mockServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&reads, 1)
+		secrets.ServeHTTP(w, r)
+	})
+
+	config := &Config{
+		SecretName:               "apikey-{{ .Host }}",
+		SecretKey:                "token",
+		HeaderName:               "X-Api-Key",
+		Namespace:                "default",
+		CacheTTL:                 300,
+		AllowedSecretNamePattern: `apikey-[a-z]+\.example\.com`,
+	}
+	guard, err := newSecretNameGuard(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-Api-Key")
+		}),
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:     &secretCache{ttl: 300 * time.Second},
+		perHost:   true,
+		nameGuard: guard,
+		misses:    newMissCache(hostMissTTL),
+	}
+
+	tests := []struct {
+		host           string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{host: "shop.example.com", expectedStatus: http.StatusOK, expectedHeader: "shop-token"},
+		{host: "BLOG.example.com:443", expectedStatus: http.StatusOK, expectedHeader: "blog-token"},
+		{host: "unknown.example.com", expectedStatus: http.StatusInternalServerError},
+		{host: "unknown.example.com", expectedStatus: http.StatusInternalServerError},
+		{host: "shop.example.org", expectedStatus: http.StatusForbidden},
+		{host: "[::1]", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			captured = ""
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			req.Host = tt.host
+			rw := httptest.NewRecorder()
+
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if captured != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, captured)
+			}
+		})
+	}
+
+	// The missing secret is read once, then answered from the miss cache; disallowed and
+	// invalid hosts are not read at all
+	if got := atomic.LoadInt32(&reads); got != 3 {
+		t.Errorf("Expected 3 API reads, got %d", got)
+	}
+
+	// Each resolved name is cached on its own
+	for _, key := range []string{"default/apikey-shop.example.com", "default/apikey-blog.example.com"} {
+		if _, ok := handler.cache.peek(key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+}
+
+// TestValidateHostSelection tests settings rejected with {{ .Host }}.
+func TestValidateHostSelection(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "no placeholder", config: &Config{SecretName: "api-token", JWTClaim: "tenant"}},
+		{name: "secret name", config: &Config{SecretName: "apikey-{{ .Host }}"}},
+		{name: "secret key", config: &Config{SecretName: "api-keys", SecretKey: "{{.Host}}"}},
+		{name: "jwt claim", config: &Config{SecretName: "apikey-{{ .Host }}", JWTClaim: "tenant"}, expectError: true},
+		{name: "generate mode", config: &Config{SecretName: "apikey-{{ .Host }}", Mode: modeGenerate}, expectError: true},
+		{name: "external source", config: &Config{SecretName: "apikey-{{ .Host }}", Source: sourceVault}, expectError: true},
+		{name: "fallback value", config: &Config{SecretName: "apikey-{{ .Host }}", FallbackValue: "default"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHostSelection(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestMissCache tests which failed reads are remembered and for how long.
+func TestMissCache(t *testing.T) {
+	cache := newMissCache(50 * time.Millisecond)
+	notFound := fmt.Errorf("failed to get secret: %w", &apiStatusError{code: http.StatusNotFound})
+
+	cache.record("default/apikey-a", notFound)
+	cache.record("default/apikey-b", &apiStatusError{code: http.StatusForbidden})
+	cache.record("default/apikey-c", &apiStatusError{code: http.StatusServiceUnavailable})
+
+	if err := cache.lookup("default/apikey-a"); err != notFound {
+		t.Errorf("Expected the 404 to be remembered, got %v", err)
+	}
+	if err := cache.lookup("default/apikey-b"); err == nil {
+		t.Error("Expected the 403 to be remembered")
+	}
+	if err := cache.lookup("default/apikey-c"); err != nil {
+		t.Errorf("Expected an unavailable API server to be retried, got %v", err)
+	}
+
+	cache.reset()
+	if err := cache.lookup("default/apikey-a"); err != nil {
+		t.Errorf("Expected reset to forget the miss, got %v", err)
+	}
+
+	cache.record("default/apikey-a", notFound)
+	time.Sleep(100 * time.Millisecond)
+	if err := cache.lookup("default/apikey-a"); err != nil {
+		t.Errorf("Expected the miss to expire, got %v", err)
+	}
+
+	var disabled *missCache
+	disabled.record("default/apikey-a", notFound)
+	if err := disabled.lookup("default/apikey-a"); err != nil {
+		t.Errorf("Expected a nil cache to remember nothing, got %v", err)
+	}
+}
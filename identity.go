@@ -0,0 +1,110 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Supported values of Config.InstanceHeaders.
+const (
+	instancePodName      = "podName"
+	instancePodNamespace = "podNamespace"
+	instanceNodeName     = "nodeName"
+	instanceMiddleware   = "middleware"
+)
+
+// clusterIdentity resolves the cluster identity headers sent along with the credential,
+// mapping header name to value. Values read from files (e.g. a downward API volume exposing
+// a node or namespace label) are taken once at startup.
+func clusterIdentity(config *Config) (map[string]string, error) {
+	identity := make(map[string]string)
+
+	for _, field := range []struct {
+		option, value, file, header string
+	}{
+		{"clusterName", config.ClusterName, config.ClusterNameFile, config.ClusterNameHeader},
+		{"clusterRegion", config.ClusterRegion, config.ClusterRegionFile, config.ClusterRegionHeader},
+	} {
+		if field.value != "" && field.file != "" {
+			return nil, fmt.Errorf("%s and %sFile are mutually exclusive", field.option, field.option)
+		}
+
+		value := field.value
+		if field.file != "" {
+			content, err := os.ReadFile(field.file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %sFile: %w", field.option, err)
+			}
+			if value = strings.TrimSpace(string(content)); value == "" {
+				return nil, fmt.Errorf("%sFile %s is empty", field.option, field.file)
+			}
+		}
+		if value == "" {
+			continue
+		}
+
+		if field.header == "" {
+			return nil, fmt.Errorf("%sHeader cannot be empty", field.option)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("%s must be a single line", field.option)
+		}
+		identity[field.header] = value
+	}
+
+	if len(identity) == 0 {
+		return nil, nil
+	}
+	return identity, nil
+}
+
+// instanceIdentity resolves the instance headers sent along with the credential, so upstreams
+// can tell which gateway pod injected it. Pod name and namespace come from the POD_NAME and
+// POD_NAMESPACE variables of the downward API, or else from the hostname and the service
+// account namespace; the node name comes from NODE_NAME. name is the middleware name.
+func instanceIdentity(config *Config, name string) (map[string]string, error) {
+	headers := make([]string, 0, len(config.InstanceHeaders))
+	for header := range config.InstanceHeaders {
+		headers = append(headers, header)
+	}
+	sort.Strings(headers)
+
+	host, _ := os.Hostname()
+	identity := make(map[string]string, len(headers))
+	for _, header := range headers {
+		if strings.EqualFold(header, config.HeaderName) {
+			return nil, fmt.Errorf("instanceHeaders cannot set headerName %s", header)
+		}
+		var value string
+		switch field := config.InstanceHeaders[header]; field {
+		case instancePodName:
+			value = podReference(host).Name
+		case instancePodNamespace:
+			value = podReference(host).Namespace
+		case instanceNodeName:
+			if value = os.Getenv("NODE_NAME"); value == "" {
+				return nil, fmt.Errorf("instanceHeaders[%s]: nodeName needs the NODE_NAME variable, e.g. from fieldRef spec.nodeName", header)
+			}
+		case instanceMiddleware:
+			value = name
+		default:
+			return nil, fmt.Errorf("instanceHeaders[%s] must be %s, %s, %s or %s, got %q",
+				header, instancePodName, instancePodNamespace, instanceNodeName, instanceMiddleware, field)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("instanceHeaders[%s]: %s is unknown, set POD_NAME and POD_NAMESPACE", header, config.InstanceHeaders[header])
+		}
+		identity[header] = value
+	}
+	return identity, nil
+}
+
+// injectIdentity sets the cluster and instance identity headers, replacing any client-supplied copy.
+func (s *SecretHeader) injectIdentity(req *http.Request) {
+	for name, value := range s.identity {
+		req.Header.Set(name, value)
+	}
+}
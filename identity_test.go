@@ -0,0 +1,222 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestClusterIdentity tests resolving identity headers from config and files.
+func TestClusterIdentity(t *testing.T) {
+	dir := t.TempDir()
+	regionFile := filepath.Join(dir, "region")
+	if err := os.WriteFile(regionFile, []byte("eu-west-1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		config      *Config
+		expected    map[string]string
+		expectError bool
+	}{
+		{
+			name:     "not configured",
+			config:   CreateConfig(),
+			expected: nil,
+		},
+		{
+			name: "name from config and region from file",
+			config: &Config{
+				ClusterName:         "prod-a",
+				ClusterNameHeader:   "X-Cluster-Name",
+				ClusterRegionFile:   regionFile,
+				ClusterRegionHeader: "X-Cluster-Region",
+			},
+			expected: map[string]string{"X-Cluster-Name": "prod-a", "X-Cluster-Region": "eu-west-1"},
+		},
+		{
+			name:        "value and file together",
+			config:      &Config{ClusterName: "prod-a", ClusterNameFile: regionFile, ClusterNameHeader: "X-Cluster-Name"},
+			expectError: true,
+		},
+		{
+			name:        "missing file",
+			config:      &Config{ClusterNameFile: filepath.Join(dir, "missing"), ClusterNameHeader: "X-Cluster-Name"},
+			expectError: true,
+		},
+		{
+			name:        "empty file",
+			config:      &Config{ClusterNameFile: emptyFile, ClusterNameHeader: "X-Cluster-Name"},
+			expectError: true,
+		},
+		{
+			name:        "empty header name",
+			config:      &Config{ClusterName: "prod-a"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := clusterIdentity(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(identity, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, identity)
+			}
+		})
+	}
+}
+
+// TestServeHTTPClusterIdentity tests that identity headers travel with the credential and
+// cannot be spoofed by clients.
+func TestServeHTTPClusterIdentity(t *testing.T) {
+	secretData := map[string]string{
+		"api-key": "secret-value",
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		clientHeader   string
+		expectedHeader string
+	}{
+		{
+			name:           "identity injected with the credential",
+			method:         http.MethodGet,
+			expectedHeader: "prod-a",
+		},
+		{
+			name:           "client-supplied identity is replaced",
+			method:         http.MethodGet,
+			clientHeader:   "spoofed",
+			expectedHeader: "prod-a",
+		},
+		{
+			name:           "client-supplied identity is stripped without injection",
+			method:         http.MethodPost,
+			clientHeader:   "spoofed",
+			expectedHeader: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName: "my-secret",
+				SecretKey:  "api-key",
+				HeaderName: "X-API-Key",
+				Namespace:  "default",
+				CacheTTL:   300,
+				Methods:    []string{http.MethodGet},
+			}
+
+			var cluster string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				cluster = req.Header.Get("X-Cluster-Name")
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+				identity: map[string]string{"X-Cluster-Name": "prod-a"},
+			}
+
+			req := httptest.NewRequest(tt.method, "http://example.com/test", nil)
+			if tt.clientHeader != "" {
+				req.Header.Set("X-Cluster-Name", tt.clientHeader)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rw.Code)
+			}
+			if cluster != tt.expectedHeader {
+				t.Errorf("Expected X-Cluster-Name %q, got %q", tt.expectedHeader, cluster)
+			}
+		})
+	}
+}
+
+// TestInstanceIdentity tests resolving instance headers from downward API variables.
+func TestInstanceIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "traefik-7d9f8-abcde")
+	t.Setenv("POD_NAMESPACE", "traefik")
+	t.Setenv("NODE_NAME", "")
+
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		nodeName    string
+		expected    map[string]string
+		expectError bool
+	}{
+		{name: "not configured", expected: map[string]string{}},
+		{
+			name: "pod and middleware",
+			headers: map[string]string{
+				"X-Gateway-Pod":        "podName",
+				"X-Gateway-Namespace":  "podNamespace",
+				"X-Gateway-Middleware": "middleware",
+			},
+			expected: map[string]string{
+				"X-Gateway-Pod":        "traefik-7d9f8-abcde",
+				"X-Gateway-Namespace":  "traefik",
+				"X-Gateway-Middleware": "default-api-auth@kubernetescrd",
+			},
+		},
+		{
+			name:     "node",
+			headers:  map[string]string{"X-Gateway-Node": "nodeName"},
+			nodeName: "node-1",
+			expected: map[string]string{"X-Gateway-Node": "node-1"},
+		},
+		{name: "node unknown", headers: map[string]string{"X-Gateway-Node": "nodeName"}, expectError: true},
+		{name: "unknown property", headers: map[string]string{"X-Gateway-Zone": "zone"}, expectError: true},
+		{name: "credential header", headers: map[string]string{"x-api-key": "podName"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NODE_NAME", tt.nodeName)
+			config := &Config{HeaderName: "X-API-Key", InstanceHeaders: tt.headers}
+			identity, err := instanceIdentity(config, "default-api-auth@kubernetescrd")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if !tt.expectError && !reflect.DeepEqual(identity, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, identity)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validateAPIImpersonation checks the apiImpersonateUser and apiImpersonateGroups settings.
+func validateAPIImpersonation(config *Config) error {
+	if config.APIImpersonateUser == "" {
+		if len(config.APIImpersonateGroups) > 0 {
+			return fmt.Errorf("apiImpersonateGroups requires apiImpersonateUser")
+		}
+		return nil
+	}
+	if strings.TrimSpace(config.APIImpersonateUser) != config.APIImpersonateUser {
+		return fmt.Errorf("apiImpersonateUser cannot have surrounding spaces")
+	}
+	for _, group := range config.APIImpersonateGroups {
+		if strings.TrimSpace(group) == "" {
+			return fmt.Errorf("apiImpersonateGroups cannot contain an empty entry")
+		}
+	}
+	if config.APITokenSecretName != "" {
+		return fmt.Errorf("apiImpersonateUser cannot be combined with apiTokenSecretName")
+	}
+	return nil
+}
+
+// impersonation is the identity API requests act as, through the Impersonate-User and
+// Impersonate-Group headers. The plugin's own identity needs the impersonate verb on it.
+type impersonation struct {
+	user   string
+	groups []string
+}
+
+// newImpersonation returns the impersonation configured by config, or nil without one.
+func newImpersonation(config *Config) *impersonation {
+	if config.APIImpersonateUser == "" {
+		return nil
+	}
+	return &impersonation{user: config.APIImpersonateUser, groups: config.APIImpersonateGroups}
+}
+
+// apply sets the impersonation headers in header. It does nothing on a nil impersonation.
+func (i *impersonation) apply(header http.Header) {
+	if i == nil {
+		return
+	}
+	header.Set("Impersonate-User", i.user)
+	for _, group := range i.groups {
+		header.Add("Impersonate-Group", group)
+	}
+}
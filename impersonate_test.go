@@ -0,0 +1,85 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// TestImpersonationHeaders tests that API requests carry the configured impersonation.
+func TestImpersonationHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *Config
+		expectedUser   string
+		expectedGroups []string
+	}{
+		{name: "none", config: &Config{}},
+		{
+			name:         "user",
+			config:       &Config{APIImpersonateUser: "system:serviceaccount:traefik:secret-reader"},
+			expectedUser: "system:serviceaccount:traefik:secret-reader",
+		},
+		{
+			name: "user and groups",
+			config: &Config{
+				APIImpersonateUser:   "secret-reader",
+				APIImpersonateGroups: []string{"secret-readers", "system:authenticated"},
+			},
+			expectedUser:   "secret-reader",
+			expectedGroups: []string{"secret-readers", "system:authenticated"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user string
+			var groups []string
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user = r.Header.Get("Impersonate-User")
+				groups = r.Header.Values("Impersonate-Group")
+				w.Write([]byte(`{"data":{}}`))
+			}))
+			defer mockServer.Close()
+
+			client := &k8sClient{
+				httpClient:  mockServer.Client(),
+				baseURL:     mockServer.URL,
+				token:       "test-token",
+				impersonate: newImpersonation(tt.config),
+			}
+			if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+				t.Fatal(err)
+			}
+			if user != tt.expectedUser || !reflect.DeepEqual(groups, tt.expectedGroups) {
+				t.Errorf("Expected user %q groups %v, got %q %v", tt.expectedUser, tt.expectedGroups, user, groups)
+			}
+		})
+	}
+}
+
+// TestValidateAPIImpersonation tests apiImpersonateUser and apiImpersonateGroups checks.
+func TestValidateAPIImpersonation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "none", config: &Config{}},
+		{name: "user", config: &Config{APIImpersonateUser: "secret-reader", APIImpersonateGroups: []string{"readers"}}},
+		{name: "groups without user", config: &Config{APIImpersonateGroups: []string{"readers"}}, expectError: true},
+		{name: "empty group", config: &Config{APIImpersonateUser: "secret-reader", APIImpersonateGroups: []string{" "}}, expectError: true},
+		{name: "padded user", config: &Config{APIImpersonateUser: " secret-reader"}, expectError: true},
+		{name: "token secret", config: &Config{APIImpersonateUser: "secret-reader", APITokenSecretName: "api-token"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIImpersonation(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InventoryEntry describes the credential a middleware instance handles, without any secret
+// value, so API consumers and auditors can see which routes receive which class of credential.
+type InventoryEntry struct {
+	Middleware string `json:"middleware"`
+	Mode       string `json:"mode"`
+	// Direction is "injected" when the gateway adds the credential to upstream requests and
+	// "required" when clients must present it.
+	Direction      string                 `json:"direction"`
+	Header         string                 `json:"header"`
+	Secret         string                 `json:"secret"`
+	Keys           []string               `json:"keys"`
+	Fallbacks      []string               `json:"fallbacks,omitempty"`
+	Methods        []string               `json:"methods,omitempty"`
+	SecurityScheme map[string]interface{} `json:"securityScheme"`
+}
+
+// NewInventoryEntry renders a middleware configuration as an inventory entry.
+func NewInventoryEntry(name string, config *Config) InventoryEntry {
+	mode := config.Mode
+	if mode == "" {
+		mode = modeInject
+	}
+
+	direction := "injected"
+	switch mode {
+	case modeValidate, modeHMACVerify, modeVerifyJWT:
+		direction = "required"
+	}
+
+	keys := config.SecretKeys
+	if len(keys) == 0 {
+		keys = []string{config.SecretKey}
+	}
+	if config.SecretKeyPattern != "" {
+		keys = []string{config.SecretKeyPattern}
+	}
+
+	secret := config.Namespace
+	if secret == "" {
+		secret = "default"
+	}
+	if len(config.Namespaces) > 0 {
+		secret = strings.Join(config.Namespaces, ",")
+	}
+	secret += "/" + config.SecretName
+	switch config.Source {
+	case sourceVault:
+		secret = "vault:" + config.VaultMount + "/" + config.SecretName
+	case sourceSecretsManager:
+		secret = "awsSecretsManager:" + config.SecretName
+	case sourceGCP:
+		secret = "gcpSecretManager:" + gcpSecretVersion(config.GCPProject, config.SecretName)
+	case sourceAzure:
+		secret = "azureKeyVault:" + config.AzureVaultURI + "/secrets/" + config.SecretName
+	case sourceFile:
+		secret = "file:" + config.SecretName
+	case sourceEnv:
+		secret = "env:" + config.SecretName
+	case "", sourceKubernetes:
+	default:
+		secret = config.Source + ":" + config.SecretName
+	}
+
+	return InventoryEntry{
+		Middleware:     name,
+		Mode:           mode,
+		Direction:      direction,
+		Header:         config.HeaderName,
+		Secret:         secret,
+		Keys:           keys,
+		Fallbacks:      config.FallbackSources,
+		Methods:        config.Methods,
+		SecurityScheme: OpenAPISecurityScheme(config),
+	}
+}
+
+// OpenAPISecurityScheme renders the credential of a middleware configuration as an OpenAPI 3
+// securityScheme object. Credentials the gateway injects are marked with
+// "x-injected-by-gateway", since API consumers do not send them themselves.
+func OpenAPISecurityScheme(config *Config) map[string]interface{} {
+	var scheme map[string]interface{}
+	prefix := strings.ToLower(strings.TrimSpace(config.ValuePrefix))
+
+	switch {
+	case config.Mode == modeHMACSign || config.Mode == modeHMACVerify:
+		scheme = map[string]interface{}{
+			"type":        "apiKey",
+			"in":          "header",
+			"name":        config.HeaderName,
+			"description": "HMAC-SHA256 request signature, timestamp in " + config.SignatureTimestampHeader,
+		}
+	case strings.EqualFold(config.HeaderName, "Authorization") && (config.Mode == modeMintJWT || config.Mode == modeVerifyJWT):
+		scheme = map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+	case strings.EqualFold(config.HeaderName, "Authorization") && (prefix == "" || prefix == "bearer"):
+		scheme = map[string]interface{}{"type": "http", "scheme": "bearer"}
+	case strings.EqualFold(config.HeaderName, "Authorization") && prefix == "basic":
+		scheme = map[string]interface{}{"type": "http", "scheme": "basic"}
+	default:
+		scheme = map[string]interface{}{"type": "apiKey", "in": "header", "name": config.HeaderName}
+	}
+
+	switch config.Mode {
+	case modeValidate, modeHMACVerify, modeVerifyJWT:
+	default:
+		scheme["x-injected-by-gateway"] = true
+	}
+	return scheme
+}
+
+// inventoryRegistry holds the inventory of every middleware instance in the process.
+type inventoryRegistry struct {
+	mu      sync.Mutex
+	entries map[string]inventoryRecord
+	last    uint64
+}
+
+// inventoryRecord is a registered entry and the registration it came from.
+type inventoryRecord struct {
+	entry InventoryEntry
+	id    uint64
+}
+
+// inventory is the process-wide registry; instances are replaced by name on reload.
+var inventory = &inventoryRegistry{entries: make(map[string]inventoryRecord)}
+
+// register records or replaces the entry of a middleware instance, returning the id that
+// unregisters it.
+func (r *inventoryRegistry) register(entry InventoryEntry) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last++
+	r.entries[entry.Middleware] = inventoryRecord{entry: entry, id: r.last}
+	return r.last
+}
+
+// unregister removes the entry of middleware if it is still the one registered under id, so
+// an instance released after a reload does not remove the entry of its replacement.
+func (r *inventoryRegistry) unregister(middleware string, id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.entries[middleware]; ok && record.id == id {
+		delete(r.entries, middleware)
+	}
+}
+
+// track registers the entry of handler until the handler is released. Traefik drops the
+// instances of a previous configuration without closing them, so the entry is removed when
+// the garbage collector finalizes the instance.
+func (r *inventoryRegistry) track(handler *SecretHeader) {
+	name := handler.name
+	id := r.register(NewInventoryEntry(name, handler.config))
+	runtime.SetFinalizer(handler, func(*SecretHeader) {
+		r.unregister(name, id)
+	})
+}
+
+// list returns all entries sorted by middleware name.
+func (r *inventoryRegistry) list() []InventoryEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]InventoryEntry, 0, len(r.entries))
+	for _, record := range r.entries {
+		entries = append(entries, record.entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Middleware < entries[j].Middleware })
+	return entries
+}
+
+// serveInventory writes the inventory as JSON to an allowed client, together with the OpenAPI
+// securitySchemes keyed by middleware name, ready to paste into components.securitySchemes,
+// and the JSON Schema of the configuration accepted by the running plugin version. The
+// inventory covers every instance in the process, so it is kept to admins.
+func (s *SecretHeader) serveInventory(rw http.ResponseWriter, req *http.Request) {
+	if !s.admins.allows(req) {
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return
+	}
+	entries := inventory.list()
+	schemes := make(map[string]interface{}, len(entries))
+	for _, entry := range entries {
+		schemes[entry.Middleware] = entry.SecurityScheme
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(map[string]interface{}{
+		"middlewares":     entries,
+		"securitySchemes": schemes,
+		"configSchema":    json.RawMessage(configSchema),
+	})
+}
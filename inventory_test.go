@@ -0,0 +1,153 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestOpenAPISecurityScheme tests rendering configurations as OpenAPI security schemes.
+func TestOpenAPISecurityScheme(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *Config
+		expected map[string]interface{}
+	}{
+		{
+			name:   "injected API key",
+			config: &Config{HeaderName: "X-API-Key"},
+			expected: map[string]interface{}{
+				"type": "apiKey", "in": "header", "name": "X-API-Key", "x-injected-by-gateway": true,
+			},
+		},
+		{
+			name:   "injected basic auth",
+			config: &Config{HeaderName: "Authorization", ValuePrefix: "Basic "},
+			expected: map[string]interface{}{
+				"type": "http", "scheme": "basic", "x-injected-by-gateway": true,
+			},
+		},
+		{
+			name:     "validated bearer token",
+			config:   &Config{HeaderName: "Authorization", ValuePrefix: "Bearer ", Mode: modeValidate},
+			expected: map[string]interface{}{"type": "http", "scheme": "bearer"},
+		},
+		{
+			name:     "verified JWT",
+			config:   &Config{HeaderName: "Authorization", Mode: modeVerifyJWT},
+			expected: map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+		},
+		{
+			name:   "custom Authorization scheme",
+			config: &Config{HeaderName: "Authorization", ValuePrefix: "Token ", Mode: modeValidate},
+			expected: map[string]interface{}{
+				"type": "apiKey", "in": "header", "name": "Authorization",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OpenAPISecurityScheme(tt.config); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestServeHTTPInventoryPath tests that the inventory path lists registered middlewares.
+func TestServeHTTPInventoryPath(t *testing.T) {
+	inventory.register(NewInventoryEntry("inventory-test", &Config{
+		SecretName: "partner-credentials",
+		SecretKey:  "api-key",
+		HeaderName: "X-API-Key",
+		Namespace:  "payments",
+	}))
+
+	admins, err := newIPAllowlist(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &SecretHeader{
+		next:   http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) { t.Error("Inventory request was proxied") }),
+		name:   "inventory-test",
+		config: &Config{HeaderName: "X-API-Key", InventoryPath: "/inventory"},
+		admins: admins,
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/inventory", nil))
+	if rw.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a client outside adminAllowedCIDRs, got %d", rw.Code)
+	}
+
+	rw = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/inventory", nil)
+	req.RemoteAddr = "127.0.0.1:41234"
+	handler.ServeHTTP(rw, req)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rw.Code)
+	}
+
+	var body struct {
+		Middlewares     []InventoryEntry                  `json:"middlewares"`
+		SecuritySchemes map[string]map[string]interface{} `json:"securitySchemes"`
+		ConfigSchema    map[string]interface{}            `json:"configSchema"`
+	}
+	if err := json.NewDecoder(rw.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode inventory: %v", err)
+	}
+
+	found := false
+	for _, entry := range body.Middlewares {
+		if entry.Middleware == "inventory-test" {
+			found = true
+			if entry.Secret != "payments/partner-credentials" || entry.Direction != "injected" || entry.Mode != modeInject {
+				t.Errorf("Unexpected inventory entry %+v", entry)
+			}
+		}
+	}
+	if !found {
+		t.Error("Expected inventory-test in the inventory")
+	}
+	if body.SecuritySchemes["inventory-test"]["name"] != "X-API-Key" {
+		t.Errorf("Expected a security scheme for inventory-test, got %v", body.SecuritySchemes["inventory-test"])
+	}
+	if body.ConfigSchema["type"] != "object" {
+		t.Errorf("Expected the config schema in the inventory, got %v", body.ConfigSchema)
+	}
+}
+
+// TestInventoryUnregister tests that a released instance only removes its own entry.
+func TestInventoryUnregister(t *testing.T) {
+	registry := &inventoryRegistry{entries: make(map[string]inventoryRecord)}
+	old := registry.register(InventoryEntry{Middleware: "reloaded"})
+	current := registry.register(InventoryEntry{Middleware: "reloaded"})
+
+	registry.unregister("reloaded", old)
+	if len(registry.list()) != 1 {
+		t.Fatal("Expected the replaced instance to leave the new entry in place")
+	}
+	registry.unregister("reloaded", current)
+	if len(registry.list()) != 0 {
+		t.Errorf("Expected the entry to be removed, got %v", registry.list())
+	}
+}
+
+// TestInventoryTrackReleased tests that the entry of a garbage-collected instance is removed.
+func TestInventoryTrackReleased(t *testing.T) {
+	registry := &inventoryRegistry{entries: make(map[string]inventoryRecord)}
+	registry.track(&SecretHeader{name: "released", config: &Config{HeaderName: "X-API-Key"}})
+
+	for i := 0; i < 50 && len(registry.list()) > 0; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(registry.list()) != 0 {
+		t.Errorf("Expected the entry of the released instance to be removed, got %v", registry.list())
+	}
+}
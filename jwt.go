@@ -0,0 +1,270 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// claimPlaceholder matches the {{ .Claim }} placeholder in secretName/secretKey.
+var claimPlaceholder = regexp.MustCompile(`\{\{\s*\.Claim\s*\}\}`)
+
+var (
+	// secretNamePattern is the DNS-1123 subdomain format Kubernetes requires for secret names.
+	secretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+	// secretKeyPattern is the format Kubernetes requires for secret data keys.
+	secretKeyPattern = regexp.MustCompile(`^[-._a-zA-Z0-9]{1,253}$`)
+)
+
+// jwtToken is a parsed, not necessarily verified, compact JWS.
+type jwtToken struct {
+	header       map[string]interface{}
+	claims       map[string]interface{}
+	signingInput string
+	signature    []byte
+}
+
+// parseJWT splits and decodes a compact JWT without verifying it.
+func parseJWT(raw string) (*jwtToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT: expected 3 segments, got %d", len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %w", err)
+	}
+
+	token := &jwtToken{
+		signingInput: parts[0] + "." + parts[1],
+		signature:    signature,
+	}
+	if err := json.Unmarshal(headerJSON, &token.header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(claimsJSON))
+	dec.UseNumber()
+	if err := dec.Decode(&token.claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT claims: %w", err)
+	}
+
+	return token, nil
+}
+
+// verifyHS256 checks the token's HS256 signature and its exp/nbf claims.
+func (t *jwtToken) verifyHS256(key []byte, now time.Time) error {
+	if alg, _ := t.header["alg"].(string); alg != "HS256" {
+		return fmt.Errorf("unexpected JWT algorithm %q, want HS256", alg)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(t.signingInput))
+	if !hmac.Equal(mac.Sum(nil), t.signature) {
+		return fmt.Errorf("invalid JWT signature")
+	}
+
+	return t.verifyTimes(now)
+}
+
+// verify checks the token's signature with algorithm and its exp/nbf claims. HS256 uses key
+// as the HMAC key; RS256 and ES256 expect a PEM public key or certificate. The token must
+// declare the configured algorithm, so an HS256 token cannot be checked against a public key.
+func (t *jwtToken) verify(algorithm, key string, now time.Time) error {
+	if algorithm == "HS256" {
+		return t.verifyHS256([]byte(key), now)
+	}
+	if alg, _ := t.header["alg"].(string); alg != algorithm {
+		return fmt.Errorf("unexpected JWT algorithm %q, want %s", alg, algorithm)
+	}
+
+	publicKey, err := parsePublicKey(key)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256([]byte(t.signingInput))
+
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm != "RS256" || rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], t.signature) != nil {
+			return fmt.Errorf("invalid JWT signature")
+		}
+	case *ecdsa.PublicKey:
+		if algorithm != "ES256" || len(t.signature) != 64 {
+			return fmt.Errorf("invalid JWT signature")
+		}
+		r := new(big.Int).SetBytes(t.signature[:32])
+		sig := new(big.Int).SetBytes(t.signature[32:])
+		if !ecdsa.Verify(pub, digest[:], r, sig) {
+			return fmt.Errorf("invalid JWT signature")
+		}
+	default:
+		return fmt.Errorf("unsupported JWT verification key type %T", publicKey)
+	}
+
+	return t.verifyTimes(now)
+}
+
+// parsePublicKey decodes a PEM public key (PKIX or PKCS#1) or the key of a PEM certificate.
+func parsePublicKey(pemKey string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, fmt.Errorf("JWT verification key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q for JWT verification key", block.Type)
+	}
+}
+
+// verifyTimes checks the exp and nbf claims when present.
+func (t *jwtToken) verifyTimes(now time.Time) error {
+	if exp, ok := t.numericClaim("exp"); ok && now.Unix() >= exp {
+		return fmt.Errorf("JWT expired")
+	}
+	if nbf, ok := t.numericClaim("nbf"); ok && now.Unix() < nbf {
+		return fmt.Errorf("JWT not valid yet")
+	}
+	return nil
+}
+
+// numericClaim returns an integer claim such as exp or nbf.
+func (t *jwtToken) numericClaim(name string) (int64, bool) {
+	n, ok := t.claims[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	if v, err := n.Int64(); err == nil {
+		return v, true
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// stringClaim returns a claim as a string; numeric claims are rendered verbatim.
+func (t *jwtToken) stringClaim(name string) (string, bool) {
+	switch v := t.claims[name].(type) {
+	case string:
+		return v, v != ""
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
+
+// bearerToken extracts the token from a header value, stripping an optional "Bearer " scheme.
+func bearerToken(value string) string {
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return strings.TrimSpace(value)
+}
+
+// callerClaim returns the configured claim from the caller's verified JWT.
+func (s *SecretHeader) callerClaim(req *http.Request) (string, error) {
+	headerName := s.config.JWTHeader
+	if headerName == "" {
+		headerName = "Authorization"
+	}
+
+	raw := bearerToken(req.Header.Get(headerName))
+	if raw == "" {
+		return "", fmt.Errorf("no JWT in header %s", headerName)
+	}
+
+	token, err := parseJWT(raw)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := s.getValue(req.Context(), s.config.JWTVerifySecretName, s.config.JWTVerifySecretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to load JWT verification key: %w", err)
+	}
+	if err := token.verifyHS256([]byte(key), time.Now()); err != nil {
+		return "", err
+	}
+
+	claim, ok := token.stringClaim(s.config.JWTClaim)
+	if !ok {
+		return "", fmt.Errorf("JWT has no usable %q claim", s.config.JWTClaim)
+	}
+	return claim, nil
+}
+
+// expandClaim substitutes the claim into the secret name and key and checks the results
+// are valid Kubernetes identifiers, so a caller cannot address arbitrary secrets.
+func expandClaim(secretName, secretKey, claim string) (string, string, error) {
+	return expandPlaceholder(claimPlaceholder, secretName, secretKey, claim, "claim value")
+}
+
+// expandPlaceholder substitutes value for placeholder in the secret name and key and checks
+// the results are valid Kubernetes identifiers. what names the value in errors.
+func expandPlaceholder(placeholder *regexp.Regexp, secretName, secretKey, value, what string) (string, string, error) {
+	name := placeholder.ReplaceAllLiteralString(secretName, value)
+	key := placeholder.ReplaceAllLiteralString(secretKey, value)
+
+	if !secretNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("%s %q does not yield a valid secret name", what, value)
+	}
+	if !secretKeyPattern.MatchString(key) {
+		return "", "", fmt.Errorf("%s %q does not yield a valid secret key", what, value)
+	}
+	return name, key, nil
+}
+
+// validateClaimSelection checks the JWT claim selection settings.
+func validateClaimSelection(config *Config) error {
+	usesPlaceholder := claimPlaceholder.MatchString(config.SecretName) || claimPlaceholder.MatchString(config.SecretKey)
+
+	if config.JWTClaim == "" {
+		if usesPlaceholder {
+			return fmt.Errorf("secretName/secretKey use {{ .Claim }} but jwtClaim is not set")
+		}
+		return nil
+	}
+	if !usesPlaceholder {
+		return fmt.Errorf("jwtClaim requires a {{ .Claim }} placeholder in secretName or secretKey")
+	}
+	// An unverified claim would let any caller pick any secret name in the namespace
+	if config.JWTVerifySecretName == "" || config.JWTVerifySecretKey == "" {
+		return fmt.Errorf("jwtClaim requires jwtVerifySecretName and jwtVerifySecretKey")
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signHS256 builds a compact HS256 JWT for tests.
+func signHS256(t *testing.T, claims map[string]interface{}, key string) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("Failed to marshal claims: %v", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestParseJWT tests decoding and verification of compact JWTs.
+func TestParseJWT(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		token       string
+		key         string
+		expectError bool
+	}{
+		{
+			name:  "valid token",
+			token: signHS256(t, map[string]interface{}{"org_id": "acme", "exp": now.Add(time.Hour).Unix()}, "k"),
+			key:   "k",
+		},
+		{
+			name:        "wrong key",
+			token:       signHS256(t, map[string]interface{}{"org_id": "acme"}, "k"),
+			key:         "other",
+			expectError: true,
+		},
+		{
+			name:        "expired token",
+			token:       signHS256(t, map[string]interface{}{"org_id": "acme", "exp": now.Add(-time.Minute).Unix()}, "k"),
+			key:         "k",
+			expectError: true,
+		},
+		{
+			name:        "not yet valid token",
+			token:       signHS256(t, map[string]interface{}{"org_id": "acme", "nbf": now.Add(time.Hour).Unix()}, "k"),
+			key:         "k",
+			expectError: true,
+		},
+		{
+			name:        "malformed token",
+			token:       "not-a-jwt",
+			key:         "k",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := parseJWT(tt.token)
+			if err == nil {
+				err = token.verifyHS256([]byte(tt.key), now)
+			}
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestExpandClaim tests that claim values cannot produce invalid secret references.
+func TestExpandClaim(t *testing.T) {
+	tests := []struct {
+		name         string
+		secretName   string
+		secretKey    string
+		claim        string
+		expectedName string
+		expectedKey  string
+		expectError  bool
+	}{
+		{
+			name:         "claim selects the key",
+			secretName:   "tenants",
+			secretKey:    "{{ .Claim }}",
+			claim:        "acme",
+			expectedName: "tenants",
+			expectedKey:  "acme",
+		},
+		{
+			name:         "claim selects the name",
+			secretName:   "upstream-{{.Claim}}",
+			secretKey:    "token",
+			claim:        "42",
+			expectedName: "upstream-42",
+			expectedKey:  "token",
+		},
+		{
+			name:        "path traversal is rejected",
+			secretName:  "upstream-{{ .Claim }}",
+			secretKey:   "token",
+			claim:       "../kube-system/x",
+			expectError: true,
+		},
+		{
+			name:        "uppercase name is rejected",
+			secretName:  "{{ .Claim }}",
+			secretKey:   "token",
+			claim:       "ACME",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, key, err := expandClaim(tt.secretName, tt.secretKey, tt.claim)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got name=%q key=%q", name, key)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.expectedName || key != tt.expectedKey {
+				t.Errorf("Expected %s/%s, got %s/%s", tt.expectedName, tt.expectedKey, name, key)
+			}
+		})
+	}
+}
+
+// TestServeHTTPJWTClaimSelection tests per-request secret selection from the caller's JWT.
+func TestServeHTTPJWTClaimSelection(t *testing.T) {
+	secrets := map[string]map[string]string{
+		"tenant-keys": {
+			"acme":   "acme-upstream-token",
+			"globex": "globex-upstream-token",
+		},
+		"jwt-key": {
+			"hs256": "caller-signing-key",
+		},
+	}
+
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "claim selects tenant key",
+			authorization:  "Bearer " + signHS256(t, map[string]interface{}{"org_id": "acme"}, "caller-signing-key"),
+			expectedStatus: http.StatusOK,
+			expectedHeader: "acme-upstream-token",
+		},
+		{
+			name:           "different tenant gets different key",
+			authorization:  "Bearer " + signHS256(t, map[string]interface{}{"org_id": "globex"}, "caller-signing-key"),
+			expectedStatus: http.StatusOK,
+			expectedHeader: "globex-upstream-token",
+		},
+		{
+			name:           "missing token is rejected",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing claim is rejected",
+			authorization:  "Bearer " + signHS256(t, map[string]interface{}{"sub": "user"}, "caller-signing-key"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown tenant fails",
+			authorization:  "Bearer " + signHS256(t, map[string]interface{}{"org_id": "initech"}, "caller-signing-key"),
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "forged token is rejected",
+			authorization:  "Bearer " + signHS256(t, map[string]interface{}{"org_id": "acme"}, "forged"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sSecretsServer(t, secrets)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:          "tenant-keys",
+				SecretKey:           "{{ .Claim }}",
+				HeaderName:          "X-Upstream-Token",
+				Namespace:           "default",
+				CacheTTL:            300,
+				JWTClaim:            "org_id",
+				JWTVerifySecretName: "jwt-key",
+				JWTVerifySecretKey:  "hs256",
+			}
+			if err := validateClaimSelection(config); err != nil {
+				t.Fatalf("Unexpected config error: %v", err)
+			}
+
+			var capturedHeader string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				capturedHeader = req.Header.Get(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+		})
+	}
+}
+
+// TestValidateClaimSelection tests jwtClaim configuration checks.
+func TestValidateClaimSelection(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "unset", config: &Config{SecretName: "api-token"}},
+		{name: "verified", config: &Config{SecretKey: "{{ .Claim }}", JWTClaim: "org_id", JWTVerifySecretName: "jwt-key", JWTVerifySecretKey: "hs256"}},
+		{name: "placeholder without claim", config: &Config{SecretKey: "{{ .Claim }}"}, expectError: true},
+		{name: "claim without placeholder", config: &Config{SecretKey: "token", JWTClaim: "org_id", JWTVerifySecretName: "jwt-key", JWTVerifySecretKey: "hs256"}, expectError: true},
+		{name: "unverified", config: &Config{SecretKey: "{{ .Claim }}", JWTClaim: "org_id"}, expectError: true},
+		{name: "key without secret", config: &Config{SecretKey: "{{ .Claim }}", JWTClaim: "org_id", JWTVerifySecretKey: "hs256"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateClaimSelection(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// serveVerifiedJWT authenticates the request by verifying the JWT in HeaderName with the key
+// from the secret, forwards the mapped claims as request headers and answers 401 otherwise.
+func (s *SecretHeader) serveVerifiedJWT(rw http.ResponseWriter, req *http.Request, secretName, secretKey string) {
+	key, err := s.getValue(req.Context(), secretName, secretKey)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	token, err := s.inboundJWT(req, key)
+	if err != nil {
+		metrics.inc(metricValidationFailures, "middleware", s.name)
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rejecting request: %v\n", err)
+		if strings.EqualFold(s.config.HeaderName, "Authorization") {
+			rw.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	for claim, header := range s.config.JWTClaimHeaders {
+		if value, ok := token.stringClaim(claim); ok {
+			req.Header.Set(header, value)
+		}
+	}
+
+	s.next.ServeHTTP(rw, req)
+}
+
+// inboundJWT parses and verifies the caller's JWT.
+func (s *SecretHeader) inboundJWT(req *http.Request, key string) (*jwtToken, error) {
+	raw := bearerToken(req.Header.Get(s.config.HeaderName))
+	if raw == "" {
+		return nil, fmt.Errorf("no JWT in header %s", s.config.HeaderName)
+	}
+
+	token, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := s.config.JWTAlgorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	if err := token.verify(algorithm, key, time.Now()); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// validateVerifyJWTConfig checks the settings of verifyJWT mode.
+func validateVerifyJWTConfig(config *Config) error {
+	switch config.JWTAlgorithm {
+	case "":
+		config.JWTAlgorithm = "HS256"
+	case "HS256", "RS256", "ES256":
+	default:
+		return fmt.Errorf("jwtAlgorithm must be HS256, RS256 or ES256")
+	}
+	if config.JWTClaim != "" {
+		return fmt.Errorf("jwtClaim cannot be used with mode %q", modeVerifyJWT)
+	}
+	if config.PreserveExistingHeader || config.AppendHeader || config.TrustedHeadersOnly ||
+		config.RejectExistingHeader || config.CompressThreshold > 0 {
+		return fmt.Errorf("mode %q cannot be combined with header injection options", modeVerifyJWT)
+	}
+	for claim, header := range config.JWTClaimHeaders {
+		if claim == "" || header == "" {
+			return fmt.Errorf("jwtClaimHeaders cannot contain empty claims or headers")
+		}
+		if strings.EqualFold(header, config.HeaderName) {
+			return fmt.Errorf("jwtClaimHeaders cannot overwrite headerName %s", config.HeaderName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPVerifyJWT tests inbound JWT verification and claim forwarding.
+func TestServeHTTPVerifyJWT(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+
+	mockServer := mockK8sSecretsServer(t, map[string]map[string]string{
+		"hs-key": {"key": "shared-key"},
+		"es-key": {"public.pem": publicPEM},
+	})
+	defer mockServer.Close()
+
+	valid := map[string]interface{}{"sub": "user-42", "org": "acme", "exp": time.Now().Add(time.Hour).Unix()}
+	expired := map[string]interface{}{"sub": "user-42", "exp": time.Now().Add(-time.Hour).Unix()}
+
+	es256Token, err := signJWT("ES256", "", privatePEM, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		secretName     string
+		secretKey      string
+		algorithm      string
+		authorization  string
+		spoofedUser    string
+		expectedStatus int
+		expectedUser   string
+	}{
+		{
+			name:           "valid HS256 token forwards claims",
+			secretName:     "hs-key",
+			secretKey:      "key",
+			algorithm:      "HS256",
+			authorization:  "Bearer " + signHS256(t, valid, "shared-key"),
+			spoofedUser:    "admin",
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user-42",
+		},
+		{
+			name:           "token signed with another key",
+			secretName:     "hs-key",
+			secretKey:      "key",
+			algorithm:      "HS256",
+			authorization:  "Bearer " + signHS256(t, valid, "other-key"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired token",
+			secretName:     "hs-key",
+			secretKey:      "key",
+			algorithm:      "HS256",
+			authorization:  "Bearer " + signHS256(t, expired, "shared-key"),
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing token",
+			secretName:     "hs-key",
+			secretKey:      "key",
+			algorithm:      "HS256",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid ES256 token",
+			secretName:     "es-key",
+			secretKey:      "public.pem",
+			algorithm:      "ES256",
+			authorization:  "Bearer " + es256Token,
+			expectedStatus: http.StatusOK,
+			expectedUser:   "user-42",
+		},
+		{
+			name:           "HS256 token against a public key",
+			secretName:     "es-key",
+			secretKey:      "public.pem",
+			algorithm:      "ES256",
+			authorization:  "Bearer " + signHS256(t, valid, publicPEM),
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				SecretName:      tt.secretName,
+				SecretKey:       tt.secretKey,
+				HeaderName:      "Authorization",
+				Namespace:       "default",
+				CacheTTL:        300,
+				Mode:            modeVerifyJWT,
+				JWTAlgorithm:    tt.algorithm,
+				JWTClaimHeaders: map[string]string{"sub": "X-User-Id", "org": "X-Org"},
+			}
+
+			var user string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				user = req.Header.Get("X-User-Id")
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.spoofedUser != "" {
+				req.Header.Set("X-User-Id", tt.spoofedUser)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if user != tt.expectedUser {
+				t.Errorf("Expected X-User-Id %q, got %q", tt.expectedUser, user)
+			}
+			if rw.Code == http.StatusUnauthorized && rw.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
@@ -1,10 +1,19 @@
 package traefik_k8s_secret_header
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -39,6 +48,32 @@ func mockK8sServer(t *testing.T, secretData map[string]string, secretExists bool
 	}))
 }
 
+// mockK8sSecretsServer creates a mock Kubernetes API server serving several secrets by name.
+func mockK8sSecretsServer(t *testing.T, secrets map[string]map[string]string) *httptest.Server {
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		name := path.Base(r.URL.Path)
+		secretData, ok := secrets[name]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+
+		encodedData := make(map[string]string)
+		for k, v := range secretData {
+			encodedData[k] = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{Data: encodedData})
+	}))
+}
+
 // TestServeHTTP tests the HTTP handler with a mocked Kubernetes API server.
 func TestServeHTTP(t *testing.T) {
 	tests := []struct {
@@ -303,3 +338,974 @@ func TestServeHTTPCacheExpiration(t *testing.T) {
 		t.Errorf("Expected cache to expire and K8s to be called again, but API call count didn't increase")
 	}
 }
+
+// TestServeHTTPMethodFilter tests that injection is limited to the configured methods.
+func TestServeHTTPMethodFilter(t *testing.T) {
+	secretData := map[string]string{
+		"token": "my-secret-token",
+	}
+
+	tests := []struct {
+		name           string
+		methods        []string
+		method         string
+		expectedHeader string
+	}{
+		{
+			name:           "no allowlist injects for every method",
+			method:         http.MethodGet,
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "allowed method is injected",
+			methods:        []string{"POST", "PUT", "DELETE"},
+			method:         http.MethodPost,
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "allowlist is case insensitive",
+			methods:        []string{"delete"},
+			method:         http.MethodDelete,
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "other methods pass through unmodified",
+			methods:        []string{"POST", "PUT", "DELETE"},
+			method:         http.MethodGet,
+			expectedHeader: "",
+		},
+		{
+			name:           "OPTIONS passes through unmodified",
+			methods:        []string{"POST"},
+			method:         http.MethodOptions,
+			expectedHeader: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName: "my-secret",
+				SecretKey:  "token",
+				HeaderName: "X-Auth-Token",
+				Namespace:  "default",
+				CacheTTL:   300,
+				Methods:    tt.methods,
+			}
+
+			nextCalled := false
+			var capturedHeader string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				nextCalled = true
+				capturedHeader = req.Header.Get(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(tt.method, "http://example.com/test", nil)
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if !nextCalled {
+				t.Fatal("Expected next handler to be called, but it wasn't")
+			}
+			if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+		})
+	}
+}
+
+// TestServeHTTPPreserveExistingHeader tests that client-supplied headers can be kept.
+func TestServeHTTPPreserveExistingHeader(t *testing.T) {
+	secretData := map[string]string{
+		"token": "my-secret-token",
+	}
+
+	tests := []struct {
+		name           string
+		preserve       bool
+		clientHeader   string
+		expectedHeader string
+	}{
+		{
+			name:           "client header is overwritten by default",
+			clientHeader:   "client-token",
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "client header is kept when preserving",
+			preserve:       true,
+			clientHeader:   "client-token",
+			expectedHeader: "client-token",
+		},
+		{
+			name:           "header is injected when client sent none",
+			preserve:       true,
+			expectedHeader: "my-secret-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:             "my-secret",
+				SecretKey:              "token",
+				HeaderName:             "X-Auth-Token",
+				Namespace:              "default",
+				CacheTTL:               300,
+				PreserveExistingHeader: tt.preserve,
+			}
+
+			var capturedHeader string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				capturedHeader = req.Header.Get(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			if tt.clientHeader != "" {
+				req.Header.Set(config.HeaderName, tt.clientHeader)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+		})
+	}
+}
+
+// TestServeHTTPAppendHeader tests that the value can be appended to multi-value headers.
+func TestServeHTTPAppendHeader(t *testing.T) {
+	secretData := map[string]string{
+		"token": "my-secret-token",
+	}
+
+	tests := []struct {
+		name           string
+		appendHeader   bool
+		expectedValues []string
+	}{
+		{
+			name:           "existing values are replaced by default",
+			expectedValues: []string{"my-secret-token"},
+		},
+		{
+			name:           "value is appended when configured",
+			appendHeader:   true,
+			expectedValues: []string{"for=192.0.2.60", "my-secret-token"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:   "my-secret",
+				SecretKey:    "token",
+				HeaderName:   "Forwarded",
+				Namespace:    "default",
+				CacheTTL:     300,
+				AppendHeader: tt.appendHeader,
+			}
+
+			var capturedValues []string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				capturedValues = req.Header.Values(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			// Run twice so both the fetch and the cached path are covered
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+				req.Header.Set(config.HeaderName, "for=192.0.2.60")
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if len(capturedValues) != len(tt.expectedValues) {
+					t.Fatalf("Expected header values %q, got %q", tt.expectedValues, capturedValues)
+				}
+				for j := range tt.expectedValues {
+					if capturedValues[j] != tt.expectedValues[j] {
+						t.Errorf("Expected header values %q, got %q", tt.expectedValues, capturedValues)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestServeHTTPTrustedHeadersOnly tests that client-supplied managed headers are stripped.
+func TestServeHTTPTrustedHeadersOnly(t *testing.T) {
+	secretData := map[string]string{
+		"token": "my-secret-token",
+	}
+
+	tests := []struct {
+		name           string
+		methods        []string
+		expectedHeader string
+	}{
+		{
+			name:           "spoofed header is replaced",
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "spoofed header is removed when injection is skipped",
+			methods:        []string{"POST"},
+			expectedHeader: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:         "my-secret",
+				SecretKey:          "token",
+				HeaderName:         "X-Auth-Token",
+				Namespace:          "default",
+				CacheTTL:           300,
+				Methods:            tt.methods,
+				TrustedHeadersOnly: true,
+				StripHeaders:       []string{"X-Internal-User"},
+			}
+
+			nextCalled := false
+			var capturedHeader, capturedExtra string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				nextCalled = true
+				capturedHeader = req.Header.Get(config.HeaderName)
+				capturedExtra = req.Header.Get("X-Internal-User")
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			req.Header.Set(config.HeaderName, "spoofed")
+			req.Header.Set("X-Internal-User", "admin")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if !nextCalled {
+				t.Fatal("Expected next handler to be called, but it wasn't")
+			}
+			if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+			if capturedExtra != "" {
+				t.Errorf("Expected extra header to be stripped, got %q", capturedExtra)
+			}
+		})
+	}
+}
+
+// TestServeHTTPRejectExistingHeader tests strict rejection of requests carrying the managed header.
+func TestServeHTTPRejectExistingHeader(t *testing.T) {
+	secretData := map[string]string{
+		"token": "my-secret-token",
+	}
+
+	tests := []struct {
+		name           string
+		clientHeader   string
+		rejectStatus   int
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "request without the header is injected",
+			rejectStatus:   http.StatusForbidden,
+			expectedStatus: http.StatusOK,
+			expectedHeader: "my-secret-token",
+		},
+		{
+			name:           "request with the header is forbidden",
+			clientHeader:   "spoofed",
+			rejectStatus:   http.StatusForbidden,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "bad request status is configurable",
+			clientHeader:   "spoofed",
+			rejectStatus:   http.StatusBadRequest,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:           "my-secret",
+				SecretKey:            "token",
+				HeaderName:           "X-Auth-Token",
+				Namespace:            "default",
+				CacheTTL:             300,
+				RejectExistingHeader: true,
+				RejectStatus:         tt.rejectStatus,
+			}
+
+			nextCalled := false
+			var capturedHeader string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				nextCalled = true
+				capturedHeader = req.Header.Get(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "reject-" + tt.name,
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			rejectionsBefore := metrics.value(metricHeaderRejections, "middleware", handler.name)
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			if tt.clientHeader != "" {
+				req.Header.Set(config.HeaderName, tt.clientHeader)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if tt.clientHeader != "" {
+				if nextCalled {
+					t.Error("Expected next handler not to be called on rejection, but it was called")
+				}
+				if got := metrics.value(metricHeaderRejections, "middleware", handler.name) - rejectionsBefore; got != 1 {
+					t.Errorf("Expected rejection counter to increase by 1, got %v", got)
+				}
+			} else if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+		})
+	}
+}
+
+// TestServeHTTPMetricsPath tests that the metrics path is answered by the middleware.
+func TestServeHTTPMetricsPath(t *testing.T) {
+	metrics.inc(metricHeaderRejections, "middleware", "metrics-path-test")
+
+	nextCalled := false
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			nextCalled = true
+		}),
+		name: "metrics-path-test",
+		config: &Config{
+			HeaderName:  "X-Auth-Token",
+			MetricsPath: "/metrics",
+		},
+		cache: &secretCache{},
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/metrics", nil))
+
+	if nextCalled {
+		t.Error("Expected metrics path not to be proxied")
+	}
+	if !strings.Contains(rw.Body.String(), `traefik_k8s_secret_header_header_rejections_total{middleware="metrics-path-test"} `) {
+		t.Errorf("Expected rejection counter in metrics output, got:\n%s", rw.Body.String())
+	}
+}
+
+// TestServeHTTPNoGoroutineLeak tests that middlewares built by New and serving requests
+// leave no goroutines behind.
+func TestServeHTTPNoGoroutineLeak(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+
+	func() {
+		mockServer := mockK8sServer(t, map[string]string{"token": "my-secret-token"}, true)
+		defer mockServer.Close()
+
+		client := mockServer.Client()
+		defer client.CloseIdleConnections()
+
+		config := CreateConfig()
+		config.SecretName = "my-secret"
+		config.SecretKey = "token"
+		config.HeaderName = "X-Auth-Token"
+		config.Namespace = "default"
+		config.CacheTTL = 300
+
+		for i := 0; i < 5; i++ {
+			handler, err := New(t.Context(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(http.StatusOK)
+			}), config, "leak-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Talk to the mock server instead of the in-cluster API server
+			handler.(*SecretHeader).k8sClient = &k8sClient{
+				httpClient: client,
+				baseURL:    mockServer.URL,
+				token:      "test-token",
+			}
+
+			var wg sync.WaitGroup
+			for j := 0; j < 20; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/test", nil))
+				}()
+			}
+			wg.Wait()
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("Expected goroutines to return to %d, got %d", baseline, n)
+	}
+
+	if got := metrics.value(metricCacheEntries, "middleware", "leak-test"); got != 1 {
+		t.Errorf("Expected cache_entries 1, got %v", got)
+	}
+}
+
+// TestServeHTTPAPITokenSecret tests reading the target secret with a token stored in another secret.
+func TestServeHTTPAPITokenSecret(t *testing.T) {
+	// The gateway token may only read traefik/tenant-a-token; the tenant token may only read tenant-a/upstream
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]string
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/traefik/secrets/tenant-a-token" && r.Header.Get("Authorization") == "Bearer test-token":
+			data = map[string]string{"token": "tenant-token\n"}
+		case r.URL.Path == "/api/v1/namespaces/tenant-a/secrets/upstream" && r.Header.Get("Authorization") == "Bearer tenant-token":
+			data = map[string]string{"api-key": "tenant-api-key"}
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		encodedData := make(map[string]string)
+		for k, v := range data {
+			encodedData[k] = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+		json.NewEncoder(w).Encode(k8sSecret{Data: encodedData})
+	}))
+	defer mockServer.Close()
+
+	tests := []struct {
+		name           string
+		tokenSecret    string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "service account cannot read tenant namespace",
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "tenant token reads tenant namespace",
+			tokenSecret:    "tenant-a-token",
+			expectedStatus: http.StatusOK,
+			expectedHeader: "tenant-api-key",
+		},
+		{
+			name:           "missing token secret fails",
+			tokenSecret:    "tenant-b-token",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				SecretName:              "upstream",
+				SecretKey:               "api-key",
+				HeaderName:              "X-Api-Key",
+				Namespace:               "tenant-a",
+				CacheTTL:                300,
+				APITokenSecretName:      tt.tokenSecret,
+				APITokenSecretKey:       "token",
+				APITokenSecretNamespace: "traefik",
+			}
+
+			var capturedHeader string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				capturedHeader = req.Header.Get(config.HeaderName)
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/test", nil))
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if capturedHeader != tt.expectedHeader {
+				t.Errorf("Expected header value %q, got %q", tt.expectedHeader, capturedHeader)
+			}
+		})
+	}
+}
+
+// TestConnRecycler tests that API server connections are re-dialed after the max age.
+func TestConnRecycler(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxAge        time.Duration
+		wait          time.Duration
+		expectedDials int
+	}{
+		{
+			name:          "connections are reused without recycling",
+			expectedDials: 1,
+		},
+		{
+			name:          "young connections are reused",
+			maxAge:        time.Hour,
+			expectedDials: 1,
+		},
+		{
+			name:          "old connections are re-dialed",
+			maxAge:        20 * time.Millisecond,
+			wait:          40 * time.Millisecond,
+			expectedDials: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secretServer := mockK8sServer(t, map[string]string{"token": "v"}, true)
+			defer secretServer.Close()
+
+			mockServer := httptest.NewUnstartedServer(secretServer.Config.Handler)
+			var mu sync.Mutex
+			dials := 0
+			mockServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					mu.Lock()
+					dials++
+					mu.Unlock()
+				}
+			}
+			mockServer.StartTLS()
+			defer mockServer.Close()
+
+			client := &k8sClient{
+				httpClient: mockServer.Client(),
+				baseURL:    mockServer.URL,
+				token:      "test-token",
+				recycler:   &connRecycler{maxAge: tt.maxAge},
+			}
+			defer client.httpClient.CloseIdleConnections()
+
+			for i := 0; i < 3; i++ {
+				if _, err := client.getSecret(context.Background(), "default", "my-secret"); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				time.Sleep(tt.wait)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if dials != tt.expectedDials {
+				t.Errorf("Expected %d connections, got %d", tt.expectedDials, dials)
+			}
+		})
+	}
+}
+
+// TestServeHTTPDecodeFailureKeepsCachedValue tests that a malformed value in an API response
+// never replaces a previously cached good value.
+func TestServeHTTPDecodeFailureKeepsCachedValue(t *testing.T) {
+	var mu sync.Mutex
+	encoded := map[string]string{
+		"api-key": base64.StdEncoding.EncodeToString([]byte("good-value")),
+		"other":   base64.StdEncoding.EncodeToString([]byte("other-v1")),
+	}
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{Data: encoded})
+	}))
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName: "my-secret",
+		SecretKey:  "api-key",
+		HeaderName: "X-API-Key",
+		Namespace:  "default",
+		CacheTTL:   300,
+	}
+
+	var header string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get("X-API-Key")
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	handler := &SecretHeader{
+		next:   next,
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{
+			ttl: time.Duration(config.CacheTTL) * time.Second,
+		},
+	}
+
+	serve := func() int {
+		header = ""
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		return rw.Code
+	}
+
+	if code := serve(); code != http.StatusOK || header != "good-value" {
+		t.Fatalf("Expected 200 with good-value, got %d with %q", code, header)
+	}
+
+	// The API now returns a truncated value for api-key and a rotated value for other
+	mu.Lock()
+	encoded = map[string]string{
+		"api-key": "Z29vZC12YWx1ZQ",
+		"other":   base64.StdEncoding.EncodeToString([]byte("other-v2")),
+	}
+	mu.Unlock()
+	handler.cache.ttl = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	if code := serve(); code != http.StatusOK || header != "good-value" {
+		t.Fatalf("Expected the cached good-value to survive the malformed response, got %d with %q", code, header)
+	}
+	data, _ := handler.cache.peek("default/my-secret")
+	if data["api-key"] != "good-value" {
+		t.Errorf("Expected cached api-key to stay good-value, got %q", data["api-key"])
+	}
+	if data["other"] != "other-v2" {
+		t.Errorf("Expected well-formed keys to refresh, got other=%q", data["other"])
+	}
+
+	// Without a previous good value the read fails and nothing is cached
+	handler.cache = &secretCache{ttl: time.Minute}
+	if code := serve(); code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 on a cold cache, got %d", code)
+	}
+	if handler.cache.len() != 0 {
+		t.Errorf("Expected nothing cached after a failed decode, got %d entries", handler.cache.len())
+	}
+}
+
+// TestServeHTTPRetryAfter tests answering failures with a retryable 503 within the request deadline.
+func TestServeHTTPRetryAfter(t *testing.T) {
+	mockServer := mockK8sServer(t, nil, false)
+	defer mockServer.Close()
+
+	tests := []struct {
+		name               string
+		retryAfter         int
+		deadline           time.Duration
+		expectedStatus     int
+		expectedRetryAfter string
+	}{
+		{name: "disabled", expectedStatus: http.StatusInternalServerError},
+		{name: "no deadline", retryAfter: 5, expectedStatus: http.StatusServiceUnavailable, expectedRetryAfter: "5"},
+		{name: "capped by deadline", retryAfter: 5, deadline: 2500 * time.Millisecond, expectedStatus: http.StatusServiceUnavailable, expectedRetryAfter: "2"},
+		{name: "no time left", retryAfter: 5, deadline: 500 * time.Millisecond, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				SecretName:        "missing-secret",
+				SecretKey:         "api-key",
+				HeaderName:        "X-API-Key",
+				Namespace:         "default",
+				CacheTTL:          300,
+				RetryAfter:        tt.retryAfter,
+				RetryMarkerHeader: "X-K8s-Secret-Header-Retry",
+			}
+
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					t.Error("Request should not reach the upstream")
+				}),
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			if tt.deadline > 0 {
+				ctx, cancel := context.WithTimeout(req.Context(), tt.deadline)
+				defer cancel()
+				req = req.WithContext(ctx)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if got := rw.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("Expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
+			marker := rw.Header().Get("X-K8s-Secret-Header-Retry")
+			if (tt.expectedRetryAfter != "") != (marker == "secret-unavailable") {
+				t.Errorf("Unexpected retry marker %q", marker)
+			}
+		})
+	}
+}
+
+// TestNewOutsideCluster tests that the middleware can be built without a service account,
+// the Kubernetes client only being created when the first request needs it.
+func TestNewOutsideCluster(t *testing.T) {
+	if _, err := os.Stat(serviceAccountDir + "/token"); err == nil {
+		t.Skip("running in a cluster")
+	}
+
+	config := CreateConfig()
+	config.SecretName = "api-token"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Auth-Token"
+	config.Namespace = "default"
+
+	handler, err := New(t.Context(), http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}), config, "lazy-client")
+	if err != nil {
+		t.Fatalf("Expected New to succeed outside a cluster, got %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 without a service account, got %d", rw.Code)
+	}
+}
+
+// TestKubernetesClientRetry tests that a failed client creation is retried by the next request.
+func TestKubernetesClientRetry(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{"token": "my-secret-token"}, true)
+	defer mockServer.Close()
+
+	attempts := 0
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+		name: "test-middleware",
+		config: &Config{
+			SecretName: "my-secret",
+			SecretKey:  "token",
+			HeaderName: "X-Auth-Token",
+			Namespace:  "default",
+			CacheTTL:   300,
+		},
+		newClient: func() (*k8sClient, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, fmt.Errorf("token not mounted yet")
+			}
+			return &k8sClient{httpClient: mockServer.Client(), baseURL: mockServer.URL, token: "test-token"}, nil
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+	}
+
+	for _, expected := range []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK} {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if rw.Code != expected {
+			t.Errorf("Expected status %d, got %d", expected, rw.Code)
+		}
+	}
+	if attempts != 2 {
+		t.Errorf("Expected the client to be created once after the failure, got %d attempts", attempts)
+	}
+}
+
+// TestReadKubernetesSecretResourceVersion tests that a refresh at an unchanged resourceVersion
+// keeps the decoded data, and that the version is exposed as a metric.
+func TestReadKubernetesSecretResourceVersion(t *testing.T) {
+	version, value := "100", "first"
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{
+			Metadata: k8sObjectMeta{ResourceVersion: version},
+			Data:     map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(value))},
+		})
+	}))
+	defer mockServer.Close()
+
+	handler := &SecretHeader{
+		name:   "resource-version-test",
+		config: &Config{Namespace: "default", Debug: true},
+		cache:  &secretCache{ttl: time.Nanosecond},
+	}
+	client := &k8sClient{httpClient: mockServer.Client(), baseURL: mockServer.URL, token: "test-token"}
+
+	steps := []struct {
+		name     string
+		version  string
+		value    string
+		expected string
+	}{
+		{name: "first read", version: "100", value: "first", expected: "first"},
+		// The API never changes data without a new resourceVersion; a changed body proves the
+		// refresh did not decode it again
+		{name: "unchanged version", version: "100", value: "ignored", expected: "first"},
+		{name: "new version", version: "101", value: "second", expected: "second"},
+	}
+
+	for _, step := range steps {
+		version, value = step.version, step.value
+		time.Sleep(time.Millisecond)
+
+		data, err := handler.readKubernetesSecret(t.Context(), client, "default", "api-token")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", step.name, err)
+		}
+		if data["token"] != step.expected {
+			t.Errorf("%s: expected %q, got %q", step.name, step.expected, data["token"])
+		}
+		expectedVersion, _ := strconv.ParseFloat(step.version, 64)
+		if got := metrics.value(metricResourceVersion, "middleware", "resource-version-test", "secret", "default/api-token"); got != expectedVersion {
+			t.Errorf("%s: expected resourceVersion metric %v, got %v", step.name, expectedVersion, got)
+		}
+	}
+}
+
+// TestCacheTTLOverrides tests that overridden secrets are cached with their own TTL.
+func TestCacheTTLOverrides(t *testing.T) {
+	config := &Config{
+		CacheTTL:          300,
+		CacheTTLJitter:    10,
+		CacheTTLOverrides: map[string]int{"default/oauth-token": 30, "static-key": 3600},
+	}
+	cache, err := newConfigCache(config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &SecretHeader{name: "ttl-overrides-test", config: config, cache: cache}
+
+	tests := []struct {
+		cacheKey string
+		expected time.Duration
+	}{
+		{cacheKey: "default/oauth-token", expected: 30 * time.Second},
+		{cacheKey: "team-a/oauth-token", expected: 300 * time.Second},
+		{cacheKey: "team-a/static-key", expected: time.Hour},
+		{cacheKey: "default/other", expected: 300 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cacheKey, func(t *testing.T) {
+			handler.cacheSecretData(tt.cacheKey, map[string]string{"token": "a"}, "", "", "")
+			entry, _ := cache.load(tt.cacheKey)
+			if low, high := tt.expected*9/10, tt.expected*11/10; entry.ttl < low || entry.ttl > high {
+				t.Errorf("Expected a TTL within 10%% of %v, got %v", tt.expected, entry.ttl)
+			}
+		})
+	}
+}
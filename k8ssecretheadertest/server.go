@@ -0,0 +1,349 @@
+// Package k8ssecretheadertest provides a fake Kubernetes secrets API for integration tests of
+// middleware chains using traefik_k8s_secret_header, outside a cluster.
+//
+// The fake serves secrets over TLS and authenticates the middleware with a client
+// certificate, so a test only points the middleware configuration at it:
+//
+//	server := k8ssecretheadertest.NewServer(t)
+//	server.SetSecret("default", "api-credentials", map[string]string{"token": "s3cret"})
+//
+//	config := secretheader.CreateConfig()
+//	config.SecretName, config.SecretKey, config.HeaderName = "api-credentials", "token", "X-Auth-Token"
+//	server.Configure(config)
+//	handler, err := secretheader.New(ctx, next, config, "api-auth")
+//
+// Tests can rotate secrets, deny access to them, fail every request or slow the API down
+// while the middleware runs. NewServer sets KUBERNETES_SERVICE_HOST and
+// KUBERNETES_SERVICE_PORT, so tests using it cannot run in parallel.
+package k8ssecretheadertest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	secretheader "github.com/effecti-bot/traefik-k8s-secret-header"
+)
+
+// Token is the bearer token the fake accepts besides its client certificate.
+const Token = "test-token"
+
+// Server is a fake Kubernetes API serving secrets, their SelfSubjectAccessReviews and
+// nothing else. Its methods are safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the API, e.g. https://127.0.0.1:41235.
+	URL string
+	// CAFile is the PEM file of the certificate the API serves, for apiCAFile.
+	CAFile string
+	// ClientCertFile and ClientKeyFile are the PEM client certificate and key the API
+	// accepts, for apiClientCertFile and apiClientKeyFile.
+	ClientCertFile string
+	ClientKeyFile  string
+
+	server *httptest.Server
+
+	mu        sync.Mutex
+	secrets   map[string]secret // by namespace/name
+	forbidden map[string]bool   // namespace/name, or namespace/ for a whole namespace
+	failure   int
+	latency   time.Duration
+	version   int64
+	reads     map[string]int // by namespace/name
+}
+
+// secret is a stored secret with its plain values.
+type secret struct {
+	data        map[string]string
+	annotations map[string]string
+	secretType  string
+	version     int64
+}
+
+// NewServer starts a fake API, closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		secrets:   make(map[string]secret),
+		forbidden: make(map[string]bool),
+		reads:     make(map[string]int),
+	}
+	dir := t.TempDir()
+	clientCert, err := writeClientCertificate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ClientCertFile = filepath.Join(dir, "client.crt")
+	s.ClientKeyFile = filepath.Join(dir, "client.key")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.server.TLS = &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven, ClientCAs: clientCAs}
+	s.server.StartTLS()
+	t.Cleanup(s.server.Close)
+	s.URL = s.server.URL
+
+	s.CAFile = filepath.Join(dir, "ca.crt")
+	serverCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.server.Certificate().Raw})
+	if err := os.WriteFile(s.CAFile, serverCert, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	host, port, err := net.SplitHostPort(s.server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+	return s
+}
+
+// Configure points config at the fake through its apiCAFile, apiClientCertFile and
+// apiClientKeyFile options.
+func (s *Server) Configure(config *secretheader.Config) {
+	config.APICAFile = s.CAFile
+	config.APIClientCertFile = s.ClientCertFile
+	config.APIClientKeyFile = s.ClientKeyFile
+}
+
+// Client returns an HTTP client trusting the API. Its requests authenticate with an
+// "Authorization: Bearer " + Token header.
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// SetSecret creates the secret namespace/name with the given plain values, or rotates it
+// to them, moving its resourceVersion on.
+func (s *Server) SetSecret(namespace, name string, data map[string]string) {
+	s.SetSecretWithType(namespace, name, "Opaque", data, nil)
+}
+
+// SetSecretWithType is SetSecret for a secret of the given type and annotations.
+func (s *Server) SetSecretWithType(namespace, name, secretType string, data, annotations map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.secrets[namespace+"/"+name] = secret{data: data, annotations: annotations, secretType: secretType, version: s.version}
+}
+
+// DeleteSecret deletes the secret namespace/name.
+func (s *Server) DeleteSecret(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.secrets, namespace+"/"+name)
+}
+
+// Forbid makes reads of the secret namespace/name, or of every secret of namespace when
+// name is empty, fail with 403 Forbidden as without RBAC, and Allow lets them through again.
+func (s *Server) Forbid(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forbidden[namespace+"/"+name] = true
+}
+
+// Allow undoes Forbid.
+func (s *Server) Allow(namespace, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.forbidden, namespace+"/"+name)
+}
+
+// FailRequests makes every request fail with status, e.g. 503 for an unavailable API, until
+// called with 0.
+func (s *Server) FailRequests(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = status
+}
+
+// SetLatency delays every response by latency.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// Reads returns the number of requests for the secret namespace/name, failed ones included.
+func (s *Server) Reads(namespace, name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reads[namespace+"/"+name]
+}
+
+// serveHTTP answers an API request.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(r.TLS.VerifiedChains) == 0 && r.Header.Get("Authorization") != "Bearer "+Token {
+		writeStatus(w, http.StatusUnauthorized, "Unauthorized", "unauthorized")
+		return
+	}
+
+	// /api/v1/namespaces/{namespace}/secrets/{name}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+	secretRead := r.Method == http.MethodGet && len(parts) == 3 && parts[1] == "secrets"
+
+	s.mu.Lock()
+	if secretRead {
+		s.reads[parts[0]+"/"+parts[2]]++
+	}
+	latency, failure := s.latency, s.failure
+	s.mu.Unlock()
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failure != 0 {
+		writeStatus(w, failure, http.StatusText(failure), "injected failure")
+		return
+	}
+
+	if r.Method == http.MethodPost && r.URL.Path == "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews" {
+		s.serveAccessReview(w, r)
+		return
+	}
+	if !secretRead {
+		writeStatus(w, http.StatusNotFound, "NotFound", "the server could not find the requested resource")
+		return
+	}
+	s.serveSecret(w, parts[0], parts[2])
+}
+
+// serveSecret answers a secret read.
+func (s *Server) serveSecret(w http.ResponseWriter, namespace, name string) {
+	s.mu.Lock()
+	stored, ok := s.secrets[namespace+"/"+name]
+	forbidden := s.forbiddenLocked(namespace, name)
+	s.mu.Unlock()
+
+	if forbidden {
+		writeStatus(w, http.StatusForbidden, "Forbidden",
+			fmt.Sprintf("secrets %q is forbidden: cannot get resource \"secrets\" in namespace %q", name, namespace))
+		return
+	}
+	if !ok {
+		writeStatus(w, http.StatusNotFound, "NotFound", fmt.Sprintf("secrets %q not found", name))
+		return
+	}
+
+	encoded := make(map[string]string, len(stored.data))
+	for key, value := range stored.data {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":            name,
+			"namespace":       namespace,
+			"resourceVersion": strconv.FormatInt(stored.version, 10),
+			"annotations":     stored.annotations,
+		},
+		"type": stored.secretType,
+		"data": encoded,
+	})
+}
+
+// serveAccessReview answers a SelfSubjectAccessReview for getting secrets, allowed unless
+// forbidden with Forbid.
+func (s *Server) serveAccessReview(w http.ResponseWriter, r *http.Request) {
+	var review struct {
+		APIVersion string                 `json:"apiVersion"`
+		Kind       string                 `json:"kind"`
+		Spec       map[string]interface{} `json:"spec"`
+		Status     map[string]interface{} `json:"status,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		writeStatus(w, http.StatusBadRequest, "BadRequest", err.Error())
+		return
+	}
+	attributes, _ := review.Spec["resourceAttributes"].(map[string]interface{})
+	namespace, _ := attributes["namespace"].(string)
+	name, _ := attributes["name"].(string)
+
+	s.mu.Lock()
+	allowed := !s.forbiddenLocked(namespace, name)
+	s.mu.Unlock()
+
+	review.Status = map[string]interface{}{"allowed": allowed}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(review)
+}
+
+// forbiddenLocked reports whether the secret namespace/name is forbidden. s.mu is held.
+func (s *Server) forbiddenLocked(namespace, name string) bool {
+	return s.forbidden[namespace+"/"] || s.forbidden[namespace+"/"+name]
+}
+
+// writeStatus writes a Kubernetes Status failure.
+func writeStatus(w http.ResponseWriter, code int, reason, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       code,
+	})
+}
+
+// writeClientCertificate writes a self-signed client certificate and its key to dir, as
+// client.crt and client.key, and returns the certificate.
+func writeClientCertificate(dir string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "traefik-k8s-secret-header", Organization: []string{"system:authenticated"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(filepath.Join(dir, "client.crt"), certPEM, 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "client.key"), keyPEM, 0o600); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
@@ -0,0 +1,130 @@
+package k8ssecretheadertest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	secretheader "github.com/effecti-bot/traefik-k8s-secret-header"
+)
+
+// TestServerWithMiddleware tests the fake behind a middleware: injection, rotation, RBAC
+// failures and an unavailable API.
+func TestServerWithMiddleware(t *testing.T) {
+	server := NewServer(t)
+	server.SetSecret("default", "api-credentials", map[string]string{"token": "first-token"})
+
+	config := secretheader.CreateConfig()
+	config.SecretName = "api-credentials"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Auth-Token"
+	config.CacheTTL = 0
+	server.Configure(config)
+
+	var injected string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		injected = req.Header.Get("X-Auth-Token")
+	})
+	handler, err := secretheader.New(context.Background(), next, config, "fake-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name           string
+		change         func()
+		expectedStatus int
+		expectedToken  string
+	}{
+		{name: "injected", expectedStatus: http.StatusOK, expectedToken: "first-token"},
+		{
+			name:           "rotated",
+			change:         func() { server.SetSecret("default", "api-credentials", map[string]string{"token": "second-token"}) },
+			expectedStatus: http.StatusOK,
+			expectedToken:  "second-token",
+		},
+		{name: "forbidden", change: func() { server.Forbid("default", "") }, expectedStatus: http.StatusInternalServerError},
+		{name: "allowed again", change: func() { server.Allow("default", "") }, expectedStatus: http.StatusOK, expectedToken: "second-token"},
+		{name: "unavailable", change: func() { server.FailRequests(http.StatusServiceUnavailable) }, expectedStatus: http.StatusInternalServerError},
+		{name: "deleted", change: func() { server.FailRequests(0); server.DeleteSecret("default", "api-credentials") }, expectedStatus: http.StatusInternalServerError},
+	}
+	for _, step := range steps {
+		if step.change != nil {
+			step.change()
+		}
+		injected = ""
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != step.expectedStatus || injected != step.expectedToken {
+			t.Errorf("%s: expected status %d and %q, got %d and %q", step.name, step.expectedStatus, step.expectedToken, rr.Code, injected)
+		}
+	}
+	if reads := server.Reads("default", "api-credentials"); reads != len(steps) {
+		t.Errorf("Expected %d reads, got %d", len(steps), reads)
+	}
+}
+
+// TestServerLatency tests that responses are delayed, and that a cancelled request does not
+// wait for the delay.
+func TestServerLatency(t *testing.T) {
+	server := NewServer(t)
+	server.SetSecret("default", "api-credentials", map[string]string{"token": "s3cret"})
+	server.SetLatency(100 * time.Millisecond)
+
+	get := func(timeout time.Duration) (time.Duration, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/namespaces/default/secrets/api-credentials", nil)
+		req.Header.Set("Authorization", "Bearer "+Token)
+		start := time.Now()
+		resp, err := server.Client().Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return time.Since(start), err
+	}
+
+	if elapsed, err := get(time.Second); err != nil || elapsed < 100*time.Millisecond {
+		t.Errorf("Expected a delayed response, got %v after %v", err, elapsed)
+	}
+	if _, err := get(10 * time.Millisecond); err == nil {
+		t.Error("Expected the request to time out")
+	}
+}
+
+// TestServerAccessReview tests that rbacPreflight sees the secrets denied with Forbid.
+func TestServerAccessReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		forbidden   bool
+		expectError bool
+	}{
+		{name: "allowed"},
+		{name: "forbidden", forbidden: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(t)
+			server.SetSecret("default", "api-credentials", map[string]string{"token": "s3cret"})
+			if tt.forbidden {
+				server.Forbid("default", "api-credentials")
+			}
+
+			config := secretheader.CreateConfig()
+			config.SecretName = "api-credentials"
+			config.SecretKey = "token"
+			config.HeaderName = "X-Auth-Token"
+			config.RBACPreflight = true
+			config.StrictStartup = true
+			server.Configure(config)
+
+			_, err := secretheader.New(context.Background(), http.NotFoundHandler(), config, "fake-server-review-test")
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
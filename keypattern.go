@@ -0,0 +1,114 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// keyPlaceholder matches the {{ .Key }} placeholder in headerName.
+var keyPlaceholder = regexp.MustCompile(`\{\{\s*\.Key\s*\}\}`)
+
+// patternHeader is a header injected for a key matching secretKeyPattern.
+type patternHeader struct {
+	name  string
+	value string
+}
+
+// newKeyPattern validates the secretKeyPattern settings and compiles the pattern, anchored at
+// both ends, or returns nil when it is not set.
+func newKeyPattern(config *Config) (*regexp.Regexp, error) {
+	if config.SecretKeyPattern == "" {
+		return nil, nil
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return nil, fmt.Errorf("secretKeyPattern is only supported in mode %q", modeInject)
+	}
+	if config.SecretKey != "" {
+		return nil, fmt.Errorf("secretKey and secretKeyPattern cannot both be set")
+	}
+	if !keyPlaceholder.MatchString(config.HeaderName) {
+		return nil, fmt.Errorf("secretKeyPattern requires a {{ .Key }} placeholder in headerName")
+	}
+	if config.PreserveExistingHeader || config.RejectExistingHeader || config.TrustedHeadersOnly || config.CompressThreshold > 0 {
+		return nil, fmt.Errorf("secretKeyPattern cannot be combined with preserveExistingHeader, rejectExistingHeader, trustedHeadersOnly or compressThreshold")
+	}
+	if len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return nil, fmt.Errorf("secretKeyPattern cannot be used with fallbackSources or fallbackValue")
+	}
+	if len(config.WarmupHeaders) > 0 || len(config.WarmupMethods) > 0 || len(config.WarmupUserAgents) > 0 {
+		return nil, fmt.Errorf("secretKeyPattern cannot be used with warm-up detection")
+	}
+
+	pattern, err := regexp.Compile("^(?:" + config.SecretKeyPattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid secretKeyPattern: %w", err)
+	}
+	return pattern, nil
+}
+
+// patternHeaders returns a header for every key of data matching the key pattern, in key
+// order. The header name is headerName with {{ .Key }} replaced by the first capture group of
+// the pattern, or by the whole key when the pattern has none.
+func (s *SecretHeader) patternHeaders(data map[string]string, secretName string) ([]patternHeader, error) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var headers []patternHeader
+	for _, key := range keys {
+		match := s.keyPattern.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+		value, err := s.headerValue(data[key])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s/%s key '%s': %w", s.config.Namespace, secretName, key, err)
+		}
+		value, err = s.checkValue(value, secretName, key)
+		if err != nil {
+			return nil, err
+		}
+		part := key
+		if len(match) > 1 {
+			part = match[1]
+		}
+		headers = append(headers, patternHeader{
+			name:  keyPlaceholder.ReplaceAllLiteralString(s.config.HeaderName, part),
+			value: value,
+		})
+	}
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("no key of secret %s/%s matches secretKeyPattern", s.config.Namespace, secretName)
+	}
+	return headers, nil
+}
+
+// serveKeyPattern injects a header for every key of the secret matching secretKeyPattern.
+func (s *SecretHeader) serveKeyPattern(rw http.ResponseWriter, req *http.Request, secretName string) {
+	client, err := s.apiClient(req.Context())
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+	data, err := s.fetchSecretData(req.Context(), client, s.config.Namespace, secretName)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+	headers, err := s.patternHeaders(data, secretName)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	for _, header := range headers {
+		s.injectNamedHeader(req, header.name, header.value)
+	}
+	s.injectIdentity(req)
+
+	s.next.ServeHTTP(rw, req)
+}
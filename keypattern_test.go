@@ -0,0 +1,127 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPSecretKeyPattern tests injecting every matching key as its own header.
+func TestServeHTTPSecretKeyPattern(t *testing.T) {
+	tests := []struct {
+		name            string
+		secretData      map[string]string
+		pattern         string
+		headerName      string
+		expectedHeaders map[string]string
+		expectError     bool
+	}{
+		{
+			name:       "capture group",
+			secretData: map[string]string{"partner-acme": "acme-key", "partner-globex": "globex-key", "internal": "secret"},
+			pattern:    "partner-(.+)",
+			headerName: "X-{{ .Key }}-Api-Key",
+			expectedHeaders: map[string]string{
+				"X-Acme-Api-Key":   "acme-key",
+				"X-Globex-Api-Key": "globex-key",
+			},
+		},
+		{
+			name:            "whole key",
+			secretData:      map[string]string{"token-a": "a", "token-b": "b", "other": "c"},
+			pattern:         "token-[a-z]",
+			headerName:      "X-{{.Key}}",
+			expectedHeaders: map[string]string{"X-Token-A": "a", "X-Token-B": "b"},
+		},
+		{
+			name:        "no matching key",
+			secretData:  map[string]string{"internal": "secret"},
+			pattern:     "partner-(.+)",
+			headerName:  "X-{{ .Key }}-Api-Key",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, tt.secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:       "partner-keys",
+				SecretKeyPattern: tt.pattern,
+				HeaderName:       tt.headerName,
+				Namespace:        "default",
+				CacheTTL:         300,
+			}
+			keyPattern, err := newKeyPattern(config)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var captured http.Header
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Clone()
+				}),
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:      &secretCache{ttl: 300 * time.Second},
+				keyPattern: keyPattern,
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if tt.expectError {
+				if captured != nil || rw.Code != http.StatusInternalServerError {
+					t.Errorf("Expected status 500 without calling next, got %d", rw.Code)
+				}
+				return
+			}
+			for name, value := range tt.expectedHeaders {
+				if got := captured.Get(name); got != value {
+					t.Errorf("Expected %s: %q, got %q", name, value, got)
+				}
+			}
+			if len(captured) != len(tt.expectedHeaders) {
+				t.Errorf("Expected %d headers, got %v", len(tt.expectedHeaders), captured)
+			}
+		})
+	}
+}
+
+// TestNewKeyPattern tests secretKeyPattern configuration checks.
+func TestNewKeyPattern(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "unset", config: &Config{SecretKey: "token", HeaderName: "X-Token"}},
+		{name: "pattern", config: &Config{SecretKeyPattern: "partner-(.+)", HeaderName: "X-{{ .Key }}-Key"}},
+		{name: "with secretKey", config: &Config{SecretKey: "token", SecretKeyPattern: "partner-(.+)", HeaderName: "X-{{ .Key }}"}, expectError: true},
+		{name: "fixed header name", config: &Config{SecretKeyPattern: "partner-(.+)", HeaderName: "X-Key"}, expectError: true},
+		{name: "invalid pattern", config: &Config{SecretKeyPattern: "partner-(", HeaderName: "X-{{ .Key }}"}, expectError: true},
+		{name: "validate mode", config: &Config{Mode: modeValidate, SecretKeyPattern: "partner-(.+)", HeaderName: "X-{{ .Key }}"}, expectError: true},
+		{name: "preserve existing", config: &Config{SecretKeyPattern: "partner-(.+)", HeaderName: "X-{{ .Key }}", PreserveExistingHeader: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newKeyPattern(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
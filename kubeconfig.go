@@ -0,0 +1,525 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKubeconfigSecretKey is the key of the kubeconfig in kubeconfigSecretName.
+const defaultKubeconfigSecretKey = "kubeconfig"
+
+// validateKubeconfig checks the kubeconfigSecretName settings.
+func validateKubeconfig(config *Config) error {
+	if config.KubeconfigSecretName == "" {
+		if config.KubeconfigSecretKey != "" || config.KubeconfigSecretNamespace != "" || config.KubeconfigContext != "" {
+			return fmt.Errorf("kubeconfigSecretKey, kubeconfigSecretNamespace and kubeconfigContext require kubeconfigSecretName")
+		}
+		return nil
+	}
+	if config.KubeconfigSecretKey == "" {
+		config.KubeconfigSecretKey = defaultKubeconfigSecretKey
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("kubeconfigSecretName cannot be used with source %q", config.Source)
+	}
+	if config.APITokenSecretName != "" || config.APIClientCertFile != "" {
+		return fmt.Errorf("kubeconfigSecretName cannot be combined with apiTokenSecretName or apiClientCertFile: the kubeconfig holds the credentials")
+	}
+	if config.Mode == modeServiceAccountToken {
+		return fmt.Errorf("kubeconfigSecretName cannot be used with mode %q", modeServiceAccountToken)
+	}
+	return nil
+}
+
+// validateKubeconfigSecret rejects configured reads of the kubeconfig secret: the secret read
+// in the namespace or namespaces of the middleware, and Kubernetes fallback sources. Both
+// clusters' secrets share the cache, keyed by namespace/name only, so such a read would hand
+// out the credentials of the remote cluster. Names resolved per request are checked by
+// checkKubeconfigRead.
+func validateKubeconfigSecret(config *Config) error {
+	if config.KubeconfigSecretName == "" {
+		return nil
+	}
+	namespaces := config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{config.Namespace}
+	}
+	for _, namespace := range namespaces {
+		if namespace == config.KubeconfigSecretNamespace && config.SecretName == config.KubeconfigSecretName {
+			return fmt.Errorf("kubeconfigSecretName cannot be the secret read from the remote cluster")
+		}
+	}
+	for _, entry := range config.FallbackSources {
+		source, name, _ := strings.Cut(entry, ":")
+		if source == sourceKubernetes && name == config.KubeconfigSecretName && config.Namespace == config.KubeconfigSecretNamespace {
+			return fmt.Errorf("fallbackSources cannot read kubeconfigSecretName")
+		}
+	}
+	return nil
+}
+
+// checkKubeconfigRead rejects a read of the kubeconfig secret, in namespace or in one of the
+// namespaces searched for it, by any path other than remoteClient. Secret names built from
+// a JWT claim, a header or the Host may resolve to it.
+func (s *SecretHeader) checkKubeconfigRead(namespace, secretName string) error {
+	if s.config.KubeconfigSecretName == "" || secretName != s.config.KubeconfigSecretName {
+		return nil
+	}
+	namespaces := []string{namespace}
+	if s.source == nil && len(s.config.Namespaces) > 0 && namespace == s.config.Namespace {
+		namespaces = s.config.Namespaces
+	}
+	for _, candidate := range namespaces {
+		if candidate == s.config.KubeconfigSecretNamespace {
+			return classify(ErrForbidden, fmt.Errorf("secret %s/%s holds the kubeconfig and cannot be read", candidate, secretName))
+		}
+	}
+	return nil
+}
+
+// kubeconfig is the part of a kubeconfig file needed to reach one cluster.
+type kubeconfig struct {
+	CurrentContext string              `json:"current-context"`
+	Clusters       []kubeconfigCluster `json:"clusters"`
+	Contexts       []kubeconfigContext `json:"contexts"`
+	Users          []kubeconfigUser    `json:"users"`
+}
+
+// kubeconfigCluster is a named entry of clusters.
+type kubeconfigCluster struct {
+	Name    string `json:"name"`
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthorityData string `json:"certificate-authority-data"`
+		CertificateAuthority     string `json:"certificate-authority"`
+		TLSServerName            string `json:"tls-server-name"`
+		InsecureSkipTLSVerify    bool   `json:"insecure-skip-tls-verify"`
+		ProxyURL                 string `json:"proxy-url"`
+	} `json:"cluster"`
+}
+
+// kubeconfigContext is a named entry of contexts.
+type kubeconfigContext struct {
+	Name    string `json:"name"`
+	Context struct {
+		Cluster string `json:"cluster"`
+		User    string `json:"user"`
+	} `json:"context"`
+}
+
+// kubeconfigUser is a named entry of users. Only credentials embedded in the file can be
+// used: files, exec plugins and auth providers do not exist in the Traefik pod.
+type kubeconfigUser struct {
+	Name string `json:"name"`
+	User struct {
+		Token                 string      `json:"token"`
+		ClientCertificateData string      `json:"client-certificate-data"`
+		ClientKeyData         string      `json:"client-key-data"`
+		TokenFile             string      `json:"tokenFile"`
+		ClientCertificate     string      `json:"client-certificate"`
+		ClientKey             string      `json:"client-key"`
+		Username              string      `json:"username"`
+		Exec                  interface{} `json:"exec"`
+		AuthProvider          interface{} `json:"auth-provider"`
+	} `json:"user"`
+}
+
+// parseKubeconfig reads a kubeconfig in YAML, as written by kubectl and most tools, or JSON.
+func parseKubeconfig(content string) (*kubeconfig, error) {
+	document := []byte(content)
+	if !strings.HasPrefix(strings.TrimSpace(content), "{") {
+		tree, err := parseYAML(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+		}
+		if document, err = json.Marshal(tree); err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+		}
+	}
+
+	var config kubeconfig
+	if err := json.Unmarshal(document, &config); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig: %w", err)
+	}
+	return &config, nil
+}
+
+// resolve returns the cluster and user of context name, or of the current context when name
+// is empty.
+func (k *kubeconfig) resolve(name string) (*kubeconfigCluster, *kubeconfigUser, error) {
+	if name == "" {
+		name = k.CurrentContext
+	}
+	if name == "" {
+		return nil, nil, fmt.Errorf("kubeconfig has no current-context, set kubeconfigContext")
+	}
+
+	var selected *kubeconfigContext
+	for i := range k.Contexts {
+		if k.Contexts[i].Name == name {
+			selected = &k.Contexts[i]
+			break
+		}
+	}
+	if selected == nil {
+		return nil, nil, fmt.Errorf("kubeconfig has no context %q", name)
+	}
+	var cluster *kubeconfigCluster
+	for i := range k.Clusters {
+		if k.Clusters[i].Name == selected.Context.Cluster {
+			cluster = &k.Clusters[i]
+			break
+		}
+	}
+	if cluster == nil {
+		return nil, nil, fmt.Errorf("kubeconfig has no cluster %q", selected.Context.Cluster)
+	}
+	var user *kubeconfigUser
+	for i := range k.Users {
+		if k.Users[i].Name == selected.Context.User {
+			user = &k.Users[i]
+			break
+		}
+	}
+	if user == nil {
+		return nil, nil, fmt.Errorf("kubeconfig has no user %q", selected.Context.User)
+	}
+	return cluster, user, nil
+}
+
+// remoteCluster is the API client of the cluster described by the kubeconfig secret. It is
+// built again when the kubeconfig changes, so rotated credentials are picked up at the next
+// read of the secret.
+type remoteCluster struct {
+	tlsConfig *tls.Config // TLS policy the kubeconfig's CA and certificate are added to
+
+	mu         sync.Mutex
+	kubeconfig string
+	client     *k8sClient
+}
+
+// remoteClient returns the client of the remote cluster, reading the kubeconfig through the
+// local client.
+func (s *SecretHeader) remoteClient(ctx context.Context, local *k8sClient) (*k8sClient, error) {
+	// The kubeconfig secret itself is always read with the service account
+	data, err := s.loadSecretData(ctx, local, s.config.KubeconfigSecretNamespace, s.config.KubeconfigSecretName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	content, ok := data[s.config.KubeconfigSecretKey]
+	if !ok {
+		return nil, classify(ErrKeyMissing, fmt.Errorf("failed to load kubeconfig: secret key '%s' not found in secret %s/%s",
+			s.config.KubeconfigSecretKey, s.config.KubeconfigSecretNamespace, s.config.KubeconfigSecretName))
+	}
+
+	s.remote.mu.Lock()
+	defer s.remote.mu.Unlock()
+
+	if s.remote.client != nil && s.remote.kubeconfig == content {
+		return s.remote.client, nil
+	}
+	client, err := newRemoteK8sClient(s.remote.tlsConfig, s.config, content)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig in secret %s/%s: %w", s.config.KubeconfigSecretNamespace, s.config.KubeconfigSecretName, err)
+	}
+	client.namespaces = local.namespaces
+	client.attribution = local.attribution
+	if s.remote.client != nil {
+		// Idle connections of the previous transport are dropped unless the new client reuses it
+		if s.remote.client.httpClient.Transport != client.httpClient.Transport {
+			s.remote.client.httpClient.CloseIdleConnections()
+		}
+		s.debugf("Kubeconfig in secret %s/%s changed, reconnecting to %s", s.config.KubeconfigSecretNamespace, s.config.KubeconfigSecretName, client.baseURL)
+	}
+	s.remote.kubeconfig, s.remote.client = content, client
+	return client, nil
+}
+
+// newRemoteK8sClient creates a client for the cluster and user of the configured context of
+// a kubeconfig, with the given TLS policy.
+func newRemoteK8sClient(tlsConfig *tls.Config, config *Config, content string) (*k8sClient, error) {
+	parsed, err := parseKubeconfig(content)
+	if err != nil {
+		return nil, err
+	}
+	cluster, user, err := parsed.resolve(config.KubeconfigContext)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := url.Parse(cluster.Cluster.Server)
+	if err != nil || server.Host == "" || server.Scheme != "https" {
+		return nil, fmt.Errorf("cluster %q needs an https server URL", cluster.Name)
+	}
+	if cluster.Cluster.InsecureSkipTLSVerify || cluster.Cluster.CertificateAuthority != "" || cluster.Cluster.ProxyURL != "" {
+		return nil, fmt.Errorf("cluster %q: insecure-skip-tls-verify, certificate-authority and proxy-url are not supported, embed certificate-authority-data", cluster.Name)
+	}
+	if user.User.TokenFile != "" || user.User.ClientCertificate != "" || user.User.ClientKey != "" ||
+		user.User.Username != "" || user.User.Exec != nil || user.User.AuthProvider != nil {
+		return nil, fmt.Errorf("user %q: only token and client-certificate-data credentials are supported", user.Name)
+	}
+
+	tlsConfig = tlsConfig.Clone()
+	tlsConfig.ServerName = cluster.Cluster.TLSServerName
+	var caCert []byte
+	if cluster.Cluster.CertificateAuthorityData != "" {
+		caCert, err = base64.StdEncoding.DecodeString(cluster.Cluster.CertificateAuthorityData)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %q: invalid certificate-authority-data: %w", cluster.Name, err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("cluster %q: failed to parse certificate-authority-data", cluster.Name)
+		}
+	}
+	var certPEM []byte
+	switch {
+	case user.User.ClientCertificateData != "":
+		var certErr, keyErr error
+		var keyPEM []byte
+		certPEM, certErr = base64.StdEncoding.DecodeString(user.User.ClientCertificateData)
+		keyPEM, keyErr = base64.StdEncoding.DecodeString(user.User.ClientKeyData)
+		if certErr != nil || keyErr != nil {
+			return nil, fmt.Errorf("user %q: invalid client-certificate-data or client-key-data", user.Name)
+		}
+		certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", user.Name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	case user.User.Token == "":
+		return nil, fmt.Errorf("user %q has no token or client certificate", user.Name)
+	}
+
+	// Share the connection pool with the other instances talking to the same remote server
+	// with the same trust and client certificate
+	baseURL := strings.TrimSuffix(server.String(), "/")
+	certSum := sha256.Sum256(certPEM)
+	scope := apiTransportScope(config, tlsConfig, baseURL, caCert) +
+		fmt.Sprintf("%q", []string{tlsConfig.ServerName, hex.EncodeToString(certSum[:])})
+	transport, err := apiTransports.get(scope, func() (*apiTransport, error) {
+		return newAPITransport(config, tlsConfig), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &k8sClient{
+		httpClient:  &http.Client{Timeout: 30 * time.Second, Transport: transport.transport},
+		baseURL:     baseURL,
+		recycler:    transport.recycler,
+		token:       user.User.Token,
+		impersonate: newImpersonation(config),
+		protobuf:    config.APIProtobuf,
+	}, nil
+}
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	indent int
+	text   string
+	number int
+}
+
+// parseYAML parses the block-style YAML subset kubeconfig files are written in: nested
+// mappings and sequences, plain and quoted scalars, comments, and the empty flow
+// collections {} and []. Anchors, tags, multi-line scalars and non-empty flow collections
+// are not supported.
+func parseYAML(content string) (interface{}, error) {
+	var lines []yamlLine
+	for i, text := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" || trimmed == "..." {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		lines = append(lines, yamlLine{indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t"), number: i + 1})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].number)
+	}
+	return value, nil
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i], indented by indent.
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLItem(lines[i].text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	return parseYAMLMapping(lines, i, indent)
+}
+
+// parseYAMLMapping parses the key: value lines starting at lines[i].
+func parseYAMLMapping(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	mapping := make(map[string]interface{})
+	for i < len(lines) && lines[i].indent == indent && !isYAMLItem(lines[i].text) {
+		line := lines[i]
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, 0, fmt.Errorf("line %d: expected a key: value pair", line.number)
+		}
+		i++
+
+		var value interface{}
+		var err error
+		switch {
+		case rest != "":
+			if value, err = parseYAMLScalar(rest); err != nil {
+				return nil, 0, fmt.Errorf("line %d: %w", line.number, err)
+			}
+		case i < len(lines) && (lines[i].indent > indent || (lines[i].indent == indent && isYAMLItem(lines[i].text))):
+			// A sequence may sit at the indentation of its key
+			if value, i, err = parseYAMLBlock(lines, i, lines[i].indent); err != nil {
+				return nil, 0, err
+			}
+		}
+		mapping[key] = value
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return mapping, i, nil
+}
+
+// parseYAMLSequence parses the "- item" lines starting at lines[i].
+func parseYAMLSequence(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	sequence := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLItem(lines[i].text) {
+		line := lines[i]
+		rest := strings.TrimLeft(line.text[1:], " ")
+
+		var value interface{}
+		var err error
+		switch {
+		case rest == "":
+			i++
+			if i < len(lines) && lines[i].indent > indent {
+				if value, i, err = parseYAMLBlock(lines, i, lines[i].indent); err != nil {
+					return nil, 0, err
+				}
+			}
+		case isYAMLItem(rest) || isYAMLKey(rest):
+			// The item is a collection starting on the dash line, indented like its content
+			lines[i] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest, number: line.number}
+			if value, i, err = parseYAMLBlock(lines, i, lines[i].indent); err != nil {
+				return nil, 0, err
+			}
+		default:
+			if value, err = parseYAMLScalar(rest); err != nil {
+				return nil, 0, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			i++
+		}
+		sequence = append(sequence, value)
+	}
+	return sequence, i, nil
+}
+
+// isYAMLItem reports whether text starts a sequence item.
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// isYAMLKey reports whether text starts with a mapping key.
+func isYAMLKey(text string) bool {
+	_, _, ok := splitYAMLKey(text)
+	return ok
+}
+
+// splitYAMLKey splits "key: value" or "key:" at the separating colon. Keys may be quoted.
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "'") {
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key, err := parseYAMLScalar(text[:end+2])
+		rest := text[end+2:]
+		if err != nil || !strings.HasPrefix(rest, ":") || (len(rest) > 1 && rest[1] != ' ') {
+			return "", "", false
+		}
+		return fmt.Sprint(key), strings.TrimSpace(rest[1:]), true
+	}
+	if i := strings.Index(text, ": "); i > 0 {
+		return text[:i], strings.TrimSpace(text[i+2:]), true
+	}
+	if strings.HasSuffix(text, ":") && len(text) > 1 {
+		return text[:len(text)-1], "", true
+	}
+	return "", "", false
+}
+
+// parseYAMLScalar parses a plain or quoted scalar, or an empty flow collection.
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		end := closingQuote(text[1:])
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated quoted scalar")
+		}
+		if tail := strings.TrimSpace(text[end+2:]); tail != "" && !strings.HasPrefix(tail, "#") {
+			return nil, fmt.Errorf("text after a quoted scalar")
+		}
+		return strconv.Unquote(text[:end+2])
+	case strings.HasPrefix(text, "'"):
+		var b strings.Builder
+		for i := 1; i < len(text); i++ {
+			if text[i] != '\'' {
+				b.WriteByte(text[i])
+				continue
+			}
+			if i+1 < len(text) && text[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			if tail := strings.TrimSpace(text[i+1:]); tail != "" && !strings.HasPrefix(tail, "#") {
+				return nil, fmt.Errorf("text after a quoted scalar")
+			}
+			return b.String(), nil
+		}
+		return nil, fmt.Errorf("unterminated quoted scalar")
+	}
+
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	switch text {
+	case "{}":
+		return map[string]interface{}{}, nil
+	case "[]":
+		return []interface{}{}, nil
+	case "", "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if strings.HasPrefix(text, "{") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">") ||
+		strings.HasPrefix(text, "&") || strings.HasPrefix(text, "*") || strings.HasPrefix(text, "!") {
+		return nil, fmt.Errorf("unsupported YAML syntax %q", text[:1])
+	}
+	return text, nil
+}
@@ -0,0 +1,335 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKubeconfig returns a kubeconfig for server, with the extra user fields given.
+func testKubeconfig(server *httptest.Server, user string) string {
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	return `apiVersion: v1
+kind: Config
+# written by the cluster provisioner
+clusters:
+- cluster:
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString(ca) + `
+    server: ` + server.URL + `
+  name: workload-eu
+contexts:
+- context:
+    cluster: workload-eu
+    user: traefik
+  name: workload-eu
+current-context: workload-eu
+preferences: {}
+users:
+- name: traefik
+  user:
+    ` + user + `
+`
+}
+
+// TestParseYAML tests the YAML subset used by kubeconfig files.
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedValue interface{}
+		expectError   bool
+	}{
+		{
+			name:          "nested mappings",
+			content:       "a:\n  b: c\n  d: 'it''s'\ne: \"x\\ty\" # comment\n",
+			expectedValue: map[string]interface{}{"a": map[string]interface{}{"b": "c", "d": "it's"}, "e": "x\ty"},
+		},
+		{
+			name:    "sequence at key indentation",
+			content: "items:\n- name: one\n  value: true\n- two\n-\n  nested: {}\nempty: []\nnothing:\n",
+			expectedValue: map[string]interface{}{
+				"items": []interface{}{
+					map[string]interface{}{"name": "one", "value": true},
+					"two",
+					map[string]interface{}{"nested": map[string]interface{}{}},
+				},
+				"empty":   []interface{}{},
+				"nothing": nil,
+			},
+		},
+		{
+			name:          "url values",
+			content:       "---\nserver: https://10.0.0.1:6443\n\"quoted key\": value\n",
+			expectedValue: map[string]interface{}{"server": "https://10.0.0.1:6443", "quoted key": "value"},
+		},
+		{name: "bad indentation", content: "a: b\n  c: d\n", expectError: true},
+		{name: "block scalar", content: "a: |\n  text\n", expectError: true},
+		{name: "unterminated quote", content: "a: \"b\n", expectError: true},
+		{name: "not a mapping", content: "a: b\nplain\n", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := parseYAML(tt.content)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(value, tt.expectedValue) {
+				t.Errorf("Expected %#v, got %#v", tt.expectedValue, value)
+			}
+		})
+	}
+}
+
+// TestNewRemoteK8sClient tests building a client from the contexts and users of a kubeconfig.
+func TestNewRemoteK8sClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		content       string
+		context       string
+		expectedToken string
+		expectError   bool
+	}{
+		{name: "yaml", content: testKubeconfig(server, "token: remote-token"), expectedToken: "remote-token"},
+		{
+			name:          "json",
+			content:       `{"current-context":"c","contexts":[{"name":"c","context":{"cluster":"k","user":"u"}}],"clusters":[{"name":"k","cluster":{"server":"` + server.URL + `"}}],"users":[{"name":"u","user":{"token":"json-token"}}]}`,
+			expectedToken: "json-token",
+		},
+		{name: "unknown context", content: testKubeconfig(server, "token: remote-token"), context: "workload-us", expectError: true},
+		{name: "exec plugin", content: testKubeconfig(server, "exec:\n      command: aws"), expectError: true},
+		{name: "token file", content: testKubeconfig(server, "tokenFile: /var/run/token"), expectError: true},
+		{name: "no credentials", content: testKubeconfig(server, "as: nobody"), expectError: true},
+		{name: "plain http", content: strings.Replace(testKubeconfig(server, "token: t"), "https://", "http://", 1), expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newRemoteK8sClient(&tls.Config{}, &Config{KubeconfigContext: tt.context}, tt.content)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if client.baseURL != server.URL || client.token != tt.expectedToken {
+				t.Errorf("Expected %s with token %q, got %s with %q", server.URL, tt.expectedToken, client.baseURL, client.token)
+			}
+		})
+	}
+
+	// Instances reaching the same remote server share its connection pool, whatever the token
+	first, err := newRemoteK8sClient(&tls.Config{}, &Config{}, testKubeconfig(server, "token: first-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newRemoteK8sClient(&tls.Config{}, &Config{}, testKubeconfig(server, "token: second-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.httpClient.Transport != second.httpClient.Transport {
+		t.Error("Expected clients of the same remote server to share a transport")
+	}
+	other := httptest.NewTLSServer(http.NotFoundHandler())
+	defer other.Close()
+	third, err := newRemoteK8sClient(&tls.Config{}, &Config{}, testKubeconfig(other, "token: first-token"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.httpClient.Transport == first.httpClient.Transport {
+		t.Error("Expected clients of different remote servers to use their own transports")
+	}
+}
+
+// TestServeHTTPKubeconfig tests reading the secret from the cluster of a kubeconfig stored
+// in a local secret, and reconnecting when the kubeconfig changes.
+func TestServeHTTPKubeconfig(t *testing.T) {
+	remote := mockK8sServer(t, map[string]string{"api-key": "remote-value"}, true)
+	defer remote.Close()
+	kubeconfigs := map[string]map[string]string{
+		"workload-eu-kubeconfig": {"kubeconfig": testKubeconfig(remote, "token: test-token")},
+	}
+	local := mockK8sSecretsServer(t, kubeconfigs)
+	defer local.Close()
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("X-API-Key")
+		}),
+		name: "kubeconfig-test",
+		config: &Config{
+			SecretName:                "partner-api",
+			SecretKey:                 "api-key",
+			HeaderName:                "X-API-Key",
+			Namespace:                 "default",
+			CacheTTL:                  300,
+			KubeconfigSecretName:      "workload-eu-kubeconfig",
+			KubeconfigSecretKey:       "kubeconfig",
+			KubeconfigSecretNamespace: "clusters",
+		},
+		k8sClient: &k8sClient{
+			httpClient: local.Client(),
+			baseURL:    local.URL,
+			token:      "test-token",
+		},
+		cache:  &secretCache{ttl: 300 * time.Second},
+		remote: &remoteCluster{tlsConfig: &tls.Config{}},
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if rw.Code != http.StatusOK || captured != "remote-value" {
+		t.Fatalf("Expected status 200 with the remote value, got %d and %q", rw.Code, captured)
+	}
+	first := handler.remote.client
+
+	// A rotated kubeconfig is used from the next read of the kubeconfig secret
+	kubeconfigs["workload-eu-kubeconfig"] = map[string]string{"kubeconfig": testKubeconfig(remote, "token: wrong-token")}
+	handler.cache.invalidate()
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if rw.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 with the rotated credentials, got %d", rw.Code)
+	}
+	if handler.remote.client == first {
+		t.Error("Expected a new client for the rotated kubeconfig")
+	}
+}
+
+// TestValidateKubeconfig tests kubeconfigSecretName configuration checks.
+func TestValidateKubeconfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectedKey string
+		expectError bool
+	}{
+		{name: "unset", config: &Config{}},
+		{name: "default key", config: &Config{KubeconfigSecretName: "remote"}, expectedKey: defaultKubeconfigSecretKey},
+		{name: "custom key", config: &Config{KubeconfigSecretName: "remote", KubeconfigSecretKey: "value"}, expectedKey: "value"},
+		{name: "context without secret", config: &Config{KubeconfigContext: "remote"}, expectError: true},
+		{name: "file source", config: &Config{KubeconfigSecretName: "remote", Source: sourceFile}, expectError: true},
+		{name: "api token", config: &Config{KubeconfigSecretName: "remote", APITokenSecretName: "token"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateKubeconfig(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.KubeconfigSecretKey != tt.expectedKey {
+				t.Errorf("Expected key %q, got %q", tt.expectedKey, tt.config.KubeconfigSecretKey)
+			}
+		})
+	}
+}
+
+// TestValidateKubeconfigSecret tests that configured reads of the kubeconfig secret are rejected.
+func TestValidateKubeconfigSecret(t *testing.T) {
+	base := Config{SecretName: "partner-api", Namespace: "default", KubeconfigSecretName: "remote", KubeconfigSecretNamespace: "default"}
+	tests := []struct {
+		name        string
+		modify      func(config *Config)
+		expectError bool
+	}{
+		{name: "other secret", modify: func(config *Config) {}},
+		{name: "unset", modify: func(config *Config) { config.KubeconfigSecretName = ""; config.SecretName = "remote" }},
+		{name: "secret name", modify: func(config *Config) { config.SecretName = "remote" }, expectError: true},
+		{name: "other namespace", modify: func(config *Config) { config.SecretName = "remote"; config.KubeconfigSecretNamespace = "clusters" }},
+		{
+			name: "listed namespace",
+			modify: func(config *Config) {
+				config.SecretName = "remote"
+				config.KubeconfigSecretNamespace = "clusters"
+				config.Namespaces = []string{"team-a", "clusters"}
+			},
+			expectError: true,
+		},
+		{name: "kubernetes fallback", modify: func(config *Config) { config.FallbackSources = []string{"kubernetes:remote"} }, expectError: true},
+		{name: "file fallback", modify: func(config *Config) { config.FallbackSources = []string{"file:remote"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := base
+			tt.modify(&config)
+			err := validateKubeconfigSecret(&config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestCheckKubeconfigRead tests that secret names resolved per request cannot read the
+// kubeconfig secret.
+func TestCheckKubeconfigRead(t *testing.T) {
+	handler := &SecretHeader{config: &Config{
+		SecretName:                "tenant-{{ .Header }}",
+		Namespace:                 "default",
+		Namespaces:                []string{"team-a", "clusters"},
+		KubeconfigSecretName:      "tenant-remote",
+		KubeconfigSecretNamespace: "clusters",
+	}}
+
+	tests := []struct {
+		name        string
+		namespace   string
+		secretName  string
+		expectError bool
+	}{
+		{name: "other secret", namespace: "default", secretName: "tenant-acme"},
+		{name: "searched namespaces", namespace: "default", secretName: "tenant-remote", expectError: true},
+		{name: "kubeconfig namespace", namespace: "clusters", secretName: "tenant-remote", expectError: true},
+		{name: "other namespace", namespace: "team-b", secretName: "tenant-remote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handler.checkKubeconfigRead(tt.namespace, tt.secretName)
+			if tt.expectError {
+				if !errors.Is(err, ErrForbidden) {
+					t.Errorf("Expected ErrForbidden, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+
+	if _, err := handler.fetchSecretData(t.Context(), &k8sClient{}, "clusters", "tenant-remote"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("Expected fetchSecretData to refuse the kubeconfig secret, got %v", err)
+	}
+}
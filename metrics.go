@@ -0,0 +1,274 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsNamespace prefixes every metric name exposed by the plugin.
+const metricsNamespace = "traefik_k8s_secret_header"
+
+// metricDesc describes a metric family.
+type metricDesc struct {
+	name  string
+	help  string
+	typ   string // "counter" or "gauge"
+	since bool   // values are Unix times, exposed as the seconds elapsed since then
+}
+
+// Metric families exposed by the plugin.
+var (
+	metricHeaderRejections = metricDesc{
+		name: "header_rejections_total",
+		help: "Requests rejected because they already carried the managed header.",
+		typ:  "counter",
+	}
+	metricValidationFailures = metricDesc{
+		name: "validation_failures_total",
+		help: "Requests rejected in validate or hmacVerify mode because their credential or signature did not match the secret.",
+		typ:  "counter",
+	}
+	metricValueRejections = metricDesc{
+		name: "value_rejections_total",
+		help: "Secret values that failed valuePattern or the length and prefix rules.",
+		typ:  "counter",
+	}
+	metricSourceFallbacks = metricDesc{
+		name: "source_fallbacks_total",
+		help: "Values taken from fallbackSources or fallbackValue because the primary source failed.",
+		typ:  "counter",
+	}
+	metricDryRunRequests = metricDesc{
+		name: "dry_run_requests_total",
+		help: "Requests seen in dryRun mode, by whether the value could be injected.",
+		typ:  "counter",
+	}
+	metricCacheEntries = metricDesc{
+		name: "cache_entries",
+		help: "Secret values currently held in the middleware cache.",
+		typ:  "gauge",
+	}
+	metricCacheEvictions = metricDesc{
+		name: "cache_evictions_total",
+		help: "Secrets evicted from the cache because it held cacheMaxEntries entries.",
+		typ:  "counter",
+	}
+	metricResourceVersion = metricDesc{
+		name: "secret_resource_version",
+		help: "resourceVersion of the last read of each Kubernetes secret.",
+		typ:  "gauge",
+	}
+	metricSecretAge = metricDesc{
+		name:  "secret_age_seconds",
+		help:  "Seconds since the data of each secret last changed.",
+		typ:   "gauge",
+		since: true,
+	}
+	metricSecretRotations = metricDesc{
+		name: "secret_rotations_total",
+		help: "Changes of the data of each secret seen on refresh.",
+		typ:  "counter",
+	}
+	metricCertificateNotAfter = metricDesc{
+		name: "certificate_not_after_timestamp_seconds",
+		help: "Expiry time of the certificate held by each TLS secret, in Unix seconds.",
+		typ:  "gauge",
+	}
+	metricCertificateExpiring = metricDesc{
+		name: "certificate_expiring",
+		help: "1 if the certificate held by each TLS secret expires within certExpiryWarningDays.",
+		typ:  "gauge",
+	}
+	metricStaleServed = metricDesc{
+		name: "stale_served_total",
+		help: "Requests served with an expired cached secret within maxStale because reading it again failed.",
+		typ:  "counter",
+	}
+	metricAuthFailureRefreshes = metricDesc{
+		name: "auth_failure_refreshes_total",
+		help: "Secrets read again after an upstream 401 or 403, by result: retried, unchanged or failed.",
+		typ:  "counter",
+	}
+	metricCoalesceTimeouts = metricDesc{
+		name: "coalesce_timeouts_total",
+		help: "Requests that timed out waiting for a secret read started by another request.",
+		typ:  "counter",
+	}
+	metricRBACDenied = metricDesc{
+		name: "rbac_denied_total",
+		help: "Kubernetes secret reads forbidden by RBAC.",
+		typ:  "counter",
+	}
+	metricSecretFetches = metricDesc{
+		name: "secret_fetches_total",
+		help: "Reads of secrets from their source, by result: success or the error code of the failure.",
+		typ:  "counter",
+	}
+)
+
+// metricsRegistry holds process-wide metric values. It is shared by all middleware
+// instances so a single scrape sees every instance, labelled by middleware name.
+type metricsRegistry struct {
+	mu     sync.Mutex
+	descs  map[string]metricDesc
+	series map[string]map[string]float64 // family name -> rendered labels -> value
+	sinks  map[string]*statsdSink        // StatsD sink by middleware name
+}
+
+// metrics is the process-wide registry.
+var metrics = newMetricsRegistry()
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{
+		descs:  make(map[string]metricDesc),
+		series: make(map[string]map[string]float64),
+		sinks:  make(map[string]*statsdSink),
+	}
+}
+
+// inc increments a counter. labels are name/value pairs.
+func (r *metricsRegistry) inc(desc metricDesc, labels ...string) {
+	r.add(desc, 1, labels...)
+}
+
+// add adds delta to a counter or gauge.
+func (r *metricsRegistry) add(desc metricDesc, delta float64, labels ...string) {
+	r.mu.Lock()
+	series := r.family(desc)
+	key := renderLabels(labels)
+	series[key] += delta
+	value, sink := series[key], r.sink(labels)
+	r.mu.Unlock()
+
+	if desc.typ == "counter" {
+		value = delta
+	}
+	sink.send(desc, value, labels)
+}
+
+// set sets a gauge to value.
+func (r *metricsRegistry) set(desc metricDesc, value float64, labels ...string) {
+	r.mu.Lock()
+	series := r.family(desc)
+	series[renderLabels(labels)] = value
+	sink := r.sink(labels)
+	r.mu.Unlock()
+
+	sink.send(desc, value, labels)
+}
+
+// attachSink sends the later updates of the metrics of middleware to sink, replacing the
+// sink of a previous instance with the same name. A nil sink detaches it.
+func (r *metricsRegistry) attachSink(middleware string, sink *statsdSink) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if previous := r.sinks[middleware]; previous != nil && previous != sink {
+		previous.conn.Close()
+	}
+	if sink == nil {
+		delete(r.sinks, middleware)
+		return
+	}
+	r.sinks[middleware] = sink
+}
+
+// sink returns the StatsD sink of the middleware labelled in labels, if any. Callers hold r.mu.
+func (r *metricsRegistry) sink(labels []string) *statsdSink {
+	if len(labels) < 2 || labels[0] != "middleware" {
+		return nil
+	}
+	return r.sinks[labels[1]]
+}
+
+// value returns the current value of a series, mainly for tests.
+func (r *metricsRegistry) value(desc metricDesc, labels ...string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.series[desc.name][renderLabels(labels)]
+}
+
+// family returns the series map of a family, registering it on first use. Callers hold r.mu.
+func (r *metricsRegistry) family(desc metricDesc) map[string]float64 {
+	series, ok := r.series[desc.name]
+	if !ok {
+		r.descs[desc.name] = desc
+		series = make(map[string]float64)
+		r.series[desc.name] = series
+	}
+	return series
+}
+
+// writePrometheus renders all metrics in the Prometheus text exposition format.
+func (r *metricsRegistry) writePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.descs))
+	for name := range r.descs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := float64(time.Now().UnixNano()) / 1e9
+	for _, name := range names {
+		desc := r.descs[name]
+		fullName := metricsNamespace + "_" + name
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", fullName, desc.help, fullName, desc.typ); err != nil {
+			return err
+		}
+
+		labelSets := make([]string, 0, len(r.series[name]))
+		for labels := range r.series[name] {
+			labelSets = append(labelSets, labels)
+		}
+		sort.Strings(labelSets)
+
+		for _, labels := range labelSets {
+			v := r.series[name][labels]
+			if desc.since {
+				v = now - v
+			}
+			value := strconv.FormatFloat(v, 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", fullName, labels, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderLabels formats name/value pairs as a Prometheus label set, e.g. {middleware="a"}.
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// serveMetrics writes the registry as a Prometheus scrape response.
+func serveMetrics(rw http.ResponseWriter) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	metrics.writePrometheus(rw)
+}
@@ -0,0 +1,50 @@
+package traefik_k8s_secret_header
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMetricsRegistry tests counter/gauge bookkeeping and Prometheus rendering.
+func TestMetricsRegistry(t *testing.T) {
+	registry := newMetricsRegistry()
+
+	counter := metricDesc{name: "things_total", help: "Things.", typ: "counter"}
+	gauge := metricDesc{name: "level", help: "Level.", typ: "gauge"}
+
+	registry.inc(counter, "middleware", "b")
+	registry.inc(counter, "middleware", "a")
+	registry.add(counter, 2, "middleware", "a")
+	registry.set(gauge, 7)
+	registry.set(gauge, 5)
+
+	if got := registry.value(counter, "middleware", "a"); got != 3 {
+		t.Errorf("Expected counter value 3, got %v", got)
+	}
+
+	var out strings.Builder
+	if err := registry.writePrometheus(&out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `# HELP traefik_k8s_secret_header_level Level.
+# TYPE traefik_k8s_secret_header_level gauge
+traefik_k8s_secret_header_level 5
+# HELP traefik_k8s_secret_header_things_total Things.
+# TYPE traefik_k8s_secret_header_things_total counter
+traefik_k8s_secret_header_things_total{middleware="a"} 3
+traefik_k8s_secret_header_things_total{middleware="b"} 1
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected exposition:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+// TestRenderLabels tests escaping of label values.
+func TestRenderLabels(t *testing.T) {
+	got := renderLabels([]string{"middleware", `a"b\c`, "namespace", "default"})
+	expected := `{middleware="a\"b\\c",namespace="default"}`
+	if got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
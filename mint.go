@@ -0,0 +1,246 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// mintPlaceholder matches request placeholders such as {{ .Host }} in mintClaims values.
+var mintPlaceholder = regexp.MustCompile(`\{\{\s*\.(\w+)\s*\}\}`)
+
+// mintRegisteredClaims are set by the minter itself and cannot be overridden by mintClaims.
+var mintRegisteredClaims = map[string]bool{"iss": true, "aud": true, "iat": true, "nbf": true, "exp": true}
+
+// minter caches minted tokens per rendered claim set.
+type minter struct {
+	mu     sync.Mutex
+	tokens map[string]mintedToken
+}
+
+// mintedToken is a cached JWT and the key that signed it.
+type mintedToken struct {
+	key     string
+	token   string
+	expires time.Time
+}
+
+// mintedJWT returns a JWT signed with the secret, reusing the cached token for the
+// same claims until less than a quarter of its lifetime is left.
+func (s *SecretHeader) mintedJWT(req *http.Request, secretName, secretKey string) (string, error) {
+	key, err := s.getValue(req.Context(), secretName, secretKey)
+	if err != nil {
+		return "", err
+	}
+
+	claims := make(map[string]interface{}, len(s.config.MintClaims)+5)
+	for name, value := range s.config.MintClaims {
+		claims[name] = expandMintPlaceholders(value, req)
+	}
+	if s.config.MintIssuer != "" {
+		claims["iss"] = s.config.MintIssuer
+	}
+	if s.config.MintAudience != "" {
+		claims["aud"] = s.config.MintAudience
+	}
+
+	// The cache key is the claim set without the time-based claims
+	cacheKey, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	m := s.minter
+	m.mu.Lock()
+
+	now := time.Now()
+	ttl := time.Duration(s.config.MintTTL) * time.Second
+	if cached, ok := m.tokens[string(cacheKey)]; ok && cached.key == key && now.Add(ttl/4).Before(cached.expires) {
+		m.mu.Unlock()
+		return cached.token, nil
+	}
+
+	expires := now.Add(ttl)
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+	claims["exp"] = expires.Unix()
+
+	algorithm := s.config.MintAlgorithm
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+	token, err := signJWT(algorithm, s.config.MintKeyID, key, claims)
+	if err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
+
+	if m.tokens == nil {
+		m.tokens = make(map[string]mintedToken)
+	}
+	// Templated claims can yield many claim sets; drop expired tokens once the map grows
+	if len(m.tokens) >= 1024 {
+		for k, cached := range m.tokens {
+			if !now.Before(cached.expires) {
+				delete(m.tokens, k)
+			}
+		}
+	}
+	m.tokens[string(cacheKey)] = mintedToken{key: key, token: token, expires: expires}
+	m.mu.Unlock()
+
+	// Like an OAuth2 renewal, the write-back serves every request and must not be canceled
+	// with the one that minted the token. Other requests reuse the cached token meanwhile.
+	s.writeBackToken(context.Background(), token, expires)
+	return token, nil
+}
+
+// signJWT encodes claims as a compact JWS. HS256 uses key as the HMAC key; RS256 and ES256
+// expect a PEM private key, as stored in the tls.key of a kubernetes.io/tls secret.
+func signJWT(algorithm, keyID, key string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": algorithm, "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT header: %w", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JWT claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	var signature []byte
+	switch algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case "RS256", "ES256":
+		signer, err := parsePrivateKey(key)
+		if err != nil {
+			return "", err
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if signature, err = signDigest(algorithm, signer, digest[:]); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// signDigest signs a SHA-256 digest with an RSA (RS256) or P-256 ECDSA (ES256) key.
+func signDigest(algorithm string, signer crypto.Signer, digest []byte) ([]byte, error) {
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != "RS256" {
+			return nil, fmt.Errorf("RSA key cannot sign %s", algorithm)
+		}
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	case *ecdsa.PrivateKey:
+		if algorithm != "ES256" || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ES256 requires a P-256 ECDSA key")
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign JWT: %w", err)
+		}
+		// JWS uses the fixed-size r||s encoding rather than ASN.1
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", signer)
+	}
+}
+
+// parsePrivateKey decodes a PEM private key in PKCS#1, SEC 1 or PKCS#8 form.
+func parsePrivateKey(pemKey string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, fmt.Errorf("JWT signing key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q for JWT signing key", block.Type)
+	}
+}
+
+// expandMintPlaceholders substitutes {{ .Host }}, {{ .Method }} and {{ .Path }} in a claim value.
+func expandMintPlaceholders(value string, req *http.Request) string {
+	return mintPlaceholder.ReplaceAllStringFunc(value, func(placeholder string) string {
+		switch mintPlaceholder.FindStringSubmatch(placeholder)[1] {
+		case "Host":
+			return req.Host
+		case "Method":
+			return req.Method
+		case "Path":
+			return req.URL.Path
+		default:
+			return placeholder
+		}
+	})
+}
+
+// validateMintConfig checks the JWT minting settings.
+func validateMintConfig(config *Config) error {
+	switch config.MintAlgorithm {
+	case "":
+		config.MintAlgorithm = "HS256"
+	case "HS256", "RS256", "ES256":
+	default:
+		return fmt.Errorf("mintAlgorithm must be HS256, RS256 or ES256")
+	}
+	if config.MintTTL <= 0 {
+		return fmt.Errorf("mintTTL must be positive")
+	}
+	for name, value := range config.MintClaims {
+		if mintRegisteredClaims[name] {
+			return fmt.Errorf("mintClaims cannot set the %q claim", name)
+		}
+		for _, match := range mintPlaceholder.FindAllStringSubmatch(value, -1) {
+			switch match[1] {
+			case "Host", "Method", "Path":
+			default:
+				return fmt.Errorf("mintClaims %q uses unknown placeholder %s", name, match[0])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPMintJWT tests injecting HS256 JWTs minted with the secret.
+func TestServeHTTPMintJWT(t *testing.T) {
+	secretData := map[string]string{
+		"signing-key": "mint-key",
+	}
+
+	mockServer := mockK8sServer(t, secretData, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:   "jwt-signing",
+		SecretKey:    "signing-key",
+		HeaderName:   "Authorization",
+		ValuePrefix:  "Bearer ",
+		Namespace:    "default",
+		CacheTTL:     300,
+		Mode:         modeMintJWT,
+		MintIssuer:   "traefik",
+		MintAudience: "orders-api",
+		MintTTL:      60,
+		MintClaims:   map[string]string{"sub": "gateway", "host": "{{ .Host }}"},
+	}
+
+	var authorization string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		authorization = req.Header.Get("Authorization")
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	handler := &SecretHeader{
+		next:   next,
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{
+			ttl: time.Duration(config.CacheTTL) * time.Second,
+		},
+		minter: &minter{},
+	}
+
+	tokens := make(map[string]string)
+	for _, host := range []string{"a.example.com", "a.example.com", "b.example.com"} {
+		req := httptest.NewRequest(http.MethodGet, "http://"+host+"/orders", nil)
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rw.Code)
+		}
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			t.Fatalf("Expected a bearer token, got %q", authorization)
+		}
+		raw := strings.TrimPrefix(authorization, "Bearer ")
+
+		token, err := parseJWT(raw)
+		if err != nil {
+			t.Fatalf("Failed to parse minted JWT: %v", err)
+		}
+		if err := token.verifyHS256([]byte("mint-key"), time.Now()); err != nil {
+			t.Fatalf("Minted JWT does not verify: %v", err)
+		}
+		for claim, expected := range map[string]string{"iss": "traefik", "aud": "orders-api", "sub": "gateway", "host": host} {
+			if got, _ := token.stringClaim(claim); got != expected {
+				t.Errorf("Expected claim %s %q, got %q", claim, expected, got)
+			}
+		}
+		exp, _ := token.numericClaim("exp")
+		if lifetime := time.Until(time.Unix(exp, 0)); lifetime <= 0 || lifetime > time.Minute {
+			t.Errorf("Expected a lifetime of at most 60s, got %v", lifetime)
+		}
+
+		if previous, ok := tokens[host]; ok && previous != raw {
+			t.Errorf("Expected the cached token to be reused for %s", host)
+		}
+		tokens[host] = raw
+	}
+
+	if tokens["a.example.com"] == tokens["b.example.com"] {
+		t.Error("Expected distinct tokens for distinct templated claims")
+	}
+}
+
+// TestValidateMintConfig tests JWT minting configuration checks.
+func TestValidateMintConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{
+			name:   "static and templated claims",
+			config: &Config{MintTTL: 300, MintClaims: map[string]string{"sub": "gateway", "path": "{{ .Method }} {{.Path}}"}},
+		},
+		{
+			name:        "non-positive ttl",
+			config:      &Config{},
+			expectError: true,
+		},
+		{
+			name:        "registered claim override",
+			config:      &Config{MintTTL: 300, MintClaims: map[string]string{"exp": "9999999999"}},
+			expectError: true,
+		},
+		{
+			name:        "unknown placeholder",
+			config:      &Config{MintTTL: 300, MintClaims: map[string]string{"sub": "{{ .User }}"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateMintConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestSignJWT tests HS256, RS256 and ES256 signatures and the kid header.
+func TestSignJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8DER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	ecPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+	pkcs8PEM := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8DER}))
+
+	verifyRS256 := func(token *jwtToken) error {
+		digest := sha256.Sum256([]byte(token.signingInput))
+		return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], token.signature)
+	}
+	verifyES256 := func(token *jwtToken) error {
+		if len(token.signature) != 64 {
+			return errInvalidTestSignature
+		}
+		digest := sha256.Sum256([]byte(token.signingInput))
+		r := new(big.Int).SetBytes(token.signature[:32])
+		s := new(big.Int).SetBytes(token.signature[32:])
+		if !ecdsa.Verify(&ecKey.PublicKey, digest[:], r, s) {
+			return errInvalidTestSignature
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		algorithm   string
+		key         string
+		verify      func(*jwtToken) error
+		expectError bool
+	}{
+		{
+			name:      "HS256",
+			algorithm: "HS256",
+			key:       "shared-key",
+			verify: func(token *jwtToken) error {
+				return token.verifyHS256([]byte("shared-key"), time.Now())
+			},
+		},
+		{name: "RS256 with PKCS#1 key", algorithm: "RS256", key: rsaPEM, verify: verifyRS256},
+		{name: "ES256 with SEC 1 key", algorithm: "ES256", key: ecPEM, verify: verifyES256},
+		{name: "ES256 with PKCS#8 key", algorithm: "ES256", key: pkcs8PEM, verify: verifyES256},
+		{name: "ES256 with RSA key", algorithm: "ES256", key: rsaPEM, expectError: true},
+		{name: "RS256 with non-PEM key", algorithm: "RS256", key: "not-a-key", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := signJWT(tt.algorithm, "key-1", tt.key, map[string]interface{}{"sub": "gateway"})
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			token, err := parseJWT(raw)
+			if err != nil {
+				t.Fatalf("Failed to parse JWT: %v", err)
+			}
+			if token.header["alg"] != tt.algorithm || token.header["kid"] != "key-1" {
+				t.Errorf("Expected alg %s and kid key-1, got %v", tt.algorithm, token.header)
+			}
+			if err := tt.verify(token); err != nil {
+				t.Errorf("Signature does not verify: %v", err)
+			}
+		})
+	}
+}
+
+// errInvalidTestSignature is returned by the test verifiers.
+var errInvalidTestSignature = fmt.Errorf("invalid signature")
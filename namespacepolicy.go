@@ -0,0 +1,89 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environment variables of the Traefik process restricting the namespaces every middleware
+// instance may read, as comma-separated namespace names. They are set on the Traefik
+// deployment, out of reach of whoever writes Middleware resources.
+const (
+	allowedNamespacesEnv = "K8S_SECRET_HEADER_ALLOWED_NAMESPACES"
+	deniedNamespacesEnv  = "K8S_SECRET_HEADER_DENIED_NAMESPACES"
+)
+
+// namespacePolicy is the process-wide namespace allowlist and denylist. A nil policy allows
+// every namespace.
+type namespacePolicy struct {
+	allowed map[string]bool // nil allows every namespace not denied
+	denied  map[string]bool
+}
+
+// namespacePolicyFromEnv returns the policy set in the environment, or nil when neither
+// variable is set.
+func namespacePolicyFromEnv() *namespacePolicy {
+	allowed, denied := namespaceSet(os.Getenv(allowedNamespacesEnv)), namespaceSet(os.Getenv(deniedNamespacesEnv))
+	if allowed == nil && denied == nil {
+		return nil
+	}
+	return &namespacePolicy{allowed: allowed, denied: denied}
+}
+
+// namespaceSet parses a comma-separated list of namespaces, nil when it has none.
+func namespaceSet(list string) map[string]bool {
+	var set map[string]bool
+	for _, namespace := range strings.Split(list, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			if set == nil {
+				set = make(map[string]bool)
+			}
+			set[namespace] = true
+		}
+	}
+	return set
+}
+
+// check returns an error when the policy forbids reading or writing secrets in namespace.
+// The denylist wins over the allowlist.
+func (p *namespacePolicy) check(namespace string) error {
+	if p == nil {
+		return nil
+	}
+	if p.denied[namespace] {
+		return fmt.Errorf("namespace %q is denied by %s", namespace, deniedNamespacesEnv)
+	}
+	if p.allowed != nil && !p.allowed[namespace] {
+		return fmt.Errorf("namespace %q is not in %s", namespace, allowedNamespacesEnv)
+	}
+	return nil
+}
+
+// checkConfig returns an error naming every configured namespace the policy forbids, so a
+// middleware pointed at kube-system fails when it is loaded rather than at its first read.
+func (p *namespacePolicy) checkConfig(config *Config) error {
+	namespaces := map[string]bool{config.Namespace: true}
+	for _, namespace := range config.Namespaces {
+		namespaces[namespace] = true
+	}
+	if config.APITokenSecretName != "" {
+		namespaces[config.APITokenSecretNamespace] = true
+	}
+	if config.KubeconfigSecretName != "" {
+		namespaces[config.KubeconfigSecretNamespace] = true
+	}
+
+	var problems []string
+	for namespace := range namespaces {
+		if err := p.check(namespace); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
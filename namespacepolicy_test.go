@@ -0,0 +1,73 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNamespacePolicy tests the environment allowlist and denylist.
+func TestNamespacePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  string
+		denied   string
+		expected map[string]bool
+	}{
+		{name: "unset", expected: map[string]bool{"default": true, "kube-system": true}},
+		{name: "allowlist", allowed: "team-a, team-b", expected: map[string]bool{"team-a": true, "team-b": true, "kube-system": false}},
+		{name: "denylist", denied: "kube-system,", expected: map[string]bool{"default": true, "kube-system": false}},
+		{name: "denylist wins", allowed: "team-a,kube-system", denied: "kube-system", expected: map[string]bool{"team-a": true, "kube-system": false}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(allowedNamespacesEnv, tt.allowed)
+			t.Setenv(deniedNamespacesEnv, tt.denied)
+
+			policy := namespacePolicyFromEnv()
+			for namespace, expected := range tt.expected {
+				if err := policy.check(namespace); (err == nil) != expected {
+					t.Errorf("Namespace %s: expected allowed %v, got %v", namespace, expected, err)
+				}
+			}
+		})
+	}
+}
+
+// TestNewNamespacePolicy tests that middlewares reading a forbidden namespace are rejected,
+// and that clients never call the API server for one.
+func TestNewNamespacePolicy(t *testing.T) {
+	t.Setenv(deniedNamespacesEnv, "kube-system")
+
+	config := CreateConfig()
+	config.SecretName = "api-token"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Api-Key"
+	config.Namespace = "kube-system"
+	_, err := New(context.Background(), http.NotFoundHandler(), config, "namespace-policy-test")
+	if err == nil || !strings.Contains(err.Error(), `namespace "kube-system" is denied`) {
+		t.Errorf("Expected the namespace to be rejected, got %v", err)
+	}
+
+	config.Namespace = "default"
+	if _, err := New(context.Background(), http.NotFoundHandler(), config, "namespace-policy-test"); err != nil {
+		t.Errorf("Expected other namespaces to be allowed, got %v", err)
+	}
+
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected API request %s", r.URL.Path)
+	}))
+	defer mockServer.Close()
+	client := &k8sClient{
+		httpClient: mockServer.Client(),
+		baseURL:    mockServer.URL,
+		token:      "test-token",
+		namespaces: namespacePolicyFromEnv(),
+	}
+	if _, err := client.getSecret(context.Background(), "kube-system", "bootstrap-token"); err == nil {
+		t.Error("Expected reading kube-system to fail")
+	}
+}
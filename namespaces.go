@@ -0,0 +1,69 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// namespacesCachePrefix prefixes cache keys of secrets resolved through Config.Namespaces.
+// "*" is not a valid namespace name, so these keys never collide with per-namespace ones.
+const namespacesCachePrefix = "*/"
+
+// validateNamespaces checks Config.Namespaces and makes its first entry the namespace
+// reported in logs and the inventory.
+func validateNamespaces(config *Config) error {
+	if len(config.Namespaces) == 0 {
+		return nil
+	}
+	for _, namespace := range config.Namespaces {
+		if namespace == "" || strings.ContainsAny(namespace, "/*") {
+			return fmt.Errorf("invalid namespace %q in namespaces", namespace)
+		}
+	}
+	if config.Namespace != "" && config.Namespace != config.Namespaces[0] {
+		return fmt.Errorf("namespace and namespaces cannot both be set")
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("namespaces cannot be used with source %q", config.Source)
+	}
+	if config.Mode == modeGenerate {
+		return fmt.Errorf("namespaces cannot be used with mode %q", modeGenerate)
+	}
+	config.Namespace = config.Namespaces[0]
+	return nil
+}
+
+// secretCacheKey returns the cache key of a secret in the configured namespace or namespaces.
+func (s *SecretHeader) secretCacheKey(secretName string) string {
+	if len(s.config.Namespaces) > 0 {
+		return namespacesCachePrefix + secretName
+	}
+	return s.config.Namespace + "/" + secretName
+}
+
+// readNamespaces returns the data of the secret in the first of Config.Namespaces holding
+// it. Only a missing secret moves on to the next namespace; any other error fails the read,
+// so an override is never silently skipped. The resolved data is cached as a whole, sparing
+// repeated lookups of namespaces without the secret.
+func (s *SecretHeader) readNamespaces(ctx context.Context, client *k8sClient, secretName string) (map[string]string, error) {
+	cacheKey := s.secretCacheKey(secretName)
+	if data, ok := s.cache.get(cacheKey); ok {
+		return data, nil
+	}
+
+	for _, namespace := range s.config.Namespaces {
+		data, err := s.readKubernetesSecret(ctx, client, namespace, secretName)
+		if hasStatus(err, http.StatusNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry, _ := s.cache.load(namespace + "/" + secretName)
+		s.cacheSecretData(cacheKey, data, "", entry.secretType, entry.keyPointer)
+		return data, nil
+	}
+	return nil, fmt.Errorf("secret %s not found in namespaces %s", secretName, strings.Join(s.config.Namespaces, ", "))
+}
@@ -0,0 +1,157 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockNamespacesServer serves one api-token secret per namespace in tokens. The "locked"
+// namespace answers 403.
+func mockNamespacesServer(t *testing.T, tokens map[string]string, reads *int32) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(reads, 1)
+		namespace := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")[0]
+		if namespace == "locked" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		token, ok := tokens[namespace]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+			return
+		}
+		json.NewEncoder(w).Encode(k8sSecret{Data: map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(token))}})
+	}))
+}
+
+// TestServeHTTPNamespaces tests that the first namespace holding the secret wins.
+func TestServeHTTPNamespaces(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokens         map[string]string
+		namespaces     []string
+		expectedHeader string
+		expectError    bool
+	}{
+		{
+			name:           "team override",
+			tokens:         map[string]string{"team-a": "team-token", "shared": "shared-token"},
+			namespaces:     []string{"team-a", "shared", "default"},
+			expectedHeader: "team-token",
+		},
+		{
+			name:           "shared secret",
+			tokens:         map[string]string{"shared": "shared-token", "default": "default-token"},
+			namespaces:     []string{"team-a", "shared", "default"},
+			expectedHeader: "shared-token",
+		},
+		{
+			name:        "missing everywhere",
+			tokens:      map[string]string{"team-b": "other-token"},
+			namespaces:  []string{"team-a", "shared"},
+			expectError: true,
+		},
+		{
+			name:        "forbidden namespace is not skipped",
+			tokens:      map[string]string{"shared": "shared-token"},
+			namespaces:  []string{"locked", "shared"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reads int32
+			mockServer := mockNamespacesServer(t, tt.tokens, &reads)
+			defer mockServer.Close()
+
+			var captured string
+			nextCalled := false
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					nextCalled = true
+					captured = req.Header.Get("X-Auth-Token")
+				}),
+				name: "test-middleware",
+				config: &Config{
+					SecretName: "api-token",
+					SecretKey:  "token",
+					HeaderName: "X-Auth-Token",
+					Namespace:  tt.namespaces[0],
+					Namespaces: tt.namespaces,
+					CacheTTL:   300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if tt.expectError {
+				if nextCalled || rw.Code != http.StatusInternalServerError {
+					t.Errorf("Expected status 500 without calling next, got %d", rw.Code)
+				}
+				return
+			}
+			if captured != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, captured)
+			}
+
+			// The resolved secret is cached, including the namespaces without it
+			before := atomic.LoadInt32(&reads)
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if after := atomic.LoadInt32(&reads); after != before {
+				t.Errorf("Expected no API reads on the second request, got %d", after-before)
+			}
+		})
+	}
+}
+
+// TestValidateNamespaces tests namespaces configuration checks.
+func TestValidateNamespaces(t *testing.T) {
+	tests := []struct {
+		name              string
+		config            *Config
+		expectedNamespace string
+		expectError       bool
+	}{
+		{name: "unset", config: &Config{Namespace: "apps"}, expectedNamespace: "apps"},
+		{name: "list", config: &Config{Namespaces: []string{"team-a", "shared"}}, expectedNamespace: "team-a"},
+		{name: "namespace matching the first entry", config: &Config{Namespace: "team-a", Namespaces: []string{"team-a", "shared"}}, expectedNamespace: "team-a"},
+		{name: "conflicting namespace", config: &Config{Namespace: "apps", Namespaces: []string{"team-a"}}, expectError: true},
+		{name: "empty entry", config: &Config{Namespaces: []string{"team-a", ""}}, expectError: true},
+		{name: "external source", config: &Config{Source: sourceEnv, Namespaces: []string{"team-a"}}, expectError: true},
+		{name: "generate mode", config: &Config{Mode: modeGenerate, Namespaces: []string{"team-a"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateNamespaces(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.Namespace != tt.expectedNamespace {
+				t.Errorf("Expected namespace %q, got %q", tt.expectedNamespace, tt.config.Namespace)
+			}
+		})
+	}
+}
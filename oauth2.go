@@ -0,0 +1,338 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported values for Config.OAuth2AuthStyle.
+const (
+	oauth2AuthBasic = "basic"
+	oauth2AuthBody  = "body"
+	oauth2AuthTLS   = "tls"
+)
+
+// Supported values for Config.OAuth2RequestFormat.
+const (
+	oauth2FormatForm = "form"
+	oauth2FormatJSON = "json"
+)
+
+// oauth2ReservedParams are the token request parameters set by the middleware, which
+// oauth2TokenParams cannot replace.
+var oauth2ReservedParams = []string{"grant_type", "scope", "audience", "resource", "client_id", "client_secret"}
+
+// defaultOAuth2Lifetime is assumed when a token response carries no expires_in.
+const defaultOAuth2Lifetime = 5 * time.Minute
+
+// tokenSource caches the access token of the client-credentials flow, or the service account
+// token of serviceAccountToken mode. Renewals are shared between concurrent requests, and a
+// token entering the refresh-ahead window is renewed by one request while the others keep
+// using it.
+type tokenSource struct {
+	client *http.Client
+
+	mu       sync.Mutex
+	token    string
+	expires  time.Time
+	inflight *tokenCall
+
+	certMu  sync.Mutex
+	cert    *tls.Certificate // client certificate of oauth2ClientCertKey, nil until read
+	certSum [sha256.Size]byte
+}
+
+// tokenCall is a renewal in progress; done is closed once token/err are set.
+type tokenCall struct {
+	done    chan struct{}
+	token   string
+	expires time.Time
+	err     error
+}
+
+// tokenResponse is the token endpoint answer (RFC 6749 section 5.1).
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// oauth2Token returns a cached access token, renewing it through the token endpoint when it
+// expires or enters the refresh-ahead window.
+func (s *SecretHeader) oauth2Token(ctx context.Context, secretName string) (string, error) {
+	refreshAhead := time.Duration(s.config.OAuth2RefreshAhead) * time.Second
+	return s.tokens.get(ctx, refreshAhead, func(ctx context.Context) (string, time.Time, error) {
+		token, expires, err := s.requestToken(ctx, secretName)
+		if err == nil {
+			s.writeBackToken(ctx, token, expires)
+		}
+		return token, expires, err
+	})
+}
+
+// get returns the cached token, renewing it with renew when it expires or has less than
+// refreshAhead left.
+func (ts *tokenSource) get(ctx context.Context, refreshAhead time.Duration, renew func(context.Context) (string, time.Time, error)) (string, error) {
+	ts.mu.Lock()
+	now := time.Now()
+	valid := ts.token != "" && now.Before(ts.expires)
+	if valid && now.Add(refreshAhead).Before(ts.expires) {
+		token := ts.token
+		ts.mu.Unlock()
+		return token, nil
+	}
+
+	call := ts.inflight
+	if call != nil && valid {
+		// Someone is already refreshing ahead of expiry; the current token is still good
+		token := ts.token
+		ts.mu.Unlock()
+		return token, nil
+	}
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		ts.inflight = call
+		ts.mu.Unlock()
+
+		// The renewal is shared, so the request that happens to start it must not cancel it
+		call.token, call.expires, call.err = renew(context.Background())
+
+		ts.mu.Lock()
+		if call.err == nil {
+			ts.token, ts.expires = call.token, call.expires
+		}
+		ts.inflight = nil
+		ts.mu.Unlock()
+		close(call.done)
+	} else {
+		ts.mu.Unlock()
+	}
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	if call.err != nil {
+		if valid {
+			// A failed refresh ahead of expiry keeps the current token
+			return ts.currentToken()
+		}
+		return "", call.err
+	}
+	return call.token, nil
+}
+
+// currentToken returns the cached token if it has not expired.
+func (ts *tokenSource) currentToken() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token == "" || !time.Now().Before(ts.expires) {
+		return "", fmt.Errorf("cached token expired")
+	}
+	return ts.token, nil
+}
+
+// useCertificate sets the client certificate presented to the token endpoint, dropping the
+// idle connections made with a previous one.
+func (ts *tokenSource) useCertificate(certPEM, keyPEM string) error {
+	sum := sha256.Sum256([]byte(certPEM + "\n" + keyPEM))
+
+	ts.certMu.Lock()
+	defer ts.certMu.Unlock()
+
+	if ts.cert != nil && ts.certSum == sum {
+		return nil
+	}
+	certificate, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return fmt.Errorf("invalid OAuth2 client certificate: %w", err)
+	}
+	rotated := ts.cert != nil
+	ts.cert, ts.certSum = &certificate, sum
+	if rotated {
+		ts.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// clientCertificate is the GetClientCertificate callback of the token endpoint transport.
+func (ts *tokenSource) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	ts.certMu.Lock()
+	defer ts.certMu.Unlock()
+
+	if ts.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return ts.cert, nil
+}
+
+// requestToken performs the client-credentials grant with the client ID and secret, and
+// optionally the client certificate, stored in the Kubernetes secret.
+func (s *SecretHeader) requestToken(ctx context.Context, secretName string) (string, time.Time, error) {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	clientID, clientSecret := data[s.config.OAuth2ClientIDKey], data[s.config.SecretKey]
+	if clientID == "" || (clientSecret == "" && s.config.OAuth2AuthStyle != oauth2AuthTLS) {
+		return "", time.Time{}, classify(ErrKeyMissing, fmt.Errorf("secret %s/%s lacks keys '%s' and '%s'",
+			s.config.Namespace, secretName, s.config.OAuth2ClientIDKey, s.config.SecretKey))
+	}
+	if s.config.OAuth2ClientCertKey != "" {
+		certPEM, keyPEM := data[s.config.OAuth2ClientCertKey], data[s.config.OAuth2ClientKeyKey]
+		if certPEM == "" || keyPEM == "" {
+			return "", time.Time{}, classify(ErrKeyMissing, fmt.Errorf("secret %s/%s lacks keys '%s' and '%s'",
+				s.config.Namespace, secretName, s.config.OAuth2ClientCertKey, s.config.OAuth2ClientKeyKey))
+		}
+		if err := s.tokens.useCertificate(certPEM, keyPEM); err != nil {
+			return "", time.Time{}, fmt.Errorf("secret %s/%s: %w", s.config.Namespace, secretName, err)
+		}
+	}
+
+	params := make(map[string]string, len(s.config.OAuth2TokenParams)+6)
+	for name, value := range s.config.OAuth2TokenParams {
+		params[name] = value
+	}
+	params["grant_type"] = "client_credentials"
+	if len(s.config.OAuth2Scopes) > 0 {
+		params["scope"] = strings.Join(s.config.OAuth2Scopes, " ")
+	}
+	if s.config.OAuth2Audience != "" {
+		params["audience"] = s.config.OAuth2Audience
+	}
+	if s.config.OAuth2Resource != "" {
+		params["resource"] = s.config.OAuth2Resource
+	}
+	switch s.config.OAuth2AuthStyle {
+	case oauth2AuthBody:
+		params["client_id"] = clientID
+		params["client_secret"] = clientSecret
+	case oauth2AuthTLS:
+		params["client_id"] = clientID
+	}
+
+	body, contentType, err := encodeTokenRequest(s.config.OAuth2RequestFormat, params)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.OAuth2TokenURL, bytes.NewReader(body))
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	if s.config.OAuth2AuthStyle != oauth2AuthBody && s.config.OAuth2AuthStyle != oauth2AuthTLS {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	requestedAt := time.Now()
+	resp, err := s.tokens.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request OAuth2 token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", time.Time{}, fmt.Errorf("OAuth2 token endpoint returned status %d: %s", resp.StatusCode, body)
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode OAuth2 token response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("OAuth2 token response has no access_token")
+	}
+
+	lifetime := defaultOAuth2Lifetime
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	return token.AccessToken, requestedAt.Add(lifetime), nil
+}
+
+// encodeTokenRequest returns the body and content type of a token request with params, as a
+// form or as a JSON object.
+func encodeTokenRequest(format string, params map[string]string) ([]byte, string, error) {
+	if format == oauth2FormatJSON {
+		body, err := json.Marshal(params)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to encode token request: %w", err)
+		}
+		return body, "application/json", nil
+	}
+	form := make(url.Values, len(params))
+	for name, value := range params {
+		form.Set(name, value)
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+// validateOAuth2Config checks the client-credentials settings.
+func validateOAuth2Config(config *Config) error {
+	if config.OAuth2TokenURL == "" {
+		return fmt.Errorf("oauth2TokenURL is required in mode %q", modeOAuth2)
+	}
+	tokenURL, err := url.Parse(config.OAuth2TokenURL)
+	if err != nil || tokenURL.Host == "" || (tokenURL.Scheme != "https" && tokenURL.Scheme != "http") {
+		return fmt.Errorf("invalid oauth2TokenURL %q", config.OAuth2TokenURL)
+	}
+
+	switch config.OAuth2AuthStyle {
+	case "":
+		config.OAuth2AuthStyle = oauth2AuthBasic
+	case oauth2AuthBasic, oauth2AuthBody, oauth2AuthTLS:
+	default:
+		return fmt.Errorf("oauth2AuthStyle must be %q, %q or %q", oauth2AuthBasic, oauth2AuthBody, oauth2AuthTLS)
+	}
+	switch config.OAuth2RequestFormat {
+	case "":
+		config.OAuth2RequestFormat = oauth2FormatForm
+	case oauth2FormatForm, oauth2FormatJSON:
+	default:
+		return fmt.Errorf("oauth2RequestFormat must be %q or %q", oauth2FormatForm, oauth2FormatJSON)
+	}
+	for name := range config.OAuth2TokenParams {
+		if name == "" {
+			return fmt.Errorf("oauth2TokenParams cannot have an empty name")
+		}
+		for _, reserved := range oauth2ReservedParams {
+			if name == reserved {
+				return fmt.Errorf("oauth2TokenParams cannot set %q, it is set by the middleware", name)
+			}
+		}
+	}
+
+	if (config.OAuth2ClientCertKey == "") != (config.OAuth2ClientKeyKey == "") {
+		return fmt.Errorf("oauth2ClientCertKey and oauth2ClientKeyKey must be set together")
+	}
+	if config.OAuth2AuthStyle == oauth2AuthTLS && config.OAuth2ClientCertKey == "" {
+		return fmt.Errorf("oauth2AuthStyle %q requires oauth2ClientCertKey and oauth2ClientKeyKey", oauth2AuthTLS)
+	}
+
+	if config.OAuth2RefreshAhead < 0 {
+		return fmt.Errorf("oauth2RefreshAhead cannot be negative")
+	}
+	// The middleware caches a single access token, so the client credentials cannot change per request
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || usesHostPlaceholder(config) {
+		return fmt.Errorf("jwtClaim, secretNameHeader and {{ .Host }} cannot be used with mode %q", modeOAuth2)
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPOAuth2 tests the client-credentials flow, token caching and shared renewals.
+func TestServeHTTPOAuth2(t *testing.T) {
+	secretData := map[string]string{
+		"client_id":     "gateway",
+		"client_secret": "s3cr3t",
+	}
+	mockServer := mockK8sServer(t, secretData, true)
+	defer mockServer.Close()
+
+	var calls int32
+	var failing int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "gateway" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "orders:read orders:write" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	config := &Config{
+		SecretName:         "oauth-client",
+		SecretKey:          "client_secret",
+		HeaderName:         "Authorization",
+		ValuePrefix:        "Bearer ",
+		Namespace:          "default",
+		CacheTTL:           300,
+		Mode:               modeOAuth2,
+		OAuth2TokenURL:     tokenServer.URL,
+		OAuth2Scopes:       []string{"orders:read", "orders:write"},
+		OAuth2ClientIDKey:  "client_id",
+		OAuth2AuthStyle:    oauth2AuthBasic,
+		OAuth2RefreshAhead: 60,
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		seen[req.Header.Get("Authorization")]++
+		mu.Unlock()
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	handler := &SecretHeader{
+		next:   next,
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{
+			ttl: time.Duration(config.CacheTTL) * time.Second,
+		},
+		tokens: &tokenSource{client: tokenServer.Client()},
+	}
+
+	serve := func() int {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		return rw.Code
+	}
+
+	// Concurrent cold-start requests share one token request
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := serve(); code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("Expected 1 token request, got %d", got)
+	}
+	if seen["Bearer token-1"] != 20 {
+		t.Fatalf("Expected all requests to carry token-1, got %v", seen)
+	}
+
+	// Inside the refresh-ahead window a failed renewal keeps the still valid token
+	atomic.StoreInt32(&failing, 1)
+	handler.tokens.expires = time.Now().Add(30 * time.Second)
+	if code := serve(); code != http.StatusOK || seen["Bearer token-1"] != 21 {
+		t.Fatalf("Expected the current token after a failed refresh, got %d and %v", code, seen)
+	}
+
+	// A successful renewal replaces it
+	atomic.StoreInt32(&failing, 0)
+	if code := serve(); code != http.StatusOK || seen["Bearer token-3"] != 1 {
+		t.Fatalf("Expected the renewed token, got %d and %v", code, seen)
+	}
+
+	// Without a valid token a failing endpoint fails the request
+	atomic.StoreInt32(&failing, 1)
+	handler.tokens.expires = time.Now().Add(-time.Second)
+	if code := serve(); code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", code)
+	}
+}
+
+// TestRequestTokenParameters tests the resource and custom parameters, the JSON body and the
+// certificate-bound client authentication of token requests.
+func TestRequestTokenParameters(t *testing.T) {
+	certFile, keyFile := writeClientCertificate(t, t.TempDir(), "gateway")
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockServer := mockK8sServer(t, map[string]string{
+		"client_id":     "gateway",
+		"client_secret": "s3cr3t",
+		"tls.crt":       string(certPEM),
+		"tls.key":       string(keyPEM),
+	}, true)
+	defer mockServer.Close()
+
+	var received map[string]string
+	var contentType, peer string
+	tokenServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType, peer = r.Header.Get("Content-Type"), ""
+		if len(r.TLS.PeerCertificates) > 0 {
+			peer = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		received = make(map[string]string)
+		if contentType == "application/json" {
+			json.NewDecoder(r.Body).Decode(&received)
+		} else {
+			r.ParseForm()
+			for name := range r.PostForm {
+				received[name] = r.PostForm.Get(name)
+			}
+		}
+		if id, secret, ok := r.BasicAuth(); ok {
+			received["basic"] = id + ":" + secret
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "bound-token", "expires_in": 3600})
+	}))
+	tokenServer.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	tokenServer.StartTLS()
+	defer tokenServer.Close()
+
+	tests := []struct {
+		name                string
+		config              Config
+		expectedContentType string
+		expectedParams      map[string]string
+		expectedPeer        string
+	}{
+		{
+			name: "form with resource and custom parameters",
+			config: Config{
+				OAuth2Resource:    "https://api.partner.example.com",
+				OAuth2TokenParams: map[string]string{"tenant": "eu"},
+			},
+			expectedContentType: "application/x-www-form-urlencoded",
+			expectedParams: map[string]string{
+				"grant_type": "client_credentials",
+				"resource":   "https://api.partner.example.com",
+				"tenant":     "eu",
+				"basic":      "gateway:s3cr3t",
+			},
+		},
+		{
+			name:                "json body",
+			config:              Config{OAuth2RequestFormat: oauth2FormatJSON, OAuth2AuthStyle: oauth2AuthBody, OAuth2Audience: "partner"},
+			expectedContentType: "application/json",
+			expectedParams: map[string]string{
+				"grant_type":    "client_credentials",
+				"audience":      "partner",
+				"client_id":     "gateway",
+				"client_secret": "s3cr3t",
+			},
+		},
+		{
+			name:                "certificate-bound",
+			config:              Config{OAuth2AuthStyle: oauth2AuthTLS, OAuth2ClientCertKey: "tls.crt", OAuth2ClientKeyKey: "tls.key"},
+			expectedContentType: "application/x-www-form-urlencoded",
+			expectedParams:      map[string]string{"grant_type": "client_credentials", "client_id": "gateway"},
+			expectedPeer:        "gateway",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.SecretName = "oauth-client"
+			config.SecretKey = "client_secret"
+			config.Namespace = "default"
+			config.OAuth2TokenURL = tokenServer.URL
+			config.OAuth2ClientIDKey = "client_id"
+			if err := validateOAuth2Config(&config); err != nil {
+				t.Fatal(err)
+			}
+
+			tokens := &tokenSource{}
+			transport := tokenServer.Client().Transport.(*http.Transport).Clone()
+			transport.TLSClientConfig.GetClientCertificate = tokens.clientCertificate
+			tokens.client = &http.Client{Transport: transport}
+			handler := &SecretHeader{
+				name:   "test-middleware",
+				config: &config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:  &secretCache{ttl: 300 * time.Second},
+				tokens: tokens,
+			}
+
+			token, _, err := handler.requestToken(t.Context(), "oauth-client")
+			if err != nil || token != "bound-token" {
+				t.Fatalf("Expected the token, got %q, %v", token, err)
+			}
+			if contentType != tt.expectedContentType {
+				t.Errorf("Expected content type %s, got %s", tt.expectedContentType, contentType)
+			}
+			if !reflect.DeepEqual(received, tt.expectedParams) {
+				t.Errorf("Expected parameters %v, got %v", tt.expectedParams, received)
+			}
+			if peer != tt.expectedPeer {
+				t.Errorf("Expected client certificate %q, got %q", tt.expectedPeer, peer)
+			}
+		})
+	}
+}
+
+// TestValidateOAuth2Config tests the client-credentials configuration checks.
+func TestValidateOAuth2Config(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "valid", config: &Config{OAuth2TokenURL: "https://idp.example.com/oauth/token"}},
+		{name: "missing token URL", config: &Config{}, expectError: true},
+		{name: "relative token URL", config: &Config{OAuth2TokenURL: "/oauth/token"}, expectError: true},
+		{name: "unknown auth style", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2AuthStyle: "jwt"}, expectError: true},
+		{name: "negative refresh ahead", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2RefreshAhead: -1}, expectError: true},
+		{name: "json body", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2RequestFormat: oauth2FormatJSON}},
+		{name: "unknown format", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2RequestFormat: "xml"}, expectError: true},
+		{name: "custom parameter", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2TokenParams: map[string]string{"tenant": "eu"}}},
+		{name: "reserved parameter", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2TokenParams: map[string]string{"grant_type": "password"}}, expectError: true},
+		{name: "certificate without key", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2ClientCertKey: "tls.crt"}, expectError: true},
+		{name: "tls auth without certificate", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2AuthStyle: oauth2AuthTLS}, expectError: true},
+		{
+			name:   "tls auth",
+			config: &Config{OAuth2TokenURL: "https://idp.example.com/token", OAuth2AuthStyle: oauth2AuthTLS, OAuth2ClientCertKey: "tls.crt", OAuth2ClientKeyKey: "tls.key"},
+		},
+		{name: "claim-selected secret", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", JWTClaim: "org_id"}, expectError: true},
+		{name: "header-selected secret", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", SecretName: "creds-{{ .Header }}", SecretNameHeader: "X-Tenant"}, expectError: true},
+		{name: "host-selected secret", config: &Config{OAuth2TokenURL: "https://idp.example.com/token", SecretName: "creds-{{ .Host }}"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateOAuth2Config(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"os"
+)
+
+// optInAnnotation marks a Kubernetes secret as allowed to be read by the plugin when
+// requireOptInAnnotation is set.
+const optInAnnotation = "traefik.io/allow-header-injection"
+
+// validateOptInAnnotation checks the requireOptInAnnotation setting. Only Kubernetes secrets
+// carry annotations.
+func validateOptInAnnotation(config *Config) error {
+	if config.RequireOptInAnnotation && config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("requireOptInAnnotation is only supported with source %q", sourceKubernetes)
+	}
+	return nil
+}
+
+// checkOptIn refuses a secret without the opt-in annotation set to "true" when
+// requireOptInAnnotation is set, so a misconfigured middleware cannot send an arbitrary
+// cluster secret upstream. The secrets holding the API token and the kubeconfig are never
+// sent upstream and are exempt.
+func (s *SecretHeader) checkOptIn(secret *k8sSecret, namespace, secretName string) error {
+	if !s.config.RequireOptInAnnotation {
+		return nil
+	}
+	if namespace == s.config.APITokenSecretNamespace && secretName == s.config.APITokenSecretName {
+		return nil
+	}
+	if namespace == s.config.KubeconfigSecretNamespace && secretName == s.config.KubeconfigSecretName {
+		return nil
+	}
+	if secret.Metadata.Annotations[optInAnnotation] == "true" {
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Refusing secret %s/%s without annotation %s: \"true\"\n",
+		namespace, secretName, optInAnnotation)
+	return fmt.Errorf("secret %s/%s is not annotated %s: \"true\"", namespace, secretName, optInAnnotation)
+}
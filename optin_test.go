@@ -0,0 +1,92 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPRequireOptInAnnotation tests that only annotated secrets are injected.
+func TestServeHTTPRequireOptInAnnotation(t *testing.T) {
+	tests := []struct {
+		name           string
+		annotations    []map[string]string // per read
+		expectedStatus []int
+	}{
+		{
+			name:           "annotated",
+			annotations:    []map[string]string{{optInAnnotation: "true"}},
+			expectedStatus: []int{http.StatusOK},
+		},
+		{
+			name:           "not annotated",
+			annotations:    []map[string]string{nil},
+			expectedStatus: []int{http.StatusInternalServerError},
+		},
+		{
+			name:           "annotated false",
+			annotations:    []map[string]string{{optInAnnotation: "false"}},
+			expectedStatus: []int{http.StatusInternalServerError},
+		},
+		{
+			name:           "annotation removed",
+			annotations:    []map[string]string{{optInAnnotation: "true"}, nil},
+			expectedStatus: []int{http.StatusOK, http.StatusInternalServerError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var annotations map[string]string
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{
+					Metadata: k8sObjectMeta{Annotations: annotations},
+					Data:     map[string]string{"token": base64.StdEncoding.EncodeToString([]byte("my-secret-token"))},
+				})
+			}))
+			defer mockServer.Close()
+
+			var injected string
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					injected = req.Header.Get("X-Auth-Token")
+				}),
+				name: "opt-in-test",
+				config: &Config{
+					SecretName:             "my-secret",
+					SecretKey:              "token",
+					HeaderName:             "X-Auth-Token",
+					Namespace:              "default",
+					CacheTTL:               300,
+					MaxStale:               3600,
+					RequireOptInAnnotation: true,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			for i, read := range tt.annotations {
+				annotations = read
+				handler.cache.expire("default/my-secret", 0)
+				injected = ""
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+				if rw.Code != tt.expectedStatus[i] {
+					t.Errorf("Read %d: expected status %d, got %d", i, tt.expectedStatus[i], rw.Code)
+				}
+				if expected := rw.Code == http.StatusOK; (injected == "my-secret-token") != expected {
+					t.Errorf("Read %d: expected injection %v, got %q", i, expected, injected)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+)
+
+// validateSecretKeyAnnotation checks the secretKeyAnnotation setting.
+func validateSecretKeyAnnotation(config *Config) error {
+	if config.SecretKeyAnnotation == "" {
+		return nil
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("secretKeyAnnotation is only supported with source %q", sourceKubernetes)
+	}
+	switch config.Mode {
+	case "", modeInject:
+	default:
+		return fmt.Errorf("secretKeyAnnotation is only supported in mode %q", modeInject)
+	}
+	if len(config.SecretKeys) > 0 || config.SecretKeyPattern != "" {
+		return fmt.Errorf("secretKeyAnnotation cannot be combined with secretKeys or secretKeyPattern")
+	}
+	if len(config.Namespaces) > 0 || config.JWTClaim != "" {
+		return fmt.Errorf("secretKeyAnnotation cannot be combined with namespaces or jwtClaim")
+	}
+	return nil
+}
+
+// keyPointer returns the key named by the secretKeyAnnotation of the secret cached under
+// cacheKey. The pointer is cached in the same entry as the data it was read with, so
+// rotation tooling switches the injected key and the values atomically, also for instances
+// sharing the cache.
+func (s *SecretHeader) keyPointer(cacheKey string) (string, bool) {
+	entry, ok := s.cache.loadEntry(cacheKey)
+	return entry.keyPointer, ok && entry.keyPointer != ""
+}
+
+// pointedKey returns the key of the secret secretName named by its secretKeyAnnotation, or
+// secretKey while the secret has no such annotation. Read errors are left to the read of
+// the value, which also applies the fallbacks.
+func (s *SecretHeader) pointedKey(ctx context.Context, secretName string) string {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return s.config.SecretKey
+	}
+	cacheKey := s.secretCacheKey(secretName)
+	if _, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName); err != nil {
+		return s.config.SecretKey
+	}
+	if key, ok := s.keyPointer(cacheKey); ok {
+		s.debugf("Injecting key %s of secret %s named by annotation %s", key, cacheKey, s.config.SecretKeyAnnotation)
+		return key
+	}
+	return s.config.SecretKey
+}
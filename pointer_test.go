@@ -0,0 +1,168 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// mockAnnotatedSecretServer serves a secret with data and the annotations returned by
+// annotations at the time of each read.
+func mockAnnotatedSecretServer(t *testing.T, data map[string]string, annotations func() map[string]string) *httptest.Server {
+	t.Helper()
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoded := make(map[string]string)
+		for key, value := range data {
+			encoded[key] = base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k8sSecret{
+			Metadata: k8sObjectMeta{Annotations: annotations()},
+			Data:     encoded,
+		})
+	}))
+}
+
+// TestServeHTTPSecretKeyAnnotation tests injecting the key named by an annotation of the
+// secret, and switching keys when the annotation changes.
+func TestServeHTTPSecretKeyAnnotation(t *testing.T) {
+	data := map[string]string{"token": "default", "token-blue": "blue", "token-green": "green"}
+	tests := []struct {
+		name           string
+		pointers       []string // annotation value at each read, "" for none
+		expectedStatus int
+		expectedValues []string
+	}{
+		{name: "annotated key", pointers: []string{"token-blue"}, expectedStatus: http.StatusOK, expectedValues: []string{"blue"}},
+		{name: "no annotation", pointers: []string{""}, expectedStatus: http.StatusOK, expectedValues: []string{"default"}},
+		{name: "switch", pointers: []string{"token-blue", "token-green", ""}, expectedStatus: http.StatusOK, expectedValues: []string{"blue", "green", "default"}},
+		{name: "missing key", pointers: []string{"token-red"}, expectedStatus: http.StatusInternalServerError, expectedValues: []string{""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			read := 0
+			mockServer := mockAnnotatedSecretServer(t, data, func() map[string]string {
+				pointer := tt.pointers[read]
+				read++
+				if pointer == "" {
+					return nil
+				}
+				return map[string]string{"current-key": pointer}
+			})
+			defer mockServer.Close()
+
+			var injected string
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					injected = req.Header.Get("X-Api-Key")
+				}),
+				name: "key-annotation-test",
+				config: &Config{
+					SecretName:          "my-secret",
+					SecretKey:           "token",
+					SecretKeyAnnotation: "current-key",
+					HeaderName:          "X-Api-Key",
+					Namespace:           "default",
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			for i, expected := range tt.expectedValues {
+				// Each request reads the secret again, as after the TTL
+				handler.cache.invalidate()
+				injected = ""
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+				if rw.Code != tt.expectedStatus {
+					t.Fatalf("Read %d: expected status %d, got %d", i, tt.expectedStatus, rw.Code)
+				}
+				if injected != expected {
+					t.Errorf("Read %d: expected %q injected, got %q", i, expected, injected)
+				}
+			}
+		})
+	}
+}
+
+// TestServeHTTPSecretKeyAnnotationSharedCache tests that instances sharing a cache inject the
+// key named by the secret read by another instance.
+func TestServeHTTPSecretKeyAnnotationSharedCache(t *testing.T) {
+	data := map[string]string{"token": "default", "token-blue": "blue", "token-green": "green"}
+	pointer := "token-blue"
+	mockServer := mockAnnotatedSecretServer(t, data, func() map[string]string {
+		return map[string]string{"current-key": pointer}
+	})
+	defer mockServer.Close()
+
+	cache := &secretCache{ttl: 300 * time.Second}
+	newHandler := func(name string) (*SecretHeader, *string) {
+		injected := new(string)
+		return &SecretHeader{
+			next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				*injected = req.Header.Get("X-Api-Key")
+			}),
+			name: name,
+			config: &Config{
+				SecretName:          "my-secret",
+				SecretKey:           "token",
+				SecretKeyAnnotation: "current-key",
+				HeaderName:          "X-Api-Key",
+				Namespace:           "default",
+				SharedCache:         true,
+			},
+			k8sClient: &k8sClient{
+				httpClient: mockServer.Client(),
+				baseURL:    mockServer.URL,
+				token:      "test-token",
+			},
+			cache: cache,
+		}, injected
+	}
+	first, firstValue := newHandler("first")
+	second, secondValue := newHandler("second")
+
+	for _, expected := range []string{"blue", "green"} {
+		// The first instance refreshes the shared entry, the second only reads it
+		cache.invalidate()
+		pointer = "token-" + expected
+		first.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		second.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if *firstValue != expected || *secondValue != expected {
+			t.Errorf("Expected both instances to inject %q, got %q and %q", expected, *firstValue, *secondValue)
+		}
+	}
+}
+
+// TestValidateSecretKeyAnnotation tests the secretKeyAnnotation checks.
+func TestValidateSecretKeyAnnotation(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "none", config: &Config{Source: "vault"}},
+		{name: "inject", config: &Config{SecretKeyAnnotation: "current-key", SecretKey: "token"}},
+		{name: "other source", config: &Config{SecretKeyAnnotation: "current-key", Source: "vault"}, expectError: true},
+		{name: "validate mode", config: &Config{SecretKeyAnnotation: "current-key", Mode: "validate"}, expectError: true},
+		{name: "secret keys", config: &Config{SecretKeyAnnotation: "current-key", SecretKeys: []string{"a"}}, expectError: true},
+		{name: "namespaces", config: &Config{SecretKeyAnnotation: "current-key", Namespaces: []string{"a", "b"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSecretKeyAnnotation(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// validatePrefetch checks the prefetch and strictStartup settings. Only a secret known at
+// startup can be read ahead of the first request.
+func validatePrefetch(config *Config) error {
+	if config.PrefetchRequired && !config.Prefetch {
+		return fmt.Errorf("prefetchRequired requires prefetch")
+	}
+	if !config.Prefetch && !config.StrictStartup {
+		return nil
+	}
+	if config.Mode == modeGenerate {
+		return fmt.Errorf("prefetch and strictStartup cannot be used with mode %q", modeGenerate)
+	}
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || usesHostPlaceholder(config) {
+		return fmt.Errorf("prefetch and strictStartup cannot be combined with jwtClaim, secretNameHeader or {{ .Host }}")
+	}
+	return nil
+}
+
+// prefetch reads the configured secret into the cache, so the first request does not wait
+// for the API round-trip. A failure is returned when prefetchRequired is set and only
+// logged otherwise, leaving the read to the first request.
+func (s *SecretHeader) prefetch(ctx context.Context) error {
+	client, err := s.apiClient(ctx)
+	if err == nil {
+		_, err = s.fetchSecretData(ctx, client, s.config.Namespace, s.config.SecretName)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if s.config.PrefetchRequired {
+		return fmt.Errorf("prefetch of secret %s failed: %w", s.config.SecretName, err)
+	}
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Prefetch of secret %s failed, reading it on the first request: %v\n",
+		s.config.SecretName, err)
+	return nil
+}
+
+// checkStartup reads the configured secret into the cache and verifies that it holds the
+// configured keys, so a missing secret, key or RBAC rule fails the configuration with a
+// precise error instead of surfacing as 500s at runtime.
+func (s *SecretHeader) checkStartup(ctx context.Context) error {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return fmt.Errorf("strictStartup: %w", err)
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, s.config.SecretName)
+	switch {
+	case hasStatus(err, http.StatusForbidden):
+		return fmt.Errorf("strictStartup: reading secret %s/%s is forbidden, grant get on secrets to the service account: %w",
+			s.config.Namespace, s.config.SecretName, err)
+	case hasStatus(err, http.StatusNotFound):
+		return fmt.Errorf("strictStartup: secret %s/%s does not exist", s.config.Namespace, s.config.SecretName)
+	case err != nil:
+		return fmt.Errorf("strictStartup: %w", err)
+	}
+
+	keys := append([]string{s.config.SecretKey}, s.config.SecretKeys...)
+	keys = append(keys, s.config.EnvelopeKeys...)
+	injected := s.injectedKey(s.secretCacheKey(s.config.SecretName), data)
+	switch {
+	case s.config.SecretKeyAnnotation != "":
+		// The annotation, when present, replaces secretKey
+		keys = []string{injected}
+	case s.config.SecretKey == "" && len(s.config.SecretKeys) > 0 && s.config.Mode != modeValidate:
+		// Injecting the first key present, so one of them is enough
+		if _, ok := data[injected]; !ok {
+			return fmt.Errorf("strictStartup: secret %s/%s has none of the keys %v", s.config.Namespace, s.config.SecretName, s.config.SecretKeys)
+		}
+		keys = nil
+	}
+	for _, key := range keys {
+		if _, ok := data[key]; key != "" && !ok {
+			return fmt.Errorf("strictStartup: secret %s/%s has no key '%s'", s.config.Namespace, s.config.SecretName, key)
+		}
+	}
+	if s.keyPattern != nil {
+		if _, err := s.patternHeaders(data, s.config.SecretName); err != nil {
+			return fmt.Errorf("strictStartup: %w", err)
+		}
+	}
+	if len(s.config.EnvFileHeaders) > 0 {
+		if _, err := s.envFileHeaders(data, s.config.SecretName); err != nil {
+			return fmt.Errorf("strictStartup: %w", err)
+		}
+	}
+	if s.basicAuth {
+		if _, _, err := s.basicAuthCredentials(ctx, s.config.SecretName); err != nil {
+			return fmt.Errorf("strictStartup: %w", err)
+		}
+	}
+	return nil
+}
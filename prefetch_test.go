@@ -0,0 +1,152 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSecretHeaderPrefetch tests reading the secret into the cache ahead of the first request.
+func TestSecretHeaderPrefetch(t *testing.T) {
+	tests := []struct {
+		name         string
+		secretExists bool
+		required     bool
+		expectError  bool
+	}{
+		{name: "secret cached", secretExists: true},
+		{name: "failure logged", secretExists: false},
+		{name: "failure required", secretExists: false, required: true, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"token": "my-secret-token"}, tt.secretExists)
+			defer mockServer.Close()
+
+			handler := &SecretHeader{
+				name: "test-middleware",
+				config: &Config{
+					SecretName:       "my-secret",
+					SecretKey:        "token",
+					HeaderName:       "X-Auth-Token",
+					Namespace:        "default",
+					CacheTTL:         300,
+					Prefetch:         true,
+					PrefetchRequired: tt.required,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			err := handler.prefetch(t.Context())
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			data, ok := handler.cache.get("default/my-secret")
+			if ok != tt.secretExists || (ok && data["token"] != "my-secret-token") {
+				t.Errorf("Expected cached %v, got %v", tt.secretExists, data)
+			}
+		})
+	}
+}
+
+// TestSecretHeaderCheckStartup tests the precise errors of strictStartup.
+func TestSecretHeaderCheckStartup(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		secretKey     string
+		secretKeys    []string
+		expectedError string
+	}{
+		{name: "secret and keys present", secretKey: "token", secretKeys: []string{"token", "previous"}},
+		{name: "missing key", secretKey: "api-key", expectedError: "has no key 'api-key'"},
+		{name: "missing secondary key", secretKey: "token", secretKeys: []string{"next"}, expectedError: "has no key 'next'"},
+		{name: "fallback key present", secretKeys: []string{"api-key", "previous"}},
+		{name: "no fallback key present", secretKeys: []string{"api-key", "key"}, expectedError: "has none of the keys [api-key key]"},
+		{name: "missing secret", status: http.StatusNotFound, secretKey: "token", expectedError: "does not exist"},
+		{name: "forbidden", status: http.StatusForbidden, secretKey: "token", expectedError: "grant get on secrets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"token": "current", "previous": "old"}, true)
+			defer mockServer.Close()
+			apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				mockServer.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer apiServer.Close()
+
+			handler := &SecretHeader{
+				name: "test-middleware",
+				config: &Config{
+					SecretName:    "my-secret",
+					SecretKey:     tt.secretKey,
+					SecretKeys:    tt.secretKeys,
+					HeaderName:    "X-Auth-Token",
+					Namespace:     "default",
+					CacheTTL:      300,
+					StrictStartup: true,
+				},
+				k8sClient: &k8sClient{
+					httpClient: apiServer.Client(),
+					baseURL:    apiServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			err := handler.checkStartup(t.Context())
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+// TestValidatePrefetch tests prefetch and strictStartup configuration checks.
+func TestValidatePrefetch(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "disabled", config: &Config{SecretName: "api-token"}},
+		{name: "enabled", config: &Config{SecretName: "api-token", Prefetch: true, PrefetchRequired: true}},
+		{name: "required without prefetch", config: &Config{SecretName: "api-token", PrefetchRequired: true}, expectError: true},
+		{name: "generate mode", config: &Config{SecretName: "api-token", Mode: modeGenerate, Prefetch: true}, expectError: true},
+		{name: "jwt claim", config: &Config{SecretName: "{{ .Claim }}", JWTClaim: "org", Prefetch: true}, expectError: true},
+		{name: "host", config: &Config{SecretName: "{{ .Host }}", Prefetch: true}, expectError: true},
+		{name: "strict startup", config: &Config{SecretName: "api-token", StrictStartup: true}},
+		{name: "strict startup per tenant", config: &Config{SecretName: "{{ .Header }}", SecretNameHeader: "X-Tenant-Id", StrictStartup: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePrefetch(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// protobufContentType is the Kubernetes protobuf encoding, requested for secret reads with
+// apiProtobuf. Built-in resources support it; the server answers JSON otherwise.
+const protobufContentType = "application/vnd.kubernetes.protobuf"
+
+// protobufMagic prefixes every protobuf-encoded Kubernetes object, ahead of the
+// runtime.Unknown envelope holding it.
+const protobufMagic = "k8s\x00"
+
+// Protobuf wire types of the fields read by the plugin.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// readProtoFields calls fn for each field of a protobuf message. value holds the payload of
+// length-delimited fields and number that of varints; fixed-size fields are skipped.
+func readProtoFields(message []byte, fn func(field int, value []byte, number uint64) error) error {
+	for len(message) > 0 {
+		tag, n := binary.Uvarint(message)
+		if n <= 0 {
+			return fmt.Errorf("malformed protobuf tag")
+		}
+		message = message[n:]
+		field, wire := int(tag>>3), int(tag&7)
+
+		var value []byte
+		var number uint64
+		switch wire {
+		case wireVarint:
+			number, n = binary.Uvarint(message)
+			if n <= 0 {
+				return fmt.Errorf("malformed protobuf varint in field %d", field)
+			}
+			message = message[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return fmt.Errorf("truncated protobuf field %d", field)
+			}
+			value = message[n : n+int(length)]
+			message = message[n+int(length):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wire == wireFixed32 {
+				size = 4
+			}
+			if len(message) < size {
+				return fmt.Errorf("truncated protobuf field %d", field)
+			}
+			message = message[size:]
+			continue
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d in field %d", wire, field)
+		}
+		if err := fn(field, value, number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwrapProtobuf returns the object encoded in a protobuf response: the raw field of the
+// runtime.Unknown envelope following the magic prefix.
+func unwrapProtobuf(payload []byte) ([]byte, error) {
+	if !bytes.HasPrefix(payload, []byte(protobufMagic)) {
+		return nil, fmt.Errorf("missing protobuf envelope")
+	}
+	var raw []byte
+	err := readProtoFields(payload[len(protobufMagic):], func(field int, value []byte, _ uint64) error {
+		if field == 2 {
+			raw = value
+		}
+		return nil
+	})
+	return raw, err
+}
+
+// decodeSecretProtobuf decodes a protobuf-encoded v1.Secret into secret. Data values are
+// base64 encoded, as in JSON responses, so both encodings are handled alike afterwards.
+func decodeSecretProtobuf(payload []byte, secret *k8sSecret) error {
+	raw, err := unwrapProtobuf(payload)
+	if err != nil {
+		return err
+	}
+	secret.APIVersion, secret.Kind = "v1", "Secret"
+	return readProtoFields(raw, func(field int, value []byte, _ uint64) error {
+		switch field {
+		case 1:
+			return decodeObjectMetaProtobuf(value, &secret.Metadata)
+		case 2:
+			key, data, err := decodeProtoMapEntry(value)
+			if err != nil {
+				return err
+			}
+			if secret.Data == nil {
+				secret.Data = make(map[string]string)
+			}
+			secret.Data[key] = base64.StdEncoding.EncodeToString(data)
+		case 3:
+			secret.Type = string(value)
+		}
+		return nil
+	})
+}
+
+// decodeObjectMetaProtobuf decodes the fields of k8sObjectMeta from a protobuf ObjectMeta.
+func decodeObjectMetaProtobuf(message []byte, meta *k8sObjectMeta) error {
+	return readProtoFields(message, func(field int, value []byte, _ uint64) error {
+		switch field {
+		case 1:
+			meta.Name = string(value)
+		case 3:
+			meta.Namespace = string(value)
+		case 6:
+			meta.ResourceVersion = string(value)
+		case 8:
+			timestamp, err := decodeTimeProtobuf(value)
+			meta.CreationTimestamp = timestamp
+			return err
+		case 12:
+			key, annotation, err := decodeProtoMapEntry(value)
+			if err != nil {
+				return err
+			}
+			if meta.Annotations == nil {
+				meta.Annotations = make(map[string]string)
+			}
+			meta.Annotations[key] = string(annotation)
+		case 17:
+			var managed k8sManagedField
+			err := readProtoFields(value, func(field int, value []byte, _ uint64) error {
+				if field != 4 {
+					return nil
+				}
+				timestamp, err := decodeTimeProtobuf(value)
+				managed.Time = timestamp
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			meta.ManagedFields = append(meta.ManagedFields, managed)
+		}
+		return nil
+	})
+}
+
+// decodeTimeProtobuf returns a protobuf metav1.Time in the RFC 3339 form of JSON responses.
+func decodeTimeProtobuf(message []byte) (string, error) {
+	var seconds int64
+	err := readProtoFields(message, func(field int, _ []byte, number uint64) error {
+		if field == 1 {
+			seconds = int64(number)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339), nil
+}
+
+// decodeProtoMapEntry returns the key and value of a protobuf map entry.
+func decodeProtoMapEntry(message []byte) (string, []byte, error) {
+	var key string
+	var value []byte
+	err := readProtoFields(message, func(field int, data []byte, _ uint64) error {
+		switch field {
+		case 1:
+			key = string(data)
+		case 2:
+			value = data
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+// protobufStatusMessage returns the message of a protobuf-encoded metav1.Status error
+// response, or "" when body is not one.
+func protobufStatusMessage(body []byte) string {
+	raw, err := unwrapProtobuf(body)
+	if err != nil {
+		return ""
+	}
+	var message string
+	readProtoFields(raw, func(field int, value []byte, _ uint64) error {
+		if field == 3 {
+			message = string(value)
+		}
+		return nil
+	})
+	return message
+}
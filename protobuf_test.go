@@ -0,0 +1,173 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// protoBytes appends a length-delimited field to buf.
+func protoBytes(buf []byte, field int, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|wireBytes))
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
+
+// protoVarint appends a varint field to buf.
+func protoVarint(buf []byte, field int, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|wireVarint))
+	return binary.AppendUvarint(buf, value)
+}
+
+// protoEntry encodes a map entry.
+func protoEntry(key string, value []byte) []byte {
+	return protoBytes(protoBytes(nil, 1, []byte(key)), 2, value)
+}
+
+// protoEnvelope wraps object in the runtime.Unknown envelope of Kubernetes responses.
+func protoEnvelope(object []byte) []byte {
+	typeMeta := protoBytes(protoBytes(nil, 1, []byte("v1")), 2, []byte("Secret"))
+	unknown := protoBytes(protoBytes(nil, 1, typeMeta), 2, object)
+	unknown = protoBytes(unknown, 4, []byte(protobufContentType))
+	return append([]byte(protobufMagic), unknown...)
+}
+
+// protoSecret encodes a v1.Secret the way the API server does.
+func protoSecret() []byte {
+	created := protoVarint(nil, 1, 1700000000)
+	managed := protoBytes(protoBytes(nil, 1, []byte("kubectl")), 4, protoVarint(nil, 1, 1700003600))
+
+	var meta []byte
+	meta = protoBytes(meta, 1, []byte("my-secret"))
+	meta = protoBytes(meta, 3, []byte("default"))
+	meta = protoBytes(meta, 5, []byte("5f6c1b2a"))
+	meta = protoBytes(meta, 6, []byte("4711"))
+	meta = protoVarint(meta, 7, 3)
+	meta = protoBytes(meta, 8, created)
+	meta = protoBytes(meta, 12, protoEntry("traefik.io/allow-header-injection", []byte("true")))
+	meta = protoBytes(meta, 17, managed)
+
+	var secret []byte
+	secret = protoBytes(secret, 1, meta)
+	secret = protoBytes(secret, 2, protoEntry("token", []byte("s3cr3t")))
+	secret = protoBytes(secret, 2, protoEntry("binary", []byte{0, 1, 2, 0xff}))
+	secret = protoBytes(secret, 3, []byte("Opaque"))
+	return protoEnvelope(secret)
+}
+
+// TestDecodeSecretProtobuf tests that a protobuf secret decodes like its JSON form.
+func TestDecodeSecretProtobuf(t *testing.T) {
+	var secret k8sSecret
+	if err := decodeSecretProtobuf(protoSecret(), &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := k8sSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: k8sObjectMeta{
+			Name:              "my-secret",
+			Namespace:         "default",
+			ResourceVersion:   "4711",
+			Annotations:       map[string]string{"traefik.io/allow-header-injection": "true"},
+			CreationTimestamp: "2023-11-14T22:13:20Z",
+			ManagedFields:     []k8sManagedField{{Time: "2023-11-14T23:13:20Z"}},
+		},
+		Type: "Opaque",
+		Data: map[string]string{"token": "czNjcjN0", "binary": "AAEC/w=="},
+	}
+	if !reflect.DeepEqual(secret, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, secret)
+	}
+}
+
+// TestDecodeSecretProtobufMalformed tests that malformed payloads are rejected.
+func TestDecodeSecretProtobufMalformed(t *testing.T) {
+	valid := protoSecret()
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "json", payload: []byte(`{"data":{}}`)},
+		{name: "truncated", payload: valid[:len(valid)-3]},
+		{name: "truncated field", payload: protoEnvelope(protoBytes(nil, 1, []byte("meta"))[:4])},
+		{name: "bad wire type", payload: protoEnvelope([]byte{0x0b})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var secret k8sSecret
+			if err := decodeSecretProtobuf(tt.payload, &secret); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+// TestGetSecretProtobuf tests protobuf negotiation with servers answering either encoding.
+func TestGetSecretProtobuf(t *testing.T) {
+	tests := []struct {
+		name           string
+		protobuf       bool
+		serverProtobuf bool
+		status         int
+		expectedAccept string
+		expectedError  string
+	}{
+		{name: "disabled", serverProtobuf: true, expectedAccept: "application/json"},
+		{name: "protobuf", protobuf: true, serverProtobuf: true, expectedAccept: protobufContentType + ", application/json"},
+		{name: "json fallback", protobuf: true, expectedAccept: protobufContentType + ", application/json"},
+		{name: "protobuf status", protobuf: true, serverProtobuf: true, status: http.StatusForbidden, expectedError: `secrets "my-secret" is forbidden`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept")
+				offersProtobuf := tt.serverProtobuf && strings.Contains(accept, protobufContentType)
+				if tt.status != 0 {
+					w.Header().Set("Content-Type", protobufContentType)
+					w.WriteHeader(tt.status)
+					status := protoBytes(protoBytes(nil, 2, []byte("Failure")), 3, []byte(`secrets "my-secret" is forbidden`))
+					w.Write(protoEnvelope(status))
+					return
+				}
+				if offersProtobuf {
+					w.Header().Set("Content-Type", protobufContentType)
+					w.Write(protoSecret())
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"metadata":{"name":"my-secret","resourceVersion":"4711"},"data":{"token":"czNjcjN0"}}`))
+			}))
+			defer mockServer.Close()
+
+			client := &k8sClient{
+				httpClient: mockServer.Client(),
+				baseURL:    mockServer.URL,
+				token:      "test-token",
+				protobuf:   tt.protobuf,
+			}
+			secret, err := client.getSecret(t.Context(), "default", "my-secret")
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if accept != tt.expectedAccept {
+				t.Errorf("Expected Accept %q, got %q", tt.expectedAccept, accept)
+			}
+			if secret.Data["token"] != "czNjcjN0" || secret.resourceVersion() != "4711" {
+				t.Errorf("Unexpected secret %+v", secret)
+			}
+		})
+	}
+}
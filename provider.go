@@ -0,0 +1,103 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// SecretRef names a secret in a SecretProvider.
+type SecretRef struct {
+	// Namespace is the namespace of the middleware; stores without namespaces may ignore it.
+	Namespace string
+	// Name is the secretName of the middleware, or of a fallbackSources entry.
+	Name string
+}
+
+// SecretValue is the content of a secret, as key/value pairs addressed by secretKey.
+type SecretValue struct {
+	Data map[string]string
+}
+
+// SecretProvider reads secrets from a store. Providers are called through the middleware
+// cache, so they need not cache themselves, and must be safe for concurrent use. Errors
+// should wrap ErrSecretNotFound, ErrForbidden or ErrAPIUnavailable where they apply.
+type SecretProvider interface {
+	Get(ctx context.Context, ref SecretRef) (SecretValue, error)
+}
+
+// ProviderFactory creates the provider of a middleware from its configuration. It is called
+// once per middleware using the provider, as source or fallback source.
+type ProviderFactory func(config *Config) (SecretProvider, error)
+
+// providerRegistry holds the providers registered with RegisterProvider, by source name.
+type providerRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]ProviderFactory
+}
+
+// providers is the process-wide provider registry.
+var providers = &providerRegistry{factories: make(map[string]ProviderFactory)}
+
+// RegisterProvider makes a provider available as source name, for programs embedding the
+// middleware with their own secret store. It fails for names already taken, including those
+// of the built-in sources. Traefik plugins cannot register providers, as the plugin code is
+// all Traefik loads.
+func RegisterProvider(name string, factory ProviderFactory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("provider name and factory are required")
+	}
+	switch name {
+	case sourceKubernetes, sourceVault, sourceSecretsManager, sourceGCP, sourceAzure, sourceFile, sourceEnv:
+		return fmt.Errorf("source %q is built in", name)
+	}
+
+	providers.mu.Lock()
+	defer providers.mu.Unlock()
+	if _, ok := providers.factories[name]; ok {
+		return fmt.Errorf("provider %q is already registered", name)
+	}
+	providers.factories[name] = factory
+	return nil
+}
+
+// lookup returns the factory of the provider registered as name, or nil.
+func (r *providerRegistry) lookup(name string) ProviderFactory {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.factories[name]
+}
+
+// providerReader reads secrets with a SecretProvider, in the namespace of the middleware.
+type providerReader struct {
+	provider  SecretProvider
+	namespace string
+}
+
+// readSecret returns the data of the named secret.
+func (p *providerReader) readSecret(ctx context.Context, name string) (map[string]string, error) {
+	value, err := p.provider.Get(ctx, SecretRef{Namespace: p.namespace, Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if value.Data == nil {
+		return nil, fmt.Errorf("provider returned no data")
+	}
+	return value.Data, nil
+}
+
+// validateInjectedProvider checks that config only reads secrets, as the provider given to
+// NewWithClient replaces the Kubernetes API.
+func validateInjectedProvider(config *Config) error {
+	if config.Source != "" {
+		return fmt.Errorf("source cannot be set with an injected provider")
+	}
+	if config.Mode == modeGenerate || config.Mode == modeServiceAccountToken {
+		return fmt.Errorf("mode %q needs the Kubernetes API and cannot use an injected provider", config.Mode)
+	}
+	if config.APITokenSecretName != "" || config.KubeconfigSecretName != "" || config.RBACPreflight || config.FailureEventThreshold > 0 ||
+		config.RequireOptInAnnotation || config.SecretKeyAnnotation != "" || len(config.Namespaces) > 0 {
+		return fmt.Errorf("apiTokenSecretName, kubeconfigSecretName, rbacPreflight, failureEventThreshold, requireOptInAnnotation, secretKeyAnnotation and namespaces need the Kubernetes API and cannot be used with an injected provider")
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mapProvider serves secrets from a map keyed by namespace/name, counting reads.
+type mapProvider struct {
+	secrets map[string]map[string]string
+	reads   int32
+}
+
+func (p *mapProvider) Get(ctx context.Context, ref SecretRef) (SecretValue, error) {
+	atomic.AddInt32(&p.reads, 1)
+	data, ok := p.secrets[ref.Namespace+"/"+ref.Name]
+	if !ok {
+		return SecretValue{}, fmt.Errorf("secret %s/%s not found", ref.Namespace, ref.Name)
+	}
+	return SecretValue{Data: data}, nil
+}
+
+// TestServeHTTPRegisteredProvider tests that a registered provider serves secrets through the cache.
+func TestServeHTTPRegisteredProvider(t *testing.T) {
+	provider := &mapProvider{secrets: map[string]map[string]string{
+		"payments/api-credentials": {"token": "provider-token"},
+	}}
+	var factoryNamespace string
+	err := RegisterProvider("test-map-provider", func(config *Config) (SecretProvider, error) {
+		factoryNamespace = config.Namespace
+		return provider, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := CreateConfig()
+	config.Source = "test-map-provider"
+	config.SecretName = "api-credentials"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Auth-Token"
+	config.Namespace = "payments"
+
+	var injected string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		injected = req.Header.Get("X-Auth-Token")
+	})
+	handler, err := New(context.Background(), next, config, "provider-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if factoryNamespace != "payments" {
+		t.Errorf("Expected the factory to get the middleware config, got namespace %q", factoryNamespace)
+	}
+
+	for i := 0; i < 3; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if injected != "provider-token" {
+		t.Errorf("Expected the provider value, got %q", injected)
+	}
+	if provider.reads != 1 {
+		t.Errorf("Expected one cached provider read, got %d", provider.reads)
+	}
+}
+
+// TestRegisterProvider tests provider name checks.
+func TestRegisterProvider(t *testing.T) {
+	factory := func(config *Config) (SecretProvider, error) { return &mapProvider{}, nil }
+	if err := RegisterProvider("test-register-provider", factory); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		factory  ProviderFactory
+	}{
+		{name: "already registered", provider: "test-register-provider", factory: factory},
+		{name: "built in", provider: sourceVault, factory: factory},
+		{name: "no name", factory: factory},
+		{name: "no factory", provider: "test-register-nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RegisterProvider(tt.provider, tt.factory); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if err := validateSource(&Config{Source: "test-unregistered"}); err == nil {
+		t.Error("Expected an unregistered source to be rejected")
+	}
+}
+
+// fakeClock is a Clock moved by tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// TestNewWithClient tests an injected provider and clock driving cache expiry.
+func TestNewWithClient(t *testing.T) {
+	provider := &mapProvider{secrets: map[string]map[string]string{
+		"default/api-credentials": {"token": "injected-token"},
+	}}
+	clock := &fakeClock{now: time.Date(2026, 10, 15, 8, 0, 0, 0, time.UTC)}
+
+	config := CreateConfig()
+	config.SecretName = "api-credentials"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Auth-Token"
+
+	var injected string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		injected = req.Header.Get("X-Auth-Token")
+	})
+	handler, err := NewWithClient(context.Background(), next, config, "new-with-client-test", provider, clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		advance       time.Duration
+		expectedReads int32
+	}{
+		{expectedReads: 1},
+		{advance: 299 * time.Second, expectedReads: 1},
+		{advance: 2 * time.Second, expectedReads: 2},
+	}
+	for i, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		if injected != "injected-token" || provider.reads != step.expectedReads {
+			t.Errorf("Step %d: expected the value after %d reads, got %q after %d", i, step.expectedReads, injected, provider.reads)
+		}
+	}
+}
+
+// TestNewWithClientRejectsKubernetesOptions tests that options needing the API are refused.
+func TestNewWithClientRejectsKubernetesOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(config *Config)
+	}{
+		{name: "source", modify: func(config *Config) { config.Source = sourceVault }},
+		{name: "generate", modify: func(config *Config) { config.Mode = modeGenerate }},
+		{name: "rbacPreflight", modify: func(config *Config) { config.RBACPreflight = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := CreateConfig()
+			config.SecretName = "api-credentials"
+			config.SecretKey = "token"
+			config.HeaderName = "X-Auth-Token"
+			tt.modify(config)
+			if _, err := NewWithClient(context.Background(), http.NotFoundHandler(), config, "new-with-client-rejects", &mapProvider{}, nil); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+	if _, err := NewWithClient(context.Background(), http.NotFoundHandler(), CreateConfig(), "new-with-client-rejects", nil, nil); err == nil {
+		t.Error("Expected an error without a provider")
+	}
+}
@@ -0,0 +1,34 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// validateAPIProxyURL checks the apiProxyURL setting, without echoing credentials it holds.
+func validateAPIProxyURL(config *Config) error {
+	if config.APIProxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(config.APIProxyURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("apiProxyURL must be an absolute URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	}
+	return fmt.Errorf("apiProxyURL must use http, https or socks5, got %q", u.Scheme)
+}
+
+// apiProxy returns the proxy selection of the Kubernetes API transport: apiProxyURL when
+// set, HTTPS_PROXY and NO_PROXY otherwise.
+func apiProxy(config *Config) func(*http.Request) (*url.URL, error) {
+	if config.APIProxyURL == "" {
+		return http.ProxyFromEnvironment
+	}
+	// Validated by validateAPIProxyURL
+	u, _ := url.Parse(config.APIProxyURL)
+	return http.ProxyURL(u)
+}
@@ -0,0 +1,101 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// connectProxy is an HTTP CONNECT proxy recording the tunnels it opened.
+func connectProxy(t *testing.T, tunnels *[]string, authorizations *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		mu.Lock()
+		*tunnels = append(*tunnels, r.Host)
+		*authorizations = append(*authorizations, r.Header.Get("Proxy-Authorization"))
+		mu.Unlock()
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+}
+
+// TestAPIProxy tests that API requests are tunnelled through apiProxyURL with its credentials.
+func TestAPIProxy(t *testing.T) {
+	var tunnels, authorizations []string
+	proxy := connectProxy(t, &tunnels, &authorizations)
+	defer proxy.Close()
+
+	mockServer := mockK8sServer(t, map[string]string{"token": "my-secret-token"}, true)
+	defer mockServer.Close()
+
+	config := &Config{APIProxyURL: "http://gateway:s3cret@" + proxy.Listener.Addr().String()}
+	if err := validateAPIProxyURL(config); err != nil {
+		t.Fatal(err)
+	}
+	transport := mockServer.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = apiProxy(config)
+	client := &k8sClient{
+		httpClient: &http.Client{Transport: transport},
+		baseURL:    mockServer.URL,
+		token:      "test-token",
+	}
+
+	secret, err := client.getSecret(t.Context(), "default", "my-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Data["token"] == "" {
+		t.Error("Expected the secret through the proxy")
+	}
+	if len(tunnels) != 1 || tunnels[0] != mockServer.Listener.Addr().String() {
+		t.Errorf("Expected one tunnel to the API server, got %v", tunnels)
+	}
+	if expected := "Basic " + base64.StdEncoding.EncodeToString([]byte("gateway:s3cret")); authorizations[0] != expected {
+		t.Errorf("Expected proxy credentials %q, got %q", expected, authorizations[0])
+	}
+}
+
+// TestValidateAPIProxyURL tests apiProxyURL checks.
+func TestValidateAPIProxyURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectError bool
+	}{
+		{url: ""},
+		{url: "http://proxy.corp:3128"},
+		{url: "socks5://127.0.0.1:1080"},
+		{url: "proxy.corp:3128", expectError: true},
+		{url: "ftp://proxy.corp", expectError: true},
+	}
+
+	for _, tt := range tests {
+		err := validateAPIProxyURL(&Config{APIProxyURL: tt.url})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%q: expected error %v, got %v", tt.url, tt.expectError, err)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// validateRBACPreflight checks the rbacPreflight setting. Only the Kubernetes source is
+// subject to RBAC.
+func validateRBACPreflight(config *Config) error {
+	if config.RBACPreflight && config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("rbacPreflight is only supported with source %q", sourceKubernetes)
+	}
+	return nil
+}
+
+// selfSubjectAccessReview is the subset of an authorization.k8s.io/v1 SelfSubjectAccessReview
+// used by the plugin.
+type selfSubjectAccessReview struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Spec       accessReviewSpec    `json:"spec"`
+	Status     *accessReviewStatus `json:"status,omitempty"`
+}
+
+type accessReviewSpec struct {
+	ResourceAttributes accessReviewAttributes `json:"resourceAttributes"`
+}
+
+type accessReviewAttributes struct {
+	Namespace string `json:"namespace"`
+	Verb      string `json:"verb"`
+	Resource  string `json:"resource"`
+	Name      string `json:"name,omitempty"`
+}
+
+type accessReviewStatus struct {
+	Allowed         bool   `json:"allowed"`
+	Reason          string `json:"reason,omitempty"`
+	EvaluationError string `json:"evaluationError,omitempty"`
+}
+
+// reviewSecretAccess asks the API server whether the client may get the named secret, or
+// any secret when name is empty, in namespace.
+func (c *k8sClient) reviewSecretAccess(ctx context.Context, namespace, name string) (*accessReviewStatus, error) {
+	review := &selfSubjectAccessReview{
+		APIVersion: "authorization.k8s.io/v1",
+		Kind:       "SelfSubjectAccessReview",
+		Spec: accessReviewSpec{ResourceAttributes: accessReviewAttributes{
+			Namespace: namespace,
+			Verb:      "get",
+			Resource:  "secrets",
+			Name:      name,
+		}},
+	}
+	url := c.baseURL + "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews"
+	if err := c.do(ctx, http.MethodPost, url, review, review); err != nil {
+		return nil, err
+	}
+	if review.Status == nil {
+		return nil, fmt.Errorf("access review returned no status")
+	}
+	return review.Status, nil
+}
+
+// checkRBAC verifies with a SelfSubjectAccessReview that the middleware may get its secret in
+// every namespace it reads, so a missing Role is reported when the route is loaded instead of
+// as 500s on the first requests. The error of a denied review holds the Role and RoleBinding
+// granting the access.
+func (s *SecretHeader) checkRBAC(ctx context.Context) error {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return fmt.Errorf("rbacPreflight: %w", err)
+	}
+
+	// Secrets selected per request can only be granted by namespace
+	name := s.config.SecretName
+	if strings.Contains(name, "{{") || s.config.SecretNameHeader != "" {
+		name = ""
+	}
+	namespaces := s.config.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{s.config.Namespace}
+	}
+
+	var denied []string
+	for _, namespace := range namespaces {
+		status, err := client.reviewSecretAccess(ctx, namespace, name)
+		if err != nil {
+			return fmt.Errorf("rbacPreflight: access review failed: %w", err)
+		}
+		if !status.Allowed {
+			s.debugf("Access review denied get on secrets in %s: %s%s", namespace, status.Reason, status.EvaluationError)
+			denied = append(denied, namespace)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+
+	account, accountNamespace := serviceAccountOf(client.token)
+	if client.impersonate != nil {
+		// The review was made as the impersonated identity, which needs the grant
+		account, accountNamespace = serviceAccountOfSubject(client.impersonate.user)
+	}
+	target := "secrets"
+	if name != "" {
+		target = "secret " + name
+	}
+	return fmt.Errorf("rbacPreflight: service account %s/%s may not get %s in namespace %s, apply:\n%s",
+		accountNamespace, account, target, strings.Join(denied, ", "), rbacManifest(denied, name, account, accountNamespace))
+}
+
+// serviceAccountOf returns the service account name and namespace from the subject of a
+// service account token, or placeholders to fill in when the token does not tell.
+func serviceAccountOf(token string) (string, string) {
+	var subject string
+	if parsed, err := parseJWT(token); err == nil {
+		subject, _ = parsed.stringClaim("sub")
+	}
+	return serviceAccountOfSubject(subject)
+}
+
+// serviceAccountOfSubject returns the service account name and namespace of a user name
+// like system:serviceaccount:traefik:traefik, or placeholders for other users.
+func serviceAccountOfSubject(subject string) (string, string) {
+	parts := strings.Split(subject, ":")
+	if len(parts) == 4 && parts[0] == "system" && parts[1] == "serviceaccount" {
+		return parts[3], parts[2]
+	}
+	return "<service-account>", "<service-account-namespace>"
+}
+
+// rbacManifest returns a Role and RoleBinding per namespace granting get on secrets, limited
+// to the named secret unless name is empty, to the given service account.
+func rbacManifest(namespaces []string, name, account, accountNamespace string) string {
+	resourceNames := ""
+	if name != "" {
+		resourceNames = fmt.Sprintf("  resourceNames: [%q]\n", name)
+	}
+
+	var b strings.Builder
+	for _, namespace := range namespaces {
+		fmt.Fprintf(&b, `---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: traefik-secret-reader
+  namespace: %s
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+%s  verbs: ["get"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: traefik-secret-reader
+  namespace: %s
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: traefik-secret-reader
+subjects:
+- kind: ServiceAccount
+  name: %s
+  namespace: %s
+`, namespace, resourceNames, namespace, account, accountNamespace)
+	}
+	return b.String()
+}
+
+// logRBACPreflight runs checkRBAC and logs its error, which only fails the configuration
+// with strictStartup.
+func (s *SecretHeader) logRBACPreflight(ctx context.Context) error {
+	err := s.checkRBAC(ctx)
+	if err == nil || s.config.StrictStartup {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] %v\n", err)
+	return nil
+}
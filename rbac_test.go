@@ -0,0 +1,160 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCheckRBAC tests the access review and the manifest reported when it is denied.
+func TestCheckRBAC(t *testing.T) {
+	tests := []struct {
+		name              string
+		secretName        string
+		namespaces        []string
+		allowed           map[string]bool
+		expectedReviews   []string
+		expectError       bool
+		expectedManifests int
+		expectedResource  bool
+	}{
+		{
+			name:            "allowed",
+			secretName:      "my-secret",
+			allowed:         map[string]bool{"default": true},
+			expectedReviews: []string{"default/my-secret"},
+		},
+		{
+			name:              "denied",
+			secretName:        "my-secret",
+			allowed:           map[string]bool{},
+			expectedReviews:   []string{"default/my-secret"},
+			expectError:       true,
+			expectedManifests: 1,
+			expectedResource:  true,
+		},
+		{
+			name:              "secret selected per request",
+			secretName:        "{{ .Host }}-token",
+			allowed:           map[string]bool{},
+			expectedReviews:   []string{"default/"},
+			expectError:       true,
+			expectedManifests: 1,
+		},
+		{
+			name:              "one of several namespaces denied",
+			secretName:        "my-secret",
+			namespaces:        []string{"team-a", "team-b", "shared"},
+			allowed:           map[string]bool{"team-a": true},
+			expectedReviews:   []string{"team-a/my-secret", "team-b/my-secret", "shared/my-secret"},
+			expectError:       true,
+			expectedManifests: 2,
+			expectedResource:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reviews []string
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews" {
+					t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+				}
+				var review selfSubjectAccessReview
+				if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+					t.Fatal(err)
+				}
+				attributes := review.Spec.ResourceAttributes
+				if attributes.Verb != "get" || attributes.Resource != "secrets" {
+					t.Errorf("Expected a review of get on secrets, got %+v", attributes)
+				}
+				reviews = append(reviews, attributes.Namespace+"/"+attributes.Name)
+				review.Status = &accessReviewStatus{Allowed: tt.allowed[attributes.Namespace]}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(review)
+			}))
+			defer mockServer.Close()
+
+			claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"system:serviceaccount:traefik:traefik-ingress"}`))
+			handler := &SecretHeader{
+				name: "rbac-test",
+				config: &Config{
+					SecretName:    tt.secretName,
+					SecretKey:     "token",
+					HeaderName:    "X-Auth-Token",
+					Namespace:     "default",
+					Namespaces:    tt.namespaces,
+					RBACPreflight: true,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "eyJhbGciOiJSUzI1NiJ9." + claims + ".c2ln",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			err := handler.checkRBAC(t.Context())
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if strings.Join(reviews, ",") != strings.Join(tt.expectedReviews, ",") {
+				t.Errorf("Expected reviews %q, got %q", tt.expectedReviews, reviews)
+			}
+			if err == nil {
+				return
+			}
+			message := err.Error()
+			if got := strings.Count(message, "kind: RoleBinding"); got != tt.expectedManifests {
+				t.Errorf("Expected %d RoleBindings, got %d in %s", tt.expectedManifests, got, message)
+			}
+			if !strings.Contains(message, "  name: traefik-ingress\n  namespace: traefik\n") {
+				t.Errorf("Expected the service account of the token as subject, got %s", message)
+			}
+			if got := strings.Contains(message, `resourceNames: ["my-secret"]`); got != tt.expectedResource {
+				t.Errorf("Expected resourceNames %v, got %s", tt.expectedResource, message)
+			}
+		})
+	}
+}
+
+// TestServeHTTPRBACDenied tests that forbidden secret reads are counted.
+func TestServeHTTPRBACDenied(t *testing.T) {
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"kind":"Status","reason":"Forbidden"}`, http.StatusForbidden)
+	}))
+	defer mockServer.Close()
+
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}),
+		name: "rbac-denied-test",
+		config: &Config{
+			SecretName: "my-secret",
+			SecretKey:  "token",
+			HeaderName: "X-Auth-Token",
+			Namespace:  "default",
+			CacheTTL:   300,
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+	}
+
+	for i := 0; i < 2; i++ {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rw.Code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", rw.Code)
+		}
+	}
+	if got := metrics.value(metricRBACDenied, "middleware", "rbac-denied-test"); got != 2 {
+		t.Errorf("Expected 2 denied reads, got %v", got)
+	}
+}
@@ -0,0 +1,97 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// dockerConfigKey is the data key of kubernetes.io/dockerconfigjson secrets.
+const dockerConfigKey = ".dockerconfigjson"
+
+// dockerConfig is the content of a .dockerconfigjson key.
+type dockerConfig struct {
+	Auths map[string]dockerAuth `json:"auths"`
+}
+
+// dockerAuth holds the credentials of one registry, either as auth, the base64 encoded
+// "username:password", or as separate fields.
+type dockerAuth struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// validateDockerRegistryConfig checks the dockerRegistry settings.
+func validateDockerRegistryConfig(config *Config) error {
+	if config.Mode != modeDockerRegistry {
+		if config.DockerRegistry != "" {
+			return fmt.Errorf("dockerRegistry is only supported in mode %q", modeDockerRegistry)
+		}
+		return nil
+	}
+	if config.DockerRegistry == "" {
+		return fmt.Errorf("dockerRegistry is required in mode %q", modeDockerRegistry)
+	}
+	if config.SecretKeyPattern != "" {
+		return fmt.Errorf("secretKeyPattern cannot be used with mode %q", modeDockerRegistry)
+	}
+	return nil
+}
+
+// registryAuth returns the credential of config.DockerRegistry found in the docker config
+// JSON stored under secretKey, ready for a Basic Authorization header.
+func (s *SecretHeader) registryAuth(ctx context.Context, secretName, secretKey string) (string, error) {
+	value, err := s.getValue(ctx, secretName, secretKey)
+	if err != nil {
+		return "", err
+	}
+	auth, err := dockerRegistryAuth([]byte(value), s.config.DockerRegistry)
+	if err != nil {
+		return "", fmt.Errorf("secret %s/%s key %s: %w", s.config.Namespace, secretName, secretKey, err)
+	}
+	return auth, nil
+}
+
+// dockerRegistryAuth returns the base64 encoded "username:password" of registry in a docker
+// config. Auths keys written by docker login may be URLs such as https://index.docker.io/v1/,
+// so they also match by host when no key equals registry.
+func dockerRegistryAuth(data []byte, registry string) (string, error) {
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return "", fmt.Errorf("invalid docker config: %w", err)
+	}
+
+	auth, ok := config.Auths[registry]
+	if !ok {
+		host := registryHost(registry)
+		for key, candidate := range config.Auths {
+			if registryHost(key) == host {
+				auth, ok = candidate, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("no credentials for registry %s", registry)
+	}
+
+	switch {
+	case auth.Auth != "":
+		return auth.Auth, nil
+	case auth.Username != "":
+		return base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)), nil
+	}
+	return "", fmt.Errorf("no credentials for registry %s", registry)
+}
+
+// registryHost reduces a registry reference to its lower-cased host and port.
+func registryHost(registry string) string {
+	registry = strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	if i := strings.IndexByte(registry, '/'); i >= 0 {
+		registry = registry[:i]
+	}
+	return strings.ToLower(registry)
+}
@@ -0,0 +1,143 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestDockerRegistryAuth tests credential lookup in docker config JSON.
+func TestDockerRegistryAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		registry    string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "exact host",
+			data:     `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+			registry: "registry.example.com",
+			expected: "dXNlcjpwYXNz",
+		},
+		{
+			name:     "URL key",
+			data:     `{"auths":{"https://index.docker.io/v1/":{"auth":"ZG9ja2VyOmh1Yg=="}}}`,
+			registry: "index.docker.io",
+			expected: "ZG9ja2VyOmh1Yg==",
+		},
+		{
+			name:     "username and password",
+			data:     `{"auths":{"Registry.Example.com:5000":{"username":"user","password":"pass"}}}`,
+			registry: "registry.example.com:5000",
+			expected: "dXNlcjpwYXNz",
+		},
+		{
+			name:        "other registry",
+			data:        `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`,
+			registry:    "ghcr.io",
+			expectError: true,
+		},
+		{
+			name:        "no credentials",
+			data:        `{"auths":{"registry.example.com":{}}}`,
+			registry:    "registry.example.com",
+			expectError: true,
+		},
+		{
+			name:        "invalid JSON",
+			data:        `user:pass`,
+			registry:    "registry.example.com",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := dockerRegistryAuth([]byte(tt.data), tt.registry)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", auth)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if auth != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, auth)
+			}
+		})
+	}
+}
+
+// TestServeHTTPDockerRegistry tests that dockerRegistry mode injects the registry credentials.
+func TestServeHTTPDockerRegistry(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{
+		dockerConfigKey: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"},"ghcr.io":{"auth":"b3RoZXI6dG9rZW4="}}}`,
+	}, true)
+	defer mockServer.Close()
+
+	var captured string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("Authorization")
+		}),
+		name: "registry-test",
+		config: &Config{
+			Mode:           modeDockerRegistry,
+			DockerRegistry: "registry.example.com",
+			SecretName:     "registry-pull",
+			SecretKey:      dockerConfigKey,
+			HeaderName:     "Authorization",
+			ValuePrefix:    "Basic ",
+			Namespace:      "default",
+			CacheTTL:       300,
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{ttl: 300 * time.Second},
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://registry.example.com/v2/", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rw.Code)
+	}
+	if captured != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected the registry credentials, got %q", captured)
+	}
+}
+
+// TestValidateDockerRegistryConfig tests dockerRegistry configuration checks.
+func TestValidateDockerRegistryConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "inject", config: &Config{}},
+		{name: "registry mode", config: &Config{Mode: modeDockerRegistry, DockerRegistry: "registry.example.com"}},
+		{name: "missing registry", config: &Config{Mode: modeDockerRegistry}, expectError: true},
+		{name: "registry outside its mode", config: &Config{DockerRegistry: "registry.example.com"}, expectError: true},
+		{name: "key pattern", config: &Config{Mode: modeDockerRegistry, DockerRegistry: "ghcr.io", SecretKeyPattern: "(.+)"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDockerRegistryConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
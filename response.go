@@ -0,0 +1,109 @@
+package traefik_k8s_secret_header
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// responseHeaderStripper removes stripResponseHeaders from the upstream response before its
+// headers are sent, so an upstream echoing the injected credential cannot leak it to clients.
+type responseHeaderStripper struct {
+	http.ResponseWriter
+	names       []string
+	wroteHeader bool
+}
+
+// newResponseHeaderStripper wraps rw. finish must be called once the upstream returns.
+func newResponseHeaderStripper(rw http.ResponseWriter, names []string) *responseHeaderStripper {
+	return &responseHeaderStripper{ResponseWriter: rw, names: names}
+}
+
+// strip removes the headers once, right before they are written, along with their
+// announcement as trailers.
+func (w *responseHeaderStripper) strip() {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	header := w.ResponseWriter.Header()
+	for _, name := range w.names {
+		header.Del(name)
+	}
+
+	announced := header.Values("Trailer")
+	if len(announced) == 0 {
+		return
+	}
+	var kept []string
+	for _, value := range announced {
+		for _, trailer := range strings.Split(value, ",") {
+			if trailer = strings.TrimSpace(trailer); trailer != "" && !w.stripped(trailer) {
+				kept = append(kept, trailer)
+			}
+		}
+	}
+	header.Del("Trailer")
+	if len(kept) > 0 {
+		header.Set("Trailer", strings.Join(kept, ", "))
+	}
+}
+
+// finish removes trailers set without announcement, which are sent once the upstream returns.
+func (w *responseHeaderStripper) finish() {
+	header := w.ResponseWriter.Header()
+	for _, name := range w.names {
+		header.Del(http.TrailerPrefix + name)
+	}
+}
+
+// stripped reports whether name is one of the stripped headers.
+func (w *responseHeaderStripper) stripped(name string) bool {
+	for _, strip := range w.names {
+		if strings.EqualFold(strip, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *responseHeaderStripper) WriteHeader(code int) {
+	// Informational responses send the headers set so far without ending them
+	if code >= 100 && code < 200 {
+		header := w.ResponseWriter.Header()
+		for _, name := range w.names {
+			header.Del(name)
+		}
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.strip()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseHeaderStripper) Write(b []byte) (int, error) {
+	w.strip()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working behind the wrapper.
+func (w *responseHeaderStripper) Flush() {
+	w.strip()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack keeps WebSocket upgrades working behind the wrapper. The proxy writes the upgrade
+// response from the headers set so far on the hijacked connection, so they are stripped
+// first.
+func (w *responseHeaderStripper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not support hijacking", w.ResponseWriter)
+	}
+	w.strip()
+	return hijacker.Hijack()
+}
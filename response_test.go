@@ -0,0 +1,109 @@
+package traefik_k8s_secret_header
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPStripResponseHeaders tests that configured headers never reach the client.
+func TestServeHTTPStripResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream http.HandlerFunc
+	}{
+		{
+			name: "explicit WriteHeader",
+			upstream: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("X-Api-Key", req.Header.Get("X-Api-Key"))
+				rw.Header().Set("X-Request-Id", "42")
+				rw.WriteHeader(http.StatusCreated)
+				rw.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "implicit WriteHeader",
+			upstream: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("X-Api-Key", req.Header.Get("X-Api-Key"))
+				rw.Header().Set("X-Request-Id", "42")
+				rw.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "flushed stream",
+			upstream: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("X-Api-Key", req.Header.Get("X-Api-Key"))
+				rw.Header().Set("X-Request-Id", "42")
+				rw.(http.Flusher).Flush()
+				rw.Write([]byte("ok"))
+			},
+		},
+		{
+			name: "announced trailer",
+			upstream: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("Trailer", "X-Api-Key")
+				rw.Header().Set("X-Request-Id", "42")
+				rw.Write([]byte("ok"))
+				rw.Header().Set("X-Api-Key", req.Header.Get("X-Api-Key"))
+			},
+		},
+		{
+			name: "unannounced trailer",
+			upstream: func(rw http.ResponseWriter, req *http.Request) {
+				rw.Header().Set("X-Request-Id", "42")
+				rw.Write([]byte("ok"))
+				rw.Header().Set(http.TrailerPrefix+"X-Api-Key", req.Header.Get("X-Api-Key"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"api-key": "my-secret-token"}, true)
+			defer mockServer.Close()
+
+			handler := &SecretHeader{
+				next: tt.upstream,
+				name: "strip-response-test",
+				config: &Config{
+					SecretName:           "my-secret",
+					SecretKey:            "api-key",
+					HeaderName:           "X-Api-Key",
+					Namespace:            "default",
+					CacheTTL:             300,
+					StripResponseHeaders: []string{"X-Api-Key"},
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			resp, err := http.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			// Trailers are only known once the body is read
+			if _, err := io.ReadAll(resp.Body); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := resp.Header.Get("X-Api-Key"); got != "" {
+				t.Errorf("Expected X-Api-Key to be stripped, got %q", got)
+			}
+			if got := resp.Trailer.Get("X-Api-Key"); got != "" {
+				t.Errorf("Expected the X-Api-Key trailer to be stripped, got %q", got)
+			}
+			if got := resp.Header.Get("X-Request-Id"); got != "42" {
+				t.Errorf("Expected other headers to be kept, got X-Request-Id %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// rotationTracker remembers the previous value of each secret key for a grace period after
+// it changed, so both can be sent while upstreams roll over to the new credential.
+type rotationTracker struct {
+	grace time.Duration
+
+	mu     sync.Mutex
+	states map[string]rotationState // namespace/name/key -> values
+}
+
+// rotationState is the last observed value of a secret key and the one it replaced.
+type rotationState struct {
+	current  string
+	previous string
+	changed  time.Time
+}
+
+// newRotationTracker validates the rotation settings and returns a tracker, or nil when
+// rotationGracePeriod is not set.
+func newRotationTracker(config *Config) (*rotationTracker, error) {
+	if config.RotationGracePeriod < 0 {
+		return nil, fmt.Errorf("rotationGracePeriod cannot be negative")
+	}
+	if config.RotationGracePeriod == 0 {
+		return nil, nil
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return nil, fmt.Errorf("rotationGracePeriod is only supported in mode %q", modeInject)
+	}
+	// One state per key seen; per-request selection would grow it with every tenant
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || usesHostPlaceholder(config) || config.SecretKeyPattern != "" {
+		return nil, fmt.Errorf("rotationGracePeriod cannot be combined with jwtClaim, secretNameHeader, {{ .Host }} or secretKeyPattern")
+	}
+	if config.CompressThreshold > 0 {
+		return nil, fmt.Errorf("rotationGracePeriod cannot be combined with compressThreshold")
+	}
+	if config.PreviousHeaderName == "" {
+		config.PreviousHeaderName = config.HeaderName + "-Previous"
+	}
+	return &rotationTracker{
+		grace:  time.Duration(config.RotationGracePeriod) * time.Second,
+		states: make(map[string]rotationState),
+	}, nil
+}
+
+// observe records the current value of a secret key and returns the value it replaced while
+// the grace period since the change lasts, or "" otherwise.
+func (r *rotationTracker) observe(key, value string, now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[key]
+	switch {
+	case !ok:
+		r.states[key] = rotationState{current: value}
+		return ""
+	case state.current != value:
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Secret %s changed, sending the previous value for %s\n", key, r.grace)
+		state = rotationState{current: value, previous: state.current, changed: now}
+		r.states[key] = state
+	}
+
+	if state.previous == "" || now.Sub(state.changed) > r.grace {
+		return ""
+	}
+	return state.previous
+}
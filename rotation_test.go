@@ -0,0 +1,128 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestRotationTrackerObserve tests when the previous value is returned.
+func TestRotationTrackerObserve(t *testing.T) {
+	tracker := &rotationTracker{grace: time.Minute, states: make(map[string]rotationState)}
+	start := time.Now()
+
+	steps := []struct {
+		name     string
+		value    string
+		at       time.Duration
+		expected string
+	}{
+		{name: "first value", value: "old", expected: ""},
+		{name: "unchanged", value: "old", at: time.Second, expected: ""},
+		{name: "rotated", value: "new", at: 2 * time.Second, expected: "old"},
+		{name: "within grace", value: "new", at: 61 * time.Second, expected: "old"},
+		{name: "grace over", value: "new", at: 63 * time.Second, expected: ""},
+		{name: "rotated again", value: "newer", at: 70 * time.Second, expected: "new"},
+	}
+
+	for _, step := range steps {
+		if got := tracker.observe("default/api-token/token", step.value, start.Add(step.at)); got != step.expected {
+			t.Errorf("%s: expected previous %q, got %q", step.name, step.expected, got)
+		}
+	}
+}
+
+// TestServeHTTPRotationGracePeriod tests injecting both values after the secret changed.
+func TestServeHTTPRotationGracePeriod(t *testing.T) {
+	secretData := map[string]string{"token": "old-token"}
+	mockServer := mockK8sServer(t, secretData, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:          "api-token",
+		SecretKey:           "token",
+		HeaderName:          "X-Auth-Token",
+		Namespace:           "default",
+		CacheTTL:            300,
+		RotationGracePeriod: 600,
+	}
+	rotation, err := newRotationTracker(config)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var captured http.Header
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Clone()
+		}),
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:    &secretCache{ttl: 300 * time.Second},
+		rotation: rotation,
+	}
+
+	// A client-supplied previous value never reaches the upstream
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("X-Auth-Token-Previous", "forged")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if captured.Get("X-Auth-Token") != "old-token" || captured.Get("X-Auth-Token-Previous") != "" {
+		t.Errorf("Expected only the current token, got %v", captured)
+	}
+
+	// Rotate the secret and let the cache pick it up
+	secretData["token"] = "new-token"
+	handler.cache = &secretCache{ttl: 300 * time.Second}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	if captured.Get("X-Auth-Token") != "new-token" {
+		t.Errorf("Expected the new token, got %q", captured.Get("X-Auth-Token"))
+	}
+	if captured.Get("X-Auth-Token-Previous") != "old-token" {
+		t.Errorf("Expected the old token as previous, got %q", captured.Get("X-Auth-Token-Previous"))
+	}
+}
+
+// TestNewRotationTracker tests rotation configuration checks.
+func TestNewRotationTracker(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           *Config
+		expectedPrevious string
+		expectError      bool
+	}{
+		{name: "disabled", config: &Config{HeaderName: "X-Auth-Token"}},
+		{name: "default previous header", config: &Config{HeaderName: "X-Auth-Token", RotationGracePeriod: 60}, expectedPrevious: "X-Auth-Token-Previous"},
+		{name: "custom previous header", config: &Config{HeaderName: "X-Auth-Token", RotationGracePeriod: 60, PreviousHeaderName: "X-Auth-Token-Old"}, expectedPrevious: "X-Auth-Token-Old"},
+		{name: "negative", config: &Config{HeaderName: "X-Auth-Token", RotationGracePeriod: -1}, expectError: true},
+		{name: "validate mode", config: &Config{HeaderName: "X-Auth-Token", RotationGracePeriod: 60, Mode: modeValidate}, expectError: true},
+		{name: "jwt claim", config: &Config{HeaderName: "X-Auth-Token", RotationGracePeriod: 60, JWTClaim: "tenant"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, err := newRotationTracker(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if (tracker != nil) != (tt.config.RotationGracePeriod > 0) {
+				t.Errorf("Expected a tracker only with a grace period, got %v", tracker)
+			}
+			if tt.config.PreviousHeaderName != tt.expectedPrevious {
+				t.Errorf("Expected previous header %q, got %q", tt.expectedPrevious, tt.config.PreviousHeaderName)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+)
+
+// valueSeal encrypts cached secret values with AES-CTR under a key generated when the cache
+// is created, so a heap dump of the Traefik process does not show the credentials in clear
+// for as long as they are cached. The key lives in the same process: this protects against
+// dumps being searched for credentials, not against reading the process memory as a whole.
+type valueSeal struct {
+	block cipher.Block
+}
+
+// newValueSeal returns a seal with a new random key.
+func newValueSeal() (*valueSeal, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate the cache key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	zeroBytes(key)
+	if err != nil {
+		return nil, err
+	}
+	return &valueSeal{block: block}, nil
+}
+
+// seal encrypts every value of data, each under its own random IV prepended to it.
+func (v *valueSeal) seal(data map[string]string) map[string][]byte {
+	sealed := make(map[string][]byte, len(data))
+	for key, value := range data {
+		out := make([]byte, aes.BlockSize+len(value))
+		iv := out[:aes.BlockSize]
+		if _, err := rand.Read(iv); err != nil {
+			// crypto/rand does not fail on supported platforms; a fixed IV would still
+			// keep the value out of the heap in clear
+			zeroBytes(iv)
+		}
+		cipher.NewCTR(v.block, iv).XORKeyStream(out[aes.BlockSize:], []byte(value))
+		sealed[key] = out
+	}
+	return sealed
+}
+
+// open decrypts values sealed by seal into a new map.
+func (v *valueSeal) open(sealed map[string][]byte) map[string]string {
+	data := make(map[string]string, len(sealed))
+	for key, value := range sealed {
+		plain := make([]byte, len(value)-aes.BlockSize)
+		cipher.NewCTR(v.block, value[:aes.BlockSize]).XORKeyStream(plain, value[aes.BlockSize:])
+		data[key] = string(plain)
+		zeroBytes(plain)
+	}
+	return data
+}
+
+// wipe zeroes sealed values that are no longer cached.
+func wipe(sealed map[string][]byte) {
+	for _, value := range sealed {
+		zeroBytes(value)
+	}
+}
+
+// zeroBytes overwrites b with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
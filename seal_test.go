@@ -0,0 +1,122 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestSecretCacheProtectedValues tests that a cache with a seal holds values encrypted and
+// wipes them when they are replaced.
+func TestSecretCacheProtectedValues(t *testing.T) {
+	for _, implementation := range cacheImplementations {
+		t.Run(implementation, func(t *testing.T) {
+			config := &Config{CacheTTL: 300, CacheImplementation: implementation, ProtectCachedValues: true}
+			if implementation == cacheLRU {
+				config.CacheMaxEntries = 10
+			}
+			cache, err := newConfigCache(config, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cache.set("default/api", map[string]string{"token": "first-token", "empty": ""})
+			raw, ok := cache.loadEntry("default/api")
+			if !ok {
+				t.Fatal("Expected the entry to be cached")
+			}
+			if raw.data != nil {
+				t.Error("Expected no values in clear in the cache")
+			}
+			if bytes.Contains(raw.sealed["token"], []byte("first-token")) {
+				t.Error("Expected the cached value to be encrypted")
+			}
+
+			data, ok := cache.get("default/api")
+			if !ok || data["token"] != "first-token" || data["empty"] != "" {
+				t.Errorf("Expected the decrypted values, got %v", data)
+			}
+			if entry, _ := cache.peek("default/api"); entry["token"] != "first-token" {
+				t.Errorf("Expected peek to decrypt, got %v", entry)
+			}
+			cache.each(func(key string, entry cacheEntry) {
+				if entry.data["token"] != "first-token" {
+					t.Errorf("Expected each to decrypt, got %v", entry.data)
+				}
+			})
+
+			previous := raw.sealed["token"]
+			cache.set("default/api", map[string]string{"token": "second-token"})
+			if !bytes.Equal(previous, make([]byte, len(previous))) {
+				t.Error("Expected the replaced value to be wiped")
+			}
+			if data, _ := cache.get("default/api"); data["token"] != "second-token" {
+				t.Errorf("Expected the new value, got %v", data)
+			}
+		})
+	}
+}
+
+// TestLRUStoreEvictionWipes tests that the sealed values of an evicted entry are wiped.
+func TestLRUStoreEvictionWipes(t *testing.T) {
+	cache, err := newConfigCache(&Config{CacheTTL: 300, CacheImplementation: cacheLRU, CacheMaxEntries: 1, ProtectCachedValues: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.set("default/tenant-a", map[string]string{"token": "a-token"})
+	raw, ok := cache.loadEntry("default/tenant-a")
+	if !ok {
+		t.Fatal("Expected the entry to be cached")
+	}
+	previous := raw.sealed["token"]
+	if evicted := cache.set("default/tenant-b", map[string]string{"token": "b-token"}); evicted != 1 {
+		t.Fatalf("Expected 1 eviction, got %d", evicted)
+	}
+	if !bytes.Equal(previous, make([]byte, len(previous))) {
+		t.Error("Expected the evicted value to be wiped")
+	}
+	if data, _ := cache.get("default/tenant-b"); data["token"] != "b-token" {
+		t.Errorf("Expected the new value, got %v", data)
+	}
+}
+
+// TestValueSealKeys tests that every cache encrypts under its own key.
+func TestValueSealKeys(t *testing.T) {
+	first, err := newValueSeal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newValueSeal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := first.seal(map[string]string{"token": "my-secret-token"})
+	if got := first.open(sealed)["token"]; got != "my-secret-token" {
+		t.Errorf("Expected %q, got %q", "my-secret-token", got)
+	}
+	if got := second.open(sealed)["token"]; got == "my-secret-token" {
+		t.Error("Expected another key not to decrypt the value")
+	}
+	if again := first.seal(map[string]string{"token": "my-secret-token"}); bytes.Equal(again["token"], sealed["token"]) {
+		t.Error("Expected each seal to use a new IV")
+	}
+}
+
+// BenchmarkProtectedLookup measures the cost of decrypting a secret on each lookup.
+func BenchmarkProtectedLookup(b *testing.B) {
+	cache, err := newSecretCache(time.Hour, cacheAtomic, false, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if cache.seal, err = newValueSeal(); err != nil {
+		b.Fatal(err)
+	}
+	cache.set("default/api", map[string]string{"token": "my-secret-token", "tls.key": string(make([]byte, 2048))})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.get("default/api")
+	}
+}
@@ -0,0 +1,42 @@
+package traefik_k8s_secret_header
+
+import "context"
+
+// injectedKey returns the key of data, the secret cached under cacheKey, whose value is
+// injected: secretKey, the key named by secretKeyAnnotation, or with secretKeys the first of
+// them present in data, so a middleware works across environments where teams named the key
+// differently. The first entry is returned when none is present, for the error to name it.
+// In validate mode secretKeys are all accepted instead, see acceptedValues.
+func (s *SecretHeader) injectedKey(cacheKey string, data map[string]string) string {
+	if s.config.SecretKeyAnnotation != "" {
+		if key, ok := s.keyPointer(cacheKey); ok {
+			return key
+		}
+	}
+	if len(s.config.SecretKeys) == 0 || s.config.Mode == modeValidate {
+		return s.config.SecretKey
+	}
+	for _, key := range s.config.SecretKeys {
+		if _, ok := data[key]; ok {
+			return key
+		}
+	}
+	return s.config.SecretKeys[0]
+}
+
+// selectSecretKey returns the injected key of the secret secretName. A secret that cannot
+// be read yields the first entry of secretKeys, leaving the error and the fallbacks to the
+// read of the value.
+func (s *SecretHeader) selectSecretKey(ctx context.Context, secretName string) string {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return s.config.SecretKeys[0]
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName)
+	if err != nil {
+		return s.config.SecretKeys[0]
+	}
+	key := s.injectedKey(s.secretCacheKey(secretName), data)
+	s.debugf("Injecting key %s of secret %s/%s", key, s.config.Namespace, secretName)
+	return key
+}
@@ -0,0 +1,85 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPSecretKeys tests that the first key of secretKeys present in the secret is
+// injected.
+func TestServeHTTPSecretKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		data           map[string]string
+		secretKeys     []string
+		expectedStatus int
+		expectedValue  string
+	}{
+		{
+			name:           "first key present",
+			data:           map[string]string{"token": "from-token", "api-key": "from-api-key"},
+			secretKeys:     []string{"token", "api-key", "key"},
+			expectedStatus: http.StatusOK,
+			expectedValue:  "from-token",
+		},
+		{
+			name:           "later key present",
+			data:           map[string]string{"key": "from-key"},
+			secretKeys:     []string{"token", "api-key", "key"},
+			expectedStatus: http.StatusOK,
+			expectedValue:  "from-key",
+		},
+		{
+			name:           "empty value still selected",
+			data:           map[string]string{"token": "", "key": "from-key"},
+			secretKeys:     []string{"token", "key"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "no key present",
+			data:           map[string]string{"password": "other"},
+			secretKeys:     []string{"token", "api-key"},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, tt.data, true)
+			defer mockServer.Close()
+
+			var injected string
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					injected = req.Header.Get("X-Api-Key")
+				}),
+				name: "secret-keys-test",
+				config: &Config{
+					SecretName: "my-secret",
+					SecretKeys: tt.secretKeys,
+					HeaderName: "X-Api-Key",
+					Namespace:  "default",
+					CacheTTL:   300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if injected != tt.expectedValue {
+				t.Errorf("Expected %q injected, got %q", tt.expectedValue, injected)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// secretsManagerRenewal assumes the IRSA role again this long before the credentials expire.
+const secretsManagerRenewal = 5 * time.Minute
+
+// secretsManagerClient reads secrets from AWS Secrets Manager with credentials obtained by
+// exchanging the IRSA web identity token through STS AssumeRoleWithWebIdentity.
+type secretsManagerClient struct {
+	httpClient  *http.Client
+	region      string
+	endpoint    string // default https://secretsmanager.<region>.amazonaws.com
+	stsEndpoint string
+	roleARN     string
+	tokenFile   string
+
+	mu      sync.Mutex
+	creds   awsCredentials
+	expires time.Time
+}
+
+// readSecret returns the current version of the secret with the given name or ARN. A
+// SecretString holding a JSON object yields its members as keys; any other SecretString is
+// returned under the key "SecretString" and a SecretBinary under "SecretBinary".
+func (c *secretsManagerClient) readSecret(ctx context.Context, name string) (map[string]string, error) {
+	creds, err := c.credentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	endpoint := c.endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + c.region + ".amazonaws.com"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(string(payload)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	signSigV4(req, payload, creds, c.region, "secretsmanager", time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, classify(ErrAPIUnavailable, fmt.Errorf("failed to execute request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, classify(statusClass(resp.StatusCode), fmt.Errorf("secrets manager returned status %d: %s", resp.StatusCode, body))
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+		SecretBinary []byte  `json:"SecretBinary"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("failed to decode secrets manager response: %w", err)
+	}
+
+	if out.SecretString == nil {
+		return map[string]string{"SecretBinary": string(out.SecretBinary)}, nil
+	}
+	return jsonFields(*out.SecretString, "SecretString")
+}
+
+// credentials returns temporary credentials for the IRSA role, assuming it again when they
+// are about to expire.
+func (c *secretsManagerClient) credentials(ctx context.Context) (awsCredentials, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.creds.accessKeyID != "" && time.Now().Add(secretsManagerRenewal).Before(c.expires) {
+		return c.creds, nil
+	}
+
+	// The projected token is rotated by the kubelet, so it is read on every exchange
+	token, err := os.ReadFile(c.tokenFile)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {c.roleARN},
+		"RoleSessionName":  {fmt.Sprintf("traefik-k8s-secret-header-%d", time.Now().Unix())},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.stsEndpoint+"/", strings.NewReader(form.Encode()))
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to create STS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to assume role %s: %w", c.roleARN, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return awsCredentials{}, fmt.Errorf("STS returned status %d assuming role %s: %s", resp.StatusCode, c.roleARN, body)
+	}
+
+	var out struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return awsCredentials{}, fmt.Errorf("failed to decode STS response: %w", err)
+	}
+	if out.Credentials.AccessKeyID == "" || out.Credentials.SecretAccessKey == "" {
+		return awsCredentials{}, fmt.Errorf("STS response for role %s has no credentials", c.roleARN)
+	}
+
+	c.creds = awsCredentials{
+		accessKeyID:     out.Credentials.AccessKeyID,
+		secretAccessKey: out.Credentials.SecretAccessKey,
+		sessionToken:    out.Credentials.SessionToken,
+	}
+	c.expires = out.Credentials.Expiration
+	return c.creds, nil
+}
+
+// validateSecretsManagerConfig checks the AWS Secrets Manager source settings, taking the
+// region and IRSA role from the environment.
+func validateSecretsManagerConfig(config *Config) error {
+	if config.AWSSecretsManagerRegion == "" {
+		config.AWSSecretsManagerRegion = os.Getenv("AWS_REGION")
+	}
+	if config.AWSSecretsManagerRegion == "" {
+		config.AWSSecretsManagerRegion = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if config.AWSSecretsManagerRegion == "" {
+		return fmt.Errorf("awsSecretsManagerRegion is required with source %q when AWS_REGION is not set", sourceSecretsManager)
+	}
+	if config.AWSSecretsManagerEndpoint != "" {
+		endpoint, err := url.Parse(config.AWSSecretsManagerEndpoint)
+		if err != nil || endpoint.Host == "" || (endpoint.Scheme != "https" && endpoint.Scheme != "http") {
+			return fmt.Errorf("invalid awsSecretsManagerEndpoint %q", config.AWSSecretsManagerEndpoint)
+		}
+		config.AWSSecretsManagerEndpoint = strings.TrimSuffix(config.AWSSecretsManagerEndpoint, "/")
+	}
+	if os.Getenv("AWS_ROLE_ARN") == "" || os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE") == "" {
+		return fmt.Errorf("source %q needs IRSA: AWS_ROLE_ARN and AWS_WEB_IDENTITY_TOKEN_FILE are not set", sourceSecretsManager)
+	}
+	return nil
+}
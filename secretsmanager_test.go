@@ -0,0 +1,180 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockSecretsManagerServer serves STS AssumeRoleWithWebIdentity on /sts/ and GetSecretValue on /
+// for the secrets in responses, keyed by SecretId.
+func mockSecretsManagerServer(t *testing.T, assumes *int32, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sts/" {
+			r.ParseForm()
+			if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Form.Get("WebIdentityToken") != "irsa-token" ||
+				r.Form.Get("RoleArn") != "arn:aws:iam::123456789012:role/traefik" {
+				http.Error(w, "<ErrorResponse/>", http.StatusForbidden)
+				return
+			}
+			atomic.AddInt32(assumes, 1)
+			fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret-access-key</SecretAccessKey>
+      <SessionToken>session-token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+			return
+		}
+
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || r.Header.Get("X-Amz-Security-Token") != "session-token" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=ASIAEXAMPLE/") ||
+			!strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request") {
+			http.Error(w, `{"__type":"UnrecognizedClientException"}`, http.StatusBadRequest)
+			return
+		}
+		var in map[string]string
+		json.NewDecoder(r.Body).Decode(&in)
+		response, ok := responses[in["SecretId"]]
+		if !ok {
+			http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(response))
+	}))
+}
+
+// TestSecretsManagerReadSecret tests reading JSON, plain-text and binary secrets.
+func TestSecretsManagerReadSecret(t *testing.T) {
+	var assumes int32
+	server := mockSecretsManagerServer(t, &assumes, map[string]string{
+		"prod/payments": `{"Name":"prod/payments","SecretString":"{\"api-key\":\"sm-value\",\"port\":5432}"}`,
+		"prod/plain":    `{"Name":"prod/plain","SecretString":"plain-value"}`,
+		"prod/binary":   `{"Name":"prod/binary","SecretBinary":"YmluYXJ5LXZhbHVl"}`,
+	})
+	defer server.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("irsa-token"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := &secretsManagerClient{
+		httpClient:  server.Client(),
+		region:      "eu-west-1",
+		endpoint:    server.URL,
+		stsEndpoint: server.URL + "/sts",
+		roleARN:     "arn:aws:iam::123456789012:role/traefik",
+		tokenFile:   tokenFile,
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		expected    map[string]string
+		expectError bool
+	}{
+		{name: "JSON object", secret: "prod/payments", expected: map[string]string{"api-key": "sm-value", "port": "5432"}},
+		{name: "plain text", secret: "prod/plain", expected: map[string]string{"SecretString": "plain-value"}},
+		{name: "binary", secret: "prod/binary", expected: map[string]string{"SecretBinary": "binary-value"}},
+		{name: "missing", secret: "prod/missing", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := client.readSecret(t.Context(), tt.secret)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !reflect.DeepEqual(data, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, data)
+			}
+		})
+	}
+
+	if assumes != 1 {
+		t.Errorf("Expected the role to be assumed once, got %d", assumes)
+	}
+}
+
+// TestValidateSecretsManagerConfig tests the region and IRSA environment checks.
+func TestValidateSecretsManagerConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *Config
+		env            map[string]string
+		expectedRegion string
+		expectError    bool
+	}{
+		{
+			name:           "region from IRSA environment",
+			config:         &Config{},
+			env:            map[string]string{"AWS_REGION": "eu-west-1", "AWS_ROLE_ARN": "arn", "AWS_WEB_IDENTITY_TOKEN_FILE": "/token"},
+			expectedRegion: "eu-west-1",
+		},
+		{
+			name:           "configured region",
+			config:         &Config{AWSSecretsManagerRegion: "us-east-1"},
+			env:            map[string]string{"AWS_REGION": "eu-west-1", "AWS_ROLE_ARN": "arn", "AWS_WEB_IDENTITY_TOKEN_FILE": "/token"},
+			expectedRegion: "us-east-1",
+		},
+		{
+			name:        "no region",
+			config:      &Config{},
+			env:         map[string]string{"AWS_ROLE_ARN": "arn", "AWS_WEB_IDENTITY_TOKEN_FILE": "/token"},
+			expectError: true,
+		},
+		{
+			name:        "no IRSA",
+			config:      &Config{AWSSecretsManagerRegion: "eu-west-1"},
+			expectError: true,
+		},
+		{
+			name:        "invalid endpoint",
+			config:      &Config{AWSSecretsManagerRegion: "eu-west-1", AWSSecretsManagerEndpoint: "vpce-123"},
+			env:         map[string]string{"AWS_ROLE_ARN": "arn", "AWS_WEB_IDENTITY_TOKEN_FILE": "/token"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			err := validateSecretsManagerConfig(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.AWSSecretsManagerRegion != tt.expectedRegion {
+				t.Errorf("Expected region %q, got %q", tt.expectedRegion, tt.config.AWSSecretsManagerRegion)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// sharedCacheRegistry holds the caches shared by middleware instances with sharedCache set,
+// so a secret referenced by many routers is fetched once per TTL for the whole process.
+type sharedCacheRegistry struct {
+	mu     sync.Mutex
+	caches map[string]*secretCache // by sharedCacheScope
+}
+
+// sharedCaches is the process-wide registry; caches outlive the instances, so they also
+// survive configuration reloads.
+var sharedCaches = &sharedCacheRegistry{caches: make(map[string]*secretCache)}
+
+// sharedCacheScope identifies the instances that may share a cache: cache keys are only
+// namespace/name, so instances reading through another source, with other credentials, a
+// different namespaces list or different cache settings must not see each other's entries.
+// Entries are only checked for the opt-in annotation when fetched, so instances requiring it
+// do not share with those that do not.
+func sharedCacheScope(config *Config, perRequestSecrets bool) string {
+	return fmt.Sprintf("%q", []string{
+		config.Source,
+		config.VaultAddress, config.VaultMount, config.VaultRole, config.VaultAuthPath, config.VaultNamespace,
+		config.AWSSecretsManagerRegion, config.AWSSecretsManagerEndpoint,
+		config.GCPProject, config.AzureVaultURI,
+		config.APITokenSecretNamespace, config.APITokenSecretName, config.APITokenSecretKey, config.APIClientCertFile,
+		config.KubeconfigSecretNamespace, config.KubeconfigSecretName, config.KubeconfigSecretKey, config.KubeconfigContext,
+		config.APIImpersonateUser, strings.Join(config.APIImpersonateGroups, ","),
+		strings.Join(config.Namespaces, ","),
+		fmt.Sprint(config.CacheTTL), fmt.Sprint(config.CacheTTLJitter), fmt.Sprint(config.CacheTTLOverrides),
+		config.CacheImplementation, fmt.Sprint(config.CacheMaxEntries),
+		fmt.Sprint(perRequestSecrets), fmt.Sprint(config.ProtectCachedValues),
+		fmt.Sprint(config.RequireOptInAnnotation), config.SecretKeyAnnotation,
+	})
+}
+
+// get returns the cache of scope, creating it with create on first use.
+func (r *sharedCacheRegistry) get(scope string, create func() (*secretCache, error)) (*secretCache, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cache, ok := r.caches[scope]; ok {
+		return cache, nil
+	}
+	cache, err := create()
+	if err != nil {
+		return nil, err
+	}
+	r.caches[scope] = cache
+	return cache, nil
+}
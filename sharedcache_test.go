@@ -0,0 +1,100 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSharedCacheScope tests which configurations share a cache.
+func TestSharedCacheScope(t *testing.T) {
+	base := func() *Config {
+		return &Config{SecretName: "api-token", SecretKey: "token", HeaderName: "X-Auth-Token", Namespace: "default", CacheTTL: 300}
+	}
+
+	tests := []struct {
+		name         string
+		modify       func(config *Config)
+		expectShared bool
+	}{
+		{name: "other header and key", modify: func(c *Config) { c.HeaderName = "X-Other"; c.SecretKey = "other" }, expectShared: true},
+		{name: "other secret", modify: func(c *Config) { c.SecretName = "other-token" }, expectShared: true},
+		{name: "other source", modify: func(c *Config) { c.Source = sourceVault; c.VaultAddress = "https://vault:8200" }},
+		{name: "other credentials", modify: func(c *Config) { c.APITokenSecretName = "reader"; c.APITokenSecretKey = "token" }},
+		{name: "namespaces", modify: func(c *Config) { c.Namespaces = []string{"team-a", "default"} }},
+		{name: "other ttl", modify: func(c *Config) { c.CacheTTL = 60 }},
+		{name: "jitter", modify: func(c *Config) { c.CacheTTLJitter = 10 }},
+		{name: "bounded", modify: func(c *Config) { c.CacheMaxEntries = 10 }},
+		{name: "opt-in required", modify: func(c *Config) { c.RequireOptInAnnotation = true }},
+		{name: "key annotation", modify: func(c *Config) { c.SecretKeyAnnotation = "current-key" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base()
+			tt.modify(other)
+			shared := sharedCacheScope(base(), false) == sharedCacheScope(other, false)
+			if shared != tt.expectShared {
+				t.Errorf("Expected shared %v, got %v", tt.expectShared, shared)
+			}
+		})
+	}
+}
+
+// TestServeHTTPSharedCache tests that instances sharing a cache fetch a secret once.
+func TestServeHTTPSharedCache(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{"token": "shared-token", "other": "other-token"}, true)
+	defer mockServer.Close()
+
+	apiCallCount := 0
+	trackedServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiCallCount++
+		mockServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer trackedServer.Close()
+
+	registry := &sharedCacheRegistry{caches: make(map[string]*secretCache)}
+	newHandler := func(name, secretKey, headerName string) (*SecretHeader, *string) {
+		config := &Config{
+			SecretName:  "api-token",
+			SecretKey:   secretKey,
+			HeaderName:  headerName,
+			Namespace:   "default",
+			CacheTTL:    300,
+			SharedCache: true,
+		}
+		cache, err := registry.get(sharedCacheScope(config, false), func() (*secretCache, error) {
+			return newConfigCache(config, false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		captured := new(string)
+		return &SecretHeader{
+			next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				*captured = req.Header.Get(headerName)
+			}),
+			name:   name,
+			config: config,
+			k8sClient: &k8sClient{
+				httpClient: trackedServer.Client(),
+				baseURL:    trackedServer.URL,
+				token:      "test-token",
+			},
+			cache: cache,
+		}, captured
+	}
+
+	first, firstValue := newHandler("first", "token", "X-Auth-Token")
+	second, secondValue := newHandler("second", "other", "X-Other-Token")
+
+	first.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+	second.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if *firstValue != "shared-token" || *secondValue != "other-token" {
+		t.Errorf("Expected each instance to inject its key, got %q and %q", *firstValue, *secondValue)
+	}
+	if apiCallCount != 1 {
+		t.Errorf("Expected a single API call for both instances, got %d", apiCallCount)
+	}
+}
@@ -0,0 +1,203 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// awsCredentials are the static AWS credentials read from the secret.
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// serveSigV4 signs the request with AWS Signature Version 4 and forwards it.
+func (s *SecretHeader) serveSigV4(rw http.ResponseWriter, req *http.Request, secretName string) {
+	creds, err := s.awsCredentials(req, secretName)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	body, err := bufferBody(req, s.config.SignatureMaxBodyBytes)
+	if err != nil {
+		if err == errBodyTooLarge {
+			http.Error(rw, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		s.serveError(rw, req, err)
+		return
+	}
+
+	if s.config.AWSHost != "" {
+		req.Host = s.config.AWSHost
+	}
+	signSigV4(req, body, creds, s.config.AWSRegion, s.config.AWSService, time.Now())
+
+	s.next.ServeHTTP(rw, req)
+}
+
+// awsCredentials reads the access key, secret key and optional session token from one secret.
+func (s *SecretHeader) awsCredentials(req *http.Request, secretName string) (awsCredentials, error) {
+	client, err := s.apiClient(req.Context())
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	data, err := s.fetchSecretData(req.Context(), client, s.config.Namespace, secretName)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	creds := awsCredentials{
+		accessKeyID:     data[s.config.AWSAccessKeyIDKey],
+		secretAccessKey: data[s.config.SecretKey],
+		sessionToken:    data[s.config.AWSSessionTokenKey],
+	}
+	if creds.accessKeyID == "" || creds.secretAccessKey == "" {
+		return awsCredentials{}, classify(ErrKeyMissing, fmt.Errorf("secret %s/%s lacks keys '%s' and '%s'",
+			s.config.Namespace, secretName, s.config.AWSAccessKeyIDKey, s.config.SecretKey))
+	}
+	return creds, nil
+}
+
+// signSigV4 sets the X-Amz-Date, X-Amz-Security-Token (for session credentials),
+// X-Amz-Content-Sha256 (for S3) and Authorization headers.
+func signSigV4(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	payloadSum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(payloadSum[:])
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signedHeaders, canonicalHeaders := sigV4Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL, service),
+		sigV4Query(req.URL),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestSum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestSum[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// sigV4Headers returns the signed header list and canonical headers: host, content-type and
+// every x-amz-* header.
+func sigV4Headers(req *http.Request) (string, string) {
+	values := map[string]string{"host": req.Host}
+	for name, vals := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			trimmed := make([]string, len(vals))
+			for i, v := range vals {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			values[lower] = strings.Join(trimmed, ",")
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// sigV4Path returns the canonical URI. S3 encodes each segment once, other services sign the
+// already encoded path, encoding it a second time.
+func sigV4Path(u *url.URL, service string) string {
+	path := u.EscapedPath()
+	if service == "s3" {
+		path = u.Path
+	}
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = sigV4Escape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sigV4Query returns the canonical query string, sorted by key then value.
+func sigV4Query(u *url.URL) string {
+	query := u.Query()
+	keys := make([]string, 0, len(query))
+	escaped := make(map[string]string, len(query))
+	for key := range query {
+		escaped[key] = sigV4Escape(key)
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return escaped[keys[i]] < escaped[keys[j]] })
+
+	pairs := make([]string, 0, len(query))
+	for _, key := range keys {
+		values := make([]string, len(query[key]))
+		for i, value := range query[key] {
+			values[i] = sigV4Escape(value)
+		}
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, escaped[key]+"="+value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// sigV4Escape percent-encodes everything except the RFC 3986 unreserved characters.
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns the raw HMAC-SHA256 of data.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
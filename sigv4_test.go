@@ -0,0 +1,126 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignSigV4 tests the signer against the AWS Signature Version 4 test suite.
+func TestSignSigV4(t *testing.T) {
+	creds := awsCredentials{
+		accessKeyID:     "AKIDEXAMPLE",
+		secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		target   string
+		expected string
+	}{
+		{
+			name:   "get-vanilla",
+			target: "http://example.amazonaws.com/",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:   "get-vanilla-query-order-key-case",
+			target: "http://example.amazonaws.com/?Param2=value2&Param1=value1",
+			expected: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			signSigV4(req, nil, creds, "us-east-1", "service", now)
+
+			if got := req.Header.Get("Authorization"); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("Expected X-Amz-Date 20150830T123600Z, got %q", got)
+			}
+		})
+	}
+}
+
+// TestServeHTTPSigV4 tests signing proxied requests with credentials from the secret.
+func TestServeHTTPSigV4(t *testing.T) {
+	secretData := map[string]string{
+		"aws_access_key_id":     "AKIDEXAMPLE",
+		"aws_secret_access_key": "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		"aws_session_token":     "session-token",
+	}
+
+	mockServer := mockK8sServer(t, secretData, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:            "aws-credentials",
+		SecretKey:             "aws_secret_access_key",
+		HeaderName:            "Authorization",
+		Namespace:             "default",
+		CacheTTL:              300,
+		Mode:                  modeSigV4,
+		AWSRegion:             "eu-west-1",
+		AWSService:            "s3",
+		AWSHost:               "my-bucket.s3.eu-west-1.amazonaws.com",
+		AWSAccessKeyIDKey:     "aws_access_key_id",
+		AWSSessionTokenKey:    "aws_session_token",
+		SignatureMaxBodyBytes: 1024,
+	}
+
+	var forwarded *http.Request
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		forwarded = req
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	handler := &SecretHeader{
+		next:   next,
+		name:   "test-middleware",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache: &secretCache{
+			ttl: time.Duration(config.CacheTTL) * time.Second,
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "http://gateway.local/reports/2024.csv", strings.NewReader("a,b\n"))
+	req.Header.Set("Authorization", "Bearer client-token")
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rw.Code)
+	}
+	if forwarded.Host != "my-bucket.s3.eu-west-1.amazonaws.com" {
+		t.Errorf("Expected Host to be rewritten, got %q", forwarded.Host)
+	}
+
+	authorization := forwarded.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+		!strings.Contains(authorization, "/eu-west-1/s3/aws4_request") ||
+		!strings.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token") {
+		t.Errorf("Unexpected Authorization header %q", authorization)
+	}
+	if got := forwarded.Header.Get("X-Amz-Security-Token"); got != "session-token" {
+		t.Errorf("Expected the session token to be forwarded, got %q", got)
+	}
+	payloadSum := sha256.Sum256([]byte("a,b\n"))
+	if got, expected := forwarded.Header.Get("X-Amz-Content-Sha256"), hex.EncodeToString(payloadSum[:]); got != expected {
+		t.Errorf("Expected payload hash %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,160 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Supported values for Config.Source.
+const (
+	sourceKubernetes     = "kubernetes"
+	sourceVault          = "vault"
+	sourceSecretsManager = "awsSecretsManager"
+	sourceGCP            = "gcpSecretManager"
+	sourceAzure          = "azureKeyVault"
+	sourceFile           = "file"
+	sourceEnv            = "env"
+)
+
+// disableKubernetesAPIEnv, set to "true" on the Traefik deployment, rejects every middleware
+// that would call the Kubernetes API, for clusters where the ingress controller holds no
+// RBAC on secrets and reads them from mounted volumes only.
+const disableKubernetesAPIEnv = "K8S_SECRET_HEADER_DISABLE_KUBERNETES_API"
+
+// secretReader reads secrets from a store other than Kubernetes. Results go through the same
+// cache as Kubernetes secrets, keyed by namespace and name.
+type secretReader interface {
+	// readSecret returns the key/value data of the named secret.
+	readSecret(ctx context.Context, name string) (map[string]string, error)
+}
+
+// changeChecker is a secretReader that cheaply checks for changes on every read instead of
+// relying on a TTL. Its results bypass the TTL cache, so updates are picked up by the next
+// request.
+type changeChecker interface {
+	secretReader
+	checksChanges()
+}
+
+// jsonFields splits a secret stored as a JSON object into keys, JSON-encoding non-string
+// members. Any other value is returned whole under fallbackKey.
+func jsonFields(raw, fallbackKey string) (map[string]string, error) {
+	var fields map[string]interface{}
+	if json.Unmarshal([]byte(raw), &fields) != nil || fields == nil {
+		return map[string]string{fallbackKey: raw}, nil
+	}
+
+	data := make(map[string]string, len(fields))
+	for key, value := range fields {
+		if s, ok := value.(string); ok {
+			data[key] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key '%s': %w", key, err)
+		}
+		data[key] = string(encoded)
+	}
+	return data, nil
+}
+
+// validateSource checks the settings of config.Source.
+func validateSource(config *Config) error {
+	switch config.Source {
+	case "", sourceKubernetes:
+	case sourceVault:
+		return validateVaultConfig(config)
+	case sourceSecretsManager:
+		return validateSecretsManagerConfig(config)
+	case sourceGCP:
+		return validateGCPConfig(config)
+	case sourceAzure:
+		return validateAzureConfig(config)
+	case sourceFile:
+		return validateFileConfig(config)
+	case sourceEnv:
+		return validateEnvConfig(config)
+	default:
+		if providers.lookup(config.Source) == nil {
+			return fmt.Errorf("unknown source %q", config.Source)
+		}
+	}
+	return nil
+}
+
+// newSourceReader returns the reader of a validated config.Source, or nil for Kubernetes.
+// Each remote store gets its own HTTP client with the configured TLS policy; a registered
+// provider is created by its factory.
+func newSourceReader(config *Config, tlsConfig *tls.Config) (secretReader, error) {
+	httpClient := func() *http.Client {
+		return &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig.Clone(), Proxy: http.ProxyFromEnvironment},
+		}
+	}
+
+	switch config.Source {
+	case sourceVault:
+		return &vaultClient{
+			httpClient: httpClient(),
+			address:    config.VaultAddress,
+			mount:      config.VaultMount,
+			authPath:   config.VaultAuthPath,
+			role:       config.VaultRole,
+			namespace:  config.VaultNamespace,
+			jwtFile:    serviceAccountDir + "/token",
+		}, nil
+	case sourceSecretsManager:
+		return &secretsManagerClient{
+			httpClient:  httpClient(),
+			region:      config.AWSSecretsManagerRegion,
+			endpoint:    config.AWSSecretsManagerEndpoint,
+			stsEndpoint: "https://sts." + config.AWSSecretsManagerRegion + ".amazonaws.com",
+			roleARN:     os.Getenv("AWS_ROLE_ARN"),
+			tokenFile:   os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"),
+		}, nil
+	case sourceGCP:
+		return &gcpClient{
+			httpClient: httpClient(),
+			project:    config.GCPProject,
+		}, nil
+	case sourceAzure:
+		authorityHost := os.Getenv("AZURE_AUTHORITY_HOST")
+		if authorityHost == "" {
+			authorityHost = "https://login.microsoftonline.com/"
+		}
+		return &azureClient{
+			httpClient:    httpClient(),
+			vaultURI:      config.AzureVaultURI,
+			clientID:      os.Getenv("AZURE_CLIENT_ID"),
+			tenantID:      os.Getenv("AZURE_TENANT_ID"),
+			authorityHost: authorityHost,
+			tokenFile:     os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+		}, nil
+	case sourceFile:
+		return &fileSource{}, nil
+	case sourceEnv:
+		return envSource{}, nil
+	case "", sourceKubernetes:
+		return nil, nil
+	}
+
+	factory := providers.lookup(config.Source)
+	if factory == nil {
+		return nil, fmt.Errorf("unknown source %q", config.Source)
+	}
+	provider, err := factory(config)
+	if err == nil && provider == nil {
+		err = fmt.Errorf("no provider")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create provider %q: %w", config.Source, err)
+	}
+	return &providerReader{provider: provider, namespace: config.Namespace}, nil
+}
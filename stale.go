@@ -0,0 +1,37 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// staleSecretData returns the data cached under cacheKey after a failed read, when it
+// expired less than MaxStale seconds ago, so an unavailable API does not fail requests for
+// a value that was good moments ago. readErr is the error of the failed read; a secret that
+// was deleted is never served stale, as deleting it is how a credential is revoked.
+func (s *SecretHeader) staleSecretData(cacheKey string, readErr error) (map[string]string, bool) {
+	if s.config.MaxStale <= 0 || hasStatus(readErr, http.StatusNotFound) {
+		return nil, false
+	}
+	entry, ok := s.cache.load(cacheKey)
+	if !ok {
+		return nil, false
+	}
+
+	ttl := entry.ttl
+	if ttl == 0 {
+		ttl = s.cache.ttl
+	}
+	age := s.cache.since(entry.lastFetch)
+	expiredFor := age - ttl
+	if expiredFor > time.Duration(s.config.MaxStale)*time.Second {
+		return nil, false
+	}
+
+	fmt.Fprintf(os.Stderr, "[k8s-secret-header] Serving secret %s fetched %s ago: %v\n",
+		cacheKey, age.Round(time.Second), readErr)
+	metrics.inc(metricStaleServed, "middleware", s.name)
+	return entry.data, true
+}
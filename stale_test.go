@@ -0,0 +1,97 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPMaxStale tests that an expired value is served while the API fails, within
+// maxStale.
+func TestServeHTTPMaxStale(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxStale       int
+		failStatus     int
+		expired        time.Duration
+		expectedStatus int
+	}{
+		{name: "within maxStale", maxStale: 60, failStatus: http.StatusServiceUnavailable, expired: time.Second, expectedStatus: http.StatusOK},
+		{name: "beyond maxStale", maxStale: 60, failStatus: http.StatusServiceUnavailable, expired: 2 * time.Minute, expectedStatus: http.StatusInternalServerError},
+		{name: "disabled", failStatus: http.StatusServiceUnavailable, expired: time.Second, expectedStatus: http.StatusInternalServerError},
+		{name: "deleted secret", maxStale: 60, failStatus: http.StatusNotFound, expired: time.Second, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failing int32
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.LoadInt32(&failing) == 1 {
+					w.WriteHeader(tt.failStatus)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{
+					Data: map[string]string{"api-key": base64.StdEncoding.EncodeToString([]byte("my-secret-token"))},
+				})
+			}))
+			defer mockServer.Close()
+
+			var captured string
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req.Header.Get("X-Api-Key")
+				}),
+				name: "max-stale-" + tt.name,
+				config: &Config{
+					SecretName: "my-secret",
+					SecretKey:  "api-key",
+					HeaderName: "X-Api-Key",
+					Namespace:  "default",
+					CacheTTL:   300,
+					MaxStale:   tt.maxStale,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if rw.Code != http.StatusOK {
+				t.Fatalf("Expected the first request to succeed, got %d", rw.Code)
+			}
+
+			// Age the entry past its TTL and take the API down
+			entry, _ := handler.cache.load("default/my-secret")
+			entry.lastFetch = time.Now().Add(-300*time.Second - tt.expired)
+			handler.cache.put("default/my-secret", entry)
+			atomic.StoreInt32(&failing, 1)
+			captured = ""
+
+			rw = httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			served := metrics.value(metricStaleServed, "middleware", handler.name)
+			if tt.expectedStatus == http.StatusOK {
+				if captured != "my-secret-token" {
+					t.Errorf("Expected the last known good value, got %q", captured)
+				}
+				if served != 1 {
+					t.Errorf("Expected 1 stale value served, got %v", served)
+				}
+			} else if served != 0 {
+				t.Errorf("Expected no stale value served, got %v", served)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Supported values for Config.StatsDFormat.
+const (
+	statsdFormatDogStatsD = "dogstatsd"
+	statsdFormatStatsD    = "statsd"
+)
+
+// validateStatsD checks the StatsD sink settings.
+func validateStatsD(config *Config) error {
+	if config.StatsDAddress == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(config.StatsDAddress); err != nil {
+		return fmt.Errorf("statsdAddress must be host:port: %w", err)
+	}
+	if strings.ContainsAny(config.StatsDPrefix, ":|#@\n") {
+		return fmt.Errorf("statsdPrefix cannot contain ':', '|', '#', '@' or newlines")
+	}
+	switch config.StatsDFormat {
+	case "", statsdFormatDogStatsD:
+	case statsdFormatStatsD:
+		if len(config.StatsDTags) > 0 {
+			return fmt.Errorf("statsdTags require statsdFormat %q", statsdFormatDogStatsD)
+		}
+	default:
+		return fmt.Errorf("statsdFormat must be %q or %q", statsdFormatDogStatsD, statsdFormatStatsD)
+	}
+	for _, tag := range config.StatsDTags {
+		if tag == "" || strings.ContainsAny(tag, ",|#@\n") {
+			return fmt.Errorf("invalid statsdTags entry %q", tag)
+		}
+	}
+	return nil
+}
+
+// statsdSink sends the metrics of one middleware to a StatsD or DogStatsD server over UDP,
+// one datagram per update. Sends never block and their errors are ignored: metrics are
+// best effort and must not slow down requests.
+type statsdSink struct {
+	conn      net.Conn
+	prefix    string
+	tags      []string // static tags of every metric
+	dogstatsd bool     // labels are sent as tags rather than folded into the name
+}
+
+// newStatsdSink returns the sink configured by config, or nil without statsdAddress.
+func newStatsdSink(config *Config) (*statsdSink, error) {
+	if config.StatsDAddress == "" {
+		return nil, nil
+	}
+	conn, err := net.Dial("udp", config.StatsDAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open statsdAddress: %w", err)
+	}
+	return &statsdSink{
+		conn:      conn,
+		prefix:    config.StatsDPrefix,
+		tags:      config.StatsDTags,
+		dogstatsd: config.StatsDFormat != statsdFormatStatsD,
+	}, nil
+}
+
+// send emits value for desc: the increment of a counter or the current value of a gauge.
+// Gauges of times elapsed since a moment are computed at scrape time and not sent.
+func (s *statsdSink) send(desc metricDesc, value float64, labels []string) {
+	if s == nil || desc.since || (desc.typ == "counter" && value == 0) {
+		return
+	}
+	s.conn.Write([]byte(s.line(desc, value, labels)))
+}
+
+// line formats a metric update, e.g. "traefik_k8s_secret_header.stale_served_total:1|c|#middleware:api-auth"
+// in DogStatsD format, or "traefik_k8s_secret_header.stale_served_total.api-auth:1|c" in plain StatsD.
+func (s *statsdSink) line(desc metricDesc, value float64, labels []string) string {
+	kind := "g"
+	if desc.typ == "counter" {
+		kind = "c"
+	}
+
+	var b strings.Builder
+	b.WriteString(s.prefix)
+	b.WriteString(desc.name)
+	if !s.dogstatsd {
+		for i := 1; i < len(labels); i += 2 {
+			b.WriteByte('.')
+			b.WriteString(statsdSanitize(labels[i], "."))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	if s.dogstatsd && len(labels)+len(s.tags) > 0 {
+		tags := append([]string(nil), s.tags...)
+		for i := 0; i+1 < len(labels); i += 2 {
+			tags = append(tags, labels[i]+":"+statsdSanitize(labels[i+1], ""))
+		}
+		b.WriteString("|#")
+		b.WriteString(strings.Join(tags, ","))
+	}
+	return b.String()
+}
+
+// statsdSanitize replaces the characters of value that are separators in the StatsD line
+// protocol, and those of extra, with underscores.
+func statsdSanitize(value, extra string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(":|,#@\n"+extra, r) {
+			return '_'
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,133 @@
+package traefik_k8s_secret_header
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestStatsdLine tests the line protocol of both formats.
+func TestStatsdLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		sink     *statsdSink
+		desc     metricDesc
+		value    float64
+		labels   []string
+		expected string
+	}{
+		{
+			name:     "dogstatsd counter",
+			sink:     &statsdSink{prefix: "traefik_k8s_secret_header.", tags: []string{"env:prod"}, dogstatsd: true},
+			desc:     metricStaleServed,
+			value:    1,
+			labels:   []string{"middleware", "api-auth"},
+			expected: "traefik_k8s_secret_header.stale_served_total:1|c|#env:prod,middleware:api-auth",
+		},
+		{
+			name:     "dogstatsd gauge",
+			sink:     &statsdSink{dogstatsd: true},
+			desc:     metricCacheEntries,
+			value:    12,
+			labels:   []string{"middleware", "default-api-auth@kubernetescrd"},
+			expected: "cache_entries:12|g|#middleware:default-api-auth_kubernetescrd",
+		},
+		{
+			name:     "dogstatsd without tags",
+			sink:     &statsdSink{dogstatsd: true},
+			desc:     metricCacheEntries,
+			value:    0.5,
+			expected: "cache_entries:0.5|g",
+		},
+		{
+			name:     "statsd",
+			sink:     &statsdSink{prefix: "edge."},
+			desc:     metricSourceFallbacks,
+			value:    2,
+			labels:   []string{"middleware", "api-auth", "source", "vault:kv/api"},
+			expected: "edge.source_fallbacks_total.api-auth.vault_kv/api:2|c",
+		},
+		{
+			name:     "statsd secret label",
+			sink:     &statsdSink{},
+			desc:     metricSecretRotations,
+			value:    1,
+			labels:   []string{"middleware", "api-auth", "secret", "default/api.token"},
+			expected: "secret_rotations_total.api-auth.default/api_token:1|c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sink.line(tt.desc, tt.value, tt.labels); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestStatsdSink tests that registry updates of a middleware reach its sink.
+func TestStatsdSink(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	sink, err := newStatsdSink(&Config{StatsDAddress: server.LocalAddr().String(), StatsDPrefix: "k8s."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := newMetricsRegistry()
+	registry.attachSink("api-auth", sink)
+	defer registry.attachSink("api-auth", nil)
+
+	registry.inc(metricStaleServed, "middleware", "other")
+	registry.add(metricStaleServed, 0, "middleware", "api-auth")
+	registry.set(metricSecretAge, float64(time.Now().Unix()), "middleware", "api-auth", "secret", "default/api")
+	registry.inc(metricStaleServed, "middleware", "api-auth")
+	registry.set(metricCacheEntries, 3, "middleware", "api-auth")
+
+	expected := []string{
+		"k8s.stale_served_total:1|c|#middleware:api-auth",
+		"k8s.cache_entries:3|g|#middleware:api-auth",
+	}
+	buf := make([]byte, 512)
+	for _, line := range expected {
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != line {
+			t.Errorf("Expected %q, got %q", line, got)
+		}
+	}
+}
+
+// TestValidateStatsD tests the StatsD sink settings checks.
+func TestValidateStatsD(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "disabled", config: &Config{StatsDFormat: "bogus"}},
+		{name: "dogstatsd", config: &Config{StatsDAddress: "localhost:8125", StatsDPrefix: "edge.", StatsDTags: []string{"env:prod"}}},
+		{name: "statsd", config: &Config{StatsDAddress: "localhost:8125", StatsDFormat: "statsd"}},
+		{name: "no port", config: &Config{StatsDAddress: "localhost"}, expectError: true},
+		{name: "bad prefix", config: &Config{StatsDAddress: "localhost:8125", StatsDPrefix: "edge:"}, expectError: true},
+		{name: "unknown format", config: &Config{StatsDAddress: "localhost:8125", StatsDFormat: "graphite"}, expectError: true},
+		{name: "tags without dogstatsd", config: &Config{StatsDAddress: "localhost:8125", StatsDFormat: "statsd", StatsDTags: []string{"env:prod"}}, expectError: true},
+		{name: "bad tag", config: &Config{StatsDAddress: "localhost:8125", StatsDTags: []string{"env:prod,team:x"}}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStatsD(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fetchStatus remembers the outcome of the most recent secret read of a middleware instance.
+type fetchStatus struct {
+	mu  sync.Mutex
+	key string
+	at  time.Time
+	err error
+}
+
+// record stores the outcome of a read of the secret cached under key.
+func (f *fetchStatus) record(key string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.key, f.at, f.err = key, time.Now(), err
+}
+
+// statusReport is the JSON document served on statusPath. It never contains secret values.
+type statusReport struct {
+	Middleware        string           `json:"middleware"`
+	ConfigFingerprint string           `json:"configFingerprint"`
+	CacheTTLSeconds   int              `json:"cacheTTLSeconds"`
+	Cache             []cacheStatus    `json:"cache"`
+	LastFetch         *lastFetchStatus `json:"lastFetch,omitempty"`
+}
+
+// cacheStatus describes one cached secret.
+type cacheStatus struct {
+	Key        string  `json:"key"`
+	AgeSeconds float64 `json:"ageSeconds"`
+	TTLSeconds float64 `json:"ttlSeconds"`
+	Expired    bool    `json:"expired"`
+}
+
+// lastFetchStatus is the most recent secret read and its error, if any.
+type lastFetchStatus struct {
+	Key   string    `json:"key"`
+	Time  time.Time `json:"time"`
+	Error string    `json:"error,omitempty"`
+}
+
+// configFingerprint returns a short hash of the configuration, to tell at a glance whether
+// two replicas or two reloads run the same settings. Options that may hold credentials are
+// left out, as a hash of a low-entropy value can be brute-forced.
+func configFingerprint(config *Config) string {
+	public := *config
+	public.FallbackValue = ""
+	public.RotationWebhookURL = ""
+	public.APIProxyURL = ""
+	encoded, _ := json.Marshal(&public)
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// status returns the cache and fetch state of the middleware instance.
+func (s *SecretHeader) status() statusReport {
+	report := statusReport{
+		Middleware:        s.name,
+		ConfigFingerprint: configFingerprint(s.config),
+		CacheTTLSeconds:   s.config.CacheTTL,
+		Cache:             []cacheStatus{},
+	}
+
+	now := s.cache.now()
+	s.cache.each(func(key string, entry cacheEntry) {
+		ttl := entry.ttl
+		if ttl == 0 {
+			ttl = s.cache.ttl
+		}
+		report.Cache = append(report.Cache, cacheStatus{
+			Key:        key,
+			AgeSeconds: now.Sub(entry.lastFetch).Seconds(),
+			TTLSeconds: ttl.Seconds(),
+			Expired:    s.cache.stale(entry),
+		})
+	})
+	sort.Slice(report.Cache, func(i, j int) bool { return report.Cache[i].Key < report.Cache[j].Key })
+
+	s.fetches.mu.Lock()
+	defer s.fetches.mu.Unlock()
+
+	if !s.fetches.at.IsZero() {
+		report.LastFetch = &lastFetchStatus{Key: s.fetches.key, Time: s.fetches.at}
+		if s.fetches.err != nil {
+			report.LastFetch.Error = s.fetches.err.Error()
+		}
+	}
+	return report
+}
+
+// serveStatus writes the status of the middleware instance as JSON to an allowed client. The
+// last fetch error may quote the API server's response, so it is kept to admins.
+func (s *SecretHeader) serveStatus(rw http.ResponseWriter, req *http.Request) {
+	if !s.admins.allows(req) {
+		http.Error(rw, "Forbidden", http.StatusForbidden)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(s.status())
+}
@@ -0,0 +1,94 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultPlaceholder is the token replaced with the secret value in mode substitute.
+const defaultPlaceholder = "{{SECRET}}"
+
+// validateSubstituteConfig checks the mode substitute settings. The request keeps its own
+// HeaderName, so options deciding whether to inject a whole header do not apply.
+func validateSubstituteConfig(config *Config) error {
+	if config.Mode != modeSubstitute {
+		if config.Placeholder != "" || config.PlaceholderInURL {
+			return fmt.Errorf("placeholder and placeholderInURL are only supported in mode %q", modeSubstitute)
+		}
+		return nil
+	}
+	if config.PreserveExistingHeader || config.AppendHeader || config.TrustedHeadersOnly ||
+		config.RejectExistingHeader || config.CompressThreshold > 0 || config.ValuePrefix != "" {
+		return fmt.Errorf("mode %q cannot be combined with header injection options", modeSubstitute)
+	}
+	if config.SecretKeyPattern != "" {
+		return fmt.Errorf("secretKeyPattern cannot be used with mode %q", modeSubstitute)
+	}
+	return nil
+}
+
+// serveSubstituted replaces the placeholder in the values of HeaderName and, with
+// placeholderInURL, in the request path and query with the secret value. Requests without
+// the placeholder pass through untouched, without reading the secret.
+func (s *SecretHeader) serveSubstituted(rw http.ResponseWriter, req *http.Request, secretName, secretKey string) {
+	placeholder := s.config.Placeholder
+	inHeader := false
+	for _, value := range req.Header.Values(s.config.HeaderName) {
+		inHeader = inHeader || strings.Contains(value, placeholder)
+	}
+	inURL := s.config.PlaceholderInURL && urlHasPlaceholder(req.URL, placeholder)
+	if !inHeader && !inURL {
+		s.next.ServeHTTP(rw, req)
+		return
+	}
+
+	value, err := s.getValue(req.Context(), secretName, secretKey)
+	if err == nil {
+		value, err = s.headerValue(value)
+	}
+	if err == nil {
+		value, err = s.checkValue(value, secretName, secretKey)
+	}
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	if inHeader {
+		values := req.Header.Values(s.config.HeaderName)
+		substituted := make([]string, len(values))
+		for i, headerValue := range values {
+			substituted[i] = strings.ReplaceAll(headerValue, placeholder, value)
+		}
+		req.Header[http.CanonicalHeaderKey(s.config.HeaderName)] = substituted
+	}
+	if inURL {
+		substituteURL(req.URL, placeholder, value)
+		req.RequestURI = req.URL.RequestURI()
+	}
+	s.injectIdentity(req)
+	s.next.ServeHTTP(rw, req)
+}
+
+// urlHasPlaceholder reports whether the path or query of u holds placeholder, as is or
+// percent-encoded.
+func urlHasPlaceholder(u *url.URL, placeholder string) bool {
+	return strings.Contains(u.Path, placeholder) ||
+		strings.Contains(u.RawQuery, placeholder) || strings.Contains(u.RawQuery, url.QueryEscape(placeholder))
+}
+
+// substituteURL replaces placeholder in the path and query of u with value, escaped so it
+// stays within the path segment or query parameter holding the placeholder.
+func substituteURL(u *url.URL, placeholder, value string) {
+	if strings.Contains(u.Path, placeholder) {
+		escaped := strings.ReplaceAll(u.EscapedPath(), url.PathEscape(placeholder), url.PathEscape(value))
+		escaped = strings.ReplaceAll(escaped, placeholder, url.PathEscape(value))
+		if path, err := url.PathUnescape(escaped); err == nil {
+			u.Path, u.RawPath = path, escaped
+		}
+	}
+	query := strings.ReplaceAll(u.RawQuery, url.QueryEscape(placeholder), url.QueryEscape(value))
+	u.RawQuery = strings.ReplaceAll(query, placeholder, url.QueryEscape(value))
+}
@@ -0,0 +1,155 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPSubstitute tests that the placeholder is replaced in the header and URL.
+func TestServeHTTPSubstitute(t *testing.T) {
+	tests := []struct {
+		name             string
+		placeholderInURL bool
+		target           string
+		header           []string
+		expectedHeader   []string
+		expectedURI      string
+		expectedQuery    string
+	}{
+		{
+			name:           "compound header",
+			target:         "/orders",
+			header:         []string{"ApiKey key={{SECRET}}, version=2"},
+			expectedHeader: []string{"ApiKey key=s3cr/t+1, version=2"},
+			expectedURI:    "/orders",
+		},
+		{
+			name:           "several values and occurrences",
+			target:         "/orders",
+			header:         []string{"{{SECRET}}:{{SECRET}}", "other"},
+			expectedHeader: []string{"s3cr/t+1:s3cr/t+1", "other"},
+			expectedURI:    "/orders",
+		},
+		{
+			name:           "URL ignored by default",
+			target:         "/orders?key={{SECRET}}",
+			header:         []string{"Token {{SECRET}}"},
+			expectedHeader: []string{"Token s3cr/t+1"},
+			expectedURI:    "/orders?key={{SECRET}}",
+		},
+		{
+			name:             "query",
+			placeholderInURL: true,
+			target:           "/orders?key=%7B%7BSECRET%7D%7D&page=2",
+			expectedURI:      "/orders?key=s3cr%2Ft%2B1&page=2",
+			expectedQuery:    "s3cr/t+1",
+		},
+		{
+			name:             "path segment",
+			placeholderInURL: true,
+			target:           "/keys/%7B%7BSECRET%7D%7D/orders",
+			expectedURI:      "/keys/s3cr%2Ft+1/orders",
+		},
+		{
+			name:             "no placeholder",
+			placeholderInURL: true,
+			target:           "/orders",
+			header:           []string{"Bearer client-token"},
+			expectedHeader:   []string{"Bearer client-token"},
+			expectedURI:      "/orders",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"api-key": "s3cr/t+1"}, true)
+			defer mockServer.Close()
+
+			var captured *http.Request
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					captured = req
+				}),
+				name: "substitute-test",
+				config: &Config{
+					Mode:             modeSubstitute,
+					SecretName:       "my-secret",
+					SecretKey:        "api-key",
+					HeaderName:       "Authorization",
+					Placeholder:      defaultPlaceholder,
+					PlaceholderInURL: tt.placeholderInURL,
+					Namespace:        "default",
+					CacheTTL:         300,
+				},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{ttl: 300 * time.Second},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			for _, value := range tt.header {
+				req.Header.Add("Authorization", value)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", rw.Code)
+			}
+			got := captured.Header.Values("Authorization")
+			if len(got) != len(tt.expectedHeader) {
+				t.Fatalf("Expected Authorization %q, got %q", tt.expectedHeader, got)
+			}
+			for i := range got {
+				if got[i] != tt.expectedHeader[i] {
+					t.Errorf("Expected Authorization %q, got %q", tt.expectedHeader, got)
+				}
+			}
+			if uri := captured.URL.RequestURI(); uri != tt.expectedURI {
+				t.Errorf("Expected URI %q, got %q", tt.expectedURI, uri)
+			}
+			if captured.RequestURI != captured.URL.RequestURI() {
+				t.Errorf("Expected RequestURI %q to follow the URL, got %q", captured.URL.RequestURI(), captured.RequestURI)
+			}
+			if tt.expectedQuery != "" {
+				if key := captured.URL.Query().Get("key"); key != tt.expectedQuery {
+					t.Errorf("Expected query key %q, got %q", tt.expectedQuery, key)
+				}
+			}
+		})
+	}
+}
+
+// TestValidateSubstituteConfig tests mode substitute configuration checks.
+func TestValidateSubstituteConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "substitute", config: &Config{Mode: modeSubstitute, Placeholder: defaultPlaceholder}},
+		{name: "inject", config: &Config{Mode: modeInject}},
+		{name: "placeholder outside mode", config: &Config{Placeholder: "<key>"}, expectError: true},
+		{name: "URL outside mode", config: &Config{PlaceholderInURL: true}, expectError: true},
+		{name: "value prefix", config: &Config{Mode: modeSubstitute, ValuePrefix: "Bearer "}, expectError: true},
+		{name: "preserve existing header", config: &Config{Mode: modeSubstitute, PreserveExistingHeader: true}, expectError: true},
+		{name: "key pattern", config: &Config{Mode: modeSubstitute, SecretKeyPattern: "(.+)"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSubstituteConfig(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
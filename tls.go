@@ -0,0 +1,87 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions maps the accepted tlsMinVersion values.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsCurves maps the accepted tlsCurvePreferences values.
+var tlsCurves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// buildTLSConfig returns the TLS settings for outbound connections to the Kubernetes API
+// and other providers, rejecting unknown names and combinations that cannot be honoured.
+func buildTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if config.TLSMinVersion != "" {
+		version, ok := tlsVersions[config.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported tlsMinVersion %q, expected 1.2 or 1.3", config.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(config.TLSCipherSuites) > 0 {
+		// Go does not allow configuring TLS 1.3 suites, so a 1.3-only policy with a suite list
+		// would silently ignore it
+		if tlsConfig.MinVersion == tls.VersionTLS13 {
+			return nil, fmt.Errorf("tlsCipherSuites cannot be set with tlsMinVersion 1.3: TLS 1.3 cipher suites are not configurable")
+		}
+
+		secure := make(map[string]*tls.CipherSuite)
+		for _, suite := range tls.CipherSuites() {
+			secure[suite.Name] = suite
+		}
+		insecure := make(map[string]bool)
+		for _, suite := range tls.InsecureCipherSuites() {
+			insecure[suite.Name] = true
+		}
+
+		for _, name := range config.TLSCipherSuites {
+			suite, ok := secure[name]
+			switch {
+			case insecure[name]:
+				return nil, fmt.Errorf("tlsCipherSuites: %s is insecure", name)
+			case !ok:
+				return nil, fmt.Errorf("tlsCipherSuites: unknown cipher suite %q", name)
+			case !supportsTLS12(suite):
+				return nil, fmt.Errorf("tlsCipherSuites: %s is a TLS 1.3 suite and cannot be configured", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, suite.ID)
+		}
+	}
+
+	for _, name := range config.TLSCurvePreferences {
+		curve, ok := tlsCurves[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("tlsCurvePreferences: unknown curve %q, expected one of X25519, P256, P384, P521", name)
+		}
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, curve)
+	}
+
+	return tlsConfig, nil
+}
+
+// supportsTLS12 reports whether a cipher suite applies to TLS 1.2 connections.
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+// TestBuildTLSConfig tests TLS policy parsing and rejection of impossible combinations.
+func TestBuildTLSConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *Config
+		expectedMin    uint16
+		expectedSuites int
+		expectedCurves []tls.CurveID
+		expectError    bool
+	}{
+		{
+			name:        "default policy",
+			config:      &Config{},
+			expectedMin: tls.VersionTLS12,
+		},
+		{
+			name:           "TLS 1.3 only with curves",
+			config:         &Config{TLSMinVersion: "1.3", TLSCurvePreferences: []string{"X25519", "p384"}},
+			expectedMin:    tls.VersionTLS13,
+			expectedCurves: []tls.CurveID{tls.X25519, tls.CurveP384},
+		},
+		{
+			name: "TLS 1.2 cipher suite allowlist",
+			config: &Config{TLSCipherSuites: []string{
+				"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+				"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			}},
+			expectedMin:    tls.VersionTLS12,
+			expectedSuites: 2,
+		},
+		{
+			name:        "unknown version",
+			config:      &Config{TLSMinVersion: "1.1"},
+			expectError: true,
+		},
+		{
+			name:        "cipher suites with TLS 1.3 only",
+			config:      &Config{TLSMinVersion: "1.3", TLSCipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"}},
+			expectError: true,
+		},
+		{
+			name:        "TLS 1.3 suite in allowlist",
+			config:      &Config{TLSCipherSuites: []string{"TLS_AES_128_GCM_SHA256"}},
+			expectError: true,
+		},
+		{
+			name:        "insecure suite",
+			config:      &Config{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+			expectError: true,
+		},
+		{
+			name:        "unknown suite",
+			config:      &Config{TLSCipherSuites: []string{"TLS_MADE_UP"}},
+			expectError: true,
+		},
+		{
+			name:        "unknown curve",
+			config:      &Config{TLSCurvePreferences: []string{"P224"}},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := buildTLSConfig(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tlsConfig.MinVersion != tt.expectedMin {
+				t.Errorf("Expected min version %x, got %x", tt.expectedMin, tlsConfig.MinVersion)
+			}
+			if len(tlsConfig.CipherSuites) != tt.expectedSuites {
+				t.Errorf("Expected %d cipher suites, got %d", tt.expectedSuites, len(tlsConfig.CipherSuites))
+			}
+			if len(tlsConfig.CurvePreferences) != len(tt.expectedCurves) {
+				t.Fatalf("Expected curves %v, got %v", tt.expectedCurves, tlsConfig.CurvePreferences)
+			}
+			for i := range tt.expectedCurves {
+				if tlsConfig.CurvePreferences[i] != tt.expectedCurves[i] {
+					t.Errorf("Expected curves %v, got %v", tt.expectedCurves, tlsConfig.CurvePreferences)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultTokenExpiration is the requested lifetime of service account tokens, in seconds.
+const defaultTokenExpiration = 3600
+
+// minTokenExpiration is the shortest lifetime the TokenRequest API grants, in seconds.
+const minTokenExpiration = 600
+
+// validateServiceAccountTokenConfig checks the settings of serviceAccountToken mode.
+func validateServiceAccountTokenConfig(config *Config) error {
+	if config.TokenServiceAccount == "" {
+		return fmt.Errorf("tokenServiceAccount is required in mode %q", modeServiceAccountToken)
+	}
+	if config.SecretName != "" || config.SecretKey != "" {
+		return fmt.Errorf("mode %q mints tokens and cannot use secretName or secretKey", modeServiceAccountToken)
+	}
+	switch {
+	case config.TokenExpirationSeconds == 0:
+		config.TokenExpirationSeconds = defaultTokenExpiration
+	case config.TokenExpirationSeconds < minTokenExpiration:
+		return fmt.Errorf("tokenExpirationSeconds must be at least %d, got %d", minTokenExpiration, config.TokenExpirationSeconds)
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("mode %q cannot use source %q", modeServiceAccountToken, config.Source)
+	}
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || config.Prefetch || config.StrictStartup || config.RBACPreflight ||
+		len(config.FallbackSources) > 0 || config.FallbackValue != "" {
+		return fmt.Errorf("mode %q cannot be combined with jwtClaim, secretNameHeader, prefetch, strictStartup, rbacPreflight or fallbacks",
+			modeServiceAccountToken)
+	}
+	return nil
+}
+
+// tokenRequest is the subset of an authentication.k8s.io/v1 TokenRequest used by the plugin.
+type tokenRequest struct {
+	APIVersion string              `json:"apiVersion"`
+	Kind       string              `json:"kind"`
+	Spec       tokenRequestSpec    `json:"spec"`
+	Status     *tokenRequestStatus `json:"status,omitempty"`
+}
+
+type tokenRequestSpec struct {
+	Audiences         []string `json:"audiences,omitempty"`
+	ExpirationSeconds int64    `json:"expirationSeconds"`
+}
+
+type tokenRequestStatus struct {
+	Token               string    `json:"token"`
+	ExpirationTimestamp time.Time `json:"expirationTimestamp"`
+}
+
+// createToken requests a token for a service account through the TokenRequest API.
+func (c *k8sClient) createToken(ctx context.Context, namespace, account string, spec tokenRequestSpec) (*tokenRequestStatus, error) {
+	if err := c.namespaces.check(namespace); err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/serviceaccounts/%s/token", c.baseURL, namespace, account)
+	request := &tokenRequest{APIVersion: "authentication.k8s.io/v1", Kind: "TokenRequest", Spec: spec}
+	var response tokenRequest
+	if err := c.do(ctx, http.MethodPost, url, request, &response); err != nil {
+		return nil, err
+	}
+	if response.Status == nil || response.Status.Token == "" {
+		return nil, fmt.Errorf("TokenRequest for service account %s/%s returned no token", namespace, account)
+	}
+	return response.Status, nil
+}
+
+// serviceAccountToken returns a token of tokenServiceAccount bound to tokenAudiences, so
+// upstream services can verify the gateway with a TokenReview. The token is renewed once 80%
+// of its lifetime has passed, as the kubelet does for projected tokens.
+func (s *SecretHeader) serviceAccountToken(ctx context.Context) (string, error) {
+	refreshAhead := time.Duration(s.config.TokenExpirationSeconds) * time.Second / 5
+	return s.tokens.get(ctx, refreshAhead, s.requestServiceAccountToken)
+}
+
+// requestServiceAccountToken mints a token of tokenServiceAccount.
+func (s *SecretHeader) requestServiceAccountToken(ctx context.Context) (string, time.Time, error) {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	status, err := client.createToken(ctx, s.config.Namespace, s.config.TokenServiceAccount, tokenRequestSpec{
+		Audiences:         s.config.TokenAudiences,
+		ExpirationSeconds: int64(s.config.TokenExpirationSeconds),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to request token for service account %s/%s: %w",
+			s.config.Namespace, s.config.TokenServiceAccount, err)
+	}
+	return status.Token, status.ExpirationTimestamp, nil
+}
@@ -0,0 +1,114 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPServiceAccountToken tests minting, caching and renewal of service account tokens.
+func TestServeHTTPServiceAccountToken(t *testing.T) {
+	var calls int
+	mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v1/namespaces/traefik/serviceaccounts/gateway/token" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var request tokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Fatal(err)
+		}
+		if request.Kind != "TokenRequest" || !reflect.DeepEqual(request.Spec.Audiences, []string{"orders-api"}) || request.Spec.ExpirationSeconds != 3600 {
+			t.Errorf("Unexpected token request %+v", request)
+		}
+		calls++
+		request.Status = &tokenRequestStatus{
+			Token:               fmt.Sprintf("sa-token-%d", calls),
+			ExpirationTimestamp: time.Now().Add(time.Hour).UTC().Truncate(time.Second),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(request)
+	}))
+	defer mockServer.Close()
+
+	var injected string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			injected = req.Header.Get("Authorization")
+		}),
+		name: "service-account-token-test",
+		config: &Config{
+			Mode:                   modeServiceAccountToken,
+			HeaderName:             "Authorization",
+			ValuePrefix:            "Bearer ",
+			Namespace:              "traefik",
+			TokenServiceAccount:    "gateway",
+			TokenAudiences:         []string{"orders-api"},
+			TokenExpirationSeconds: 3600,
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:  &secretCache{ttl: 300 * time.Second},
+		tokens: &tokenSource{},
+	}
+
+	steps := []struct {
+		name          string
+		expires       time.Duration // moves the cached token's expiry when set
+		expectedToken string
+		expectedCalls int
+	}{
+		{name: "minted", expectedToken: "sa-token-1", expectedCalls: 1},
+		{name: "cached", expectedToken: "sa-token-1", expectedCalls: 1},
+		{name: "over 80% of lifetime", expires: 10 * time.Minute, expectedToken: "sa-token-2", expectedCalls: 2},
+	}
+	for _, step := range steps {
+		if step.expires != 0 {
+			handler.tokens.expires = time.Now().Add(step.expires)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", step.name, rr.Code)
+		}
+		if injected != "Bearer "+step.expectedToken || calls != step.expectedCalls {
+			t.Errorf("%s: expected %q after %d calls, got %q after %d", step.name, step.expectedToken, step.expectedCalls, injected, calls)
+		}
+	}
+}
+
+// TestValidateServiceAccountTokenConfig tests serviceAccountToken mode checks.
+func TestValidateServiceAccountTokenConfig(t *testing.T) {
+	tests := []struct {
+		name               string
+		config             *Config
+		expectError        bool
+		expectedExpiration int
+	}{
+		{name: "defaults", config: &Config{TokenServiceAccount: "gateway"}, expectedExpiration: defaultTokenExpiration},
+		{name: "no service account", config: &Config{}, expectError: true},
+		{name: "secret name", config: &Config{TokenServiceAccount: "gateway", SecretName: "api-credentials"}, expectError: true},
+		{name: "short expiration", config: &Config{TokenServiceAccount: "gateway", TokenExpirationSeconds: 60}, expectError: true},
+		{name: "vault source", config: &Config{TokenServiceAccount: "gateway", Source: sourceVault}, expectError: true},
+		{name: "prefetch", config: &Config{TokenServiceAccount: "gateway", Prefetch: true}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Mode = modeServiceAccountToken
+			err := validateServiceAccountTokenConfig(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Expected error %v, got %v", tt.expectError, err)
+			}
+			if !tt.expectError && tt.config.TokenExpirationSeconds != tt.expectedExpiration {
+				t.Errorf("Expected expiration %d, got %d", tt.expectedExpiration, tt.config.TokenExpirationSeconds)
+			}
+		})
+	}
+}
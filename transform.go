@@ -0,0 +1,280 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// transform turns a value into the input of the next step of a valuePipeline.
+type transform func(value string) (string, error)
+
+// transformFactory creates a transform from the argument following the colon in its
+// transforms entry, "" without one.
+type transformFactory func(arg string) (transform, error)
+
+// transformRegistry holds the transforms by the name used in Config.Transforms. A new
+// transform only needs an entry here.
+var transformRegistry = map[string]transformFactory{
+	"trim":         fixedTransform(trimTransform),
+	"base64":       fixedTransform(base64Transform),
+	"base64Decode": fixedTransform(base64DecodeTransform),
+	"jsonPath":     newJSONPathTransform,
+	"prefix":       newPrefixTransform,
+	"suffix":       newSuffixTransform,
+	"certificate":  newCertificateTransform,
+	"sha256":       newSHA256Transform,
+}
+
+// transformStep is one entry of a valuePipeline.
+type transformStep struct {
+	entry string // as configured, e.g. "jsonPath:$.token"
+	fn    transform
+}
+
+// valuePipeline is the list of transforms applied in order to a value before it is injected.
+type valuePipeline []transformStep
+
+// newValuePipeline builds the transforms applied to injected values: certificateField and
+// trimValue, expressed as the equivalent transforms, followed by Config.Transforms.
+func newValuePipeline(config *Config) (valuePipeline, error) {
+	var entries []string
+	if config.CertificateField != "" {
+		entries = append(entries, "certificate:"+config.CertificateField)
+	}
+	if config.TrimValue {
+		entries = append(entries, "trim")
+	}
+	entries = append(entries, config.Transforms...)
+
+	pipeline := make(valuePipeline, 0, len(entries))
+	for _, entry := range entries {
+		name, arg := entry, ""
+		if i := strings.IndexByte(entry, ':'); i >= 0 {
+			name, arg = entry[:i], entry[i+1:]
+		}
+		factory, ok := transformRegistry[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown transform %q", name)
+		}
+		fn, err := factory(arg)
+		if err != nil {
+			return nil, fmt.Errorf("transform %s: %w", entry, err)
+		}
+		pipeline = append(pipeline, transformStep{entry: entry, fn: fn})
+	}
+	return pipeline, nil
+}
+
+// apply runs value through the pipeline. Errors name the failing step, never the value.
+func (p valuePipeline) apply(value string) (string, error) {
+	for _, step := range p {
+		var err error
+		if value, err = step.fn(value); err != nil {
+			return "", fmt.Errorf("transform %s: %w", step.entry, err)
+		}
+	}
+	return value, nil
+}
+
+// fixedTransform returns the factory of a transform taking no argument.
+func fixedTransform(fn transform) transformFactory {
+	return func(arg string) (transform, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("takes no argument")
+		}
+		return fn, nil
+	}
+}
+
+// trimTransform removes the whitespace around value.
+func trimTransform(value string) (string, error) {
+	return strings.TrimSpace(value), nil
+}
+
+// base64Transform encodes value in standard base64.
+func base64Transform(value string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(value)), nil
+}
+
+// base64DecodeTransform decodes standard base64, padded or not.
+func base64DecodeTransform(value string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		decoded, err = base64.RawStdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		return "", fmt.Errorf("value is not valid base64")
+	}
+	return string(decoded), nil
+}
+
+// transformText returns the text argument of prefix and suffix, which may be quoted to keep
+// surrounding spaces, e.g. prefix:"Bearer ".
+func transformText(arg string) (string, error) {
+	if arg == "" {
+		return "", fmt.Errorf("requires a text argument")
+	}
+	if strings.HasPrefix(arg, `"`) {
+		text, err := strconv.Unquote(arg)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted text %s", arg)
+		}
+		return text, nil
+	}
+	return arg, nil
+}
+
+// newPrefixTransform returns a transform prepending the text argument.
+func newPrefixTransform(arg string) (transform, error) {
+	text, err := transformText(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) (string, error) {
+		return text + value, nil
+	}, nil
+}
+
+// newSuffixTransform returns a transform appending the text argument.
+func newSuffixTransform(arg string) (transform, error) {
+	text, err := transformText(arg)
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) (string, error) {
+		return value + text, nil
+	}, nil
+}
+
+// newCertificateTransform returns a transform replacing a PEM certificate with one of the
+// certificateField values.
+func newCertificateTransform(field string) (transform, error) {
+	switch field {
+	case certFieldFingerprint, certFieldSPKIPin, certFieldSubject, certFieldPublicKey:
+	default:
+		return nil, fmt.Errorf("unknown certificate field %q", field)
+	}
+	fields := &certFields{}
+	return func(value string) (string, error) {
+		cert, err := fields.certificate(value)
+		if err != nil {
+			return "", err
+		}
+		return certificateField(cert, field)
+	}, nil
+}
+
+// newSHA256Transform returns a transform replacing value with its SHA-256 digest, in hex by
+// default or in standard base64 with the base64 argument.
+func newSHA256Transform(encoding string) (transform, error) {
+	var encode func([]byte) string
+	switch encoding {
+	case "", "hex":
+		encode = hex.EncodeToString
+	case "base64":
+		encode = base64.StdEncoding.EncodeToString
+	default:
+		return nil, fmt.Errorf("unknown encoding %q, expected hex or base64", encoding)
+	}
+	return func(value string) (string, error) {
+		sum := sha256.Sum256([]byte(value))
+		return encode(sum[:]), nil
+	}, nil
+}
+
+// jsonPathStep is an object key or, for array steps, a position of a JSON path.
+type jsonPathStep struct {
+	key   string
+	index int
+	array bool
+}
+
+// newJSONPathTransform returns a transform replacing a JSON document with the value at the
+// path argument, e.g. $.credentials.token, $.keys[0] or $['api-key']. Strings are returned
+// as is, other values as JSON.
+func newJSONPathTransform(path string) (transform, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return func(value string) (string, error) {
+		var node interface{}
+		if err := json.Unmarshal([]byte(value), &node); err != nil {
+			return "", fmt.Errorf("value is not valid JSON")
+		}
+		for _, step := range steps {
+			switch current := node.(type) {
+			case map[string]interface{}:
+				next, ok := current[step.key]
+				if step.array || !ok {
+					return "", fmt.Errorf("no value at %s", path)
+				}
+				node = next
+			case []interface{}:
+				if !step.array || step.index >= len(current) {
+					return "", fmt.Errorf("no value at %s", path)
+				}
+				node = current[step.index]
+			default:
+				return "", fmt.Errorf("no value at %s", path)
+			}
+		}
+		if text, ok := node.(string); ok {
+			return text, nil
+		}
+		encoded, err := json.Marshal(node)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	}, nil
+}
+
+// parseJSONPath parses the subset of JSONPath made of $ followed by .key, ['key'] and [n].
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSON path %q must start with $", path)
+	}
+
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSON path %q has an empty key", path)
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSON path %q has an unterminated [", path)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, jsonPathStep{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("JSON path %q has an invalid index %q", path, inner)
+			}
+			steps = append(steps, jsonPathStep{index: index, array: true})
+		default:
+			return nil, fmt.Errorf("JSON path %q is not supported", path)
+		}
+	}
+	return steps, nil
+}
@@ -0,0 +1,186 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestValuePipeline tests transforms applied in order.
+func TestValuePipeline(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		value       string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "no transforms",
+			config:   &Config{},
+			value:    " token\n",
+			expected: " token\n",
+		},
+		{
+			name:     "trim before configured transforms",
+			config:   &Config{TrimValue: true, Transforms: []string{`prefix:"Bearer "`}},
+			value:    "token\n",
+			expected: "Bearer token",
+		},
+		{
+			name:     "json path",
+			config:   &Config{Transforms: []string{"jsonPath:$.credentials.token"}},
+			value:    `{"credentials":{"token":"abc","expires":3600}}`,
+			expected: "abc",
+		},
+		{
+			name:     "json path index and quoted key",
+			config:   &Config{Transforms: []string{"jsonPath:$.keys[1]['api-key']"}},
+			value:    `{"keys":[{"api-key":"old"},{"api-key":"new"}]}`,
+			expected: "new",
+		},
+		{
+			name:     "json path to a number",
+			config:   &Config{Transforms: []string{"jsonPath:$.credentials.expires"}},
+			value:    `{"credentials":{"token":"abc","expires":3600}}`,
+			expected: "3600",
+		},
+		{
+			name:     "base64 round trip and suffix",
+			config:   &Config{Transforms: []string{"base64", "base64Decode", "suffix:@example.com"}},
+			value:    "user",
+			expected: "user@example.com",
+		},
+		{
+			name:     "decode then wrap",
+			config:   &Config{Transforms: []string{"base64Decode", "jsonPath:$.token", "prefix:Token="}},
+			value:    "eyJ0b2tlbiI6ImFiYyJ9",
+			expected: "Token=abc",
+		},
+		{
+			name:     "sha256 hex",
+			config:   &Config{Transforms: []string{"sha256"}},
+			value:    "abc",
+			expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+		{
+			name:     "sha256 base64 after trim",
+			config:   &Config{TrimValue: true, Transforms: []string{"sha256:base64"}},
+			value:    "abc\n",
+			expected: "ungWv48Bz+pBQUDeXa4iI7ADYaOWF3qctBD/YfIAFa0=",
+		},
+		{
+			name:        "missing json key",
+			config:      &Config{Transforms: []string{"jsonPath:$.token"}},
+			value:       `{"other":"abc"}`,
+			expectError: true,
+		},
+		{
+			name:        "not JSON",
+			config:      &Config{Transforms: []string{"jsonPath:$.token"}},
+			value:       "abc",
+			expectError: true,
+		},
+		{
+			name:        "invalid base64",
+			config:      &Config{Transforms: []string{"base64Decode"}},
+			value:       "not base64!",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := newValuePipeline(tt.config)
+			if err != nil {
+				t.Fatalf("Expected no error building the pipeline, got %v", err)
+			}
+			value, err := pipeline.apply(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, value)
+			}
+		})
+	}
+}
+
+// TestNewValuePipelineErrors tests that invalid transforms fail the configuration.
+func TestNewValuePipelineErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		transforms []string
+	}{
+		{name: "unknown transform", transforms: []string{"rot13"}},
+		{name: "unexpected argument", transforms: []string{"trim:all"}},
+		{name: "missing text", transforms: []string{"prefix"}},
+		{name: "bad quoting", transforms: []string{`prefix:"Bearer `}},
+		{name: "relative json path", transforms: []string{"jsonPath:token"}},
+		{name: "bad json index", transforms: []string{"jsonPath:$.keys[-1]"}},
+		{name: "unterminated json index", transforms: []string{"jsonPath:$.keys[0"}},
+		{name: "unknown hash encoding", transforms: []string{"sha256:base32"}},
+		{name: "unknown certificate field", transforms: []string{"certificate:issuer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newValuePipeline(&Config{Transforms: tt.transforms}); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+}
+
+// TestServeHTTPTransforms tests that the transformed value is injected.
+func TestServeHTTPTransforms(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{"credentials.json": "{\"token\": \"abc\"}\n"}, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName: "my-secret",
+		SecretKey:  "credentials.json",
+		HeaderName: "Authorization",
+		Namespace:  "default",
+		CacheTTL:   300,
+		TrimValue:  true,
+		Transforms: []string{"jsonPath:$.token", `prefix:"Bearer "`},
+	}
+	transforms, err := newValuePipeline(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			header = req.Header.Get("Authorization")
+		}),
+		name:   "transforms-test",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:      &secretCache{ttl: 300 * time.Second},
+		transforms: transforms,
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if rw.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rw.Code)
+	}
+	if header != "Bearer abc" {
+		t.Errorf("Expected %q, got %q", "Bearer abc", header)
+	}
+}
@@ -0,0 +1,118 @@
+package traefik_k8s_secret_header
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Supported values for Config.APIHTTP2.
+const (
+	apiHTTP2Disable = "disable"
+	apiHTTP2Force   = "force"
+)
+
+// Defaults of the API transport, those of http.DefaultTransport for a single host.
+const (
+	defaultAPIMaxIdleConns     = 2
+	defaultAPIIdleConnTimeout  = 90
+	defaultAPIHandshakeTimeout = 10 * time.Second
+)
+
+// validateAPITransport checks the connection pool settings of the Kubernetes API client.
+func validateAPITransport(config *Config) error {
+	if config.APIMaxIdleConns < 0 {
+		return fmt.Errorf("apiMaxIdleConns cannot be negative")
+	}
+	if config.APIIdleConnTimeout < 0 {
+		return fmt.Errorf("apiIdleConnTimeout cannot be negative")
+	}
+	switch config.APIHTTP2 {
+	case "", apiHTTP2Disable, apiHTTP2Force:
+	default:
+		return fmt.Errorf("apiHTTP2 must be %q or %q", apiHTTP2Disable, apiHTTP2Force)
+	}
+	return nil
+}
+
+// apiTransport is a connection pool to the Kubernetes API, with the recycler closing its
+// idle connections.
+type apiTransport struct {
+	transport *http.Transport
+	recycler  *connRecycler
+}
+
+// apiTransportRegistry holds the API transports shared by middleware instances, so every
+// middleware of the process reuses the same connections instead of dialing and handshaking
+// its own. Transports outlive the instances, so they also survive configuration reloads.
+type apiTransportRegistry struct {
+	mu         sync.Mutex
+	transports map[string]*apiTransport // by apiTransportScope
+}
+
+// apiTransports is the process-wide registry.
+var apiTransports = &apiTransportRegistry{transports: make(map[string]*apiTransport)}
+
+// apiTransportScope identifies the instances that may share a transport: the same server,
+// trust, client certificate, proxy and TLS and pool settings. Credentials sent in headers,
+// such as the token or the impersonated user, are set per request and may differ.
+func apiTransportScope(config *Config, tlsConfig *tls.Config, baseURL string, caCert []byte) string {
+	sum := sha256.Sum256(caCert)
+	return fmt.Sprintf("%q", []string{
+		baseURL, hex.EncodeToString(sum[:]),
+		fmt.Sprint(tlsConfig.MinVersion), fmt.Sprint(tlsConfig.CipherSuites), fmt.Sprint(tlsConfig.CurvePreferences),
+		config.APIClientCertFile, config.APIClientKeyFile, config.APIProxyURL,
+		fmt.Sprint(config.APIMaxIdleConns), fmt.Sprint(config.APIIdleConnTimeout), config.APIHTTP2,
+		fmt.Sprint(config.APIMaxConnectionAge),
+	})
+}
+
+// get returns the transport of scope, creating it with create on first use.
+func (r *apiTransportRegistry) get(scope string, create func() (*apiTransport, error)) (*apiTransport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if transport, ok := r.transports[scope]; ok {
+		return transport, nil
+	}
+	transport, err := create()
+	if err != nil {
+		return nil, err
+	}
+	r.transports[scope] = transport
+	return transport, nil
+}
+
+// newAPITransport returns a transport to the Kubernetes API with the pool settings of config.
+func newAPITransport(config *Config, tlsConfig *tls.Config) *apiTransport {
+	maxIdle := config.APIMaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = defaultAPIMaxIdleConns
+	}
+	idleTimeout := config.APIIdleConnTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultAPIIdleConnTimeout
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		Proxy:               apiProxy(config),
+		MaxIdleConns:        maxIdle,
+		MaxIdleConnsPerHost: maxIdle,
+		IdleConnTimeout:     time.Duration(idleTimeout) * time.Second,
+		TLSHandshakeTimeout: defaultAPIHandshakeTimeout,
+	}
+	// A custom TLS configuration disables Go's automatic HTTP/2, so HTTP/1.1 is the default
+	if config.APIHTTP2 == apiHTTP2Force {
+		transport.ForceAttemptHTTP2 = true
+	}
+
+	return &apiTransport{
+		transport: transport,
+		recycler:  &connRecycler{maxAge: time.Duration(config.APIMaxConnectionAge) * time.Second},
+	}
+}
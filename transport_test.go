@@ -0,0 +1,145 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// apiServerWithCertificate starts a TLS API server requiring a client certificate, points
+// the client environment to it and returns a config authenticating with a certificate.
+func apiServerWithCertificate(t *testing.T, handler http.HandlerFunc) *Config {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBERNETES_SERVICE_HOST", host)
+	t.Setenv("KUBERNETES_SERVICE_PORT", port)
+
+	certFile, keyFile := writeClientCertificate(t, dir, "traefik")
+	return &Config{APIClientCertFile: certFile, APIClientKeyFile: keyFile, APICAFile: caFile}
+}
+
+// TestAPITransportShared tests that instances with the same settings reuse one connection.
+func TestAPITransportShared(t *testing.T) {
+	connections := make(map[string]bool)
+	config := apiServerWithCertificate(t, func(w http.ResponseWriter, r *http.Request) {
+		connections[r.RemoteAddr] = true
+		json.NewEncoder(w).Encode(k8sSecret{Data: map[string]string{}})
+	})
+
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := newK8sClient(tlsConfig, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newK8sClient(tlsConfig, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.httpClient.Transport != second.httpClient.Transport || first.recycler != second.recycler {
+		t.Fatal("Expected instances with the same settings to share the transport")
+	}
+
+	for _, client := range []*k8sClient{first, second, first} {
+		if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(connections) != 1 {
+		t.Errorf("Expected 1 connection, got %d", len(connections))
+	}
+
+	tuned := *config
+	tuned.APIMaxIdleConns = 8
+	other, err := newK8sClient(tlsConfig, &tuned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := other.httpClient.Transport.(*http.Transport)
+	if transport == first.httpClient.Transport || transport.MaxIdleConnsPerHost != 8 {
+		t.Errorf("Expected a separate transport keeping 8 idle connections, got %d", transport.MaxIdleConnsPerHost)
+	}
+}
+
+// TestAPITransportHTTP2 tests the protocol selected by apiHTTP2.
+func TestAPITransportHTTP2(t *testing.T) {
+	tests := []struct {
+		name          string
+		http2         string
+		expectedProto int
+	}{
+		{name: "default", expectedProto: 1},
+		{name: "disable", http2: "disable", expectedProto: 1},
+		{name: "force", http2: "force", expectedProto: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proto int
+			config := apiServerWithCertificate(t, func(w http.ResponseWriter, r *http.Request) {
+				proto = r.ProtoMajor
+				json.NewEncoder(w).Encode(k8sSecret{Data: map[string]string{}})
+			})
+			config.APIHTTP2 = tt.http2
+
+			tlsConfig, err := buildTLSConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := newK8sClient(tlsConfig, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+				t.Fatal(err)
+			}
+			if proto != tt.expectedProto {
+				t.Errorf("Expected HTTP/%d, got HTTP/%d", tt.expectedProto, proto)
+			}
+		})
+	}
+}
+
+// TestValidateAPITransport tests the connection pool settings checks.
+func TestValidateAPITransport(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "defaults", config: &Config{}},
+		{name: "tuned", config: &Config{APIMaxIdleConns: 16, APIIdleConnTimeout: 30, APIHTTP2: "force"}},
+		{name: "negative idle conns", config: &Config{APIMaxIdleConns: -1}, expectError: true},
+		{name: "negative idle timeout", config: &Config{APIIdleConnTimeout: -1}, expectError: true},
+		{name: "unknown protocol", config: &Config{APIHTTP2: "on"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPITransport(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
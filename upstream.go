@@ -0,0 +1,43 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// validateUpstreamTLS checks requireTLSUpstream. Traefik does not expose the load balancer
+// target to middlewares, so the route's upstream is declared in upstreamURL and checked once,
+// failing startup rather than ever sending the credential in plaintext.
+func validateUpstreamTLS(config *Config) error {
+	if !config.RequireTLSUpstream {
+		if config.UpstreamURL != "" {
+			return fmt.Errorf("upstreamURL is only used with requireTLSUpstream")
+		}
+		return nil
+	}
+
+	switch config.Mode {
+	case "", modeInject, modeGenerate, modeMintJWT, modeOAuth2, modeDockerRegistry, modeSubstitute, modeServiceAccountToken, modeEnvelope:
+	default:
+		return fmt.Errorf("requireTLSUpstream is only supported in modes that inject a credential")
+	}
+
+	if config.UpstreamURL == "" {
+		return fmt.Errorf("requireTLSUpstream needs upstreamURL, the URL of the route's service")
+	}
+	upstream, err := url.Parse(config.UpstreamURL)
+	if err != nil {
+		return fmt.Errorf("invalid upstreamURL: %w", err)
+	}
+	if upstream.Scheme != "https" {
+		return fmt.Errorf("requireTLSUpstream refuses plaintext upstream %s", config.UpstreamURL)
+	}
+	return nil
+}
+
+// plaintextUpstream reports whether the request itself targets a plain HTTP URL, which is
+// the case for absolute-form (proxy) requests.
+func (s *SecretHeader) plaintextUpstream(req *http.Request) bool {
+	return s.config.RequireTLSUpstream && req.URL.IsAbs() && req.URL.Scheme != "https"
+}
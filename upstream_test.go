@@ -0,0 +1,120 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestValidateUpstreamTLS tests the requireTLSUpstream configuration checks.
+func TestValidateUpstreamTLS(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "disabled", config: &Config{}},
+		{name: "https upstream", config: &Config{RequireTLSUpstream: true, UpstreamURL: "https://orders.shop.svc:8443"}},
+		{name: "http upstream", config: &Config{RequireTLSUpstream: true, UpstreamURL: "http://orders.shop.svc:8080"}, expectError: true},
+		{name: "undeclared upstream", config: &Config{RequireTLSUpstream: true}, expectError: true},
+		{name: "upstream without requirement", config: &Config{UpstreamURL: "https://orders.shop.svc"}, expectError: true},
+		{name: "verification mode", config: &Config{RequireTLSUpstream: true, UpstreamURL: "https://orders.shop.svc", Mode: modeValidate}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpstreamTLS(tt.config)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestServeHTTPRequireTLSUpstream tests that absolute-form plaintext requests never get the credential.
+func TestServeHTTPRequireTLSUpstream(t *testing.T) {
+	secretData := map[string]string{
+		"api-key": "secret-value",
+	}
+
+	tests := []struct {
+		name           string
+		request        func() *http.Request
+		expectedStatus int
+	}{
+		{
+			name: "origin-form request",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+				req.Host = "example.com"
+				return req
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "absolute-form https request",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "https://example.com/orders", nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "absolute-form http request",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "http://example.com/orders", nil)
+			},
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:         "my-secret",
+				SecretKey:          "api-key",
+				HeaderName:         "X-API-Key",
+				Namespace:          "default",
+				CacheTTL:           300,
+				RequireTLSUpstream: true,
+				UpstreamURL:        "https://orders.shop.svc",
+			}
+
+			injected := false
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				injected = req.Header.Get("X-API-Key") != ""
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, tt.request())
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if injected != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("Expected injection %v, got %v", tt.expectedStatus == http.StatusOK, injected)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// pluginVersion is the release of this plugin, reported in the User-Agent of API requests.
+// It is kept in step with the release tag.
+const pluginVersion = "v1.0.0"
+
+// reservedAPIHeaders are set by the client itself and cannot carry the attribution.
+var reservedAPIHeaders = []string{"Authorization", "Accept", "Content-Type", "Host", "User-Agent"}
+
+// validateAPIAttribution checks the apiUserAgent and apiAttributionHeader settings. The
+// header name itself is checked with the other header names.
+func validateAPIAttribution(config *Config) error {
+	if strings.IndexFunc(config.APIUserAgent, func(r rune) bool { return r < ' ' || r == 0x7f }) >= 0 {
+		return fmt.Errorf("apiUserAgent cannot contain control characters")
+	}
+	name := http.CanonicalHeaderKey(config.APIAttributionHeader)
+	for _, reserved := range reservedAPIHeaders {
+		if name == reserved {
+			return fmt.Errorf("apiAttributionHeader cannot be %s", reserved)
+		}
+	}
+	if strings.HasPrefix(name, "Impersonate-") {
+		return fmt.Errorf("apiAttributionHeader cannot be an Impersonate- header")
+	}
+	return nil
+}
+
+// apiAttribution identifies the middleware behind its Kubernetes API requests, so the
+// audit log of the cluster, which records the User-Agent, ties each secret read to it.
+type apiAttribution struct {
+	userAgent string
+	header    string // extra header carrying the middleware name, if configured
+	name      string
+}
+
+// newAPIAttribution returns the attribution of the middleware called name.
+func newAPIAttribution(config *Config, name string) *apiAttribution {
+	userAgent := config.APIUserAgent
+	if userAgent == "" {
+		userAgent = fmt.Sprintf("traefik-k8s-secret-header/%s (middleware %s)", pluginVersion, name)
+	}
+	return &apiAttribution{userAgent: userAgent, header: config.APIAttributionHeader, name: name}
+}
+
+// apply sets the attribution headers in header. It does nothing on a nil attribution.
+func (a *apiAttribution) apply(header http.Header) {
+	if a == nil {
+		return
+	}
+	header.Set("User-Agent", a.userAgent)
+	if a.header != "" {
+		header.Set(a.header, a.name)
+	}
+}
@@ -0,0 +1,82 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAPIAttributionHeaders tests that API requests name the plugin and the middleware.
+func TestAPIAttributionHeaders(t *testing.T) {
+	tests := []struct {
+		name                string
+		config              *Config
+		expectedUserAgent   string
+		expectedAttribution string
+	}{
+		{
+			name:              "default",
+			config:            &Config{},
+			expectedUserAgent: "traefik-k8s-secret-header/" + pluginVersion + " (middleware default-api-auth@kubernetescrd)",
+		},
+		{
+			name:                "configured",
+			config:              &Config{APIUserAgent: "traefik-edge/payments", APIAttributionHeader: "X-Traefik-Middleware"},
+			expectedUserAgent:   "traefik-edge/payments",
+			expectedAttribution: "default-api-auth@kubernetescrd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userAgent, attribution string
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userAgent = r.Header.Get("User-Agent")
+				attribution = r.Header.Get("X-Traefik-Middleware")
+				w.Write([]byte(`{"data":{}}`))
+			}))
+			defer mockServer.Close()
+
+			client := &k8sClient{
+				httpClient:  mockServer.Client(),
+				baseURL:     mockServer.URL,
+				token:       "test-token",
+				attribution: newAPIAttribution(tt.config, "default-api-auth@kubernetescrd"),
+			}
+			if _, err := client.getSecret(t.Context(), "default", "my-secret"); err != nil {
+				t.Fatal(err)
+			}
+			if userAgent != tt.expectedUserAgent {
+				t.Errorf("Expected User-Agent %q, got %q", tt.expectedUserAgent, userAgent)
+			}
+			if attribution != tt.expectedAttribution {
+				t.Errorf("Expected attribution %q, got %q", tt.expectedAttribution, attribution)
+			}
+		})
+	}
+}
+
+// TestValidateAPIAttribution tests apiUserAgent and apiAttributionHeader checks.
+func TestValidateAPIAttribution(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{name: "none", config: &Config{}},
+		{name: "configured", config: &Config{APIUserAgent: "traefik-edge/1.0 (payments)", APIAttributionHeader: "X-Traefik-Middleware"}},
+		{name: "newline in user agent", config: &Config{APIUserAgent: "edge\r\nX-Injected: 1"}, expectError: true},
+		{name: "authorization", config: &Config{APIAttributionHeader: "authorization"}, expectError: true},
+		{name: "user agent header", config: &Config{APIAttributionHeader: "User-Agent"}, expectError: true},
+		{name: "impersonation", config: &Config{APIAttributionHeader: "Impersonate-User"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAPIAttribution(tt.config)
+			if (err != nil) != tt.expectError {
+				t.Errorf("Expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// validateRequest authenticates the request by comparing the presented credential with the
+// accepted secret values, forwarding it on a match and answering 401 otherwise.
+func (s *SecretHeader) validateRequest(rw http.ResponseWriter, req *http.Request, secretName, secretKey string) {
+	accepted, err := s.acceptedValues(req.Context(), secretName, secretKey)
+	if err != nil {
+		s.serveError(rw, req, err)
+		return
+	}
+
+	presented := s.presentedCredential(req)
+	matched := false
+	for _, value := range accepted {
+		// Compare against every value so timing does not reveal which one matched
+		if credentialMatches(presented, s.config.ValuePrefix+value) {
+			matched = true
+		}
+	}
+
+	if !matched {
+		metrics.inc(metricValidationFailures, "middleware", s.name)
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rejecting request with invalid %s credential\n", s.config.HeaderName)
+		if strings.EqualFold(s.config.HeaderName, "Authorization") {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(rw, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	s.next.ServeHTTP(rw, req)
+}
+
+// acceptedValues returns the secret values a credential may match. With secretKeys, keys
+// absent from the secret are skipped so a previous key can be removed once rotation is done.
+func (s *SecretHeader) acceptedValues(ctx context.Context, secretName, secretKey string) ([]string, error) {
+	if len(s.config.SecretKeys) == 0 {
+		value, err := s.getValue(ctx, secretName, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		return []string{value}, nil
+	}
+
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.fetchSecretData(ctx, client, s.config.Namespace, secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	var accepted []string
+	for _, key := range s.config.SecretKeys {
+		if value, ok := data[key]; ok && value != "" {
+			accepted = append(accepted, value)
+		}
+	}
+	if len(accepted) == 0 {
+		return nil, fmt.Errorf("none of the secret keys %v found in secret %s/%s", s.config.SecretKeys, s.config.Namespace, secretName)
+	}
+	return accepted, nil
+}
+
+// presentedCredential returns the credential sent by the client. For the Authorization header
+// without a configured valuePrefix, the bearer token is compared rather than the whole value.
+func (s *SecretHeader) presentedCredential(req *http.Request) string {
+	presented := req.Header.Get(s.config.HeaderName)
+	if s.config.ValuePrefix == "" && strings.EqualFold(s.config.HeaderName, "Authorization") {
+		return bearerToken(presented)
+	}
+	return presented
+}
+
+// credentialMatches compares in constant time. Hashing first keeps the comparison
+// independent of the expected value's length.
+func credentialMatches(presented, expected string) bool {
+	if presented == "" || expected == "" {
+		return false
+	}
+	presentedSum := sha256.Sum256([]byte(presented))
+	expectedSum := sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(presentedSum[:], expectedSum[:]) == 1
+}
@@ -0,0 +1,224 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPValidateMode tests authenticating inbound requests against the secret.
+func TestServeHTTPValidateMode(t *testing.T) {
+	secretData := map[string]string{
+		"api-key": "s3cr3t",
+	}
+
+	tests := []struct {
+		name           string
+		headerName     string
+		valuePrefix    string
+		presented      string
+		expectedStatus int
+	}{
+		{
+			name:           "matching API key is accepted",
+			headerName:     "X-Api-Key",
+			presented:      "s3cr3t",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong API key is rejected",
+			headerName:     "X-Api-Key",
+			presented:      "guess",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing API key is rejected",
+			headerName:     "X-Api-Key",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "prefix of the key is rejected",
+			headerName:     "X-Api-Key",
+			presented:      "s3cr",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "bearer token is accepted",
+			headerName:     "Authorization",
+			presented:      "Bearer s3cr3t",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong bearer token is rejected",
+			headerName:     "Authorization",
+			presented:      "Bearer nope",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "configured prefix is part of the credential",
+			headerName:     "Authorization",
+			valuePrefix:    "Token ",
+			presented:      "Token s3cr3t",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, secretData, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:  "api-keys",
+				SecretKey:   "api-key",
+				HeaderName:  tt.headerName,
+				ValuePrefix: tt.valuePrefix,
+				Namespace:   "default",
+				CacheTTL:    300,
+				Mode:        modeValidate,
+			}
+
+			nextCalled := false
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				nextCalled = true
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "validate-test",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+			if tt.presented != "" {
+				req.Header.Set(tt.headerName, tt.presented)
+			}
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, req)
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if nextCalled != (tt.expectedStatus == http.StatusOK) {
+				t.Errorf("Expected next called=%v, got %v", tt.expectedStatus == http.StatusOK, nextCalled)
+			}
+		})
+	}
+}
+
+// TestCredentialMatches tests the constant-time comparison helper.
+func TestCredentialMatches(t *testing.T) {
+	if !credentialMatches("abc", "abc") {
+		t.Error("Expected identical credentials to match")
+	}
+	if credentialMatches("abc", "abcd") {
+		t.Error("Expected different credentials not to match")
+	}
+	if credentialMatches("", "") {
+		t.Error("Expected empty credentials never to match")
+	}
+}
+
+// TestServeHTTPValidateModeMultipleKeys tests that every listed key is accepted during rotation.
+func TestServeHTTPValidateModeMultipleKeys(t *testing.T) {
+	tests := []struct {
+		name           string
+		secretData     map[string]string
+		presented      string
+		expectedStatus int
+	}{
+		{
+			name:           "current key is accepted",
+			secretData:     map[string]string{"token-current": "new", "token-previous": "old"},
+			presented:      "new",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "previous key is accepted during grace window",
+			secretData:     map[string]string{"token-current": "new", "token-previous": "old"},
+			presented:      "old",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "removed previous key is no longer accepted",
+			secretData:     map[string]string{"token-current": "new"},
+			presented:      "old",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unlisted key is not accepted",
+			secretData:     map[string]string{"token-current": "new", "admin": "root"},
+			presented:      "root",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "secret without any listed key fails",
+			secretData:     map[string]string{"other": "value"},
+			presented:      "value",
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiCalls := 0
+			mockServer := mockK8sServer(t, tt.secretData, true)
+			defer mockServer.Close()
+			countingServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				apiCalls++
+				mockServer.Config.Handler.ServeHTTP(w, r)
+			}))
+			defer countingServer.Close()
+
+			config := &Config{
+				SecretName: "api-keys",
+				SecretKeys: []string{"token-current", "token-previous"},
+				HeaderName: "X-Api-Key",
+				Namespace:  "default",
+				CacheTTL:   300,
+				Mode:       modeValidate,
+			}
+
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					rw.WriteHeader(http.StatusOK)
+				}),
+				name:   "validate-test",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: countingServer.Client(),
+					baseURL:    countingServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/test", nil)
+				req.Header.Set(config.HeaderName, tt.presented)
+				rw := httptest.NewRecorder()
+				handler.ServeHTTP(rw, req)
+
+				if rw.Code != tt.expectedStatus {
+					t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+				}
+			}
+
+			if tt.expectedStatus != http.StatusInternalServerError && apiCalls != 1 {
+				t.Errorf("Expected all keys to be served from one cached read, got %d API calls", apiCalls)
+			}
+		})
+	}
+}
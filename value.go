@@ -0,0 +1,106 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// valueRules are the format checks applied to a fetched value before it is injected.
+type valueRules struct {
+	pattern   *regexp.Regexp
+	minLength int
+	maxLength int
+	prefix    string
+	extract   bool // inject the first capture group of pattern instead of the whole value
+}
+
+// newValueRules compiles the value validation settings; it returns nil when none are set.
+func newValueRules(config *Config) (*valueRules, error) {
+	if config.ValuePattern == "" && config.ValueMinLength == 0 && config.ValueMaxLength == 0 && config.RequiredValuePrefix == "" {
+		return nil, nil
+	}
+	if config.ValueMinLength < 0 || config.ValueMaxLength < 0 {
+		return nil, fmt.Errorf("valueMinLength and valueMaxLength cannot be negative")
+	}
+	if config.ValueMaxLength > 0 && config.ValueMinLength > config.ValueMaxLength {
+		return nil, fmt.Errorf("valueMinLength cannot exceed valueMaxLength")
+	}
+
+	rules := &valueRules{
+		minLength: config.ValueMinLength,
+		maxLength: config.ValueMaxLength,
+		prefix:    config.RequiredValuePrefix,
+	}
+	if config.ValuePattern != "" {
+		pattern, err := regexp.Compile(config.ValuePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid valuePattern: %w", err)
+		}
+		rules.pattern = pattern
+		rules.extract = pattern.NumSubexp() > 0
+	}
+	return rules, nil
+}
+
+// check reports why value does not satisfy the rules. The value itself is never included.
+func (r *valueRules) check(value string) error {
+	if r == nil {
+		return nil
+	}
+	if len(value) < r.minLength {
+		return fmt.Errorf("value is shorter than %d bytes", r.minLength)
+	}
+	if r.maxLength > 0 && len(value) > r.maxLength {
+		return fmt.Errorf("value is longer than %d bytes", r.maxLength)
+	}
+	if !strings.HasPrefix(value, r.prefix) {
+		return fmt.Errorf("value does not start with the required prefix")
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value) {
+		return fmt.Errorf("value does not match valuePattern")
+	}
+	if r.extract && r.extracted(value) == "" {
+		return fmt.Errorf("valuePattern captured an empty value")
+	}
+	return nil
+}
+
+// extracted returns the part of a value satisfying the rules that is injected: the first
+// capture group of valuePattern, or the whole value when the pattern has none.
+func (r *valueRules) extracted(value string) string {
+	if r == nil || !r.extract {
+		return value
+	}
+	match := r.pattern.FindStringSubmatch(value)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// headerValue runs a value read from the secret through the transforms. Values still
+// containing CR or LF are refused, as they cannot be sent in a header.
+func (s *SecretHeader) headerValue(value string) (string, error) {
+	value, err := s.transforms.apply(value)
+	if err != nil {
+		return "", err
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("value contains a line break, which cannot be sent in a header")
+	}
+	return value, nil
+}
+
+// checkValue validates a fetched value, counting failures, so a wrong key rotated into the
+// secret is caught before it reaches the upstream. It returns the part of the value to inject.
+func (s *SecretHeader) checkValue(value, secretName, secretKey string) (string, error) {
+	if err := s.valueRules.check(value); err != nil {
+		metrics.inc(metricValueRejections, "middleware", s.name)
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rejected value of key '%s' in secret %s/%s: %v\n",
+			secretKey, s.config.Namespace, secretName, err)
+		return "", fmt.Errorf("secret %s/%s key '%s' failed value validation", s.config.Namespace, secretName, secretKey)
+	}
+	return s.valueRules.extracted(value), nil
+}
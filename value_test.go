@@ -0,0 +1,257 @@
+package traefik_k8s_secret_header
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestValueRules tests the value format checks.
+func TestValueRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		value       string
+		expectError bool
+	}{
+		{name: "no rules", config: &Config{}, value: "anything"},
+		{name: "prefix matches", config: &Config{RequiredValuePrefix: "sk_live_"}, value: "sk_live_abc"},
+		{name: "prefix mismatch", config: &Config{RequiredValuePrefix: "sk_live_"}, value: "sk_test_abc", expectError: true},
+		{name: "too short", config: &Config{ValueMinLength: 8}, value: "short", expectError: true},
+		{name: "too long", config: &Config{ValueMaxLength: 4}, value: "too-long", expectError: true},
+		{name: "pattern matches", config: &Config{ValuePattern: `^[0-9a-f]{8}$`}, value: "deadbeef"},
+		{name: "pattern mismatch", config: &Config{ValuePattern: `^[0-9a-f]{8}$`}, value: "not-hex!", expectError: true},
+		{name: "capture group", config: &Config{ValuePattern: `^[a-z]+:(.*)$`}, value: "user:token"},
+		{name: "empty capture", config: &Config{ValuePattern: `^[a-z]+:(.*)$`}, value: "user:", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newValueRules(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to build rules: %v", err)
+			}
+			err = rules.check(tt.value)
+			if tt.expectError && err == nil {
+				t.Error("Expected an error, got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+
+	for _, config := range []*Config{
+		{ValuePattern: "("},
+		{ValueMinLength: 10, ValueMaxLength: 5},
+		{ValueMinLength: -1},
+	} {
+		if _, err := newValueRules(config); err == nil {
+			t.Errorf("Expected an error for %+v", config)
+		}
+	}
+}
+
+// TestServeHTTPValueValidation tests that a value failing validation is never injected.
+func TestServeHTTPValueValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		expectedStatus int
+	}{
+		{name: "valid value", value: "sk_live_123456", expectedStatus: http.StatusOK},
+		{name: "wrong key rotated in", value: "sk_test_123456", expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"api-key": tt.value}, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:          "my-secret",
+				SecretKey:           "api-key",
+				HeaderName:          "X-API-Key",
+				Namespace:           "default",
+				CacheTTL:            300,
+				RequiredValuePrefix: "sk_live_",
+			}
+			rules, err := newValueRules(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var header string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				header = req.Header.Get("X-API-Key")
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "value-validation-test",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+				valueRules: rules,
+			}
+
+			rejectionsBefore := metrics.value(metricValueRejections, "middleware", "value-validation-test")
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			rejections := metrics.value(metricValueRejections, "middleware", "value-validation-test") - rejectionsBefore
+			if tt.expectedStatus == http.StatusOK {
+				if header != tt.value || rejections != 0 {
+					t.Errorf("Expected %q injected without rejections, got %q and %v", tt.value, header, rejections)
+				}
+				return
+			}
+			if header != "" || rejections != 1 {
+				t.Errorf("Expected no injection and one rejection, got %q and %v", header, rejections)
+			}
+		})
+	}
+}
+
+// TestValueRulesExtracted tests the part of a value injected for valuePattern capture groups.
+func TestValueRulesExtracted(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		value    string
+		expected string
+	}{
+		{name: "no pattern", value: "user:token", expected: "user:token"},
+		{name: "no capture group", pattern: `^(?:user):\w+$`, value: "user:token", expected: "user:token"},
+		{name: "first group", pattern: `^([a-z]+):([a-z]+)$`, value: "user:token", expected: "user"},
+		{name: "token portion", pattern: `:(.+)$`, value: "user:token", expected: "token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := newValueRules(&Config{ValuePattern: tt.pattern})
+			if err != nil {
+				t.Fatalf("Failed to build rules: %v", err)
+			}
+			if got := rules.extracted(tt.value); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// TestServeHTTPValuePatternCapture tests that only the captured part of the value is injected.
+func TestServeHTTPValuePatternCapture(t *testing.T) {
+	mockServer := mockK8sServer(t, map[string]string{"credentials": "svc-gateway:3f9c1e"}, true)
+	defer mockServer.Close()
+
+	config := &Config{
+		SecretName:   "my-secret",
+		SecretKey:    "credentials",
+		HeaderName:   "X-Api-Token",
+		Namespace:    "default",
+		CacheTTL:     300,
+		ValuePattern: `^[a-z-]+:([0-9a-f]+)$`,
+	}
+	rules, err := newValueRules(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var header string
+	handler := &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			header = req.Header.Get("X-Api-Token")
+		}),
+		name:   "value-capture-test",
+		config: config,
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:      &secretCache{ttl: 300 * time.Second},
+		valueRules: rules,
+	}
+
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+	if rw.Code != http.StatusOK || header != "3f9c1e" {
+		t.Errorf("Expected status 200 with the token injected, got %d and %q", rw.Code, header)
+	}
+}
+
+// TestServeHTTPTrimValue tests whitespace trimming and the line break check of injected values.
+func TestServeHTTPTrimValue(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          string
+		trim           bool
+		expectedStatus int
+		expected       string
+	}{
+		{name: "trailing newline", value: "my-secret-token\n", trim: true, expectedStatus: http.StatusOK, expected: "my-secret-token"},
+		{name: "CRLF and spaces", value: "  my-secret-token\r\n", trim: true, expectedStatus: http.StatusOK, expected: "my-secret-token"},
+		{name: "trimming disabled", value: " my-secret-token ", expectedStatus: http.StatusOK, expected: " my-secret-token "},
+		{name: "newline kept without trimming", value: "my-secret-token\n", expectedStatus: http.StatusInternalServerError},
+		{name: "embedded newline", value: "my-secret\ntoken", trim: true, expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := mockK8sServer(t, map[string]string{"token": tt.value}, true)
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName: "my-secret",
+				SecretKey:  "token",
+				HeaderName: "X-Auth-Token",
+				Namespace:  "default",
+				CacheTTL:   300,
+				TrimValue:  tt.trim,
+			}
+			transforms, err := newValuePipeline(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var header string
+			handler := &SecretHeader{
+				next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+					header = req.Header.Get("X-Auth-Token")
+				}),
+				name:   "trim-test",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache:      &secretCache{ttl: 300 * time.Second},
+				transforms: transforms,
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+
+			if rw.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if header != tt.expected {
+				t.Errorf("Expected %q injected, got %q", tt.expected, header)
+			}
+		})
+	}
+}
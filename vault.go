@@ -0,0 +1,198 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultLoginMargin renews the Vault token this long before its lease runs out.
+const vaultLoginMargin = 30 * time.Second
+
+// vaultClient reads KV v2 secrets from HashiCorp Vault, logging in with the Kubernetes auth
+// method using the pod's service account token.
+type vaultClient struct {
+	httpClient *http.Client
+	address    string
+	mount      string
+	authPath   string
+	role       string
+	namespace  string
+	jwtFile    string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// vaultStatusError is returned when Vault answers with a non-success status.
+type vaultStatusError struct {
+	code int
+	body string
+}
+
+func (e *vaultStatusError) Error() string {
+	return fmt.Sprintf("vault returned status %d: %s", e.code, e.body)
+}
+
+// Is matches the error class of the status.
+func (e *vaultStatusError) Is(target error) bool {
+	class := statusClass(e.code)
+	return class != nil && target == class
+}
+
+// readSecret returns the latest version of the KV v2 secret at path. Non-string values are
+// returned JSON-encoded.
+func (c *vaultClient) readSecret(ctx context.Context, path string) (map[string]string, error) {
+	token, err := c.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", c.address, c.mount, strings.TrimPrefix(path, "/"))
+	err = c.do(ctx, http.MethodGet, endpoint, token, nil, &out)
+	var statusErr *vaultStatusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusForbidden {
+		// The token may have been revoked before its lease ended: log in again once
+		c.mu.Lock()
+		c.token = ""
+		c.mu.Unlock()
+		if token, err = c.login(ctx); err != nil {
+			return nil, err
+		}
+		err = c.do(ctx, http.MethodGet, endpoint, token, nil, &out)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if out.Data.Data == nil {
+		return nil, fmt.Errorf("vault secret %s has no data (deleted or destroyed version?)", path)
+	}
+
+	data := make(map[string]string, len(out.Data.Data))
+	for key, value := range out.Data.Data {
+		if s, ok := value.(string); ok {
+			data[key] = s
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode key '%s' of vault secret %s: %w", key, path, err)
+		}
+		data[key] = string(encoded)
+	}
+	return data, nil
+}
+
+// login returns a valid Vault token, logging in with the service account token when there is
+// none or its lease is about to end.
+func (c *vaultClient) login(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && time.Now().Add(vaultLoginMargin).Before(c.expires) {
+		return c.token, nil
+	}
+
+	// Projected service account tokens rotate, so the file is read on every login
+	jwt, err := os.ReadFile(c.jwtFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token for vault login: %w", err)
+	}
+
+	var out struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int64  `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	endpoint := fmt.Sprintf("%s/v1/auth/%s/login", c.address, c.authPath)
+	in := map[string]string{"role": c.role, "jwt": strings.TrimSpace(string(jwt))}
+	if err := c.do(ctx, http.MethodPost, endpoint, "", in, &out); err != nil {
+		return "", fmt.Errorf("vault login failed: %w", err)
+	}
+	if out.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault login returned no client token")
+	}
+
+	c.token = out.Auth.ClientToken
+	c.expires = time.Now().Add(time.Duration(out.Auth.LeaseDuration) * time.Second)
+	return c.token, nil
+}
+
+// do performs a JSON request against the Vault HTTP API.
+func (c *vaultClient) do(ctx context.Context, method, endpoint, token string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		payload, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return classify(ErrAPIUnavailable, fmt.Errorf("failed to execute request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &vaultStatusError{code: resp.StatusCode, body: string(body)}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+// validateVaultConfig checks the Vault source settings and applies their defaults.
+func validateVaultConfig(config *Config) error {
+	if config.VaultAddress == "" || config.VaultRole == "" {
+		return fmt.Errorf("vaultAddress and vaultRole are required with source %q", sourceVault)
+	}
+	address, err := url.Parse(config.VaultAddress)
+	if err != nil || address.Host == "" || (address.Scheme != "https" && address.Scheme != "http") {
+		return fmt.Errorf("invalid vaultAddress %q", config.VaultAddress)
+	}
+	config.VaultAddress = strings.TrimSuffix(config.VaultAddress, "/")
+
+	if config.VaultMount == "" {
+		config.VaultMount = "secret"
+	}
+	if config.VaultAuthPath == "" {
+		config.VaultAuthPath = "kubernetes"
+	}
+	config.VaultMount = strings.Trim(config.VaultMount, "/")
+	config.VaultAuthPath = strings.Trim(config.VaultAuthPath, "/")
+	return nil
+}
@@ -0,0 +1,202 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockVaultServer serves Kubernetes auth logins and KV v2 reads of secret/data/app/payments.
+// Tokens are revoked after revokeAfter reads (0 never revokes).
+func mockVaultServer(t *testing.T, logins, reads *int32, revokeAfter int32) *httptest.Server {
+	t.Helper()
+
+	var token atomic.Value
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			var in map[string]string
+			json.NewDecoder(r.Body).Decode(&in)
+			if in["role"] != "traefik" || in["jwt"] != "sa-token" {
+				http.Error(w, `{"errors":["permission denied"]}`, http.StatusBadRequest)
+				return
+			}
+			n := atomic.AddInt32(logins, 1)
+			issued := "vault-token-" + string(rune('0'+n))
+			token.Store(issued)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]interface{}{"client_token": issued, "lease_duration": 3600},
+			})
+		case "/v1/secret/data/app/payments":
+			n := atomic.AddInt32(reads, 1)
+			if r.Header.Get("X-Vault-Token") != token.Load() || (revokeAfter > 0 && n == revokeAfter) {
+				http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"api-key": "vault-value", "limits": map[string]int{"rps": 10}},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// newVaultTestClient returns a Vault client for server logging in with a fake service account token.
+func newVaultTestClient(t *testing.T, server *httptest.Server) *vaultClient {
+	t.Helper()
+
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(jwtFile, []byte("sa-token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return &vaultClient{
+		httpClient: server.Client(),
+		address:    server.URL,
+		mount:      "secret",
+		authPath:   "kubernetes",
+		role:       "traefik",
+		jwtFile:    jwtFile,
+	}
+}
+
+// TestServeHTTPVaultSource tests injecting a value read from Vault through the secret cache.
+func TestServeHTTPVaultSource(t *testing.T) {
+	var logins, reads int32
+	server := mockVaultServer(t, &logins, &reads, 0)
+	defer server.Close()
+
+	config := &Config{
+		SecretName: "app/payments",
+		SecretKey:  "api-key",
+		HeaderName: "X-API-Key",
+		Namespace:  "default",
+		CacheTTL:   300,
+		Source:     sourceVault,
+	}
+
+	var header string
+	next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get("X-API-Key")
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	handler := &SecretHeader{
+		next:   next,
+		name:   "test-middleware",
+		config: config,
+		cache: &secretCache{
+			ttl: time.Duration(config.CacheTTL) * time.Second,
+		},
+		source: newVaultTestClient(t, server),
+	}
+
+	for i := 0; i < 3; i++ {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rw.Code)
+		}
+		if header != "vault-value" {
+			t.Fatalf("Expected header %q, got %q", "vault-value", header)
+		}
+	}
+
+	if logins != 1 || reads != 1 {
+		t.Errorf("Expected 1 login and 1 read, got %d and %d", logins, reads)
+	}
+}
+
+// TestVaultReadSecret tests value conversion and logging in again after a revoked token.
+func TestVaultReadSecret(t *testing.T) {
+	var logins, reads int32
+	server := mockVaultServer(t, &logins, &reads, 2)
+	defer server.Close()
+
+	client := newVaultTestClient(t, server)
+
+	for i := 0; i < 2; i++ {
+		data, err := client.readSecret(t.Context(), "app/payments")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if data["api-key"] != "vault-value" || data["limits"] != `{"rps":10}` {
+			t.Errorf("Unexpected data %v", data)
+		}
+	}
+	if logins != 2 {
+		t.Errorf("Expected a second login after the revoked token, got %d logins", logins)
+	}
+
+	if _, err := client.readSecret(t.Context(), "app/missing"); err == nil {
+		t.Error("Expected an error for a missing secret")
+	}
+}
+
+// TestValidateVaultConfig tests Vault source configuration checks.
+func TestValidateVaultConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectError bool
+	}{
+		{
+			name:   "defaults",
+			config: &Config{VaultAddress: "https://vault.vault.svc:8200/", VaultRole: "traefik"},
+		},
+		{
+			name:        "missing role",
+			config:      &Config{VaultAddress: "https://vault.vault.svc:8200"},
+			expectError: true,
+		},
+		{
+			name:        "invalid address",
+			config:      &Config{VaultAddress: "vault:8200", VaultRole: "traefik"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVaultConfig(tt.config)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.VaultMount != "secret" || tt.config.VaultAuthPath != "kubernetes" || tt.config.VaultAddress != "https://vault.vault.svc:8200" {
+				t.Errorf("Unexpected defaults %+v", tt.config)
+			}
+		})
+	}
+}
+
+// TestValidateVaultGenerateMode tests that generate mode is rejected with the Vault source.
+func TestValidateVaultGenerateMode(t *testing.T) {
+	config := CreateConfig()
+	config.SecretName = "app/api"
+	config.SecretKey = "token"
+	config.HeaderName = "X-Api-Key"
+	config.Source = sourceVault
+	config.VaultAddress = "https://vault.vault.svc:8200"
+	config.VaultRole = "traefik"
+	config.Mode = modeGenerate
+
+	problems := validateConfig(config)
+	expected := `mode "generate" stores values in Kubernetes secrets and cannot use source "vault"`
+	if len(problems) != 1 || problems[0].Error() != expected {
+		t.Errorf("Expected %q, got %v", expected, problems)
+	}
+}
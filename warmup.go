@@ -0,0 +1,99 @@
+package traefik_k8s_secret_header
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Supported values for Config.WarmupOnMiss.
+const (
+	warmupForward = "forward"
+	warmupReject  = "reject"
+)
+
+// isWarmup reports whether req is a load balancer warmup or synthetic request.
+func (s *SecretHeader) isWarmup(req *http.Request) bool {
+	for _, name := range s.config.WarmupHeaders {
+		if req.Header.Get(name) != "" {
+			return true
+		}
+	}
+	for _, method := range s.config.WarmupMethods {
+		if req.Method == method {
+			return true
+		}
+	}
+	if userAgent := req.UserAgent(); userAgent != "" {
+		for _, fragment := range s.config.WarmupUserAgents {
+			if strings.Contains(userAgent, fragment) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveWarmup injects the header from the cache only, so synthetic traffic during scale-ups
+// never reaches the Kubernetes API. Expired entries are still used. On a miss the request is
+// forwarded without the header or rejected with 503, depending on WarmupOnMiss.
+func (s *SecretHeader) serveWarmup(rw http.ResponseWriter, req *http.Request) {
+	cacheKey := s.secretCacheKey(s.config.SecretName)
+	if data, ok := s.cache.peek(cacheKey); ok {
+		value, ok := data[s.injectedKey(cacheKey, data)]
+		var err error
+		if ok {
+			value, err = s.headerValue(value)
+		}
+		if ok && err == nil && s.valueRules.check(value) == nil {
+			value, err := s.compressValue(req, s.valueRules.extracted(value))
+			if err != nil {
+				s.serveError(rw, req, err)
+				return
+			}
+			s.injectHeader(req, value)
+			s.injectIdentity(req)
+			s.next.ServeHTTP(rw, req)
+			return
+		}
+	}
+
+	if s.config.WarmupOnMiss == warmupReject {
+		http.Error(rw, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.next.ServeHTTP(rw, req)
+}
+
+// validateWarmupConfig checks the warmup detection settings.
+func validateWarmupConfig(config *Config) error {
+	if len(config.WarmupHeaders) == 0 && len(config.WarmupMethods) == 0 && len(config.WarmupUserAgents) == 0 {
+		if config.WarmupOnMiss != "" {
+			return fmt.Errorf("warmupOnMiss requires warmupHeaders, warmupMethods or warmupUserAgents")
+		}
+		return nil
+	}
+	if config.Mode != "" && config.Mode != modeInject {
+		return fmt.Errorf("warmup detection is only supported in mode %q", modeInject)
+	}
+
+	switch config.WarmupOnMiss {
+	case "":
+		config.WarmupOnMiss = warmupForward
+	case warmupForward, warmupReject:
+	default:
+		return fmt.Errorf("warmupOnMiss must be %q or %q", warmupForward, warmupReject)
+	}
+
+	for i, method := range config.WarmupMethods {
+		config.WarmupMethods[i] = strings.ToUpper(strings.TrimSpace(method))
+	}
+	for _, list := range [][]string{config.WarmupHeaders, config.WarmupMethods, config.WarmupUserAgents} {
+		for _, entry := range list {
+			if entry == "" {
+				return fmt.Errorf("warmup detection lists cannot contain an empty entry")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestServeHTTPWarmup tests that warmup requests only use cached values.
+func TestServeHTTPWarmup(t *testing.T) {
+	tests := []struct {
+		name           string
+		onMiss         string
+		warmCache      bool
+		expiredCache   bool
+		request        func() *http.Request
+		expectedStatus int
+		expectedHeader string
+		expectedReads  int32
+	}{
+		{
+			name:      "regular request fetches",
+			onMiss:    warmupForward,
+			warmCache: false,
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "secret-value",
+			expectedReads:  1,
+		},
+		{
+			name:   "warmup header on cold cache is forwarded without value",
+			onMiss: warmupForward,
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+				req.Header.Set("X-Warmup", "1")
+				return req
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "HEAD warmup on cold cache is rejected",
+			onMiss: warmupReject,
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodHead, "http://example.com/", nil)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:         "health checker uses expired cache without fetching",
+			onMiss:       warmupReject,
+			warmCache:    true,
+			expiredCache: true,
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+				req.Header.Set("User-Agent", "ELB-HealthChecker/2.0")
+				return req
+			},
+			expectedStatus: http.StatusOK,
+			expectedHeader: "cached-value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reads int32
+			mockServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&reads, 1)
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(k8sSecret{Data: map[string]string{
+					"api-key": base64.StdEncoding.EncodeToString([]byte("secret-value")),
+				}})
+			}))
+			defer mockServer.Close()
+
+			config := &Config{
+				SecretName:       "my-secret",
+				SecretKey:        "api-key",
+				HeaderName:       "X-API-Key",
+				Namespace:        "default",
+				CacheTTL:         300,
+				WarmupHeaders:    []string{"X-Warmup"},
+				WarmupMethods:    []string{http.MethodHead},
+				WarmupUserAgents: []string{"ELB-HealthChecker"},
+				WarmupOnMiss:     tt.onMiss,
+			}
+
+			var header string
+			next := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				header = req.Header.Get("X-API-Key")
+				rw.WriteHeader(http.StatusOK)
+			})
+
+			handler := &SecretHeader{
+				next:   next,
+				name:   "test-middleware",
+				config: config,
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				cache: &secretCache{
+					ttl: time.Duration(config.CacheTTL) * time.Second,
+				},
+			}
+			if tt.warmCache {
+				handler.cache.set("default/my-secret", map[string]string{"api-key": "cached-value"})
+				if tt.expiredCache {
+					handler.cache.ttl = time.Nanosecond
+					time.Sleep(time.Millisecond)
+				}
+			}
+
+			rw := httptest.NewRecorder()
+			handler.ServeHTTP(rw, tt.request())
+
+			if rw.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rw.Code)
+			}
+			if header != tt.expectedHeader {
+				t.Errorf("Expected header %q, got %q", tt.expectedHeader, header)
+			}
+			if got := atomic.LoadInt32(&reads); got != tt.expectedReads {
+				t.Errorf("Expected %d API reads, got %d", tt.expectedReads, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package traefik_k8s_secret_header
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// validateRotationWebhook checks the rotationWebhookURL and rotationWebhookFormat settings.
+func validateRotationWebhook(config *Config) error {
+	switch config.RotationWebhookFormat {
+	case "", "json", "slack":
+	default:
+		return fmt.Errorf("rotationWebhookFormat must be json or slack, got %q", config.RotationWebhookFormat)
+	}
+	if config.RotationWebhookURL == "" {
+		if config.RotationWebhookFormat != "" {
+			return fmt.Errorf("rotationWebhookFormat requires rotationWebhookURL")
+		}
+		return nil
+	}
+	u, err := url.Parse(config.RotationWebhookURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("rotationWebhookURL must be an http or https URL")
+	}
+	return nil
+}
+
+// rotationNotice is the JSON payload posted when a rotation is seen. It identifies the new
+// value by a hash prefix only.
+type rotationNotice struct {
+	Middleware string `json:"middleware"`
+	Secret     string `json:"secret"`
+	Key        string `json:"key,omitempty"`
+	SHA256     string `json:"sha256"`
+	Time       string `json:"time"`
+}
+
+// rotationWebhook posts a notice to a webhook when the injected value changes, so teams
+// know a rotation propagated through the gateway.
+type rotationWebhook struct {
+	client *http.Client
+	url    string
+	format string // "json" or "slack"
+}
+
+// notifyRotation posts a notice for the secret cached under cacheKey when the value of
+// secretKey, or any value without one, changed between previous and data. A failed post is
+// logged and otherwise ignored.
+func (s *SecretHeader) notifyRotation(cacheKey string, previous, data map[string]string) {
+	if s.webhook == nil {
+		return
+	}
+	key := s.injectedKey(cacheKey, data)
+	if key != "" && previous[key] == data[key] {
+		return
+	}
+
+	var hashed []byte
+	if key != "" {
+		hashed = []byte(data[key])
+	} else {
+		hashed, _ = json.Marshal(data)
+	}
+	sum := sha256.Sum256(hashed)
+	notice := rotationNotice{
+		Middleware: s.name,
+		Secret:     cacheKey,
+		Key:        key,
+		SHA256:     hex.EncodeToString(sum[:4]),
+		Time:       time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := s.webhook.post(notice); err != nil {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Rotation webhook for secret %s failed: %v\n", cacheKey, err)
+	}
+}
+
+// post sends notice in the configured format.
+func (w *rotationWebhook) post(notice rotationNotice) error {
+	var payload interface{} = notice
+	if w.format == "slack" {
+		payload = map[string]string{
+			"text": fmt.Sprintf("Secret %s rotated: middleware %s now injects sha256=%s (%s)",
+				notice.Secret, notice.Middleware, notice.SHA256, notice.Time),
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		// The URL of a Slack webhook is a credential: keep it out of the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
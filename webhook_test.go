@@ -0,0 +1,104 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestNotifyRotation tests that a change of the injected value is posted once, without the
+// value itself.
+func TestNotifyRotation(t *testing.T) {
+	tests := []struct {
+		name            string
+		format          string
+		previous        map[string]string
+		data            map[string]string
+		expectedNotices int
+	}{
+		{
+			name:            "injected value changed",
+			previous:        map[string]string{"token": "old-token", "note": "a"},
+			data:            map[string]string{"token": "new-token", "note": "a"},
+			expectedNotices: 1,
+		},
+		{
+			name:     "other key changed",
+			previous: map[string]string{"token": "old-token", "note": "a"},
+			data:     map[string]string{"token": "old-token", "note": "b"},
+		},
+		{
+			name:            "slack",
+			format:          "slack",
+			previous:        map[string]string{"token": "old-token"},
+			data:            map[string]string{"token": "new-token"},
+			expectedNotices: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []map[string]string
+			webhookServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+					t.Errorf("Expected a JSON POST, got %s %s", r.Method, r.Header.Get("Content-Type"))
+				}
+				var body map[string]string
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				bodies = append(bodies, body)
+			}))
+			defer webhookServer.Close()
+
+			handler := &SecretHeader{
+				name:   "webhook-test",
+				config: &Config{SecretName: "my-secret", SecretKey: "token", Namespace: "default"},
+				webhook: &rotationWebhook{
+					client: webhookServer.Client(),
+					url:    webhookServer.URL,
+					format: tt.format,
+				},
+			}
+			handler.notifyRotation("default/my-secret", tt.previous, tt.data)
+
+			if len(bodies) != tt.expectedNotices {
+				t.Fatalf("Expected %d notices, got %d", tt.expectedNotices, len(bodies))
+			}
+			if len(bodies) == 0 {
+				return
+			}
+			body := bodies[0]
+			encoded, _ := json.Marshal(body)
+			if strings.Contains(string(encoded), "new-token") {
+				t.Fatalf("Expected no secret value in the notice, got %s", encoded)
+			}
+			if tt.format == "slack" {
+				if !strings.Contains(body["text"], "default/my-secret") || !strings.Contains(body["text"], "sha256=") {
+					t.Errorf("Unexpected Slack message %q", body["text"])
+				}
+				return
+			}
+			if body["secret"] != "default/my-secret" || body["key"] != "token" || body["middleware"] != "webhook-test" || len(body["sha256"]) != 8 {
+				t.Errorf("Unexpected notice %v", body)
+			}
+		})
+	}
+}
+
+// TestRotationWebhookErrorHidesURL tests that a failed post does not log the webhook URL.
+func TestRotationWebhookErrorHidesURL(t *testing.T) {
+	webhook := &rotationWebhook{
+		client: http.DefaultClient,
+		url:    "http://127.0.0.1:1/services/T000/B000/XXXXSECRET",
+	}
+	err := webhook.post(rotationNotice{Secret: "default/my-secret"})
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if strings.Contains(err.Error(), "XXXXSECRET") {
+		t.Errorf("Expected the URL to be left out, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package traefik_k8s_secret_header
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// defaultWriteBackSecretKey is the key of the token in writeBackSecretName.
+const defaultWriteBackSecretKey = "token"
+
+// writeBackTimeout bounds a write-back, which runs on the request that obtained the token.
+const writeBackTimeout = 5 * time.Second
+
+// Annotations of a write-back secret: the replica that wrote the token and when the token
+// expires. Together they form a lease: only the writer stores tokens until then, so replicas
+// do not overwrite each other's tokens with every renewal.
+const (
+	writeBackWriterAnnotation  = "k8s-secret-header.traefik.io/writer"
+	writeBackExpiresAnnotation = "k8s-secret-header.traefik.io/token-expires"
+)
+
+// validateWriteBack checks the writeBackSecretName settings.
+func validateWriteBack(config *Config) error {
+	if config.WriteBackSecretName == "" {
+		if config.WriteBackSecretKey != "" {
+			return fmt.Errorf("writeBackSecretKey requires writeBackSecretName")
+		}
+		return nil
+	}
+	if config.WriteBackSecretKey == "" {
+		config.WriteBackSecretKey = defaultWriteBackSecretKey
+	}
+	if config.Mode != modeMintJWT && config.Mode != modeOAuth2 {
+		return fmt.Errorf("writeBackSecretName is only supported in modes %q and %q", modeMintJWT, modeOAuth2)
+	}
+	if !secretNamePattern.MatchString(config.WriteBackSecretName) {
+		return fmt.Errorf("invalid writeBackSecretName %q", config.WriteBackSecretName)
+	}
+	if !secretKeyPattern.MatchString(config.WriteBackSecretKey) {
+		return fmt.Errorf("invalid writeBackSecretKey %q", config.WriteBackSecretKey)
+	}
+	if config.WriteBackSecretName == config.SecretName {
+		return fmt.Errorf("writeBackSecretName cannot be the secret the credentials are read from")
+	}
+	if config.Source != "" && config.Source != sourceKubernetes {
+		return fmt.Errorf("writeBackSecretName cannot be used with source %q", config.Source)
+	}
+	// Secrets selected per request and templated claims yield a token per request, so there
+	// is no single current token
+	if config.JWTClaim != "" || config.SecretNameHeader != "" || usesHostPlaceholder(config) {
+		return fmt.Errorf("writeBackSecretName cannot be used with jwtClaim, secretNameHeader or {{ .Host }}")
+	}
+	for _, value := range config.MintClaims {
+		if mintPlaceholder.MatchString(value) {
+			return fmt.Errorf("writeBackSecretName cannot be used with templated mintClaims")
+		}
+	}
+	return nil
+}
+
+// writeBackWriter names this replica and middleware in the writer annotation.
+func writeBackWriter(name string) string {
+	host, _ := os.Hostname()
+	return podReference(host).Name + "/" + name
+}
+
+// writeBackToken stores a newly obtained token in writeBackSecretName, for workloads outside
+// the gateway to reuse. It gives up after writeBackTimeout so a slow API server delays the
+// request only that long; failures are logged, the token is still served to requests.
+func (s *SecretHeader) writeBackToken(ctx context.Context, token string, expires time.Time) {
+	if s.config.WriteBackSecretName == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, writeBackTimeout)
+	defer cancel()
+	if err := s.storeWriteBack(ctx, token, expires); err != nil {
+		fmt.Fprintf(os.Stderr, "[k8s-secret-header] Failed to write token back to secret %s/%s: %v\n",
+			s.config.Namespace, s.config.WriteBackSecretName, err)
+	}
+}
+
+// storeWriteBack writes token to writeBackSecretName unless another replica holds the write
+// lease. The lease lasts until the written token expires, so a replica that stops writing is
+// replaced by the next one renewing its token after that. Writes carry the resourceVersion
+// read, so of two replicas claiming the lease at once only one succeeds.
+func (s *SecretHeader) storeWriteBack(ctx context.Context, token string, expires time.Time) error {
+	client, err := s.apiClient(ctx)
+	if err != nil {
+		return err
+	}
+	namespace, name := s.config.Namespace, s.config.WriteBackSecretName
+
+	secret, err := client.getSecret(ctx, namespace, name)
+	if err != nil && !hasStatus(err, http.StatusNotFound) {
+		return err
+	}
+
+	now := time.Now()
+	if secret != nil {
+		writer := secret.Metadata.Annotations[writeBackWriterAnnotation]
+		until, _ := time.Parse(time.RFC3339, secret.Metadata.Annotations[writeBackExpiresAnnotation])
+		if writer != "" && writer != s.writer && now.Before(until) {
+			s.debugf("Token in secret %s/%s is written by %s until %s", namespace, name, writer, until.Format(time.RFC3339))
+			return nil
+		}
+	}
+
+	data := map[string]string{s.config.WriteBackSecretKey: base64.StdEncoding.EncodeToString([]byte(token))}
+	annotations := map[string]string{
+		writeBackWriterAnnotation:  s.writer,
+		writeBackExpiresAnnotation: expires.UTC().Format(time.RFC3339),
+	}
+	if secret == nil {
+		err = client.createSecret(ctx, namespace, &k8sSecret{
+			APIVersion: "v1",
+			Kind:       "Secret",
+			Metadata: k8sObjectMeta{
+				Name:        name,
+				Namespace:   namespace,
+				Annotations: annotations,
+			},
+			Type: "Opaque",
+			Data: data,
+		})
+	} else {
+		err = client.patchSecret(ctx, namespace, name, &secretMergePatch{
+			Metadata: secretPatchMeta{ResourceVersion: secret.Metadata.ResourceVersion, Annotations: annotations},
+			Data:     data,
+		})
+	}
+	if hasStatus(err, http.StatusConflict) {
+		s.debugf("Another replica wrote the token in secret %s/%s first", namespace, name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.debugf("Wrote token expiring at %s to secret %s/%s", expires.UTC().Format(time.RFC3339), namespace, name)
+	return nil
+}
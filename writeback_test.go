@@ -0,0 +1,197 @@
+package traefik_k8s_secret_header
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeBackSecret builds a write-back secret holding token, written by writer until expires.
+func writeBackSecret(token, writer string, expires time.Time) *k8sSecret {
+	return &k8sSecret{
+		Metadata: k8sObjectMeta{
+			Name: "gateway-token",
+			Annotations: map[string]string{
+				writeBackWriterAnnotation:  writer,
+				writeBackExpiresAnnotation: expires.UTC().Format(time.RFC3339),
+			},
+		},
+		Data: map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(token))},
+	}
+}
+
+// TestServeHTTPMintJWTWriteBack tests that a minted token is written back once per mint.
+func TestServeHTTPMintJWTWriteBack(t *testing.T) {
+	store := &fakeSecretStore{secrets: map[string]map[string]interface{}{}}
+	store.put(&k8sSecret{
+		Metadata: k8sObjectMeta{Name: "jwt-signing"},
+		Data:     map[string]string{"signing-key": base64.StdEncoding.EncodeToString([]byte("mint-key"))},
+	})
+	mockServer := store.server(t)
+	defer mockServer.Close()
+
+	var captured string
+	var handler *SecretHeader
+	// Requests reuse the minted token while it is written back, so the minter must be unlocked
+	lockedDuringWrite := false
+	store.beforeWrite = func(*fakeSecretStore) {
+		if !handler.minter.mu.TryLock() {
+			lockedDuringWrite = true
+			return
+		}
+		handler.minter.mu.Unlock()
+	}
+	handler = &SecretHeader{
+		next: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			captured = req.Header.Get("Authorization")
+		}),
+		name: "write-back-test",
+		config: &Config{
+			SecretName:          "jwt-signing",
+			SecretKey:           "signing-key",
+			HeaderName:          "Authorization",
+			ValuePrefix:         "Bearer ",
+			Namespace:           "default",
+			CacheTTL:            300,
+			Mode:                modeMintJWT,
+			MintTTL:             60,
+			WriteBackSecretName: "gateway-token",
+			WriteBackSecretKey:  "token",
+		},
+		k8sClient: &k8sClient{
+			httpClient: mockServer.Client(),
+			baseURL:    mockServer.URL,
+			token:      "test-token",
+		},
+		cache:  &secretCache{ttl: 300 * time.Second},
+		minter: &minter{},
+		writer: "gateway-0/write-back-test",
+	}
+
+	for i := 0; i < 3; i++ {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if rw.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rw.Code)
+		}
+	}
+
+	if store.writes != 1 {
+		t.Errorf("Expected the minted token to be written once, got %d writes", store.writes)
+	}
+	if lockedDuringWrite {
+		t.Error("Expected the minter to be unlocked during the write-back")
+	}
+	if stored := store.storedValue(t, "gateway-token", "token"); "Bearer "+stored != captured {
+		t.Errorf("Expected the injected token to be written back, got %q and %q", stored, captured)
+	}
+	annotations := store.secrets["gateway-token"]["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if annotations[writeBackWriterAnnotation] != "gateway-0/write-back-test" || annotations[writeBackExpiresAnnotation] == nil {
+		t.Errorf("Expected the writer and expiry annotations, got %v", annotations)
+	}
+}
+
+// TestStoreWriteBackLease tests that replicas write the token only while they hold the lease.
+func TestStoreWriteBackLease(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name          string
+		existing      *k8sSecret
+		beforeWrite   func(store *fakeSecretStore)
+		expectWritten bool
+	}{
+		{name: "no secret", expectWritten: true},
+		{name: "own lease", existing: writeBackSecret("old-token", "gateway-0/api", now.Add(time.Minute)), expectWritten: true},
+		{name: "lease of another replica", existing: writeBackSecret("other-token", "gateway-1/api", now.Add(time.Minute))},
+		{name: "expired lease of another replica", existing: writeBackSecret("other-token", "gateway-1/api", now.Add(-time.Minute)), expectWritten: true},
+		{name: "secret without lease", existing: &k8sSecret{Metadata: k8sObjectMeta{Name: "gateway-token"}}, expectWritten: true},
+		{
+			name:     "lease claimed concurrently",
+			existing: writeBackSecret("old-token", "gateway-1/api", now.Add(-time.Minute)),
+			beforeWrite: func(store *fakeSecretStore) {
+				store.put(writeBackSecret("other-token", "gateway-1/api", now.Add(time.Minute)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeSecretStore{secrets: map[string]map[string]interface{}{}, beforeWrite: tt.beforeWrite}
+			if tt.existing != nil {
+				store.put(tt.existing)
+			}
+			mockServer := store.server(t)
+			defer mockServer.Close()
+
+			handler := &SecretHeader{
+				name:   "api",
+				config: &Config{Namespace: "default", WriteBackSecretName: "gateway-token", WriteBackSecretKey: "token"},
+				k8sClient: &k8sClient{
+					httpClient: mockServer.Client(),
+					baseURL:    mockServer.URL,
+					token:      "test-token",
+				},
+				writer: "gateway-0/api",
+			}
+
+			if err := handler.storeWriteBack(t.Context(), "new-token", now.Add(time.Hour)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			written := store.storedValue(t, "gateway-token", "token") == "new-token"
+			if written != tt.expectWritten {
+				t.Errorf("Expected written %v, got %v", tt.expectWritten, written)
+			}
+		})
+	}
+}
+
+// TestValidateWriteBack tests writeBackSecretName configuration checks.
+func TestValidateWriteBack(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *Config
+		expectedKey string
+		expectError string
+	}{
+		{name: "unset", config: &Config{Mode: modeOAuth2}},
+		{name: "oauth2", config: &Config{Mode: modeOAuth2, SecretName: "client", WriteBackSecretName: "gateway-token"}, expectedKey: defaultWriteBackSecretKey},
+		{name: "mint", config: &Config{Mode: modeMintJWT, SecretName: "key", WriteBackSecretName: "gateway-token", WriteBackSecretKey: "jwt"}, expectedKey: "jwt"},
+		{name: "key without secret", config: &Config{Mode: modeOAuth2, WriteBackSecretKey: "token"}, expectError: "requires writeBackSecretName"},
+		{name: "inject mode", config: &Config{SecretName: "client", WriteBackSecretName: "gateway-token"}, expectError: "only supported in modes"},
+		{name: "same secret", config: &Config{Mode: modeOAuth2, SecretName: "client", WriteBackSecretName: "client"}, expectError: "cannot be the secret"},
+		{name: "invalid name", config: &Config{Mode: modeOAuth2, SecretName: "client", WriteBackSecretName: "Gateway_Token"}, expectError: "invalid writeBackSecretName"},
+		{name: "claim-selected secret", config: &Config{Mode: modeMintJWT, SecretName: "key-{{ .Claim }}", JWTClaim: "org", WriteBackSecretName: "gateway-token"}, expectError: "cannot be used with jwtClaim"},
+		{name: "host-selected secret", config: &Config{Mode: modeMintJWT, SecretName: "key-{{ .Host }}", WriteBackSecretName: "gateway-token"}, expectError: "cannot be used with jwtClaim"},
+		{
+			name:        "header-selected secret",
+			config:      &Config{Mode: modeMintJWT, SecretName: "key-{{ .Header }}", SecretNameHeader: "X-Tenant", WriteBackSecretName: "gateway-token"},
+			expectError: "cannot be used with jwtClaim",
+		},
+		{
+			name:        "templated claims",
+			config:      &Config{Mode: modeMintJWT, SecretName: "key", WriteBackSecretName: "gateway-token", MintClaims: map[string]string{"host": "{{ .Host }}"}},
+			expectError: "templated mintClaims",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWriteBack(tt.config)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected an error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if tt.config.WriteBackSecretKey != tt.expectedKey {
+				t.Errorf("Expected key %q, got %q", tt.expectedKey, tt.config.WriteBackSecretKey)
+			}
+		})
+	}
+}